@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/updater"
+	"github.com/kardianos/service"
+)
+
+// Exit codes shared by the commands
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// cli is the state shared by the commands of one invocation
+type cli struct {
+	quiet      bool
+	verbose    bool
+	user       bool
+	version    bool
+	configPath string
+	logLevel   string
+	service    service.Service
+
+	// serviceConfig describes the updater service, and newService creates
+	// it; install registers the service with the global flags it should
+	// run with
+	serviceConfig *service.Config
+	newService    func(config *service.Config) (service.Service, error)
+
+	// stdout and stderr receive the output of the commands and the flag
+	// parsing errors
+	stdout io.Writer
+	stderr io.Writer
+
+	// stdin answers confirmation prompts
+	stdin io.Reader
+
+	// requirePrivileges fails when the commands that change services or
+	// binaries cannot; nil means updater.RequirePrivileges
+	requirePrivileges func() error
+}
+
+// cliCommand is a sentinel-updater subcommand
+type cliCommand struct {
+	name     string
+	synopsis string
+	summary  string
+
+	// define registers the command's flags and returns the function that
+	// runs it with the remaining arguments once they are parsed, and
+	// returns its exit code
+	define func(flags *flag.FlagSet) func(c *cli, args []string) int
+}
+
+// commands are the subcommands in the order help lists them
+var commands = []cliCommand{
+	{"install", "", "Install the updater service", privileged(defineInstall)},
+	{"uninstall", "[--purge | --agent-only] [--include-database] [--yes]", "Uninstall the updater service, or also remove the agent and its data", privileged(defineUninstall)},
+	{"start", "", "Start the updater service", privileged(defineServiceControl("start", "Service started successfully"))},
+	{"stop", "", "Stop the updater service", privileged(defineServiceControl("stop", "Service stopped successfully"))},
+	{"restart", "", "Restart the updater service", privileged(defineServiceControl("restart", "Service restarted successfully"))},
+	{"rollback", "[--to <version>]", "Restore a retained backup of the main agent", privileged(defineRollback)},
+	{"update", "[--no-cache] [<version>]", "Install the latest, or the given, agent version now", privileged(defineUpdate)},
+	{"bootstrap", "[--version <version>] [--no-cache]", "Install the agent and its service on a machine that has none", privileged(defineBootstrap)},
+	{"check", "[--refresh] [--ref <ref>] [--json] [--timeout <duration>]", "Report whether an agent update is available, without installing it", defineCheck},
+	{"pause", "[--duration <duration>] [--reason <reason>]", "Stop installing updates until resumed or the duration passes", definePause},
+	{"resume", "", "Resume installing updates", defineResume},
+	{"status", "", "Show what the running updater is doing", defineStatus},
+	{"doctor", "[--json]", "Diagnose the updater environment", defineDoctor},
+	{"diagnose", "--bundle <path> [--agent-log-kb <kb>]", "Package logs, configuration and state for support", defineDiagnose},
+	{"logs", "[-n <lines>] [-f] [--list]", "Show the end of the updater log", defineLogs},
+}
+
+// help looks commands up, so it is added once they are initialized
+func init() {
+	commands = append(commands, cliCommand{"help", "[<command>]", "Show this help, or the flags of a command", defineHelp})
+}
+
+// findCommand returns the command called name, or nil
+func findCommand(name string) *cliCommand {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// newFlagSet returns a flag set that also accepts the global flags, so they
+// may follow the command name
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.BoolVar(&c.quiet, "quiet", c.quiet, "only print errors and requested information")
+	flags.BoolVar(&c.verbose, "verbose", c.verbose, "log at debug level, whatever logLevel is configured")
+	flags.StringVar(&c.configPath, "config", c.configPath, "configuration file to use instead of $SENTINELGO_CONFIG or updater-config.json in the data directory")
+	flags.StringVar(&c.logLevel, "log-level", c.logLevel, "log at this level (debug, info, warning, error), whatever logLevel is configured")
+	flags.BoolVar(&c.user, "user", c.user, "keep the updater's data in a per-user directory under $XDG_DATA_HOME on Linux")
+	return flags
+}
+
+// execute runs the command named by args and returns its exit code, or
+// reports that args name no command and the updater runs as a service
+func (c *cli) execute(args []string) (code int, runService bool) {
+	global := c.newFlagSet("sentinel-updater")
+	global.BoolVar(&c.version, "version", false, "show version information")
+	global.BoolVar(&c.version, "v", false, "show version information")
+	global.Usage = c.printUsage
+	if err := global.Parse(args); err != nil {
+		return parseExitCode(err), false
+	}
+
+	if c.version {
+		fmt.Fprintf(c.stdout, "sentinelgo-updater version %s\n", Version)
+		fmt.Fprintf(c.stdout, "Build time: %s\n", BuildTime)
+		fmt.Fprintf(c.stdout, "Git commit: %s\n", GitCommit)
+		return exitOK, false
+	}
+
+	if global.NArg() == 0 {
+		if err := c.applyGlobalFlags(); err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitUsage, false
+		}
+		return exitOK, true
+	}
+
+	cmd := findCommand(global.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(c.stdout, "Unknown command: %s\n\n", global.Arg(0))
+		c.printUsage()
+		return exitUsage, false
+	}
+	return c.dispatch(cmd, global.Args()[1:]), false
+}
+
+// parseExitCode returns the exit code for a flag parsing error; asking for
+// help is not one
+func parseExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// applyGlobalFlags applies --user, --config, --log-level and --verbose
+func (c *cli) applyGlobalFlags() error {
+	if c.user {
+		paths.SetUserMode(true)
+	}
+	if c.configPath != "" {
+		paths.SetUpdaterConfigPath(c.configPath)
+	}
+	if c.logLevel != "" {
+		if err := updater.SetLogLevel(c.logLevel); err != nil {
+			return err
+		}
+	}
+	if c.verbose {
+		updater.EnableDebugLogging()
+	}
+	return nil
+}
+
+// dispatch parses the arguments of cmd, runs it and returns its exit code
+func (c *cli) dispatch(cmd *cliCommand, args []string) int {
+	flags := c.newFlagSet(cmd.name)
+	run := cmd.define(flags)
+	flags.Usage = func() { c.printCommandUsage(cmd, flags) }
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if err := c.applyGlobalFlags(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitUsage
+	}
+	return run(c, flags.Args())
+}
+
+// privileged wraps define so the command fails before doing anything when
+// the updater lacks root or Administrator privileges
+func privileged(define func(flags *flag.FlagSet) func(c *cli, args []string) int) func(flags *flag.FlagSet) func(c *cli, args []string) int {
+	return func(flags *flag.FlagSet) func(c *cli, args []string) int {
+		run := define(flags)
+		return func(c *cli, args []string) int {
+			check := c.requirePrivileges
+			if check == nil {
+				check = updater.RequirePrivileges
+			}
+			if err := check(); err != nil {
+				return c.failf("%v", err)
+			}
+			return run(c, args)
+		}
+	}
+}
+
+// println prints a progress or success message unless --quiet is set
+func (c *cli) println(message string) {
+	if !c.quiet {
+		fmt.Fprintln(c.stdout, message)
+	}
+}
+
+// failf prints why a command failed and returns exitFailure
+func (c *cli) failf(format string, args ...interface{}) int {
+	fmt.Fprintf(c.stdout, format+"\n", args...)
+	return exitFailure
+}
+
+// usageErrorf prints how a command was misused and returns exitUsage
+func (c *cli) usageErrorf(format string, args ...interface{}) int {
+	fmt.Fprintf(c.stdout, format+"\n", args...)
+	return exitUsage
+}
+
+// serviceArguments returns the global flags the service runs with, so it
+// reads the configuration file and uses the log level and data directory
+// the install was given
+func (c *cli) serviceArguments() ([]string, error) {
+	var args []string
+	if c.configPath != "" {
+		configPath, err := filepath.Abs(c.configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", c.configPath, err)
+		}
+		args = append(args, "--config", configPath)
+	}
+	if c.logLevel != "" {
+		args = append(args, "--log-level", c.logLevel)
+	}
+	if c.user {
+		args = append(args, "--user")
+	}
+	return args, nil
+}
+
+func defineInstall(flags *flag.FlagSet) func(c *cli, args []string) int {
+	return func(c *cli, args []string) int {
+		arguments, err := c.serviceArguments()
+		if err != nil {
+			return c.failf("Failed to install service: %v", err)
+		}
+		config := *c.serviceConfig
+		config.Arguments = arguments
+		s, err := c.newService(&config)
+		if err != nil {
+			return c.failf("Failed to install service: %v", err)
+		}
+		if err := s.Install(); err != nil {
+			return c.failf("Failed to install service: %v", err)
+		}
+		c.println("Service installed successfully")
+		c.println("Run 'sentinel-updater start' to start the service")
+		return exitOK
+	}
+}
+
+func defineUninstall(flags *flag.FlagSet) func(c *cli, args []string) int {
+	purge := flags.Bool("purge", false, "also stop and remove the agent service, its binaries and backups, and the data directory")
+	agentOnly := flags.Bool("agent-only", false, "only stop and remove the agent service and its binaries, keeping the updater and the data directory")
+	includeDatabase := flags.Bool("include-database", false, "with --purge, also delete the agent database and its snapshots")
+	yes := flags.Bool("yes", false, "remove without asking for confirmation")
+	return func(c *cli, args []string) int {
+		switch {
+		case *purge && *agentOnly:
+			return c.usageErrorf("uninstall takes --purge or --agent-only, not both")
+		case *includeDatabase && !*purge:
+			return c.usageErrorf("--include-database requires --purge")
+		case *purge || *agentOnly:
+			return c.purge(updater.PurgeOptions{AgentOnly: *agentOnly, IncludeDatabase: *includeDatabase}, *yes)
+		}
+
+		if err := c.service.Uninstall(); err != nil {
+			return c.failf("Failed to uninstall service: %v", err)
+		}
+		c.println("Service uninstalled successfully")
+		if err := updater.RevertMachinePath(); err != nil {
+			fmt.Fprintf(c.stdout, "Failed to revert machine PATH changes: %v\n", err)
+		}
+		return exitOK
+	}
+}
+
+// purge removes the agent, and unless options.AgentOnly is set the updater
+// service and the data directory, once confirmed. It reports every item it
+// removed or failed to remove and fails if any removal did.
+func (c *cli) purge(options updater.PurgeOptions, confirmed bool) int {
+	targets, err := updater.PurgeTargets(options)
+	if err != nil {
+		fmt.Fprintf(c.stdout, "Warning: %v; removing what the default configuration names\n", err)
+	}
+	if !options.AgentOnly {
+		targets = append([]string{"uninstall the updater service"}, targets...)
+	}
+	if len(targets) == 0 {
+		c.println("Nothing to remove")
+		return exitOK
+	}
+
+	fmt.Fprintln(c.stdout, "This will:")
+	for _, target := range targets {
+		fmt.Fprintf(c.stdout, "  %s\n", target)
+	}
+	if !options.IncludeDatabase && !options.AgentOnly {
+		fmt.Fprintln(c.stdout, "The agent database and its snapshots are kept; add --include-database to delete them.")
+	}
+	if !confirmed && !c.confirm("Continue?") {
+		return c.failf("Aborted, nothing was removed")
+	}
+
+	var items []updater.PurgeItem
+	if !options.AgentOnly {
+		// Stop the updater first so it does not reinstall the agent
+		if status, err := c.service.Status(); err == nil && status == service.StatusRunning {
+			items = append(items, updater.PurgeItem{What: "stop the updater service", Err: c.service.Stop()})
+		}
+		items = append(items, updater.PurgeItem{What: "uninstall the updater service", Err: c.service.Uninstall()})
+		items = append(items, updater.PurgeItem{What: "revert machine PATH changes", Err: updater.RevertMachinePath()})
+	}
+	removed, err := updater.RunPurge(options)
+	if err != nil {
+		c.printPurgeItems(items)
+		return c.failf("Purge failed: %v", err)
+	}
+	items = append(items, removed...)
+
+	if failed := c.printPurgeItems(items); failed > 0 {
+		return c.failf("Purge finished, %d of %d actions failed", failed, len(items))
+	}
+	c.println("Purge completed successfully")
+	return exitOK
+}
+
+// printPurgeItems lists the actions a purge took and how they failed, and
+// returns the number of failures
+func (c *cli) printPurgeItems(items []updater.PurgeItem) int {
+	failed := 0
+	for _, item := range items {
+		if item.Err != nil {
+			failed++
+			fmt.Fprintf(c.stdout, "Failed:  %s: %v\n", item.What, item.Err)
+			continue
+		}
+		c.println("Done:    " + item.What)
+	}
+	return failed
+}
+
+// confirm asks question on stdout and reports whether the answer on stdin
+// is yes
+func (c *cli) confirm(question string) bool {
+	fmt.Fprintf(c.stdout, "%s [y/N] ", question)
+	if c.stdin == nil {
+		fmt.Fprintln(c.stdout)
+		return false
+	}
+	answer, _ := bufio.NewReader(c.stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// defineServiceControl defines start, stop and restart, which pass the
+// action to the service manager
+func defineServiceControl(action, success string) func(flags *flag.FlagSet) func(c *cli, args []string) int {
+	return func(flags *flag.FlagSet) func(c *cli, args []string) int {
+		return func(c *cli, args []string) int {
+			if err := service.Control(c.service, action); err != nil {
+				return c.failf("Failed to %s service: %v", action, err)
+			}
+			c.println(success)
+			return exitOK
+		}
+	}
+}
+
+func defineRollback(flags *flag.FlagSet) func(c *cli, args []string) int {
+	toVersion := flags.String("to", "", "version to restore (default: most recent backup)")
+	return func(c *cli, args []string) int {
+		if err := updater.RunRollback(*toVersion); err != nil {
+			fmt.Fprintf(c.stdout, "Rollback failed: %v\n", err)
+			c.printAvailableBackups()
+			return exitFailure
+		}
+		c.println("Rollback completed successfully")
+		return exitOK
+	}
+}
+
+func defineUpdate(flags *flag.FlagSet) func(c *cli, args []string) int {
+	noCache := flags.Bool("no-cache", false, "compile the agent even when a build of the version is cached")
+	return func(c *cli, args []string) int {
+		if len(args) > 1 {
+			return c.usageErrorf("Usage: sentinel-updater update [--no-cache] [<version>]")
+		}
+		var version string
+		if len(args) == 1 {
+			version = args[0]
+		}
+
+		installed, err := updater.RunUpdate(version, *noCache)
+		if err != nil {
+			return c.failf("Update failed: %v", err)
+		}
+		if installed == "" {
+			c.println("Already up to date")
+			return exitOK
+		}
+		c.println(fmt.Sprintf("Updated to %s", installed))
+		return exitOK
+	}
+}
+
+func defineBootstrap(flags *flag.FlagSet) func(c *cli, args []string) int {
+	version := flags.String("version", "", "agent version to install (default: the latest on the configured channel)")
+	noCache := flags.Bool("no-cache", false, "compile the agent even when a build of the version is cached")
+	return func(c *cli, args []string) int {
+		if len(args) > 0 {
+			return c.usageErrorf("Usage: sentinel-updater bootstrap [--version <version>] [--no-cache]")
+		}
+		result, err := updater.RunBootstrap(*version, *noCache)
+		if err != nil {
+			return c.failf("Bootstrap failed: %v", err)
+		}
+		if result.AlreadyInstalled {
+			c.println(fmt.Sprintf("Agent %s is already installed at %s, nothing to do", result.Version, result.BinaryPath))
+			c.println("Run 'sentinel-updater update' to update it")
+			return exitOK
+		}
+		c.println(fmt.Sprintf("Installed agent %s at %s and started its service", result.Version, result.BinaryPath))
+		return exitOK
+	}
+}
+
+// Exit codes of the check command, stable for scripts and monitoring
+const (
+	exitUpToDate        = exitOK
+	exitCheckFailed     = exitFailure
+	exitUpdateAvailable = 10
+)
+
+func defineCheck(flags *flag.FlagSet) func(c *cli, args []string) int {
+	refresh := flags.Bool("refresh", false, "query for the latest version even when the cached result is fresh")
+	ref := flags.String("ref", "", "resolve a branch, commit or pseudo-version as the dev channel would")
+	jsonOutput := flags.Bool("json", false, "print the result as JSON")
+	timeout := flags.Duration("timeout", 0, "give up on the version queries after this long, e.g. 30s (default: no limit)")
+	return func(c *cli, args []string) int {
+		result, err := updater.RunCheck(updater.CheckOptions{Refresh: *refresh, Ref: *ref, Timeout: *timeout})
+		if *jsonOutput {
+			output := struct {
+				*updater.CheckResult
+				Error string `json:"error,omitempty"`
+			}{CheckResult: result}
+			if output.CheckResult == nil {
+				output.CheckResult = &updater.CheckResult{}
+			}
+			if err != nil {
+				output.Error = err.Error()
+			}
+			encoder := json.NewEncoder(c.stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(output)
+		} else if err != nil {
+			fmt.Fprintf(c.stdout, "Check failed: %v\n", err)
+		} else {
+			fmt.Fprintln(c.stdout, result)
+		}
+
+		switch {
+		case err != nil:
+			return exitCheckFailed
+		case result.UpdateAvailable:
+			return exitUpdateAvailable
+		default:
+			return exitUpToDate
+		}
+	}
+}
+
+func definePause(flags *flag.FlagSet) func(c *cli, args []string) int {
+	duration := flags.Duration("duration", 0, "how long to pause, e.g. 48h (default: until resumed)")
+	reason := flags.String("reason", "", "why updates are paused, shown by status")
+	return func(c *cli, args []string) int {
+		if *duration < 0 {
+			return c.usageErrorf("Pause failed: --duration must not be negative")
+		}
+		pause, err := updater.PauseUpdates(*duration, *reason)
+		if err != nil {
+			return c.failf("Pause failed: %v", err)
+		}
+		c.println("Updates " + pause.String())
+		c.println("Version checks keep running; run 'sentinel-updater resume' to resume updates")
+		return exitOK
+	}
+}
+
+func defineResume(flags *flag.FlagSet) func(c *cli, args []string) int {
+	return func(c *cli, args []string) int {
+		pause, err := updater.ResumeUpdates()
+		if err != nil {
+			return c.failf("Resume failed: %v", err)
+		}
+		if pause == nil {
+			c.println("Updates were not paused")
+			return exitOK
+		}
+		c.println("Updates resumed")
+		return exitOK
+	}
+}
+
+func defineStatus(flags *flag.FlagSet) func(c *cli, args []string) int {
+	return func(c *cli, args []string) int {
+		if status, err := c.service.Status(); err != nil || status != service.StatusRunning {
+			fmt.Fprintln(c.stdout, "Updater service is not running")
+			if err != nil {
+				fmt.Fprintf(c.stdout, "  %v\n", err)
+			}
+			return exitFailure
+		}
+		return c.printStatus()
+	}
+}
+
+func defineDoctor(flags *flag.FlagSet) func(c *cli, args []string) int {
+	jsonOutput := flags.Bool("json", false, "print the checks as JSON")
+	return func(c *cli, args []string) int {
+		checks := updater.RunDoctor()
+		failed := false
+		for _, check := range checks {
+			failed = failed || check.Status == updater.DoctorFail
+		}
+
+		if *jsonOutput {
+			encoder := json.NewEncoder(c.stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(checks)
+		} else {
+			for _, check := range checks {
+				if c.quiet && check.Status == updater.DoctorPass {
+					continue
+				}
+				fmt.Fprintf(c.stdout, "[%-4s] %-18s %s\n", strings.ToUpper(string(check.Status)), check.Name, check.Detail)
+				if check.Fix != "" && check.Status != updater.DoctorPass {
+					fmt.Fprintf(c.stdout, "       %-18s fix: %s\n", "", check.Fix)
+				}
+			}
+		}
+		if failed {
+			return exitFailure
+		}
+		return exitOK
+	}
+}
+
+func defineDiagnose(flags *flag.FlagSet) func(c *cli, args []string) int {
+	bundle := flags.String("bundle", "", "zip file to write, e.g. /tmp/sentinel-diag.zip")
+	agentLogKB := flags.Int("agent-log-kb", updater.DefaultBundleAgentLogKB, "how much of the end of agent.log to include, in KB")
+	return func(c *cli, args []string) int {
+		if *bundle == "" {
+			return c.usageErrorf("diagnose requires --bundle <path>")
+		}
+		manifest, err := updater.WriteDiagnosticBundle(*bundle, updater.BundleOptions{AgentLogKB: *agentLogKB})
+		if err != nil {
+			return c.failf("Diagnose failed: %v", err)
+		}
+		for _, file := range manifest.Files {
+			if file.Error != "" && !c.quiet {
+				fmt.Fprintf(c.stdout, "  not included: %-28s %s\n", file.Name, file.Error)
+			}
+		}
+		c.println(fmt.Sprintf("Wrote %s with %d files; it contains no agent database, but check it before sharing", *bundle, len(manifest.Included())))
+		return exitOK
+	}
+}
+
+func defineLogs(flags *flag.FlagSet) func(c *cli, args []string) int {
+	lines := flags.Int("n", 50, "number of lines to show")
+	follow := flags.Bool("f", false, "keep printing lines as they are written, until interrupted")
+	list := flags.Bool("list", false, "list the current and rotated log files instead")
+	return func(c *cli, args []string) int {
+		if *list {
+			files, err := updater.ListUpdaterLogs()
+			if err != nil {
+				return c.failf("Failed to list updater logs: %v", err)
+			}
+			for _, file := range files {
+				fmt.Fprintf(c.stdout, "%-60s %10d  %s\n", file.Path, file.Size, file.ModTime.Format(time.RFC3339))
+			}
+			return exitOK
+		}
+
+		if err := updater.TailUpdaterLog(c.stdout, *lines); err != nil {
+			return c.failf("Failed to read updater log: %v", err)
+		}
+		if !*follow {
+			return exitOK
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := updater.FollowUpdaterLog(ctx, c.stdout); err != nil {
+			return c.failf("Failed to follow updater log: %v", err)
+		}
+		return exitOK
+	}
+}
+
+func defineHelp(flags *flag.FlagSet) func(c *cli, args []string) int {
+	return func(c *cli, args []string) int {
+		if len(args) == 0 {
+			c.printUsage()
+			return exitOK
+		}
+		cmd := findCommand(args[0])
+		if cmd == nil {
+			fmt.Fprintf(c.stdout, "Unknown command: %s\n\n", args[0])
+			c.printUsage()
+			return exitUsage
+		}
+		flags := c.newFlagSet(cmd.name)
+		cmd.define(flags)
+		c.printCommandUsage(cmd, flags)
+		return exitOK
+	}
+}
+
+// printUsage lists the commands and global flags
+func (c *cli) printUsage() {
+	fmt.Fprintln(c.stdout, "Usage: sentinel-updater [--config <path>] [--log-level <level>] [--quiet] [--verbose] [--user] [<command>]")
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, "Without a command the updater runs as a service in the foreground.")
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, "Commands:")
+	for _, cmd := range commands {
+		entry := cmd.name
+		if cmd.synopsis != "" {
+			entry += " " + cmd.synopsis
+		}
+		if len(entry) <= 10 {
+			fmt.Fprintf(c.stdout, "  sentinel-updater %-10s - %s\n", entry, cmd.summary)
+			continue
+		}
+		fmt.Fprintf(c.stdout, "  sentinel-updater %s\n", entry)
+		fmt.Fprintf(c.stdout, "                              - %s\n", cmd.summary)
+	}
+	fmt.Fprintln(c.stdout, "  sentinel-updater --version  - Show version information")
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, "Flags, before the command or after it:")
+	fmt.Fprintln(c.stdout, "  --config <path>     Use this configuration file instead of updater-config.json")
+	fmt.Fprintln(c.stdout, "  --log-level <level> Log at debug, info, warning or error, whatever logLevel is configured")
+	fmt.Fprintln(c.stdout, "  --quiet             Only print errors and the information a command was asked for")
+	fmt.Fprintln(c.stdout, "  --verbose           Log at debug level, whatever logLevel is configured")
+	fmt.Fprintln(c.stdout, "  --user              Keep the updater's data in a per-user directory (Linux)")
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, "Exit codes: 0 on success, 1 when the command fails, 2 for invalid usage;")
+	fmt.Fprintln(c.stdout, "check exits 10 when an update is available.")
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, "Run 'sentinel-updater help <command>' for the flags of a command.")
+}
+
+// printCommandUsage describes cmd and its flags
+func (c *cli) printCommandUsage(cmd *cliCommand, flags *flag.FlagSet) {
+	fmt.Fprintf(c.stdout, "Usage: sentinel-updater %s\n", strings.TrimSpace(cmd.name+" "+cmd.synopsis))
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, cmd.summary)
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintln(c.stdout, "Flags:")
+	flags.SetOutput(c.stdout)
+	flags.PrintDefaults()
+}
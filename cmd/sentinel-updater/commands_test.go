@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/kardianos/service"
+)
+
+// execute runs the CLI with args and returns its exit code, whether it would
+// run as a service, and what it printed
+func execute(t *testing.T, args ...string) (int, bool, string) {
+	t.Helper()
+	var output bytes.Buffer
+	c := &cli{stdout: &output, stderr: &output, requirePrivileges: func() error { return nil }}
+	code, runService := c.execute(args)
+	return code, runService, output.String()
+}
+
+// TestExecuteDispatch verifies the exit codes and output of dispatching
+// commands, flags and invalid arguments
+func TestExecuteDispatch(t *testing.T) {
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantOutput string
+	}{
+		{[]string{"--version"}, exitOK, "sentinelgo-updater version"},
+		{[]string{"-v"}, exitOK, "Git commit:"},
+		{[]string{"help"}, exitOK, "sentinel-updater rollback [--to <version>]"},
+		{[]string{"--quiet", "help", "update"}, exitOK, "-no-cache"},
+		{[]string{"help", "check", "--verbose"}, exitOK, "-timeout"},
+		{[]string{"update", "-h"}, exitOK, "Usage: sentinel-updater update"},
+		{[]string{"help", "bogus"}, exitUsage, "Unknown command: bogus"},
+		{[]string{"bogus"}, exitUsage, "Unknown command: bogus"},
+		{[]string{"--bogus"}, exitUsage, "flag provided but not defined"},
+		{[]string{"update", "--bogus"}, exitUsage, "flag provided but not defined"},
+		{[]string{"update", "v1.0.0", "v1.1.0"}, exitUsage, "Usage: sentinel-updater update"},
+		{[]string{"help", "bootstrap"}, exitOK, "-version"},
+		{[]string{"bootstrap", "v1.0.0"}, exitUsage, "Usage: sentinel-updater bootstrap"},
+		{[]string{"uninstall", "--purge", "--agent-only"}, exitUsage, "not both"},
+		{[]string{"uninstall", "--include-database"}, exitUsage, "--include-database requires --purge"},
+		{[]string{"pause", "--duration", "-1h"}, exitUsage, "must not be negative"},
+		{[]string{"diagnose"}, exitUsage, "requires --bundle"},
+		{[]string{"--log-level", "loud", "help"}, exitUsage, `unknown log level "loud"`},
+	}
+	for _, tt := range tests {
+		code, runService, output := execute(t, tt.args...)
+		if code != tt.wantCode || runService || !strings.Contains(output, tt.wantOutput) {
+			t.Errorf("execute(%q) = %d, %v; want %d with %q in:\n%s", tt.args, code, runService, tt.wantCode, tt.wantOutput, output)
+		}
+	}
+}
+
+// TestExecuteRunService verifies that without a command the updater runs as
+// a service, with the global flags applied
+func TestExecuteRunService(t *testing.T) {
+	t.Cleanup(func() { paths.SetUpdaterConfigPath("") })
+	configPath := filepath.Join(t.TempDir(), "updater-config.json")
+
+	if code, runService, output := execute(t); code != exitOK || !runService || output != "" {
+		t.Errorf("execute() = %d, %v, %q; want to run as a service", code, runService, output)
+	}
+	if code, runService, _ := execute(t, "--config", configPath, "--log-level", "warning"); code != exitOK || !runService {
+		t.Errorf("execute(--config, --log-level) = %d, %v; want to run as a service", code, runService)
+	}
+	if got := paths.GetUpdaterConfigPath(); got != configPath {
+		t.Errorf("GetUpdaterConfigPath() after --config = %s; want %s", got, configPath)
+	}
+}
+
+// TestUninstallPurgeAborts verifies that a purge lists what it would do and
+// removes nothing unless confirmed
+func TestUninstallPurgeAborts(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv(paths.DataDirectoryEnv, dataDir)
+	t.Setenv(paths.ConfigPathEnv, "")
+	logPath := filepath.Join(dataDir, "updater.log")
+	if err := os.WriteFile(logPath, []byte("log\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	var output bytes.Buffer
+	c := &cli{stdout: &output, stderr: &output, stdin: strings.NewReader("no\n"), requirePrivileges: func() error { return nil }}
+	code, _ := c.execute([]string{"uninstall", "--purge"})
+	if code != exitFailure {
+		t.Errorf("execute(uninstall --purge) = %d; want %d", code, exitFailure)
+	}
+	for _, want := range []string{"uninstall the updater service", "delete " + logPath, "--include-database", "Aborted, nothing was removed"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, output.String())
+		}
+	}
+	if _, err := os.Stat(logPath); err != nil {
+		t.Errorf("%s removed without confirmation: %v", logPath, err)
+	}
+}
+
+// TestPrivilegedCommands verifies that the commands that change services or
+// binaries fail before doing anything without privileges, and the others
+// still run
+func TestPrivilegedCommands(t *testing.T) {
+	var output bytes.Buffer
+	c := &cli{stdout: &output, stderr: &output, requirePrivileges: func() error {
+		return errors.New("this command requires administrator privileges: run it with sudo")
+	}}
+	// c.service is nil, so a command that got past the check would panic
+	for _, name := range []string{"install", "uninstall", "start", "stop", "restart", "rollback", "update", "bootstrap"} {
+		output.Reset()
+		if code, _ := c.execute([]string{name}); code != exitFailure || !strings.Contains(output.String(), "requires administrator privileges") {
+			t.Errorf("execute(%s) = %d; want %d with guidance in:\n%s", name, code, exitFailure, output.String())
+		}
+	}
+	output.Reset()
+	if code, _ := c.execute([]string{"help"}); code != exitOK {
+		t.Errorf("execute(help) = %d; want %d:\n%s", code, exitOK, output.String())
+	}
+}
+
+// fakeService records whether it was installed; its other methods are not
+// used
+type fakeService struct {
+	service.Service
+	installed bool
+}
+
+func (s *fakeService) Install() error {
+	s.installed = true
+	return nil
+}
+
+// TestInstallServiceArguments verifies that install registers the service
+// with the configuration file, log level and user mode it was given, so the
+// service reads the same configuration as the command
+func TestInstallServiceArguments(t *testing.T) {
+	t.Cleanup(func() {
+		paths.SetUpdaterConfigPath("")
+		paths.SetUserMode(false)
+	})
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"install"}, nil},
+		{[]string{"--config", "updater.yaml", "install", "--log-level", "warning", "--user"},
+			[]string{"--config", filepath.Join(dir, "updater.yaml"), "--log-level", "warning", "--user"}},
+	}
+	for _, tt := range tests {
+		var output bytes.Buffer
+		var installed *service.Config
+		s := &fakeService{}
+		c := &cli{
+			stdout:            &output,
+			stderr:            &output,
+			requirePrivileges: func() error { return nil },
+			serviceConfig:     &service.Config{Name: "sentinelgo-updater"},
+			newService: func(config *service.Config) (service.Service, error) {
+				installed = config
+				return s, nil
+			},
+		}
+		if code, _ := c.execute(tt.args); code != exitOK || !s.installed {
+			t.Fatalf("execute(%q) = %d, installed %v; want the service installed:\n%s", tt.args, code, s.installed, output.String())
+		}
+		if !slices.Equal(installed.Arguments, tt.want) {
+			t.Errorf("execute(%q) installed the service with %q; want %q", tt.args, installed.Arguments, tt.want)
+		}
+	}
+}
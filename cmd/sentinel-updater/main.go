@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/BrainStation-23/SentinelGo-Updater/internal/updater"
 	"github.com/kardianos/service"
@@ -18,38 +20,61 @@ var (
 	GitCommit = "unknown"
 )
 
+// stopTimeout bounds how long Stop waits for the updater loop to end. An
+// update step still running then is resumed from its journal on restart.
+const stopTimeout = 20 * time.Second
+
 // updaterProgram implements the service.Interface
 type updaterProgram struct {
-	exit chan struct{}
+	// options configures the updater the service runs
+	options updater.Options
+
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 // Start is called when the service starts
 func (p *updaterProgram) Start(s service.Service) error {
-	// Start the updater in a goroutine
-	p.exit = make(chan struct{})
-	go p.run()
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel, p.done = cancel, make(chan struct{})
+	go p.run(ctx)
 	return nil
 }
 
-// run executes the main updater logic
-func (p *updaterProgram) run() {
-	// Run the updater loop
-	updater.Run()
+// run executes the main updater logic until ctx is done
+func (p *updaterProgram) run(ctx context.Context) {
+	defer close(p.done)
+	if err := updater.New(p.options).Run(ctx); err != nil {
+		log.Fatalf("Failed to initialize logging system: %v", err)
+	}
 }
 
-// Stop is called when the service stops
+// Stop is called when the service stops. It waits for the updater loop to
+// end, so its log is closed and its watchers are stopped.
 func (p *updaterProgram) Stop(s service.Service) error {
-	// Signal the updater to stop
-	close(p.exit)
-	return nil
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(stopTimeout):
+		return fmt.Errorf("updater did not stop within %v", stopTimeout)
+	}
 }
 
 func main() {
+	updater.SetBuildInfo(Version, GitCommit, BuildTime)
+
 	// Service configuration
 	svcConfig := &service.Config{
 		Name:        "sentinelgo-updater",
 		DisplayName: "SentinelGo Updater Service",
 		Description: "Manages updates for SentinelGo Agent",
+		Option: service.KeyValue{
+			"SystemdScript": systemdUnit,
+			"WatchdogSec":   systemdWatchdogSec,
+			// systemctl reload sends SIGHUP, which reloads the configuration
+			"ReloadSignal": "HUP",
+		},
 	}
 
 	prg := &updaterProgram{}
@@ -58,72 +83,12 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Handle command-line arguments
-	if len(os.Args) > 1 {
-		command := os.Args[1]
-
-		// Handle --version flag
-		if command == "--version" || command == "-v" {
-			fmt.Printf("sentinelgo-updater version %s\n", Version)
-			fmt.Printf("Build time: %s\n", BuildTime)
-			fmt.Printf("Git commit: %s\n", GitCommit)
-			return
-		}
-
-		// Handle service control commands
-		switch command {
-		case "install":
-			err = s.Install()
-			if err != nil {
-				log.Fatalf("Failed to install service: %v", err)
-			}
-			fmt.Println("Service installed successfully")
-			fmt.Println("Run 'sentinel-updater start' to start the service")
-			return
-
-		case "uninstall":
-			err = s.Uninstall()
-			if err != nil {
-				log.Fatalf("Failed to uninstall service: %v", err)
-			}
-			fmt.Println("Service uninstalled successfully")
-			return
-
-		case "start":
-			err = s.Start()
-			if err != nil {
-				log.Fatalf("Failed to start service: %v", err)
-			}
-			fmt.Println("Service started successfully")
-			return
-
-		case "stop":
-			err = s.Stop()
-			if err != nil {
-				log.Fatalf("Failed to stop service: %v", err)
-			}
-			fmt.Println("Service stopped successfully")
-			return
-
-		case "restart":
-			err = s.Restart()
-			if err != nil {
-				log.Fatalf("Failed to restart service: %v", err)
-			}
-			fmt.Println("Service restarted successfully")
-			return
-
-		default:
-			fmt.Printf("Unknown command: %s\n", command)
-			fmt.Println("\nUsage:")
-			fmt.Println("  sentinel-updater install    - Install the updater service")
-			fmt.Println("  sentinel-updater uninstall  - Uninstall the updater service")
-			fmt.Println("  sentinel-updater start      - Start the updater service")
-			fmt.Println("  sentinel-updater stop       - Stop the updater service")
-			fmt.Println("  sentinel-updater restart    - Restart the updater service")
-			fmt.Println("  sentinel-updater --version  - Show version information")
-			os.Exit(1)
-		}
+	// Global flags come before the command, or with the command's own flags
+	c := &cli{service: s, stdout: os.Stdout, stderr: os.Stderr, stdin: os.Stdin, serviceConfig: svcConfig}
+	c.newService = func(config *service.Config) (service.Service, error) { return service.New(prg, config) }
+	code, runService := c.execute(os.Args[1:])
+	if !runService {
+		os.Exit(code)
 	}
 
 	// No command specified, run as service
@@ -137,3 +102,81 @@ func main() {
 		logger.Error(err)
 	}
 }
+
+// printAvailableBackups lists the retained agent backups that rollback can restore
+func (c *cli) printAvailableBackups() {
+	backups, err := updater.ListBackups()
+	if err != nil {
+		fmt.Fprintf(c.stdout, "Failed to read backups: %v\n", err)
+		return
+	}
+
+	if len(backups) == 0 {
+		fmt.Fprintln(c.stdout, "No backups available")
+		return
+	}
+
+	fmt.Fprintln(c.stdout, "\nAvailable backups:")
+	for _, backup := range backups {
+		fmt.Fprintf(c.stdout, "  %-20s %s\n", backup.Version, backup.CreatedAt.Format(time.RFC3339))
+	}
+}
+
+// printStatus prints the status published by the running updater
+func (c *cli) printStatus() int {
+	status, err := updater.ReadStatus()
+	if err != nil {
+		return c.failf("Failed to read updater status: %v", err)
+	}
+	if status == nil {
+		fmt.Fprintln(c.stdout, "Updater service is running but has not published a status yet")
+		return exitOK
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Round(time.Second))
+	}
+
+	if status.Pause != nil {
+		fmt.Fprintf(c.stdout, "UPDATES PAUSED:    %s\n", status.Pause)
+	}
+	fmt.Fprintf(c.stdout, "Updater:           running (pid %d) since %s\n", status.PID, status.StartedAt.Format(time.RFC3339))
+	if status.Updater.Version != "" {
+		fmt.Fprintf(c.stdout, "Updater build:     %s\n", status.Updater)
+	}
+	fmt.Fprintf(c.stdout, "Activity:          %s\n", status.Activity)
+	if beat := status.Heartbeat; beat != nil {
+		fmt.Fprintf(c.stdout, "Heartbeat:         %s, cycle %d, %s\n", formatTime(beat.Timestamp), beat.Cycle, beat.State)
+		if !beat.NextCheck.IsZero() {
+			fmt.Fprintf(c.stdout, "Next check:        %s\n", beat.NextCheck.Format(time.RFC3339))
+		}
+	}
+	fmt.Fprintf(c.stdout, "Installed version: %s\n", valueOr(status.InstalledVersion, "unknown"))
+	if status.InstalledVersionDetails != "" {
+		fmt.Fprintf(c.stdout, "Agent reports:     %s\n", status.InstalledVersionDetails)
+	}
+	fmt.Fprintf(c.stdout, "Latest version:    %s\n", valueOr(status.LatestVersion, "unknown"))
+	if status.Channel != "" {
+		fmt.Fprintf(c.stdout, "Channel:           %s\n", status.Channel)
+	}
+	fmt.Fprintf(c.stdout, "Last check:        %s\n", formatTime(status.LastCheck))
+	fmt.Fprintf(c.stdout, "Last result:       %s\n", valueOr(status.LastResult, "none"))
+	fmt.Fprintf(c.stdout, "Update pending:    %t\n", status.UpdatePending)
+	fmt.Fprintf(c.stdout, "Update running:    %s\n", valueOr(status.UpdateInProgress, "no"))
+	if status.GoCacheBytes > 0 {
+		fmt.Fprintf(c.stdout, "Go caches:         %d MB after the last update\n", status.GoCacheBytes/(1024*1024))
+	}
+	fmt.Fprintf(c.stdout, "Config file:       %s\n", status.ConfigPath)
+	return exitOK
+}
+
+// valueOr returns value, or fallback when it is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/updater"
+)
+
+// TestUpdaterProgramStop verifies that stopping the service ends the
+// updater loop that starting it began
+func TestUpdaterProgramStop(t *testing.T) {
+	t.Setenv(paths.DataDirectoryEnv, t.TempDir())
+	t.Setenv(paths.ConfigPathEnv, "")
+
+	checked := make(chan struct{}, 1)
+	program := &updaterProgram{options: updater.Options{
+		Config:         updater.DefaultConfig(),
+		ServiceManager: &servicetest.FakeManager{},
+		Runner:         &commandtest.FakeRunner{},
+		Versions: &updater.VersionChecker{
+			InstalledVersion: func() (string, error) { return "v1.0.0", nil },
+			LatestVersion: func(string, bool) (*updater.VersionCheck, error) {
+				select {
+				case checked <- struct{}{}:
+				default:
+				}
+				return &updater.VersionCheck{Channel: updater.ChannelStable, Selected: "v1.0.0"}, nil
+			},
+		},
+		LogOutput: io.Discard,
+	}}
+
+	if err := program.Start(nil); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	select {
+	case <-checked:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the updater did not check for an update after Start()")
+	}
+	if err := program.Stop(nil); err != nil {
+		t.Fatalf("Stop() failed: %v", err)
+	}
+	select {
+	case <-program.done:
+	default:
+		t.Error("Run() had not returned when Stop() did")
+	}
+}
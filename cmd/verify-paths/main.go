@@ -5,6 +5,7 @@ import (
 	"runtime"
 
 	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/updater"
 )
 
 func main() {
@@ -23,9 +24,26 @@ func main() {
 	fmt.Println("Agent Log Path:")
 	fmt.Printf("  %s\n\n", paths.GetAgentLogPath())
 
+	fmt.Println("Updater Config Path:")
+	fmt.Printf("  %s\n\n", paths.GetUpdaterConfigPath())
+
+	fmt.Println("Backup Directory:")
+	fmt.Printf("  %s\n\n", paths.GetBackupDirectory())
+
 	fmt.Println("Binary Directory:")
 	fmt.Printf("  %s\n\n", paths.GetBinaryDirectory())
 
+	target, err := updater.LoadAgentTarget()
+	if err != nil {
+		fmt.Printf("Failed to load updater config, showing defaults: %v\n\n", err)
+	}
+
+	fmt.Println("Main Agent Module:")
+	fmt.Printf("  %s\n\n", target.Module)
+
+	fmt.Println("Main Agent Package:")
+	fmt.Printf("  %s\n\n", target.Package)
+
 	fmt.Println("Main Agent Binary Path:")
-	fmt.Printf("  %s\n", paths.GetMainAgentBinaryPath())
+	fmt.Printf("  %s\n", target.BinaryPath)
 }
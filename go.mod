@@ -4,5 +4,5 @@ go 1.25.6
 
 require (
 	github.com/kardianos/service v1.2.4
-	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/sys v0.34.0
 )
@@ -0,0 +1,66 @@
+// Package command runs external commands behind an interface, so the code
+// that runs them can be tested without them
+package command
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Runner runs external commands
+type Runner interface {
+	// Run runs name with args in dir and returns what it wrote to stdout
+	// and stderr. A nil env inherits the process environment and an empty
+	// dir the working directory.
+	Run(ctx context.Context, name string, args []string, env []string, dir string) (stdout, stderr []byte, err error)
+}
+
+// Exec is the Runner that starts processes. Its zero value runs commands
+// the way exec.Command does.
+type Exec struct {
+	// Prepare adjusts each command before it starts, such as setting the
+	// credentials it runs with
+	Prepare func(cmd *exec.Cmd)
+
+	// Started is called with each process once it is running
+	Started func(process *os.Process)
+
+	// Output also receives stdout and stderr as the command writes them.
+	// It is written to from two goroutines.
+	Output io.Writer
+}
+
+// Run runs name as a process
+func (e Exec) Run(ctx context.Context, name string, args []string, env []string, dir string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if e.Output != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, e.Output)
+		cmd.Stderr = io.MultiWriter(&stderr, e.Output)
+	}
+	if e.Prepare != nil {
+		e.Prepare(cmd)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	if e.Started != nil {
+		e.Started(cmd.Process)
+	}
+	err := cmd.Wait()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Combined runs name through runner and returns its stdout followed by its
+// stderr, the way an error message quotes a command's output
+func Combined(ctx context.Context, runner Runner, name string, args ...string) ([]byte, error) {
+	stdout, stderr, err := runner.Run(ctx, name, args, nil, "")
+	return append(stdout, stderr...), err
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer is a bytes.Buffer safe for the stdout and stderr copies of a
+// process to share
+type lockedBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+// TestExecRun verifies that a process gets the environment and directory it
+// is given, and that its stdout and stderr are returned apart and written
+// to Output as well
+func TestExecRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command runs through /bin/sh")
+	}
+	dir := t.TempDir()
+	var output lockedBuffer
+	var prepared, started bool
+	runner := Exec{
+		Prepare: func(cmd *exec.Cmd) { prepared = true },
+		Started: func(process *os.Process) { started = process != nil },
+		Output:  &output,
+	}
+
+	stdout, stderr, err := runner.Run(context.Background(), "/bin/sh",
+		[]string{"-c", `echo "$GREETING"; pwd; echo oops >&2`}, []string{"GREETING=hello"}, dir)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if want := "hello\n" + dir + "\n"; string(stdout) != want {
+		t.Errorf("stdout = %q; want %q", stdout, want)
+	}
+	if string(stderr) != "oops\n" {
+		t.Errorf("stderr = %q; want %q", stderr, "oops\n")
+	}
+	if !strings.Contains(output.String(), "hello") || !strings.Contains(output.String(), "oops") {
+		t.Errorf("Output = %q; want stdout and stderr", output.String())
+	}
+	if !prepared || !started {
+		t.Errorf("prepared = %v, started = %v; want both", prepared, started)
+	}
+}
+
+// TestCombined verifies that a failing command's error is returned with its
+// stdout and stderr
+func TestCombined(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command runs through /bin/sh")
+	}
+	output, err := Combined(context.Background(), Exec{}, "/bin/sh", "-c", "echo out; echo err >&2; exit 3")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Combined() error = %v; want exit status 3", err)
+	}
+	if string(output) != "out\nerr\n" {
+		t.Errorf("Combined() = %q; want %q", output, "out\nerr\n")
+	}
+}
@@ -0,0 +1,101 @@
+// Package commandtest provides a scriptable command runner for tests
+package commandtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Call is a command a FakeRunner was asked to run
+type Call struct {
+	Name string
+	Args []string
+	Env  []string
+	Dir  string
+}
+
+// String returns the command line, such as "systemctl stop sentinelgo"
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Getenv returns the value of key in the environment the command was given
+func (c Call) Getenv(key string) string {
+	value := ""
+	for _, entry := range c.Env {
+		if k, v, ok := strings.Cut(entry, "="); ok && k == key {
+			value = v
+		}
+	}
+	return value
+}
+
+// Result is how a command a FakeRunner runs turns out
+type Result struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// ExitError is the error of a command that exited with a non-zero status
+type ExitError int
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// Failure is the Result of a command that wrote output to stderr and exited
+// with status 1
+func Failure(output string) Result {
+	return Result{Stderr: output, Err: ExitError(1)}
+}
+
+// FakeRunner is a command.Runner that runs nothing. It records each command
+// it is asked to run and answers it with the Result in Results for its
+// command line, else with the one Handler returns. Commands neither of them
+// knows succeed without output, so the zero value succeeds at everything.
+type FakeRunner struct {
+	mu sync.Mutex
+
+	// Calls are the commands run, in order
+	Calls []Call
+
+	// Results maps command lines, such as "systemctl is-active sentinelgo",
+	// to their results
+	Results map[string]Result
+
+	// Handler answers the commands not in Results
+	Handler func(call Call) Result
+}
+
+// Run records the command and returns its scripted result
+func (r *FakeRunner) Run(ctx context.Context, name string, args []string, env []string, dir string) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	call := Call{Name: name, Args: append([]string(nil), args...), Env: env, Dir: dir}
+
+	r.mu.Lock()
+	r.Calls = append(r.Calls, call)
+	result, ok := r.Results[call.String()]
+	handler := r.Handler
+	r.mu.Unlock()
+
+	if !ok && handler != nil {
+		result = handler(call)
+	}
+	return []byte(result.Stdout), []byte(result.Stderr), result.Err
+}
+
+// CallLog returns the command lines of Calls
+func (r *FakeRunner) CallLog() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := make([]string, len(r.Calls))
+	for i, call := range r.Calls {
+		lines[i] = call.String()
+	}
+	return lines
+}
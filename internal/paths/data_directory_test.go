@@ -0,0 +1,33 @@
+package paths_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/updater"
+)
+
+// TestPauseSeenByService verifies that a pause made by a user other than
+// root is written where the service, running as root, reads it
+func TestPauseSeenByService(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the per-user data directory is Linux only")
+	}
+	systemDir := t.TempDir()
+	t.Setenv(paths.DataDirectoryEnv, "")
+	t.Setenv(paths.UserModeEnv, "")
+	t.Setenv(paths.ConfigPathEnv, "")
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	paths.ActAs(t, 1000, systemDir)
+	if _, err := updater.PauseUpdates(0, "change freeze"); err != nil {
+		t.Fatalf("PauseUpdates() as a user failed: %v", err)
+	}
+
+	paths.ActAs(t, 0, systemDir)
+	pause, err := updater.ReadPause()
+	if err != nil || pause == nil || pause.Reason != "change freeze" {
+		t.Errorf("ReadPause() as root = %+v, %v; want the user's pause", pause, err)
+	}
+}
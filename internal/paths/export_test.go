@@ -0,0 +1,12 @@
+package paths
+
+import "testing"
+
+// ActAs makes the updater act as the user with uid euid and keep the Linux
+// system data directory in systemDir for the duration of the test
+func ActAs(t *testing.T, euid int, systemDir string) {
+	originalEUID, originalDir := geteuid, systemDataDirectory
+	geteuid = func() int { return euid }
+	systemDataDirectory = systemDir
+	t.Cleanup(func() { geteuid, systemDataDirectory = originalEUID, originalDir })
+}
@@ -4,13 +4,67 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
-// GetDataDirectory returns the platform-specific data directory
+// dataDirectory replaces the platform-specific data directory when set
+var dataDirectory string
+
+// DataDirectoryEnv names the environment variable that replaces the
+// platform-specific data directory
+const DataDirectoryEnv = "SENTINELGO_DATA_DIR"
+
+// ConfigPathEnv names the environment variable that replaces the default
+// updater configuration file
+const ConfigPathEnv = "SENTINELGO_CONFIG"
+
+// UserModeEnv names the environment variable that, set to 1 or true, makes
+// the updater keep its data in a per-user directory, like the --user flag
+const UserModeEnv = "SENTINELGO_USER_MODE"
+
+// userMode is set by SetUserMode
+var userMode bool
+
+// systemDataDirectory is the Linux data directory of system installs; it is
+// a variable so tests can move it
+var systemDataDirectory = "/var/lib/sentinelgo"
+
+// geteuid returns the effective user ID; it is a variable so tests can act
+// as another user
+var geteuid = os.Geteuid
+
+// UserMode reports whether the updater keeps its data per user, set with
+// SetUserMode or $SENTINELGO_USER_MODE. Otherwise every process, whoever runs
+// it, uses the data directory of the system service.
+func UserMode() bool {
+	if userMode {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(UserModeEnv))
+	return enabled
+}
+
+// SetUserMode makes the updater keep its data per user, for the --user
+// flag; false restores $SENTINELGO_USER_MODE
+func SetUserMode(enabled bool) {
+	userMode = enabled
+}
+
+// GetDataDirectory returns the data directory. The first of these applies:
+// the directory set with SetDataDirectory, $SENTINELGO_DATA_DIR, and the
+// platform-specific one
 // macOS: /Library/Application Support/SentinelGo
-// Linux: /var/lib/sentinelgo
+// Linux: /var/lib/sentinelgo, or in user mode as any user but root
+// $XDG_DATA_HOME/sentinelgo or ~/.local/share/sentinelgo
 // Windows: %ProgramData%\SentinelGo
 func GetDataDirectory() string {
+	if dataDirectory != "" {
+		return dataDirectory
+	}
+	if dir := os.Getenv(DataDirectoryEnv); dir != "" {
+		return dir
+	}
 	switch runtime.GOOS {
 	case "windows":
 		programData := os.Getenv("ProgramData")
@@ -21,10 +75,36 @@ func GetDataDirectory() string {
 	case "darwin":
 		return "/Library/Application Support/SentinelGo"
 	case "linux":
-		return "/var/lib/sentinelgo"
+		if !UserMode() {
+			return systemDataDirectory
+		}
+		return linuxDataDirectory(geteuid(), os.Getenv("XDG_DATA_HOME"), os.Getenv("HOME"))
 	default:
-		return "/var/lib/sentinelgo"
+		return systemDataDirectory
+	}
+}
+
+// linuxDataDirectory returns the user-mode data directory of a user with
+// uid euid: the system one for root, else the user's under XDG_DATA_HOME,
+// which the XDG base directory specification says to ignore unless it is
+// absolute, or under home. A user without either gets the system one.
+func linuxDataDirectory(euid int, xdgDataHome, home string) string {
+	switch {
+	case euid == 0:
+		return systemDataDirectory
+	case filepath.IsAbs(xdgDataHome):
+		return filepath.Join(xdgDataHome, "sentinelgo")
+	case filepath.IsAbs(home):
+		return filepath.Join(home, ".local", "share", "sentinelgo")
 	}
+	return systemDataDirectory
+}
+
+// SetDataDirectory makes dir the data directory, and with it the location
+// of the logs, state files, backups and the default configuration file, for
+// tests that run an update; "" restores the default
+func SetDataDirectory(dir string) {
+	dataDirectory = dir
 }
 
 // GetDatabasePath returns the full path to the database file
@@ -42,6 +122,93 @@ func GetAgentLogPath() string {
 	return filepath.Join(GetDataDirectory(), "agent.log")
 }
 
+// updaterConfigPath replaces the default configuration file when set
+var updaterConfigPath string
+
+// updaterConfigFileNames are the configuration files looked for in the data
+// directory, in order of preference
+var updaterConfigFileNames = []string{"updater-config.json", "updater-config.yaml", "updater-config.yml"}
+
+// GetUpdaterConfigPath returns the full path to the updater configuration
+// file: the one set by SetUpdaterConfigPath, else the one SENTINELGO_CONFIG
+// names, else the first of updater-config.json, updater-config.yaml and
+// updater-config.yml in the data directory that exists. Without any, it is
+// updater-config.json.
+func GetUpdaterConfigPath() string {
+	if path := explicitUpdaterConfigPath(); path != "" {
+		return path
+	}
+	dir := GetDataDirectory()
+	for _, name := range updaterConfigFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, updaterConfigFileNames[0])
+}
+
+// explicitUpdaterConfigPath returns the configuration file set by
+// SetUpdaterConfigPath or SENTINELGO_CONFIG, or ""
+func explicitUpdaterConfigPath() string {
+	if updaterConfigPath != "" {
+		return updaterConfigPath
+	}
+	return os.Getenv(ConfigPathEnv)
+}
+
+// IgnoredUpdaterConfigPaths returns the configuration files in the data
+// directory that exist but are not read, because another one takes
+// precedence. A file set explicitly ignores none: the data directory is not
+// looked in.
+func IgnoredUpdaterConfigPaths() []string {
+	if explicitUpdaterConfigPath() != "" {
+		return nil
+	}
+	used := GetUpdaterConfigPath()
+	var ignored []string
+	for _, name := range updaterConfigFileNames {
+		path := filepath.Join(GetDataDirectory(), name)
+		if _, err := os.Stat(path); err == nil && path != used {
+			ignored = append(ignored, path)
+		}
+	}
+	return ignored
+}
+
+// SetUpdaterConfigPath makes path the updater configuration file, for the
+// --config flag; "" restores SENTINELGO_CONFIG or the default
+func SetUpdaterConfigPath(path string) {
+	updaterConfigPath = path
+}
+
+// GetBackupDirectory returns the directory where previous agent binaries are retained
+func GetBackupDirectory() string {
+	return filepath.Join(GetDataDirectory(), "backups")
+}
+
+// GetBuildBinDirectory returns the directory go install writes the agent
+// binary to before it is installed
+func GetBuildBinDirectory() string {
+	return BuildBinDirectory(GetDataDirectory())
+}
+
+// BuildBinDirectory returns the build output directory under dataDir
+func BuildBinDirectory(dataDir string) string {
+	return filepath.Join(dataDir, "build", "bin")
+}
+
+// BuildGoPathDirectory returns the GOPATH of builds run as the build user,
+// which holds their module and build caches
+func BuildGoPathDirectory(dataDir string) string {
+	return filepath.Join(dataDir, "build", "gopath")
+}
+
+// BuildHomeDirectory returns the HOME of builds run as the build user
+func BuildHomeDirectory(dataDir string) string {
+	return filepath.Join(dataDir, "build", "home")
+}
+
 // GetBinaryDirectory returns the platform-specific binary installation directory
 // Linux/macOS: /usr/local/bin
 // Windows: %ProgramFiles%\SentinelGo
@@ -60,14 +227,29 @@ func GetBinaryDirectory() string {
 	}
 }
 
+// DefaultMainAgentBinaryName is the main agent binary name without the
+// Windows .exe suffix
+const DefaultMainAgentBinaryName = "sentinel"
+
+// BinaryFileName returns the file name of the binary called name, adding the
+// .exe suffix on Windows
+func BinaryFileName(name string) string {
+	if runtime.GOOS == "windows" && !strings.HasSuffix(strings.ToLower(name), ".exe") {
+		return name + ".exe"
+	}
+	return name
+}
+
+// GetAgentBinaryPath returns the full path the agent binary called name is
+// installed to
+func GetAgentBinaryPath(name string) string {
+	return filepath.Join(GetBinaryDirectory(), BinaryFileName(name))
+}
+
 // GetMainAgentBinaryPath returns the full path to the main agent binary
 // with platform-specific binary names (sentinel on Unix, sentinel.exe on Windows)
 func GetMainAgentBinaryPath() string {
-	binaryName := "sentinel"
-	if runtime.GOOS == "windows" {
-		binaryName = "sentinel.exe"
-	}
-	return filepath.Join(GetBinaryDirectory(), binaryName)
+	return GetAgentBinaryPath(DefaultMainAgentBinaryName)
 }
 
 // EnsureDataDirectory creates the data directory if it doesn't exist
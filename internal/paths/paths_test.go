@@ -55,6 +55,29 @@ func TestGetAgentLogPath(t *testing.T) {
 	}
 }
 
+// TestGetUpdaterConfigPath verifies that GetUpdaterConfigPath returns the correct path
+// based on the platform-specific data directory
+func TestGetUpdaterConfigPath(t *testing.T) {
+	t.Setenv(ConfigPathEnv, "")
+	expected := filepath.Join(GetDataDirectory(), "updater-config.json")
+	actual := GetUpdaterConfigPath()
+
+	if actual != expected {
+		t.Errorf("GetUpdaterConfigPath() = %s; want %s", actual, expected)
+	}
+}
+
+// TestGetBackupDirectory verifies that GetBackupDirectory is located inside
+// the platform-specific data directory
+func TestGetBackupDirectory(t *testing.T) {
+	expected := filepath.Join(GetDataDirectory(), "backups")
+	actual := GetBackupDirectory()
+
+	if actual != expected {
+		t.Errorf("GetBackupDirectory() = %s; want %s", actual, expected)
+	}
+}
+
 // TestDerivedPathsOnMacOS verifies the expected paths on macOS
 func TestDerivedPathsOnMacOS(t *testing.T) {
 	if runtime.GOOS != "darwin" {
@@ -93,17 +116,103 @@ func TestDerivedPathsOnMacOS(t *testing.T) {
 	}
 }
 
+// TestLinuxDataDirectory verifies that only root gets the system data
+// directory, and other users one of their own
+func TestLinuxDataDirectory(t *testing.T) {
+	tests := []struct {
+		euid        int
+		xdgDataHome string
+		home        string
+		expected    string
+	}{
+		{0, "/root/.data", "/root", "/var/lib/sentinelgo"},
+		{1000, "/home/dev/.data", "/home/dev", "/home/dev/.data/sentinelgo"},
+		{1000, "", "/home/dev", "/home/dev/.local/share/sentinelgo"},
+		{1000, "relative/data", "/home/dev", "/home/dev/.local/share/sentinelgo"},
+		{1000, "", "", "/var/lib/sentinelgo"},
+	}
+
+	for _, tt := range tests {
+		actual := linuxDataDirectory(tt.euid, tt.xdgDataHome, tt.home)
+		if actual != filepath.FromSlash(tt.expected) {
+			t.Errorf("linuxDataDirectory(%d, %q, %q) = %s; want %s", tt.euid, tt.xdgDataHome, tt.home, actual, tt.expected)
+		}
+	}
+}
+
+// TestGetDataDirectoryUserMode verifies that on Linux only user mode gives
+// users other than root a data directory of their own
+func TestGetDataDirectoryUserMode(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the per-user data directory is Linux only")
+	}
+	systemDir := t.TempDir()
+	home := t.TempDir()
+	ActAs(t, 1000, systemDir)
+	t.Setenv(DataDirectoryEnv, "")
+	t.Setenv(UserModeEnv, "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", home)
+	t.Cleanup(func() { SetUserMode(false) })
+
+	if actual := GetDataDirectory(); actual != systemDir {
+		t.Errorf("GetDataDirectory() = %s; want the system one, %s", actual, systemDir)
+	}
+	userDir := filepath.Join(home, ".local", "share", "sentinelgo")
+	t.Setenv(UserModeEnv, "1")
+	if actual := GetDataDirectory(); actual != userDir {
+		t.Errorf("GetDataDirectory() with %s=1 = %s; want %s", UserModeEnv, actual, userDir)
+	}
+	t.Setenv(UserModeEnv, "")
+	SetUserMode(true)
+	if actual := GetDataDirectory(); actual != userDir {
+		t.Errorf("GetDataDirectory() after SetUserMode = %s; want %s", actual, userDir)
+	}
+}
+
+// TestGetDataDirectoryFromEnvironment verifies that SENTINELGO_DATA_DIR
+// replaces the platform's data directory, and every path derived from it
+// follows, while SetDataDirectory still takes precedence
+func TestGetDataDirectoryFromEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(DataDirectoryEnv, dir)
+	t.Setenv(ConfigPathEnv, "")
+
+	tests := []struct {
+		name     string
+		function func() string
+		expected string
+	}{
+		{"GetDataDirectory", GetDataDirectory, dir},
+		{"GetDatabasePath", GetDatabasePath, filepath.Join(dir, "sentinel.db")},
+		{"GetUpdaterLogPath", GetUpdaterLogPath, filepath.Join(dir, "updater.log")},
+		{"GetAgentLogPath", GetAgentLogPath, filepath.Join(dir, "agent.log")},
+		{"GetUpdaterConfigPath", GetUpdaterConfigPath, filepath.Join(dir, "updater-config.json")},
+		{"GetBackupDirectory", GetBackupDirectory, filepath.Join(dir, "backups")},
+		{"GetBuildBinDirectory", GetBuildBinDirectory, filepath.Join(dir, "build", "bin")},
+	}
+	for _, tt := range tests {
+		if actual := tt.function(); actual != tt.expected {
+			t.Errorf("%s() = %s; want %s", tt.name, actual, tt.expected)
+		}
+	}
+
+	override := t.TempDir()
+	SetDataDirectory(override)
+	defer SetDataDirectory("")
+	if actual := GetDataDirectory(); actual != override {
+		t.Errorf("GetDataDirectory() after SetDataDirectory = %s; want %s", actual, override)
+	}
+}
+
 // TestEnsureDataDirectoryCreation verifies that EnsureDataDirectory creates
-// the directory with proper permissions using os.MkdirAll behavior
+// the directory with 0755 permissions
 func TestEnsureDataDirectoryCreation(t *testing.T) {
-	// Create a temporary directory for testing
-	tempDir := t.TempDir()
-	testDataDir := filepath.Join(tempDir, "test-sentinel-data")
+	testDataDir := filepath.Join(t.TempDir(), "test-sentinel-data")
+	t.Setenv(DataDirectoryEnv, testDataDir)
 
-	// Test directory creation using os.MkdirAll directly (same as EnsureDataDirectory)
-	err := os.MkdirAll(testDataDir, 0755)
-	if err != nil {
-		t.Fatalf("os.MkdirAll() failed: %v", err)
+	if err := EnsureDataDirectory(); err != nil {
+		t.Fatalf("EnsureDataDirectory() failed: %v", err)
 	}
 
 	// Verify directory exists
@@ -126,25 +235,12 @@ func TestEnsureDataDirectoryCreation(t *testing.T) {
 // TestEnsureDataDirectoryWithParents verifies that EnsureDataDirectory creates
 // all parent directories in the path if they don't exist
 func TestEnsureDataDirectoryWithParents(t *testing.T) {
-	// Create a temporary directory for testing
 	tempDir := t.TempDir()
 	testDataDir := filepath.Join(tempDir, "parent1", "parent2", "test-sentinel-data")
+	t.Setenv(DataDirectoryEnv, testDataDir)
 
-	// Test directory creation with multiple parent directories
-	err := os.MkdirAll(testDataDir, 0755)
-	if err != nil {
-		t.Fatalf("os.MkdirAll() failed to create parent directories: %v", err)
-	}
-
-	// Verify directory exists
-	info, err := os.Stat(testDataDir)
-	if err != nil {
-		t.Fatalf("Directory with parents was not created: %v", err)
-	}
-
-	// Verify it's a directory
-	if !info.IsDir() {
-		t.Errorf("Path exists but is not a directory")
+	if err := EnsureDataDirectory(); err != nil {
+		t.Fatalf("EnsureDataDirectory() failed to create parent directories: %v", err)
 	}
 
 	// Verify all parent directories were created
@@ -172,10 +268,11 @@ func TestEnsureDataDirectoryPermissionError(t *testing.T) {
 
 	// Test that directory creation fails with permission error in a protected location
 	protectedPath := "/root/test-sentinel-no-permission"
-	err := os.MkdirAll(protectedPath, 0755)
+	t.Setenv(DataDirectoryEnv, protectedPath)
+	err := EnsureDataDirectory()
 
 	if err == nil {
-		t.Errorf("os.MkdirAll() should fail without sufficient permissions")
+		t.Errorf("EnsureDataDirectory() should fail without sufficient permissions")
 		// Clean up if somehow it succeeded
 		os.RemoveAll(protectedPath)
 	} else {
@@ -192,6 +289,7 @@ func TestEnsureDataDirectoryOnMacOS(t *testing.T) {
 	}
 
 	expectedPath := "/Library/Application Support/SentinelGo"
+	t.Setenv(DataDirectoryEnv, "")
 
 	// Verify GetDataDirectory returns the correct path
 	actualPath := GetDataDirectory()
@@ -236,3 +334,82 @@ func TestEnsureDataDirectoryOnMacOS(t *testing.T) {
 		t.Logf("Successfully created directory at %s with permissions %o", expectedPath, info.Mode().Perm())
 	}
 }
+
+// TestSetUpdaterConfigPath verifies that a configuration file set for
+// --config replaces the default until it is reset
+func TestSetUpdaterConfigPath(t *testing.T) {
+	t.Setenv(ConfigPathEnv, "")
+	defaultPath := GetUpdaterConfigPath()
+	custom := filepath.Join(t.TempDir(), "updater-config.json")
+
+	SetUpdaterConfigPath(custom)
+	defer SetUpdaterConfigPath("")
+	if got := GetUpdaterConfigPath(); got != custom {
+		t.Errorf("GetUpdaterConfigPath() = %s; want %s", got, custom)
+	}
+	SetUpdaterConfigPath("")
+	if got := GetUpdaterConfigPath(); got != defaultPath {
+		t.Errorf("GetUpdaterConfigPath() after reset = %s; want %s", got, defaultPath)
+	}
+}
+
+// TestGetUpdaterConfigPathFromEnvironment verifies that SENTINELGO_CONFIG
+// replaces the configuration file in the data directory, and that
+// SetUpdaterConfigPath takes precedence over it
+func TestGetUpdaterConfigPathFromEnvironment(t *testing.T) {
+	fromEnv := filepath.Join(t.TempDir(), "etc", "updater-config.json")
+	t.Setenv(ConfigPathEnv, fromEnv)
+	if got := GetUpdaterConfigPath(); got != fromEnv {
+		t.Errorf("GetUpdaterConfigPath() = %s; want %s", got, fromEnv)
+	}
+
+	custom := filepath.Join(t.TempDir(), "updater-config.json")
+	SetUpdaterConfigPath(custom)
+	defer SetUpdaterConfigPath("")
+	if got := GetUpdaterConfigPath(); got != custom {
+		t.Errorf("GetUpdaterConfigPath() with --config = %s; want %s", got, custom)
+	}
+	SetUpdaterConfigPath("")
+	if got := GetUpdaterConfigPath(); got != fromEnv {
+		t.Errorf("GetUpdaterConfigPath() after reset = %s; want %s", got, fromEnv)
+	}
+}
+
+// TestGetUpdaterConfigPathYAML verifies that a YAML configuration file in the
+// data directory is used when there is no JSON one, and is reported as
+// ignored when there is
+func TestGetUpdaterConfigPathYAML(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(DataDirectoryEnv, dir)
+	t.Setenv(ConfigPathEnv, "")
+	jsonPath := filepath.Join(dir, "updater-config.json")
+	yamlPath := filepath.Join(dir, "updater-config.yaml")
+
+	if err := os.WriteFile(yamlPath, []byte("channel: beta\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if got := GetUpdaterConfigPath(); got != yamlPath {
+		t.Errorf("GetUpdaterConfigPath() with only YAML = %s; want %s", got, yamlPath)
+	}
+	if ignored := IgnoredUpdaterConfigPaths(); len(ignored) != 0 {
+		t.Errorf("IgnoredUpdaterConfigPaths() = %q; want none", ignored)
+	}
+
+	if err := os.WriteFile(jsonPath, []byte("{}"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if got := GetUpdaterConfigPath(); got != jsonPath {
+		t.Errorf("GetUpdaterConfigPath() with JSON and YAML = %s; want %s", got, jsonPath)
+	}
+	if ignored := IgnoredUpdaterConfigPaths(); len(ignored) != 1 || ignored[0] != yamlPath {
+		t.Errorf("IgnoredUpdaterConfigPaths() = %q; want %s", ignored, yamlPath)
+	}
+
+	t.Setenv(ConfigPathEnv, yamlPath)
+	if got := GetUpdaterConfigPath(); got != yamlPath {
+		t.Errorf("GetUpdaterConfigPath() with SENTINELGO_CONFIG = %s; want %s", got, yamlPath)
+	}
+	if ignored := IgnoredUpdaterConfigPaths(); len(ignored) != 0 {
+		t.Errorf("IgnoredUpdaterConfigPaths() with SENTINELGO_CONFIG = %q; want none", ignored)
+	}
+}
@@ -1,5 +1,11 @@
 package service
 
+import (
+	"context"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
+)
+
 // Manager defines the interface for service management operations
 type Manager interface {
 	// Stop stops the specified service
@@ -19,9 +25,30 @@ type Manager interface {
 
 	// GetServiceBinaryPath returns the path to the service binary
 	GetServiceBinaryPath(serviceName string) (string, error)
+
+	// RecentLogs returns up to lines of the service's most recent output as
+	// recorded by the service manager
+	RecentLogs(serviceName string, lines int) (string, error)
 }
 
 // NewManager creates a platform-specific service manager
 func NewManager() Manager {
-	return newPlatformManager()
+	return NewManagerWithRunner(command.Exec{})
+}
+
+// NewManagerWithRunner creates a platform-specific service manager that runs
+// the platform's service commands, such as systemctl, through runner
+func NewManagerWithRunner(runner command.Runner) Manager {
+	return newPlatformManager(runner)
+}
+
+// runCombined runs name through runner and returns its stdout and stderr
+func runCombined(runner command.Runner, name string, args ...string) ([]byte, error) {
+	return command.Combined(context.Background(), runner, name, args...)
+}
+
+// runOutput runs name through runner and returns its stdout
+func runOutput(runner command.Runner, name string, args ...string) ([]byte, error) {
+	stdout, _, err := runner.Run(context.Background(), name, args, nil, "")
+	return stdout, err
 }
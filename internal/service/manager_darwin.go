@@ -4,14 +4,17 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
 )
 
-type darwinManager struct{}
+type darwinManager struct {
+	runner command.Runner
+}
 
-func newPlatformManager() Manager {
-	return &darwinManager{}
+func newPlatformManager(runner command.Runner) Manager {
+	return &darwinManager{runner: runner}
 }
 
 // plist represents a simplified launchd plist structure
@@ -27,8 +30,7 @@ type dict struct {
 
 // Stop stops the service using launchctl
 func (m *darwinManager) Stop(serviceName string) error {
-	cmd := exec.Command("launchctl", "stop", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "launchctl", "stop", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to stop service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -40,8 +42,7 @@ func (m *darwinManager) Uninstall(serviceName string) error {
 	plistFile := fmt.Sprintf("/Library/LaunchDaemons/%s.plist", serviceName)
 
 	// Unload the service
-	cmd := exec.Command("launchctl", "unload", plistFile)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "launchctl", "unload", plistFile)
 	if err != nil {
 		// Log but don't fail if unload fails (service might not be loaded)
 		fmt.Printf("Warning: failed to unload service %s: %v, output: %s\n", serviceName, err, string(output))
@@ -87,8 +88,7 @@ func (m *darwinManager) Install(serviceName, binaryPath string) error {
 	}
 
 	// Load the service
-	cmd := exec.Command("launchctl", "load", plistFile)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "launchctl", "load", plistFile)
 	if err != nil {
 		return fmt.Errorf("failed to load service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -98,8 +98,7 @@ func (m *darwinManager) Install(serviceName, binaryPath string) error {
 
 // Start starts the service using launchctl
 func (m *darwinManager) Start(serviceName string) error {
-	cmd := exec.Command("launchctl", "start", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "launchctl", "start", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to start service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -108,8 +107,7 @@ func (m *darwinManager) Start(serviceName string) error {
 
 // IsRunning checks if the service is running using launchctl list
 func (m *darwinManager) IsRunning(serviceName string) (bool, error) {
-	cmd := exec.Command("launchctl", "list", serviceName)
-	output, err := cmd.Output()
+	output, err := runOutput(m.runner, "launchctl", "list", serviceName)
 	if err != nil {
 		// Service is not running or not found
 		return false, nil
@@ -175,3 +173,27 @@ func (m *darwinManager) GetServiceBinaryPath(serviceName string) (string, error)
 	binaryPath := content[stringStart : stringStart+stringEnd]
 	return binaryPath, nil
 }
+
+// RecentLogs reads the end of the StandardErrorPath and StandardOutPath files
+// set up by Install, stderr first as crashes are written there
+func (m *darwinManager) RecentLogs(serviceName string, lines int) (string, error) {
+	var sections []string
+	var lastErr error
+	for _, path := range []string{
+		fmt.Sprintf("/var/log/%s.err", serviceName),
+		fmt.Sprintf("/var/log/%s.log", serviceName),
+	} {
+		tail, err := TailFile(path, lines)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if tail != "" {
+			sections = append(sections, path+":\n"+tail)
+		}
+	}
+	if len(sections) == 0 && lastErr != nil {
+		return "", lastErr
+	}
+	return strings.Join(sections, "\n"), nil
+}
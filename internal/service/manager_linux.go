@@ -4,20 +4,23 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
 )
 
-type linuxManager struct{}
+type linuxManager struct {
+	runner command.Runner
+}
 
-func newPlatformManager() Manager {
-	return &linuxManager{}
+func newPlatformManager(runner command.Runner) Manager {
+	return &linuxManager{runner: runner}
 }
 
 // Stop stops the service using systemctl
 func (m *linuxManager) Stop(serviceName string) error {
-	cmd := exec.Command("systemctl", "stop", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "systemctl", "stop", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to stop service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -27,8 +30,7 @@ func (m *linuxManager) Stop(serviceName string) error {
 // Uninstall disables the service and removes the service file
 func (m *linuxManager) Uninstall(serviceName string) error {
 	// Disable the service
-	cmd := exec.Command("systemctl", "disable", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "systemctl", "disable", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to disable service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -40,8 +42,7 @@ func (m *linuxManager) Uninstall(serviceName string) error {
 	}
 
 	// Reload systemd daemon
-	cmd = exec.Command("systemctl", "daemon-reload")
-	if err := cmd.Run(); err != nil {
+	if _, err := runCombined(m.runner, "systemctl", "daemon-reload"); err != nil {
 		return fmt.Errorf("failed to reload systemd daemon: %w", err)
 	}
 
@@ -72,14 +73,12 @@ WantedBy=multi-user.target
 	}
 
 	// Reload systemd daemon
-	cmd := exec.Command("systemctl", "daemon-reload")
-	if err := cmd.Run(); err != nil {
+	if _, err := runCombined(m.runner, "systemctl", "daemon-reload"); err != nil {
 		return fmt.Errorf("failed to reload systemd daemon: %w", err)
 	}
 
 	// Enable the service
-	cmd = exec.Command("systemctl", "enable", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "systemctl", "enable", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to enable service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -89,8 +88,7 @@ WantedBy=multi-user.target
 
 // Start starts the service using systemctl
 func (m *linuxManager) Start(serviceName string) error {
-	cmd := exec.Command("systemctl", "start", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "systemctl", "start", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to start service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -99,8 +97,7 @@ func (m *linuxManager) Start(serviceName string) error {
 
 // IsRunning checks if the service is active using systemctl
 func (m *linuxManager) IsRunning(serviceName string) (bool, error) {
-	cmd := exec.Command("systemctl", "is-active", serviceName)
-	output, err := cmd.Output()
+	output, err := runOutput(m.runner, "systemctl", "is-active", serviceName)
 	if err != nil {
 		// Service is not active, but this is not an error condition
 		return false, nil
@@ -138,3 +135,12 @@ func (m *linuxManager) GetServiceBinaryPath(serviceName string) (string, error)
 
 	return "", fmt.Errorf("ExecStart not found in service file %s", serviceFile)
 }
+
+// RecentLogs reads the service's output from the systemd journal
+func (m *linuxManager) RecentLogs(serviceName string, lines int) (string, error) {
+	output, err := runOutput(m.runner, "journalctl", "-u", serviceName, "-n", strconv.Itoa(lines), "--no-pager", "-o", "cat")
+	if err != nil {
+		return "", fmt.Errorf("failed to read journal for %s: %w", serviceName, err)
+	}
+	return lastLines(string(output), lines), nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+)
+
+// TestLinuxManagerCommands verifies the systemctl and journalctl commands the
+// manager runs and how it reads their output
+func TestLinuxManagerCommands(t *testing.T) {
+	runner := &commandtest.FakeRunner{Results: map[string]commandtest.Result{
+		"systemctl is-active sentinelgo":                  {Stdout: "active\n"},
+		"systemctl is-active other":                       {Stdout: "inactive\n", Err: commandtest.ExitError(3)},
+		"systemctl start other":                           commandtest.Failure("Unit other.service not found."),
+		"journalctl -u sentinelgo -n 2 --no-pager -o cat": {Stdout: "one\ntwo\nthree\n"},
+	}}
+	manager := NewManagerWithRunner(runner)
+
+	if running, err := manager.IsRunning("sentinelgo"); !running || err != nil {
+		t.Errorf("IsRunning(sentinelgo) = %v, %v; want running", running, err)
+	}
+	if running, err := manager.IsRunning("other"); running || err != nil {
+		t.Errorf("IsRunning(other) = %v, %v; want not running", running, err)
+	}
+	if err := manager.Stop("sentinelgo"); err != nil {
+		t.Errorf("Stop() failed: %v", err)
+	}
+	err := manager.Start("other")
+	if !errors.Is(err, commandtest.ExitError(1)) || !strings.Contains(err.Error(), "Unit other.service not found.") {
+		t.Errorf("Start(other) = %v; want the exit status with systemctl's output", err)
+	}
+	if logs, err := manager.RecentLogs("sentinelgo", 2); err != nil || logs != "two\nthree" {
+		t.Errorf("RecentLogs() = %q, %v; want the last two lines", logs, err)
+	}
+
+	want := []string{
+		"systemctl is-active sentinelgo",
+		"systemctl is-active other",
+		"systemctl stop sentinelgo",
+		"systemctl start other",
+		"journalctl -u sentinelgo -n 2 --no-pager -o cat",
+	}
+	if calls := runner.CallLog(); !slices.Equal(calls, want) {
+		t.Errorf("commands = %q; want %q", calls, want)
+	}
+}
@@ -2,20 +2,22 @@ package service
 
 import (
 	"fmt"
-	"os/exec"
 	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
 )
 
-type windowsManager struct{}
+type windowsManager struct {
+	runner command.Runner
+}
 
-func newPlatformManager() Manager {
-	return &windowsManager{}
+func newPlatformManager(runner command.Runner) Manager {
+	return &windowsManager{runner: runner}
 }
 
 // Stop stops the service using sc.exe
 func (m *windowsManager) Stop(serviceName string) error {
-	cmd := exec.Command("sc.exe", "stop", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "sc.exe", "stop", serviceName)
 	if err != nil {
 		outputStr := string(output)
 		// Check if service doesn't exist (error 1060)
@@ -41,8 +43,7 @@ func (m *windowsManager) Stop(serviceName string) error {
 
 // Uninstall removes the service using sc.exe delete
 func (m *windowsManager) Uninstall(serviceName string) error {
-	cmd := exec.Command("sc.exe", "delete", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "sc.exe", "delete", serviceName)
 	if err != nil {
 		// Check if service doesn't exist (error 1060)
 		if strings.Contains(string(output), "1060") {
@@ -57,8 +58,7 @@ func (m *windowsManager) Uninstall(serviceName string) error {
 // Install creates the service using sc.exe create
 func (m *windowsManager) Install(serviceName, binaryPath string) error {
 	// Check if service already exists
-	cmd := exec.Command("sc.exe", "query", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "sc.exe", "query", serviceName)
 
 	if err == nil {
 		// Service exists, stop it first (ignore errors if already stopped)
@@ -72,12 +72,11 @@ func (m *windowsManager) Install(serviceName, binaryPath string) error {
 
 	// Create the service with sc.exe
 	// Note: sc.exe requires space after = for parameters
-	cmd = exec.Command("sc.exe", "create", serviceName,
+	output, err = runCombined(m.runner, "sc.exe", "create", serviceName,
 		fmt.Sprintf("binPath= \"%s\"", binaryPath),
 		"start=", "auto",
 		"DisplayName=", "SentinelGo Agent",
 	)
-	output, err = cmd.CombinedOutput()
 	if err != nil {
 		// Check if service already exists (race condition or deletion didn't complete)
 		if strings.Contains(string(output), "1073") {
@@ -89,11 +88,10 @@ func (m *windowsManager) Install(serviceName, binaryPath string) error {
 	}
 
 	// Configure service to restart on failure
-	cmd = exec.Command("sc.exe", "failure", serviceName,
+	if _, err := runCombined(m.runner, "sc.exe", "failure", serviceName,
 		"reset=", "86400",
 		"actions=", "restart/60000/restart/60000/restart/60000",
-	)
-	if err := cmd.Run(); err != nil {
+	); err != nil {
 		// Log warning but don't fail installation
 		fmt.Printf("Warning: failed to configure service failure actions: %v\n", err)
 	}
@@ -103,8 +101,7 @@ func (m *windowsManager) Install(serviceName, binaryPath string) error {
 
 // Start starts the service using sc.exe
 func (m *windowsManager) Start(serviceName string) error {
-	cmd := exec.Command("sc.exe", "start", serviceName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCombined(m.runner, "sc.exe", "start", serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to start service %s: %w, output: %s", serviceName, err, string(output))
 	}
@@ -113,8 +110,7 @@ func (m *windowsManager) Start(serviceName string) error {
 
 // IsRunning checks if the service is running by parsing sc.exe query output
 func (m *windowsManager) IsRunning(serviceName string) (bool, error) {
-	cmd := exec.Command("sc.exe", "query", serviceName)
-	output, err := cmd.Output()
+	output, err := runOutput(m.runner, "sc.exe", "query", serviceName)
 	if err != nil {
 		// Service not found or error querying
 		return false, nil
@@ -139,8 +135,7 @@ func (m *windowsManager) IsRunning(serviceName string) (bool, error) {
 
 // GetServiceBinaryPath queries the service configuration and parses BINARY_PATH_NAME
 func (m *windowsManager) GetServiceBinaryPath(serviceName string) (string, error) {
-	cmd := exec.Command("sc.exe", "qc", serviceName)
-	output, err := cmd.Output()
+	output, err := runOutput(m.runner, "sc.exe", "qc", serviceName)
 	if err != nil {
 		return "", fmt.Errorf("failed to query service %s: %w", serviceName, err)
 	}
@@ -164,3 +159,14 @@ func (m *windowsManager) GetServiceBinaryPath(serviceName string) (string, error
 
 	return "", fmt.Errorf("BINARY_PATH_NAME not found for service %s", serviceName)
 }
+
+// RecentLogs reads the service's newest Application event log entries,
+// newest first
+func (m *windowsManager) RecentLogs(serviceName string, lines int) (string, error) {
+	query := fmt.Sprintf("*[System[Provider[@Name='%s']]]", serviceName)
+	output, err := runOutput(m.runner, "wevtutil.exe", "qe", "Application", "/q:"+query, fmt.Sprintf("/c:%d", lines), "/rd:true", "/f:text")
+	if err != nil {
+		return "", fmt.Errorf("failed to query event log for %s: %w", serviceName, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,121 @@
+// Package servicetest provides a fake service manager for tests
+package servicetest
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeManager is a service.Manager that keeps services in memory and records
+// the calls that change them, such as "stop sentinelgo" or
+// "install sentinelgo /usr/local/bin/sentinel". A method whose name is a key
+// of Errors, such as "start", fails with that error without changing
+// anything. The zero value has no services.
+type FakeManager struct {
+	mu sync.Mutex
+
+	// Calls are the stop, uninstall, install and start calls, in order
+	Calls []string
+
+	// Binaries maps the installed services to their binaries
+	Binaries map[string]string
+
+	// Running lists the services that are running
+	Running map[string]bool
+
+	// Logs is the recent output of each service
+	Logs map[string]string
+
+	// Errors are returned by the methods named by their keys
+	Errors map[string]error
+}
+
+// record appends call to Calls and returns the error set for method
+func (m *FakeManager) record(method, call string) error {
+	m.Calls = append(m.Calls, call)
+	return m.Errors[method]
+}
+
+// CallLog returns a copy of Calls
+func (m *FakeManager) CallLog() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.Calls...)
+}
+
+func (m *FakeManager) Stop(serviceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("stop", "stop "+serviceName); err != nil {
+		return err
+	}
+	delete(m.Running, serviceName)
+	return nil
+}
+
+func (m *FakeManager) Uninstall(serviceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("uninstall", "uninstall "+serviceName); err != nil {
+		return err
+	}
+	delete(m.Binaries, serviceName)
+	delete(m.Running, serviceName)
+	return nil
+}
+
+func (m *FakeManager) Install(serviceName, binaryPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("install", "install "+serviceName+" "+binaryPath); err != nil {
+		return err
+	}
+	if m.Binaries == nil {
+		m.Binaries = make(map[string]string)
+	}
+	m.Binaries[serviceName] = binaryPath
+	return nil
+}
+
+func (m *FakeManager) Start(serviceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record("start", "start "+serviceName); err != nil {
+		return err
+	}
+	if _, ok := m.Binaries[serviceName]; !ok {
+		return fmt.Errorf("service %s not installed", serviceName)
+	}
+	if m.Running == nil {
+		m.Running = make(map[string]bool)
+	}
+	m.Running[serviceName] = true
+	return nil
+}
+
+func (m *FakeManager) IsRunning(serviceName string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.Errors["isRunning"]; err != nil {
+		return false, err
+	}
+	return m.Running[serviceName], nil
+}
+
+func (m *FakeManager) GetServiceBinaryPath(serviceName string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if binary, ok := m.Binaries[serviceName]; ok {
+		return binary, nil
+	}
+	return "", fmt.Errorf("service %s not installed", serviceName)
+}
+
+func (m *FakeManager) RecentLogs(serviceName string, lines int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.Errors["recentLogs"]; err != nil {
+		return "", err
+	}
+	return m.Logs[serviceName], nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxTailBytes bounds how much of the end of a log file TailFile reads
+const maxTailBytes = 64 * 1024
+
+// TailFile returns up to the last lines lines of the file at path
+func TailFile(path string, lines int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - maxTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek %s: %w", path, err)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return lastLines(string(data), lines), nil
+}
+
+// lastLines returns the last n lines of text, without a trailing newline
+func lastLines(text string, n int) string {
+	all := strings.Split(strings.TrimRight(text, "\r\n"), "\n")
+	if len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return strings.Join(all, "\n")
+}
@@ -0,0 +1,162 @@
+package updater
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// DefaultAgentPackage is the agent's main package, relative to its module
+const DefaultAgentPackage = "cmd/sentinel"
+
+// AgentTarget is the agent the updater builds and installs
+type AgentTarget struct {
+	Module     string
+	Package    string
+	BinaryPath string
+}
+
+// LoadAgentTarget returns the agent target set by the updater configuration
+// file, or the defaults when the file cannot be read
+func LoadAgentTarget() (AgentTarget, error) {
+	config, err := loadConfigPath(paths.GetUpdaterConfigPath())
+	return AgentTarget{
+		Module:     config.AgentModule,
+		Package:    config.agentPackagePath(),
+		BinaryPath: paths.GetAgentBinaryPath(config.AgentBinaryName),
+	}, err
+}
+
+// agentPackagePath returns the import path go install builds the agent from
+func (c *UpdaterConfig) agentPackagePath() string {
+	if c.AgentPackage == "." {
+		return c.AgentModule
+	}
+	return c.AgentModule + "/" + c.AgentPackage
+}
+
+// agentBinaryFileName returns the configured agent binary file name, with the
+// .exe suffix on Windows
+func agentBinaryFileName() string {
+	return paths.BinaryFileName(getConfig().AgentBinaryName)
+}
+
+// agentBinaryPath returns the path the agent binary is installed to
+func agentBinaryPath() string {
+	return paths.GetAgentBinaryPath(getConfig().AgentBinaryName)
+}
+
+// updateTargetPath returns where an update installs the agent whose current
+// binary was found at detected: a configured binary path is replaced in
+// place, while an auto-detected copy elsewhere (such as GOPATH/bin) is
+// replaced by the binary at the system location
+func updateTargetPath(detected string) string {
+	for _, path := range getConfig().configuredBinaryPaths() {
+		if path == detected {
+			return detected
+		}
+	}
+	return agentBinaryPath()
+}
+
+// goInstallBinaryName returns the file name go install gives the binary built
+// from pkg: its last path element, skipping a major version suffix such as /v2
+func goInstallBinaryName(pkg string) string {
+	elements := strings.Split(pkg, "/")
+	name := elements[len(elements)-1]
+	if len(elements) > 1 && isMajorVersionSuffix(name) {
+		name = elements[len(elements)-2]
+	}
+	return paths.BinaryFileName(name)
+}
+
+// isMajorVersionSuffix reports whether element is a module major version
+// suffix such as v2
+func isMajorVersionSuffix(element string) bool {
+	if len(element) < 2 || element[0] != 'v' || element[1] == '0' {
+		return false
+	}
+	for _, r := range element[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return element != "v1"
+}
+
+// validateImportPath checks the elements of a slash-separated module or
+// package path: no empty, "." or ".." elements, and only the characters Go
+// allows in module paths
+func validateImportPath(importPath string) error {
+	for _, element := range strings.Split(importPath, "/") {
+		if element == "" || element == "." || element == ".." {
+			return fmt.Errorf("invalid path element %q", element)
+		}
+		for _, r := range element {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)) {
+				return fmt.Errorf("invalid character %q", r)
+			}
+		}
+	}
+	return nil
+}
+
+// validateModulePath checks that module is a module path go can fetch: a
+// clean path whose first element is a domain name
+func validateModulePath(module string) error {
+	if err := validateImportPath(module); err != nil {
+		return err
+	}
+	if host := strings.Split(module, "/")[0]; !strings.Contains(host, ".") {
+		return fmt.Errorf("first path element %q is not a domain name", host)
+	}
+	return nil
+}
+
+// validatePackagePath checks that pkg is "." or a clean path relative to the
+// module root
+func validatePackagePath(pkg string) error {
+	if pkg == "." {
+		return nil
+	}
+	if path.Clean(pkg) != pkg {
+		return fmt.Errorf("path is not clean")
+	}
+	return validateImportPath(pkg)
+}
+
+// updaterServiceName is the service the updater itself runs as, which must
+// never be mistaken for the agent's
+const updaterServiceName = "sentinelgo-updater"
+
+// serviceNamePattern is what systemd, launchd and the Windows service
+// manager all accept as a service name
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// validateServiceName checks that name can name the agent service on every
+// platform
+func validateServiceName(name string) error {
+	if !serviceNamePattern.MatchString(name) {
+		return fmt.Errorf("must start with a letter or digit and contain only letters, digits, '.', '_', '@' and '-'")
+	}
+	if strings.EqualFold(name, updaterServiceName) {
+		return fmt.Errorf("is the updater's own service")
+	}
+	return nil
+}
+
+// agentServiceName returns the service the agent runs as
+func agentServiceName() string {
+	return getConfig().AgentServiceName
+}
+
+// validateBinaryName checks that name is a plain file name
+func validateBinaryName(name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return fmt.Errorf("must be a file name without path separators")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service"
+)
+
+const (
+	// DefaultAgentLogTailLines is how much agent output a failed
+	// verification reports from each source
+	DefaultAgentLogTailLines = 20
+
+	// maxAgentLogTailLines bounds agentLogTailLines
+	maxAgentLogTailLines = 200
+)
+
+// agentOutputTail returns the last lines of the agent log file and of the
+// service output kept by the service manager, each labelled with its source
+func agentOutputTail(agentLogPath string, lines int) string {
+	if lines <= 0 {
+		return ""
+	}
+
+	var sections []string
+	if tail, err := service.TailFile(agentLogPath, lines); err == nil && tail != "" {
+		sections = append(sections, agentLogPath+":\n"+tail)
+	}
+	if tail, err := serviceManager.RecentLogs(agentServiceName(), lines); err != nil {
+		LogDebug("Cannot read the agent's service output: %v", err)
+	} else if tail != "" {
+		sections = append(sections, "service output:\n"+tail)
+	}
+	return strings.Join(sections, "\n")
+}
+
+// withAgentOutput logs the agent's recent output and adds it to err, so a
+// rollback after a crash on startup says why the agent stopped
+func withAgentOutput(err error) error {
+	tail := agentOutputTail(paths.GetAgentLogPath(), getConfig().AgentLogTailLines)
+	if tail == "" {
+		return err
+	}
+
+	LogError("Recent agent output:")
+	for _, line := range strings.Split(tail, "\n") {
+		LogError("  %s", line)
+	}
+	return fmt.Errorf("%w\nrecent agent output:\n%s", err, tail)
+}
@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAgentOutputTail verifies that only the last lines of the agent log are
+// reported, and nothing when the tail is disabled
+func TestAgentOutputTail(t *testing.T) {
+	var content strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	agentLogPath := filepath.Join(t.TempDir(), "agent.log")
+	if err := os.WriteFile(agentLogPath, []byte(content.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tail := agentOutputTail(agentLogPath, 5)
+	if !strings.Contains(tail, agentLogPath+":\nline 26\nline 27\nline 28\nline 29\nline 30") {
+		t.Errorf("agentOutputTail() = %q; want the last 5 lines of the agent log", tail)
+	}
+	if strings.Contains(tail, "line 25\n") {
+		t.Errorf("agentOutputTail() = %q; want no more than 5 lines", tail)
+	}
+
+	if tail := agentOutputTail(agentLogPath, 0); tail != "" {
+		t.Errorf("agentOutputTail(0) = %q; want empty", tail)
+	}
+}
+
+// TestLoadConfigPathAgentLogTailLines verifies that the tail length is bounded
+func TestLoadConfigPathAgentLogTailLines(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "updater-config.json")
+	if err := os.WriteFile(configPath, []byte(`{"agentLogTailLines": 100000}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := loadConfigPath(configPath)
+	if err != nil {
+		t.Fatalf("loadConfigPath() failed: %v", err)
+	}
+	if config.AgentLogTailLines != maxAgentLogTailLines {
+		t.Errorf("AgentLogTailLines = %d; want %d", config.AgentLogTailLines, maxAgentLogTailLines)
+	}
+}
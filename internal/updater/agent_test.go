@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// TestLoadConfigPathAgentTarget verifies that a fork's module, package and
+// binary name are used and that invalid values fall back to the defaults
+func TestLoadConfigPathAgentTarget(t *testing.T) {
+	tests := []struct {
+		content     string
+		wantPackage string
+		wantBinary  string
+	}{
+		{`{}`, MainAgentModule + "/cmd/sentinel", "sentinel"},
+		{`{"agentModule": "git.example.com/acme/guard", "agentPackage": "cmd/guardd", "agentBinaryName": "guardd"}`, "git.example.com/acme/guard/cmd/guardd", "guardd"},
+		{`{"agentModule": "git.example.com/acme/guard/v2", "agentPackage": "."}`, "git.example.com/acme/guard/v2", "sentinel"},
+		{`{"agentModule": "not a module", "agentPackage": "../cmd", "agentBinaryName": "bin/guardd"}`, MainAgentModule + "/cmd/sentinel", "sentinel"},
+		{`{"agentModule": "localmodule/agent"}`, MainAgentModule + "/cmd/sentinel", "sentinel"},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		if got := config.agentPackagePath(); got != tt.wantPackage {
+			t.Errorf("loadConfigPath(%s).agentPackagePath() = %q; want %q", tt.content, got, tt.wantPackage)
+		}
+		if config.AgentBinaryName != tt.wantBinary {
+			t.Errorf("loadConfigPath(%s).AgentBinaryName = %q; want %q", tt.content, config.AgentBinaryName, tt.wantBinary)
+		}
+	}
+}
+
+// TestLoadConfigPathAgentServiceName verifies that a valid agent service
+// name is used and that an invalid one, or the updater's own, is not
+func TestLoadConfigPathAgentServiceName(t *testing.T) {
+	tests := map[string]string{
+		`{}`:                                  MainAgentServiceName,
+		`{"agentServiceName": "guard-agent"}`: "guard-agent",
+		`{"agentServiceName": "guard agent; reboot"}`: MainAgentServiceName,
+		`{"agentServiceName": "SentinelGo-Updater"}`:  MainAgentServiceName,
+	}
+
+	for content, want := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		writeLog(t, configPath, content)
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", content, err)
+		}
+		if config.AgentServiceName != want {
+			t.Errorf("loadConfigPath(%s).AgentServiceName = %q; want %q", content, config.AgentServiceName, want)
+		}
+	}
+}
+
+// TestAutoDetectFromServiceConfig verifies that the agent binary is found in
+// the configuration of the configured service, not of "sentinelgo"
+func TestAutoDetectFromServiceConfig(t *testing.T) {
+	withConfig(t, &UpdaterConfig{AgentBinaryName: "guardd", AgentServiceName: "guard-agent"})
+	if _, err := os.Stat(agentBinaryPath()); err == nil {
+		t.Skipf("an agent is installed at %s", agentBinaryPath())
+	}
+	binary := filepath.Join(t.TempDir(), "guardd")
+	writeLog(t, binary, "")
+	useServiceManager(t, &servicetest.FakeManager{Binaries: map[string]string{
+		MainAgentServiceName: filepath.Join(t.TempDir(), "missing"),
+		"guard-agent":        binary,
+	}})
+
+	path, method, err := autoDetectMainAgentBinaryPath()
+	if err != nil || path != binary || method != "service_configuration" {
+		t.Errorf("autoDetectMainAgentBinaryPath() = %q, %q, %v; want %q from the service configuration", path, method, err, binary)
+	}
+}
+
+// TestGoInstallBinaryName verifies the binary name go install derives from a
+// package path
+func TestGoInstallBinaryName(t *testing.T) {
+	tests := map[string]string{
+		MainAgentModule + "/cmd/sentinel": "sentinel",
+		"git.example.com/acme/guard/v2":   "guard",
+		"git.example.com/acme/v1":         "v1",
+	}
+
+	for pkg, want := range tests {
+		if got := goInstallBinaryName(pkg); got != paths.BinaryFileName(want) {
+			t.Errorf("goInstallBinaryName(%q) = %q; want %q", pkg, got, paths.BinaryFileName(want))
+		}
+	}
+}
+
+// TestUpdateTargetPath verifies that a configured binary path is updated in
+// place and an auto-detected copy elsewhere is replaced at the system location
+func TestUpdateTargetPath(t *testing.T) {
+	configured := filepath.Join(t.TempDir(), "sentinel")
+	config := defaultConfig()
+	config.BinaryPaths = []string{"/opt/sentinel/bin/sentinel", configured}
+	withConfig(t, config)
+
+	if got := updateTargetPath(configured); got != configured {
+		t.Errorf("updateTargetPath(configured) = %s; want %s", got, configured)
+	}
+	gopathCopy := filepath.Join(t.TempDir(), "go", "bin", "sentinel")
+	if got, want := updateTargetPath(gopathCopy), agentBinaryPath(); got != want {
+		t.Errorf("updateTargetPath(GOPATH copy) = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// artifactIndexFileName lists the cached binaries inside the cache directory
+	artifactIndexFileName = "index.json"
+
+	// DefaultArtifactCacheMaxMB bounds the total size of cached agent binaries
+	DefaultArtifactCacheMaxMB = 512
+
+	// DefaultArtifactCacheMaxAgeDays is how long a cached agent binary is kept
+	DefaultArtifactCacheMaxAgeDays = 30
+)
+
+// CachedArtifact describes a compiled agent binary kept for re-installs
+type CachedArtifact struct {
+	Package   string    `json:"package"`
+	Version   string    `json:"version"`
+	GOOS      string    `json:"goos"`
+	GOARCH    string    `json:"goarch"`
+	BuildMode string    `json:"buildMode"`
+	Path      string    `json:"path"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// artifactCacheDir returns the directory compiled binaries are cached in
+func artifactCacheDir(dataDir string) string {
+	return filepath.Join(dataDir, "build", "cache")
+}
+
+// matches reports whether the artifact was built from pkg at version for this
+// platform in buildMode
+func (a *CachedArtifact) matches(pkg, version, buildMode string) bool {
+	return a.Package == pkg && a.Version == version && a.BuildMode == buildMode &&
+		a.GOOS == runtime.GOOS && a.GOARCH == runtime.GOARCH
+}
+
+// cacheableBuildModes returns the build modes a build in cgoMode may produce,
+// in the order they are preferred: auto builds pure Go unless the agent needs
+// CGO
+func cacheableBuildModes(cgoMode CGOMode) []string {
+	switch cgoMode {
+	case CGOModeTrue:
+		return []string{BuildModeCGO}
+	case CGOModeFalse:
+		return []string{BuildModePureGo}
+	}
+	return []string{BuildModePureGo, BuildModeCGO}
+}
+
+func loadArtifactIndex(cacheDir string) ([]CachedArtifact, error) {
+	var artifacts []CachedArtifact
+	if _, err := readJSONFile(filepath.Join(cacheDir, artifactIndexFileName), &artifacts); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+func saveArtifactIndex(cacheDir string, artifacts []CachedArtifact) error {
+	return writeJSONFile(filepath.Join(cacheDir, artifactIndexFileName), artifacts)
+}
+
+// artifactFileName builds the cache file name of a binary
+func artifactFileName(pkg, version, buildMode string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' || r == '@' {
+			return '_'
+		}
+		return r
+	}, fmt.Sprintf("%s@%s-%s-%s-%s", pkg, version, runtime.GOOS, runtime.GOARCH, buildMode))
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// lookupArtifact returns a cached binary of pkg at version in one of
+// buildModes whose checksum still matches, or nil on a miss. A corrupted
+// entry is dropped.
+func lookupArtifact(dataDir, pkg, version string, buildModes []string) *CachedArtifact {
+	cacheDir := artifactCacheDir(dataDir)
+	artifacts, err := loadArtifactIndex(cacheDir)
+	if err != nil {
+		LogWarning("Build cache index unreadable: %v", err)
+		return nil
+	}
+
+	for _, mode := range buildModes {
+		for i := range artifacts {
+			artifact := artifacts[i]
+			if !artifact.matches(pkg, version, mode) {
+				continue
+			}
+			if err := verifyChecksum(artifact.Path, artifact.SHA256); err != nil {
+				LogWarning("Dropping cached build of %s: %v", version, err)
+				os.Remove(artifact.Path)
+				artifacts = append(artifacts[:i], artifacts[i+1:]...)
+				if err := saveArtifactIndex(cacheDir, artifacts); err != nil {
+					LogWarning("Failed to update build cache index: %v", err)
+				}
+				return nil
+			}
+			return &artifact
+		}
+	}
+	return nil
+}
+
+// storeArtifact copies the binary built from pkg at version into the cache,
+// replacing an earlier build of the same key, and prunes the cache
+func storeArtifact(dataDir, pkg, version, buildMode, binaryPath string, maxBytes int64, maxAge time.Duration) error {
+	cacheDir := artifactCacheDir(dataDir)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create build cache: %w", err)
+	}
+
+	cachedPath := filepath.Join(cacheDir, artifactFileName(pkg, version, buildMode))
+	if err := copyFileStreaming(binaryPath, cachedPath); err != nil {
+		return fmt.Errorf("failed to copy binary into build cache: %w", err)
+	}
+	checksum, err := fileSHA256(cachedPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash cached binary: %w", err)
+	}
+	info, err := os.Stat(cachedPath)
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := loadArtifactIndex(cacheDir)
+	if err != nil {
+		LogWarning("Build cache index unreadable, starting a new one: %v", err)
+		artifacts = nil
+	}
+
+	kept := []CachedArtifact{{
+		Package:   pkg,
+		Version:   version,
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		BuildMode: buildMode,
+		Path:      cachedPath,
+		SHA256:    checksum,
+		Size:      info.Size(),
+		CreatedAt: now(),
+	}}
+	for _, artifact := range artifacts {
+		if artifact.Path != cachedPath {
+			kept = append(kept, artifact)
+		}
+	}
+
+	return saveArtifactIndex(cacheDir, pruneArtifacts(kept, maxBytes, maxAge))
+}
+
+// pruneArtifacts deletes cached binaries older than maxAge, then the oldest
+// ones until the rest fit in maxBytes, and returns the artifacts kept. The
+// newest artifact is always kept.
+func pruneArtifacts(artifacts []CachedArtifact, maxBytes int64, maxAge time.Duration) []CachedArtifact {
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].CreatedAt.After(artifacts[j].CreatedAt)
+	})
+
+	var kept []CachedArtifact
+	var total int64
+	for i, artifact := range artifacts {
+		total += artifact.Size
+		if i > 0 && (now().Sub(artifact.CreatedAt) > maxAge || total > maxBytes) {
+			if err := os.Remove(artifact.Path); err != nil && !os.IsNotExist(err) {
+				LogWarning("Failed to prune cached build %s: %v", artifact.Path, err)
+			} else {
+				LogInfo("Pruned cached build of %s: %s", artifact.Version, artifact.Path)
+			}
+			total -= artifact.Size
+			continue
+		}
+		kept = append(kept, artifact)
+	}
+	return kept
+}
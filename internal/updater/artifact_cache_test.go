@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestArtifactCacheLookup verifies that a stored build is found for its
+// version and build mode only, and that a corrupted one is dropped
+func TestArtifactCacheLookup(t *testing.T) {
+	fakeClock(t)
+	dataDir := t.TempDir()
+	binary := filepath.Join(t.TempDir(), "sentinel")
+	writeLog(t, binary, "binary v1.2.0")
+
+	if err := storeArtifact(dataDir, "example.com/agent", "v1.2.0", BuildModePureGo, binary, 1<<20, time.Hour); err != nil {
+		t.Fatalf("storeArtifact() failed: %v", err)
+	}
+
+	tests := []struct {
+		version string
+		modes   []string
+		want    bool
+	}{
+		{"v1.2.0", cacheableBuildModes(CGOModeAuto), true},
+		{"v1.2.0", cacheableBuildModes(CGOModeFalse), true},
+		{"v1.2.0", cacheableBuildModes(CGOModeTrue), false},
+		{"v1.1.0", cacheableBuildModes(CGOModeAuto), false},
+	}
+	for _, tt := range tests {
+		if got := lookupArtifact(dataDir, "example.com/agent", tt.version, tt.modes); (got != nil) != tt.want {
+			t.Errorf("lookupArtifact(%s, %v) = %v; want hit %v", tt.version, tt.modes, got, tt.want)
+		}
+	}
+
+	artifact := lookupArtifact(dataDir, "example.com/agent", "v1.2.0", []string{BuildModePureGo})
+	writeLog(t, artifact.Path, "truncated")
+	if got := lookupArtifact(dataDir, "example.com/agent", "v1.2.0", []string{BuildModePureGo}); got != nil {
+		t.Errorf("lookupArtifact() of a corrupted build = %v; want nil", got)
+	}
+	if artifacts, _ := loadArtifactIndex(artifactCacheDir(dataDir)); len(artifacts) != 0 {
+		t.Errorf("index after corruption = %v; want empty", artifacts)
+	}
+}
+
+// TestPruneArtifacts verifies that builds past the maximum age and the oldest
+// builds over the size limit are deleted, but never the newest
+func TestPruneArtifacts(t *testing.T) {
+	clock := fakeClock(t)
+	dir := t.TempDir()
+
+	var artifacts []CachedArtifact
+	for i, age := range []time.Duration{0, time.Hour, 2 * time.Hour, 48 * time.Hour} {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		writeLog(t, path, "1234")
+		artifacts = append(artifacts, CachedArtifact{Path: path, Size: 4, CreatedAt: clock.Add(-age)})
+	}
+
+	kept := pruneArtifacts(artifacts, 8, 24*time.Hour)
+	if len(kept) != 2 || kept[0].Path != filepath.Join(dir, "a") || kept[1].Path != filepath.Join(dir, "b") {
+		t.Errorf("pruneArtifacts() kept %v; want the two newest", kept)
+	}
+	for _, name := range []string{"c", "d"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("pruned build %s still exists", name)
+		}
+	}
+
+	if kept := pruneArtifacts(artifacts[3:], 1, time.Hour); len(kept) != 1 {
+		t.Errorf("pruneArtifacts() of one oversized build kept %d; want 1", len(kept))
+	}
+}
+
+// TestDownloadAndCompileUsesCache verifies that a second build of the same
+// version is served from the cache, that the decision is logged, and that
+// useCache false compiles again
+func TestDownloadAndCompileUsesCache(t *testing.T) {
+	_, installs := useFakeGo(t)
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	useTestLog(t, logPath, 1<<20, 3)
+
+	config := defaultConfig()
+	config.CGOEnabled = CGOModeFalse
+	withConfig(t, config)
+
+	dataDir := t.TempDir()
+	for i, useCache := range []bool{true, true, false} {
+		compiled, _, err := downloadAndCompile(dataDir, "v1.2.0", useCache)
+		if err != nil {
+			t.Fatalf("downloadAndCompile() #%d failed: %v", i+1, err)
+		}
+		if data, err := os.ReadFile(compiled); err != nil || !strings.HasSuffix(string(data), "compiled") {
+			t.Errorf("downloadAndCompile() #%d binary = %q, %v; want the compiled binary", i+1, data, err)
+		}
+	}
+
+	if got := installs(); got != 2 {
+		t.Errorf("go install ran %d times; want 2", got)
+	}
+	logged, _ := os.ReadFile(logPath)
+	for _, want := range []string{"Build cache miss", "Build cache hit", "Build cache bypassed"} {
+		if !strings.Contains(string(logged), want) {
+			t.Errorf("log does not contain %q", want)
+		}
+	}
+}
+
+// TestDownloadAndCompileCacheDisabled verifies that artifactCacheMaxMB 0
+// always compiles and stores nothing
+func TestDownloadAndCompileCacheDisabled(t *testing.T) {
+	_, installs := useFakeGo(t)
+	config := defaultConfig()
+	config.CGOEnabled = CGOModeFalse
+	config.ArtifactCacheMaxMB = 0
+	withConfig(t, config)
+
+	dataDir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		if _, _, err := downloadAndCompile(dataDir, "v1.2.0", true); err != nil {
+			t.Fatalf("downloadAndCompile() failed: %v", err)
+		}
+	}
+	if got := installs(); got != 2 {
+		t.Errorf("go install ran %d times; want 2", got)
+	}
+	if _, err := os.Stat(artifactCacheDir(dataDir)); !os.IsNotExist(err) {
+		t.Errorf("build cache created with the cache disabled")
+	}
+}
@@ -0,0 +1,178 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+const (
+	// peSecurityDirectory is the data directory holding a PE file's
+	// Authenticode signatures; its address is a file offset, not an RVA
+	peSecurityDirectory = 4
+
+	// winCertTypePKCSSignedData marks a WIN_CERTIFICATE holding a PKCS#7
+	// SignedData structure
+	winCertTypePKCSSignedData = 0x0002
+)
+
+// pkcs7ContentInfo, pkcs7SignedData and pkcs7SignerInfo decode only what is
+// needed to find the certificate an Authenticode signature was made with
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     pkcs7RawCertificates `asn1:"optional,tag:0"`
+	CRLs             []asn1.RawValue      `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo    `asn1:"set"`
+}
+
+type pkcs7RawCertificates struct {
+	Raw asn1.RawContent
+}
+
+type pkcs7SignerInfo struct {
+	Version         int
+	IssuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+}
+
+// readAuthenticodeSignature returns the PKCS#7 SignedData embedded in the PE
+// file at path
+func readAuthenticodeSignature(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := pe.NewFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a PE file: %w", path, err)
+	}
+	var directory pe.DataDirectory
+	switch header := image.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		directory = header.DataDirectory[peSecurityDirectory]
+	case *pe.OptionalHeader64:
+		directory = header.DataDirectory[peSecurityDirectory]
+	}
+	if directory.Size == 0 {
+		return nil, fmt.Errorf("%s is not signed", path)
+	}
+
+	table := make([]byte, directory.Size)
+	if _, err := file.ReadAt(table, int64(directory.VirtualAddress)); err != nil {
+		return nil, fmt.Errorf("failed to read the signature of %s: %w", path, err)
+	}
+
+	// WIN_CERTIFICATE entries: length, revision and type, then the data,
+	// each padded to 8 bytes
+	for len(table) >= 8 {
+		length := binary.LittleEndian.Uint32(table[0:4])
+		certType := binary.LittleEndian.Uint16(table[6:8])
+		if length < 8 || int(length) > len(table) {
+			break
+		}
+		if certType == winCertTypePKCSSignedData {
+			return table[8:length], nil
+		}
+		next := (int(length) + 7) &^ 7
+		if next > len(table) {
+			break
+		}
+		table = table[next:]
+	}
+	return nil, fmt.Errorf("%s has no PKCS#7 signature", path)
+}
+
+// authenticodeSigner returns the certificate the Authenticode signature of
+// the PE file at path was made with. It does not verify the signature; on
+// Windows WinVerifyTrust does that.
+func authenticodeSigner(path string) (*x509.Certificate, error) {
+	signature, err := readAuthenticodeSignature(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var content pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(signature, &content); err != nil {
+		return nil, fmt.Errorf("malformed signature in %s: %w", path, err)
+	}
+	var signed pkcs7SignedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signed); err != nil {
+		return nil, fmt.Errorf("malformed signature in %s: %w", path, err)
+	}
+	if len(signed.SignerInfos) == 0 {
+		return nil, fmt.Errorf("signature in %s has no signer", path)
+	}
+
+	var certificates asn1.RawValue
+	if _, err := asn1.Unmarshal(signed.Certificates.Raw, &certificates); err != nil {
+		return nil, fmt.Errorf("signature in %s carries no certificates: %w", path, err)
+	}
+	certs, err := x509.ParseCertificates(certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("malformed certificate in the signature of %s: %w", path, err)
+	}
+
+	signer := signed.SignerInfos[0].IssuerAndSerial
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, signer.Issuer.FullBytes) && signer.Serial != nil && cert.SerialNumber.Cmp(signer.Serial) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("the signing certificate is missing from the signature of %s", path)
+}
+
+// certificateThumbprint returns the SHA-1 thumbprint of cert in upper-case
+// hex, as Windows displays it
+func certificateThumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// normalizeSignerIdentity makes a configured Team ID or thumbprint comparable,
+// ignoring case and the spaces or colons thumbprints are often copied with
+func normalizeSignerIdentity(identity string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", ":", "").Replace(strings.TrimSpace(identity)))
+}
+
+// trustedSigner reports whether identity is one of trusted
+func trustedSigner(identity string, trusted []string) bool {
+	identity = normalizeSignerIdentity(identity)
+	for _, entry := range trusted {
+		if identity != "" && normalizeSignerIdentity(entry) == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAuthenticode checks the Authenticode signature of the binary at path
+// and returns the thumbprint of its signing certificate
+func verifyAuthenticode(path string) (string, error) {
+	if err := winVerifyTrust(path); err != nil {
+		return "", fmt.Errorf("WinVerifyTrust: %w", err)
+	}
+	signer, err := authenticodeSigner(path)
+	if err != nil {
+		return "", err
+	}
+	return certificateThumbprint(signer), nil
+}
@@ -0,0 +1,170 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/x509"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// authenticodeSignature builds a PKCS#7 SignedData naming cert as its signer,
+// with enough structure for authenticodeSigner but no real signature
+func authenticodeSignature(t *testing.T, cert *x509.Certificate) []byte {
+	t.Helper()
+
+	mustMarshal := func(value interface{}) []byte {
+		encoded, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatalf("failed to encode signature: %v", err)
+		}
+		return encoded
+	}
+	set := func(content []byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: content}
+	}
+
+	signerInfo := mustMarshal(struct {
+		Version         int
+		IssuerAndSerial struct {
+			Issuer asn1.RawValue
+			Serial *big.Int
+		}
+		DigestAlgorithm asn1.RawValue
+	}{
+		Version: 1,
+		IssuerAndSerial: struct {
+			Issuer asn1.RawValue
+			Serial *big.Int
+		}{asn1.RawValue{FullBytes: cert.RawIssuer}, cert.SerialNumber},
+		DigestAlgorithm: asn1.RawValue{FullBytes: mustMarshal(struct{ Algorithm asn1.ObjectIdentifier }{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}})},
+	})
+	signedData := mustMarshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: set(nil),
+		ContentInfo:      asn1.RawValue{FullBytes: mustMarshal(struct{ Type asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}})},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos:      set(signerInfo),
+	})
+	return mustMarshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// writeSignedPE writes a 64-bit PE file whose security directory holds
+// signature, or no security directory when signature is nil
+func writeSignedPE(t *testing.T, path string, signature []byte) {
+	t.Helper()
+
+	const peOffset = 0x80
+	var buf bytes.Buffer
+	buf.WriteString("MZ")
+	buf.Write(make([]byte, 0x3c-buf.Len()))
+	binary.Write(&buf, binary.LittleEndian, uint32(peOffset))
+	buf.Write(make([]byte, peOffset-buf.Len()))
+	buf.WriteString("PE\x00\x00")
+
+	optional := pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		SizeOfOptionalHeader: uint16(binary.Size(optional)),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE,
+	})
+	certTable := buf.Len() + binary.Size(optional)
+	if signature != nil {
+		optional.DataDirectory[peSecurityDirectory] = pe.DataDirectory{
+			VirtualAddress: uint32(certTable),
+			Size:           uint32(8 + len(signature)),
+		}
+	}
+	binary.Write(&buf, binary.LittleEndian, optional)
+	if signature != nil {
+		binary.Write(&buf, binary.LittleEndian, uint32(8+len(signature)))
+		binary.Write(&buf, binary.LittleEndian, uint16(0x0200))
+		binary.Write(&buf, binary.LittleEndian, uint16(winCertTypePKCSSignedData))
+		buf.Write(signature)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatalf("failed to write PE file: %v", err)
+	}
+}
+
+// TestAuthenticodeSigner verifies that the signing certificate is read from
+// the security directory of a PE file, and that an unsigned file is reported
+func TestAuthenticodeSigner(t *testing.T) {
+	dir := t.TempDir()
+	_, _, cert := writeClientCertificate(t, dir)
+
+	signed := filepath.Join(dir, "sentinel.exe")
+	writeSignedPE(t, signed, authenticodeSignature(t, cert))
+	signer, err := authenticodeSigner(signed)
+	if err != nil {
+		t.Fatalf("authenticodeSigner() failed: %v", err)
+	}
+	if got, want := certificateThumbprint(signer), certificateThumbprint(cert); got != want {
+		t.Errorf("authenticodeSigner() thumbprint = %s; want %s", got, want)
+	}
+
+	unsigned := filepath.Join(dir, "unsigned.exe")
+	writeSignedPE(t, unsigned, nil)
+	if _, err := authenticodeSigner(unsigned); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("authenticodeSigner(unsigned) = %v; want a not signed error", err)
+	}
+}
+
+// TestCheckCodeSignatureWindows verifies that under the enforce policy a
+// binary is refused when WinVerifyTrust rejects it or its signer is not
+// trusted, and accepted when the thumbprint is listed in any common format
+func TestCheckCodeSignatureWindows(t *testing.T) {
+	dir := t.TempDir()
+	_, _, cert := writeClientCertificate(t, dir)
+	binary := filepath.Join(dir, "sentinel.exe")
+	writeSignedPE(t, binary, authenticodeSignature(t, cert))
+
+	var trustErr error
+	original := winVerifyTrust
+	winVerifyTrust = func(path string) error { return trustErr }
+	t.Cleanup(func() { winVerifyTrust = original })
+
+	thumbprint := certificateThumbprint(cert)
+	var spaced []string
+	for i := 0; i < len(thumbprint); i += 2 {
+		spaced = append(spaced, strings.ToLower(thumbprint[i:i+2]))
+	}
+
+	if err := checkCodeSignature("windows", binary, CodesignEnforce, []string{strings.Join(spaced, " ")}); err != nil {
+		t.Errorf("checkCodeSignature(trusted signer) = %v; want nil", err)
+	}
+	if err := checkCodeSignature("windows", binary, CodesignEnforce, nil); err != nil {
+		t.Errorf("checkCodeSignature(no trusted signers) = %v; want nil", err)
+	}
+
+	err := checkCodeSignature("windows", binary, CodesignEnforce, []string{strings.Repeat("AB", 20)})
+	if code := ErrorCodeOf(err); code != ErrCodeCodeSignature || !strings.Contains(err.Error(), thumbprint) {
+		t.Errorf("checkCodeSignature(untrusted signer) = %v; want %s naming %s", err, ErrCodeCodeSignature, thumbprint)
+	}
+	if err := checkCodeSignature("windows", binary, CodesignWarn, []string{strings.Repeat("AB", 20)}); err != nil {
+		t.Errorf("checkCodeSignature(warn, untrusted signer) = %v; want nil", err)
+	}
+
+	trustErr = errors.New("The digital signature of the object did not verify.")
+	if code := ErrorCodeOf(checkCodeSignature("windows", binary, CodesignEnforce, nil)); code != ErrCodeCodeSignature {
+		t.Errorf("checkCodeSignature(WinVerifyTrust failure) code = %q; want %s", code, ErrCodeCodeSignature)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package updater
+
+import "errors"
+
+// winVerifyTrust is only available on Windows; it is a variable so tests can
+// replace it
+var winVerifyTrust = func(path string) error {
+	return errors.New("Authenticode signatures can only be verified on Windows")
+}
@@ -0,0 +1,295 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+const (
+	// backupIndexFileName lists the retained backups inside the backup directory
+	backupIndexFileName = "index.json"
+
+	// DefaultBackupRetention is the number of previous agent binaries kept for manual rollback
+	DefaultBackupRetention = 3
+)
+
+// RetainedBackup describes a previous agent binary kept in the backup directory
+type RetainedBackup struct {
+	Version   string    `json:"version"`
+	Path      string    `json:"path"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyChecksum checks that the file at path has the SHA-256 checksum want
+func verifyChecksum(path, want string) error {
+	got, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", path, want, got)
+	}
+	return nil
+}
+
+// writeVerifiedBackup copies the binary at binaryPath to backupPath and reads
+// the copy back, so a truncated or partially written backup fails the update
+// instead of the rollback. It returns the checksum of the binary.
+func writeVerifiedBackup(binaryPath, backupPath string) (string, error) {
+	binaryData, err := os.ReadFile(binaryPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read current binary: %w", err)
+	}
+	sum := sha256.Sum256(binaryData)
+	checksum := hex.EncodeToString(sum[:])
+
+	if err := os.WriteFile(backupPath, binaryData, 0755); err != nil {
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := verifyChecksum(backupPath, checksum); err != nil {
+		os.Remove(backupPath)
+		return "", fmt.Errorf("backup is not a faithful copy of the current binary: %w", err)
+	}
+	return checksum, nil
+}
+
+// loadBackupIndex returns the retained backups, newest first
+func loadBackupIndex(backupDir string) ([]RetainedBackup, error) {
+	var backups []RetainedBackup
+	if _, err := readJSONFile(filepath.Join(backupDir, backupIndexFileName), &backups); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+func saveBackupIndex(backupDir string, backups []RetainedBackup) error {
+	return writeJSONFile(filepath.Join(backupDir, backupIndexFileName), backups)
+}
+
+// retainedBackupFileName builds a file name for a retained binary of the given version
+func retainedBackupFileName(version string, createdAt time.Time) string {
+	safeVersion := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, version)
+
+	name := fmt.Sprintf("sentinel-%s-%s", safeVersion, createdAt.Format("20060102-150405"))
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// retainBackup moves the backup of the replaced binary into the backup directory
+// and prunes the directory down to keep entries
+func retainBackup(backupDir string, backup *BackupInfo, keep int) error {
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	checksum := backup.SHA256
+	if checksum == "" {
+		var err error
+		if checksum, err = fileSHA256(backup.BackupPath); err != nil {
+			return fmt.Errorf("failed to hash backup %s: %w", backup.BackupPath, err)
+		}
+	}
+
+	createdAt := backup.Timestamp
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	retainedPath := filepath.Join(backupDir, retainedBackupFileName(backup.Version, createdAt))
+	if err := moveFile(backup.BackupPath, retainedPath); err != nil {
+		return fmt.Errorf("failed to move backup into %s: %w", backupDir, err)
+	}
+
+	backups, err := loadBackupIndex(backupDir)
+	if err != nil {
+		LogWarning("Backup index unreadable, starting a new one: %v", err)
+		backups = nil
+	}
+
+	backups = append([]RetainedBackup{{
+		Version:   backup.Version,
+		Path:      retainedPath,
+		SHA256:    checksum,
+		CreatedAt: createdAt,
+	}}, backups...)
+
+	if keep < 1 {
+		keep = 1
+	}
+	for len(backups) > keep {
+		oldest := backups[len(backups)-1]
+		if err := os.Remove(oldest.Path); err != nil && !os.IsNotExist(err) {
+			LogWarning("Failed to prune old backup %s: %v", oldest.Path, err)
+		} else {
+			LogInfo("Pruned old backup of version %s: %s", oldest.Version, oldest.Path)
+		}
+		backups = backups[:len(backups)-1]
+	}
+
+	if err := saveBackupIndex(backupDir, backups); err != nil {
+		return err
+	}
+
+	LogInfo("Retained backup of version %s at %s", backup.Version, retainedPath)
+	return nil
+}
+
+// moveFile renames src to dst, falling back to copy and delete across filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, data, 0755); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// selectBackup picks the backup for version, or the most recent one when version is empty
+func selectBackup(backups []RetainedBackup, version string) (*RetainedBackup, error) {
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("no retained backups available")
+	}
+
+	if version == "" {
+		return &backups[0], nil
+	}
+
+	for i := range backups {
+		if strings.TrimPrefix(backups[i].Version, "v") == strings.TrimPrefix(version, "v") {
+			return &backups[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no retained backup for version %s", version)
+}
+
+// ListBackups returns the retained agent backups available for manual rollback, newest first
+func ListBackups() ([]RetainedBackup, error) {
+	return loadBackupIndex(paths.GetBackupDirectory())
+}
+
+// RunRollback restores a retained backup on demand: the most recent one, or the
+// one matching toVersion. It stops the agent, verifies the backup checksum,
+// restores the binary, reinstalls and starts the service, and records the
+// rollback in the update history.
+func RunRollback(toVersion string) error {
+	if err := checkPrivileges(); err != nil {
+		return err
+	}
+	if err := InitLogger(); err != nil {
+		return fmt.Errorf("failed to initialize logging system: %w", err)
+	}
+	defer CloseLogger()
+	loadConfig()
+
+	dataDir := paths.GetDataDirectory()
+
+	release, err := acquireUpdateLock(dataDir)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	backups, err := ListBackups()
+	if err != nil {
+		return fmt.Errorf("failed to read backup index: %w", err)
+	}
+
+	target, err := selectBackup(backups, toVersion)
+	if err != nil {
+		return err
+	}
+
+	LogInfo("=== Manual rollback to version %s requested ===", target.Version)
+
+	if err := verifyChecksum(target.Path, target.SHA256); err != nil {
+		LogCritical("Backup verification failed: %v", err)
+		return fmt.Errorf("backup %s failed verification, refusing to restore: %w", target.Path, err)
+	}
+	LogInfo("Backup checksum verified: %s", target.SHA256)
+
+	current, err := getInstalledVersionDetails()
+	if err != nil {
+		LogWarning("Could not determine current version: %v", err)
+		current.Version = "unknown"
+	}
+	currentVersion := current.Version
+	// record saves the outcome with the full version the agent reported
+	record := func(err error) {
+		entry := newHistoryEntry(HistoryActionManualRollback, currentVersion, target.Version, err)
+		entry.FromVersionDetails = current.Raw
+		saveHistoryEntry(dataDir, entry)
+	}
+
+	// Restored where updates install the agent, resolved before the old
+	// binary is replaced
+	binaryPath := agentBinaryPath()
+	if current, _, err := getMainAgentBinaryPathWithDetails(); err == nil {
+		binaryPath = updateTargetPath(current)
+	}
+	LogInfo("Agent binary to restore: %s", binaryPath)
+
+	LogInfo("Stopping main agent service...")
+	if err := serviceManager.Stop(agentServiceName()); err != nil {
+		record(err)
+		return fmt.Errorf("failed to stop main agent: %w", err)
+	}
+
+	rollbackErr := rollback(&BackupInfo{
+		Version:    target.Version,
+		BackupPath: target.Path,
+		BinaryPath: binaryPath,
+		Timestamp:  target.CreatedAt,
+		SHA256:     target.SHA256,
+	})
+	record(rollbackErr)
+	if rollbackErr != nil {
+		return rollbackErr
+	}
+
+	LogInfo("Version %s will not be reinstalled automatically", currentVersion)
+	return nil
+}
@@ -0,0 +1,164 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestBackup creates a .backup file with the given content and returns its BackupInfo
+func writeTestBackup(t *testing.T, dir, version string, createdAt time.Time) *BackupInfo {
+	t.Helper()
+
+	backupPath := filepath.Join(dir, "sentinel.backup")
+	if err := os.WriteFile(backupPath, []byte("binary "+version), 0755); err != nil {
+		t.Fatalf("failed to write backup: %v", err)
+	}
+
+	return &BackupInfo{
+		Version:    version,
+		BackupPath: backupPath,
+		BinaryPath: filepath.Join(dir, "sentinel"),
+		Timestamp:  createdAt,
+	}
+}
+
+// TestRetainBackupPrunesOldest verifies that retained backups are indexed with
+// their checksum and that only the newest ones are kept
+func TestRetainBackupPrunesOldest(t *testing.T) {
+	workDir := t.TempDir()
+	backupDir := filepath.Join(workDir, "backups")
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 4; i++ {
+		backup := writeTestBackup(t, workDir, fmt.Sprintf("v1.0.%d", i), base.Add(time.Duration(i)*time.Hour))
+		if err := retainBackup(backupDir, backup, 2); err != nil {
+			t.Fatalf("retainBackup(v1.0.%d) failed: %v", i, err)
+		}
+	}
+
+	backups, err := loadBackupIndex(backupDir)
+	if err != nil {
+		t.Fatalf("loadBackupIndex() failed: %v", err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("len(backups) = %d; want 2", len(backups))
+	}
+	if backups[0].Version != "v1.0.4" || backups[1].Version != "v1.0.3" {
+		t.Errorf("backups = %s, %s; want v1.0.4, v1.0.3", backups[0].Version, backups[1].Version)
+	}
+
+	for _, backup := range backups {
+		checksum, err := fileSHA256(backup.Path)
+		if err != nil {
+			t.Fatalf("retained backup %s missing: %v", backup.Path, err)
+		}
+		if checksum != backup.SHA256 {
+			t.Errorf("checksum of %s = %s; want %s", backup.Path, checksum, backup.SHA256)
+		}
+	}
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("failed to read backup directory: %v", err)
+	}
+	// Two binaries plus the index file
+	if len(entries) != 3 {
+		t.Errorf("backup directory contains %d entries; want 3", len(entries))
+	}
+}
+
+// TestSelectBackup verifies backup selection by version and the default of
+// choosing the most recent backup
+func TestSelectBackup(t *testing.T) {
+	backups := []RetainedBackup{
+		{Version: "v1.6.116"},
+		{Version: "v1.6.100"},
+	}
+
+	tests := []struct {
+		version  string
+		expected string
+		wantErr  bool
+	}{
+		{version: "", expected: "v1.6.116"},
+		{version: "v1.6.100", expected: "v1.6.100"},
+		{version: "1.6.100", expected: "v1.6.100"},
+		{version: "v1.5.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		selected, err := selectBackup(backups, tt.version)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("selectBackup(%q) should fail", tt.version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectBackup(%q) failed: %v", tt.version, err)
+			continue
+		}
+		if selected.Version != tt.expected {
+			t.Errorf("selectBackup(%q) = %s; want %s", tt.version, selected.Version, tt.expected)
+		}
+	}
+
+	if _, err := selectBackup(nil, ""); err == nil {
+		t.Error("selectBackup() should fail when no backups exist")
+	}
+}
+
+// TestWriteVerifiedBackup verifies that the backup is a copy of the binary
+// and that the returned checksum is the binary's
+func TestWriteVerifiedBackup(t *testing.T) {
+	dir := t.TempDir()
+	binaryPath := filepath.Join(dir, "sentinel")
+	writeLog(t, binaryPath, "binary v1.0.0")
+
+	checksum, err := writeVerifiedBackup(binaryPath, binaryPath+".backup")
+	if err != nil {
+		t.Fatalf("writeVerifiedBackup() failed: %v", err)
+	}
+	want, err := fileSHA256(binaryPath)
+	if err != nil {
+		t.Fatalf("fileSHA256() failed: %v", err)
+	}
+	if checksum != want {
+		t.Errorf("writeVerifiedBackup() = %s; want %s", checksum, want)
+	}
+	if err := verifyChecksum(binaryPath+".backup", want); err != nil {
+		t.Errorf("verifyChecksum(backup) = %v; want nil", err)
+	}
+}
+
+// TestRollbackRefusesCorruptedBackup verifies that a backup whose contents no
+// longer match the recorded checksum is not restored
+func TestRollbackRefusesCorruptedBackup(t *testing.T) {
+	dir := t.TempDir()
+	backup := writeTestBackup(t, dir, "v1.0.0", time.Now())
+	checksum, err := fileSHA256(backup.BackupPath)
+	if err != nil {
+		t.Fatalf("fileSHA256() failed: %v", err)
+	}
+	backup.SHA256 = checksum
+	writeLog(t, backup.BackupPath, "binary v1.0")
+
+	withConfig(t, defaultConfig())
+	logPath := filepath.Join(dir, "updater.log")
+	useTestLog(t, logPath, 1<<20, 3)
+
+	if err := rollback(backup); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("rollback() = %v; want checksum mismatch", err)
+	}
+	if _, err := os.Stat(backup.BinaryPath); !os.IsNotExist(err) {
+		t.Errorf("binary was restored from a corrupted backup")
+	}
+	if logged, _ := os.ReadFile(logPath); !strings.Contains(string(logged), "[CRITICAL] Manual recovery steps:") {
+		t.Errorf("log does not contain the manual recovery steps:\n%s", logged)
+	}
+}
@@ -0,0 +1,183 @@
+package updater
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const (
+	binaryFormatELF   = "elf"
+	binaryFormatMachO = "macho"
+	binaryFormatPE    = "pe"
+)
+
+// verifyBinaryArchitecture checks that the executable at path was built for the
+// host OS and architecture. Installing a mismatched binary would leave the agent
+// unable to start until rollback, so a mismatch is reported as ARCH_MISMATCH.
+func verifyBinaryArchitecture(path string) error {
+	format, arches, err := readBinaryTarget(path)
+	if err != nil {
+		return newUpdateError(ErrCodeArchMismatch, "cannot determine target of %s: %v", path, err)
+	}
+
+	expectedFormat := expectedBinaryFormat(runtime.GOOS)
+	if format != expectedFormat {
+		return newUpdateError(ErrCodeArchMismatch, "binary %s is %s but host %s requires %s",
+			path, format, runtime.GOOS, expectedFormat)
+	}
+
+	for _, arch := range arches {
+		if arch == runtime.GOARCH {
+			LogInfo("Binary architecture verified: %s/%s (%s)", runtime.GOOS, arch, format)
+			return nil
+		}
+	}
+
+	return newUpdateError(ErrCodeArchMismatch, "binary %s targets %s but host architecture is %s",
+		path, strings.Join(arches, ","), runtime.GOARCH)
+}
+
+// pinHostTarget sets GOOS and GOARCH in env to the host's. A stray value,
+// such as GOARCH in /etc/environment, would otherwise build an agent the
+// service cannot start.
+func pinHostTarget(env []string) []string {
+	for _, target := range [][2]string{{"GOOS", runtime.GOOS}, {"GOARCH", runtime.GOARCH}} {
+		key, host := target[0], target[1]
+		if value := getEnvVar(env, key); value != "" && value != host {
+			LogWarning("Ignoring %s=%s from the environment, building for the host %s", key, value, host)
+		}
+		env = setEnvVar(env, key, host)
+	}
+	return env
+}
+
+// expectedBinaryFormat returns the executable format used by the given GOOS
+func expectedBinaryFormat(goos string) string {
+	switch goos {
+	case "windows":
+		return binaryFormatPE
+	case "darwin", "ios":
+		return binaryFormatMachO
+	default:
+		return binaryFormatELF
+	}
+}
+
+// readBinaryTarget parses the executable header at path and returns its format
+// and the GOARCH values it can run on (more than one for universal Mach-O files)
+func readBinaryTarget(path string) (string, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return "", nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		f, err := elf.NewFile(file)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid ELF file: %w", err)
+		}
+		return binaryFormatELF, []string{elfMachineToGOARCH(f)}, nil
+
+	case bytes.Equal(magic[:2], []byte("MZ")):
+		f, err := pe.NewFile(file)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid PE file: %w", err)
+		}
+		return binaryFormatPE, []string{peMachineToGOARCH(f.Machine)}, nil
+
+	default:
+		if fat, err := macho.NewFatFile(file); err == nil {
+			var arches []string
+			for _, arch := range fat.Arches {
+				arches = append(arches, machoCPUToGOARCH(arch.Cpu))
+			}
+			return binaryFormatMachO, arches, nil
+		}
+		if f, err := macho.NewFile(file); err == nil {
+			return binaryFormatMachO, []string{machoCPUToGOARCH(f.Cpu)}, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("unrecognized executable format (magic %x)", magic)
+}
+
+func elfMachineToGOARCH(f *elf.File) string {
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		return "riscv64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_LOONGARCH:
+		return "loong64"
+	case elf.EM_PPC64:
+		if f.Data == elf.ELFDATA2LSB {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_MIPS:
+		little := f.Data == elf.ELFDATA2LSB
+		switch {
+		case f.Class == elf.ELFCLASS64 && little:
+			return "mips64le"
+		case f.Class == elf.ELFCLASS64:
+			return "mips64"
+		case little:
+			return "mipsle"
+		default:
+			return "mips"
+		}
+	}
+	return fmt.Sprintf("unknown(%s)", f.Machine)
+}
+
+func machoCPUToGOARCH(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+	return fmt.Sprintf("unknown(%s)", cpu)
+}
+
+func peMachineToGOARCH(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	}
+	return fmt.Sprintf("unknown(0x%x)", machine)
+}
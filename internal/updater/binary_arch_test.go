@@ -0,0 +1,302 @@
+package updater
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeELFHeader writes a minimal 64-bit little-endian ELF header for the given machine
+func writeELFHeader(t *testing.T, path string, machine elf.Machine) {
+	t.Helper()
+
+	var header elf.Header64
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	header.Type = uint16(elf.ET_EXEC)
+	header.Machine = uint16(machine)
+	header.Version = uint32(elf.EV_CURRENT)
+	header.Ehsize = 64
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		t.Fatalf("failed to encode ELF header: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatalf("failed to write ELF header: %v", err)
+	}
+}
+
+// machOHeader returns a minimal 64-bit Mach-O executable header for cpu
+func machOHeader(t *testing.T, cpu macho.Cpu) []byte {
+	t.Helper()
+
+	header := struct {
+		macho.FileHeader
+		Reserved uint32
+	}{FileHeader: macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec}}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		t.Fatalf("failed to encode Mach-O header: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeFatMachO writes a universal Mach-O file with one minimal executable
+// for each of cpus
+func writeFatMachO(t *testing.T, path string, cpus ...macho.Cpu) {
+	t.Helper()
+
+	const align = 12
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint32{macho.MagicFat, uint32(len(cpus))})
+	var images [][]byte
+	offset := uint32(1 << align)
+	for _, cpu := range cpus {
+		image := machOHeader(t, cpu)
+		binary.Write(&buf, binary.BigEndian, macho.FatArchHeader{Cpu: cpu, Offset: offset, Size: uint32(len(image)), Align: align})
+		images = append(images, image)
+		offset += 1 << align
+	}
+	for i, image := range images {
+		buf.Write(make([]byte, (i+1)<<align-buf.Len()))
+		buf.Write(image)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatalf("failed to write fat Mach-O file: %v", err)
+	}
+}
+
+// writePEHeader writes a minimal PE file with a DOS stub header and a COFF
+// header for machine
+func writePEHeader(t *testing.T, path string, machine uint16) {
+	t.Helper()
+
+	// debug/pe reads a 96 byte DOS header before following its offset
+	const peOffset = 0x80
+	var buf bytes.Buffer
+	buf.WriteString("MZ")
+	buf.Write(make([]byte, 0x3c-buf.Len()))
+	binary.Write(&buf, binary.LittleEndian, uint32(peOffset))
+	buf.Write(make([]byte, peOffset-buf.Len()))
+	buf.WriteString("PE\x00\x00")
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{Machine: machine, Characteristics: pe.IMAGE_FILE_EXECUTABLE_IMAGE})
+	if err := os.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatalf("failed to write PE header: %v", err)
+	}
+}
+
+// hostBinaryHeader returns a minimal executable header in the host's format
+// and architecture, or nil when the tests have no fixture for the host
+func hostBinaryHeader(t *testing.T) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "host")
+	switch runtime.GOOS {
+	case "windows":
+		machines := map[string]uint16{"amd64": pe.IMAGE_FILE_MACHINE_AMD64, "386": pe.IMAGE_FILE_MACHINE_I386, "arm64": pe.IMAGE_FILE_MACHINE_ARM64}
+		if machine, ok := machines[runtime.GOARCH]; ok {
+			writePEHeader(t, path, machine)
+		}
+	case "darwin":
+		cpus := map[string]macho.Cpu{"amd64": macho.CpuAmd64, "arm64": macho.CpuArm64}
+		if cpu, ok := cpus[runtime.GOARCH]; ok {
+			return machOHeader(t, cpu)
+		}
+	default:
+		machines := map[string]elf.Machine{"amd64": elf.EM_X86_64, "arm64": elf.EM_AARCH64, "386": elf.EM_386,
+			"arm": elf.EM_ARM, "riscv64": elf.EM_RISCV, "s390x": elf.EM_S390, "loong64": elf.EM_LOONGARCH}
+		if machine, ok := machines[runtime.GOARCH]; ok {
+			writeELFHeader(t, path, machine)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	return data
+}
+
+// TestVerifyBinaryArchitectureHost verifies that the running test binary,
+// which is built for the host, passes the architecture check
+func TestVerifyBinaryArchitectureHost(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() failed: %v", err)
+	}
+
+	if err := verifyBinaryArchitecture(executable); err != nil {
+		t.Errorf("verifyBinaryArchitecture(%s) = %v; want nil", executable, err)
+	}
+}
+
+// TestVerifyBinaryArchitectureMismatch verifies that a binary for another
+// architecture is rejected with ARCH_MISMATCH
+func TestVerifyBinaryArchitectureMismatch(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("ELF fixture only matches the host format on ELF platforms")
+	}
+
+	machine := elf.EM_AARCH64
+	if runtime.GOARCH == "arm64" {
+		machine = elf.EM_X86_64
+	}
+
+	path := filepath.Join(t.TempDir(), "sentinel")
+	writeELFHeader(t, path, machine)
+
+	err := verifyBinaryArchitecture(path)
+	if code := ErrorCodeOf(err); code != ErrCodeArchMismatch {
+		t.Errorf("verifyBinaryArchitecture() code = %q; want %q (err: %v)", code, ErrCodeArchMismatch, err)
+	}
+}
+
+// TestVerifyBinaryArchitectureUnrecognized verifies that a file that is not an
+// executable is rejected with ARCH_MISMATCH
+func TestVerifyBinaryArchitectureUnrecognized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sentinel")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho not a binary\n"), 0755); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	err := verifyBinaryArchitecture(path)
+	if code := ErrorCodeOf(err); code != ErrCodeArchMismatch {
+		t.Errorf("verifyBinaryArchitecture() code = %q; want %q (err: %v)", code, ErrCodeArchMismatch, err)
+	}
+}
+
+// TestReadBinaryTarget verifies the format and architectures read from
+// fixture headers of each executable format
+func TestReadBinaryTarget(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	elfARM64 := filepath.Join(dir, "elf-arm64")
+	writeELFHeader(t, elfARM64, elf.EM_AARCH64)
+	elfAMD64 := filepath.Join(dir, "elf-amd64")
+	writeELFHeader(t, elfAMD64, elf.EM_X86_64)
+	peAMD64 := filepath.Join(dir, "pe-amd64")
+	writePEHeader(t, peAMD64, pe.IMAGE_FILE_MACHINE_AMD64)
+	peARM64 := filepath.Join(dir, "pe-arm64")
+	writePEHeader(t, peARM64, pe.IMAGE_FILE_MACHINE_ARM64)
+	universal := filepath.Join(dir, "macho-universal")
+	writeFatMachO(t, universal, macho.CpuAmd64, macho.CpuArm64)
+
+	tests := []struct {
+		path   string
+		format string
+		arches []string
+	}{
+		{elfARM64, binaryFormatELF, []string{"arm64"}},
+		{elfAMD64, binaryFormatELF, []string{"amd64"}},
+		{peAMD64, binaryFormatPE, []string{"amd64"}},
+		{peARM64, binaryFormatPE, []string{"arm64"}},
+		{write("macho-amd64", machOHeader(t, macho.CpuAmd64)), binaryFormatMachO, []string{"amd64"}},
+		{write("macho-arm64", machOHeader(t, macho.CpuArm64)), binaryFormatMachO, []string{"arm64"}},
+		{universal, binaryFormatMachO, []string{"amd64", "arm64"}},
+	}
+
+	for _, tt := range tests {
+		format, arches, err := readBinaryTarget(tt.path)
+		if err != nil {
+			t.Errorf("readBinaryTarget(%s) failed: %v", filepath.Base(tt.path), err)
+			continue
+		}
+		if format != tt.format || !reflect.DeepEqual(arches, tt.arches) {
+			t.Errorf("readBinaryTarget(%s) = %s, %v; want %s, %v", filepath.Base(tt.path), format, arches, tt.format, tt.arches)
+		}
+	}
+}
+
+// TestVerifyBinaryArchitectureNamesBothTargets verifies that a binary in the
+// wrong format, or built for another architecture, is refused with an error
+// naming the binary's target and the host's
+func TestVerifyBinaryArchitectureNamesBothTargets(t *testing.T) {
+	dir := t.TempDir()
+
+	// A binary in a format no host uses besides its own
+	foreign := filepath.Join(dir, "foreign")
+	wantFormat := binaryFormatPE
+	if runtime.GOOS == "windows" {
+		writeELFHeader(t, foreign, elf.EM_X86_64)
+		wantFormat = binaryFormatELF
+	} else {
+		writePEHeader(t, foreign, pe.IMAGE_FILE_MACHINE_AMD64)
+	}
+	err := verifyBinaryArchitecture(foreign)
+	if code := ErrorCodeOf(err); code != ErrCodeArchMismatch {
+		t.Fatalf("verifyBinaryArchitecture(foreign) code = %q; want %q (err: %v)", code, ErrCodeArchMismatch, err)
+	}
+	for _, want := range []string{wantFormat, runtime.GOOS, expectedBinaryFormat(runtime.GOOS)} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("verifyBinaryArchitecture(foreign) = %v; want it to name %s", err, want)
+		}
+	}
+
+	// The host format built for another architecture
+	header := hostBinaryHeader(t)
+	if header == nil {
+		t.Skipf("no fixture for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	other, otherArch := elf.EM_AARCH64, "arm64"
+	if runtime.GOARCH == "arm64" {
+		other, otherArch = elf.EM_X86_64, "amd64"
+	}
+	wrongArch := filepath.Join(dir, "wrong-arch")
+	switch expectedBinaryFormat(runtime.GOOS) {
+	case binaryFormatELF:
+		writeELFHeader(t, wrongArch, other)
+	case binaryFormatPE:
+		machine := map[string]uint16{"arm64": pe.IMAGE_FILE_MACHINE_ARM64, "amd64": pe.IMAGE_FILE_MACHINE_AMD64}[otherArch]
+		writePEHeader(t, wrongArch, machine)
+	case binaryFormatMachO:
+		cpu := map[string]macho.Cpu{"arm64": macho.CpuArm64, "amd64": macho.CpuAmd64}[otherArch]
+		os.WriteFile(wrongArch, machOHeader(t, cpu), 0755)
+	}
+	err = verifyBinaryArchitecture(wrongArch)
+	if code := ErrorCodeOf(err); code != ErrCodeArchMismatch {
+		t.Fatalf("verifyBinaryArchitecture(wrong arch) code = %q; want %q (err: %v)", code, ErrCodeArchMismatch, err)
+	}
+	for _, want := range []string{otherArch, runtime.GOARCH} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("verifyBinaryArchitecture(wrong arch) = %v; want it to name %s", err, want)
+		}
+	}
+
+	host := filepath.Join(dir, "host")
+	if err := os.WriteFile(host, header, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBinaryArchitecture(host); err != nil {
+		t.Errorf("verifyBinaryArchitecture(host fixture) = %v; want nil", err)
+	}
+}
+
+// TestPinHostTarget verifies that a GOARCH or GOOS leaked into the
+// environment is replaced by the host's
+func TestPinHostTarget(t *testing.T) {
+	env := pinHostTarget([]string{"PATH=/usr/bin", "GOARCH=wasm", "GOOS=js"})
+	if got := getEnvVar(env, "GOARCH"); got != runtime.GOARCH {
+		t.Errorf("GOARCH = %q; want %q", got, runtime.GOARCH)
+	}
+	if got := getEnvVar(env, "GOOS"); got != runtime.GOOS {
+		t.Errorf("GOOS = %q; want %q", got, runtime.GOOS)
+	}
+	if len(env) != 3 {
+		t.Errorf("pinHostTarget() = %v; want the variables replaced in place", env)
+	}
+}
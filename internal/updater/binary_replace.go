@@ -0,0 +1,149 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Extended attributes holding the file capabilities and the SELinux context
+const (
+	capabilityXattr = "security.capability"
+	selinuxXattr    = "security.selinux"
+)
+
+// binaryAttributes are the properties of an installed binary that a freshly
+// written file would not have
+type binaryAttributes struct {
+	Mode os.FileMode
+
+	// UID and GID are -1 when the owner is left to the writing process
+	UID int
+	GID int
+
+	// Capability and SELinux are the raw security.capability and
+	// security.selinux extended attributes, empty when not set
+	Capability []byte
+	SELinux    []byte
+}
+
+// defaultBinaryAttributes returns the attributes of a binary installed for
+// the first time: executable by everyone and, when run as root, owned by root
+func defaultBinaryAttributes() *binaryAttributes {
+	attrs := &binaryAttributes{Mode: 0755, UID: -1, GID: -1}
+	if os.Geteuid() == 0 {
+		attrs.UID, attrs.GID = 0, 0
+	}
+	return attrs
+}
+
+// resolveBinaryLink returns the file written when installing at path: the
+// target of a symbolic link at path, followed through every link, or path
+// itself when it is not a link. A link to a missing file resolves to the
+// file it names.
+func resolveBinaryLink(path string) (target string, linked bool, err error) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return path, false, nil
+	}
+	target, err = filepath.EvalSymlinks(path)
+	if err == nil {
+		return target, true, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", true, err
+	}
+	if target, err = os.Readlink(path); err != nil {
+		return "", true, err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return target, true, nil
+}
+
+// sameFile reports whether a and b name the same file, following symbolic
+// links and comparing them as the file system would
+func sameFile(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// replaceBinary replaces targetPath with a copy of sourcePath by renaming a
+// complete file over it. The mode, owner, file capabilities (such as
+// cap_net_raw set with setcap) and SELinux context of the binary it replaces
+// are applied to the new file before the rename, so the agent never runs
+// without them. When targetPath is a symbolic link, such as
+// /usr/local/bin/sentinel pointing into a GOBIN, the file it points to is
+// replaced and the link is left as it is.
+func replaceBinary(sourcePath, targetPath string) error {
+	realPath, linked, err := resolveBinaryLink(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve symbolic link %s: %w", targetPath, err)
+	}
+	if linked {
+		LogInfo("%s is a symbolic link, replacing its target %s and keeping the link", targetPath, realPath)
+		if err := os.MkdirAll(filepath.Dir(realPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory of %s: %w", realPath, err)
+		}
+		targetPath = realPath
+	}
+
+	_, statErr := os.Stat(targetPath)
+	replacing := statErr == nil
+	attrs, err := captureBinaryAttributes(targetPath)
+	if err != nil {
+		LogWarning("Failed to read the attributes of %s, installing with the defaults: %v", targetPath, err)
+		attrs = defaultBinaryAttributes()
+	}
+
+	newPath := targetPath + ".new"
+	if err := copyFileStreaming(sourcePath, newPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to write %s: %w", newPath, err)
+	}
+
+	preserved, err := applyBinaryAttributes(newPath, attrs)
+	if err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if removed, err := removeQuarantine(newPath); err != nil {
+		LogWarning("Failed to remove the %s attribute from %s: %v", quarantineXattr, newPath, err)
+	} else if removed {
+		LogInfo("Removed the %s attribute from %s", quarantineXattr, targetPath)
+	}
+	if err := os.Rename(newPath, targetPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to replace %s: %w", targetPath, err)
+	}
+
+	if len(attrs.SELinux) == 0 {
+		if relabeled, err := relabelBinary(targetPath); err != nil {
+			LogWarning("Failed to restore the SELinux context of %s: %v", targetPath, err)
+		} else if relabeled {
+			preserved = append(preserved, "SELinux context (restorecon)")
+		}
+	}
+	if len(preserved) > 0 && replacing {
+		LogInfo("Preserved on %s: %s", targetPath, strings.Join(preserved, ", "))
+	} else if len(preserved) > 0 {
+		LogInfo("Installed %s with %s", targetPath, strings.Join(preserved, ", "))
+	}
+	return nil
+}
+
+// trimXattr returns a string attribute value without its trailing NUL
+func trimXattr(value []byte) string {
+	return strings.TrimRight(string(value), "\x00")
+}
@@ -0,0 +1,86 @@
+//go:build !windows
+
+package updater
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// captureBinaryAttributes reads the attributes of the binary at path, or
+// returns the defaults when there is none yet
+func captureBinaryAttributes(path string) (*binaryAttributes, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return defaultBinaryAttributes(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := &binaryAttributes{
+		Mode: info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid),
+		UID:  -1,
+		GID:  -1,
+	}
+	// A binary that is not executable is not worth preserving that way
+	if attrs.Mode&0111 == 0 {
+		attrs.Mode = defaultBinaryAttributes().Mode
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		attrs.UID, attrs.GID = int(stat.Uid), int(stat.Gid)
+	}
+	if attrs.Capability, attrs.SELinux, err = readSecurityXattrs(path); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// applyBinaryAttributes sets attrs on the file at path and returns what was
+// carried over. The owner is set first because chown clears setuid bits and
+// file capabilities, and the mode must always be applied.
+func applyBinaryAttributes(path string, attrs *binaryAttributes) ([]string, error) {
+	var preserved []string
+
+	if attrs.UID >= 0 && os.Geteuid() == 0 {
+		if err := os.Chown(path, attrs.UID, attrs.GID); err != nil {
+			LogWarning("Failed to set ownership %d:%d on %s: %v", attrs.UID, attrs.GID, path, err)
+		} else {
+			preserved = append(preserved, fmt.Sprintf("owner %d:%d", attrs.UID, attrs.GID))
+		}
+	}
+
+	if err := os.Chmod(path, attrs.Mode); err != nil {
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	preserved = append(preserved, fmt.Sprintf("mode %04o", uint32(attrs.Mode.Perm())|setidBits(attrs.Mode)))
+
+	if len(attrs.SELinux) > 0 {
+		if err := setSecurityXattr(path, selinuxXattr, attrs.SELinux); err != nil {
+			LogWarning("Failed to set the SELinux context %s on %s: %v", trimXattr(attrs.SELinux), path, err)
+		} else {
+			preserved = append(preserved, "SELinux context "+trimXattr(attrs.SELinux))
+		}
+	}
+	if len(attrs.Capability) > 0 {
+		if err := setSecurityXattr(path, capabilityXattr, attrs.Capability); err != nil {
+			LogWarning("Failed to set file capabilities on %s: %v", path, err)
+		} else {
+			preserved = append(preserved, "file capabilities")
+		}
+	}
+	return preserved, nil
+}
+
+// setidBits returns the setuid and setgid bits of mode in octal notation
+func setidBits(mode os.FileMode) uint32 {
+	var bits uint32
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	return bits
+}
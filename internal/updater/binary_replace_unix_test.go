@@ -0,0 +1,143 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestReplaceBinaryPreservesModeAndOwner verifies that replacing a binary
+// keeps its permissions and, when run as root, its owner
+func TestReplaceBinaryPreservesModeAndOwner(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "new")
+	target := filepath.Join(dir, "sentinel")
+	writeLog(t, source, "new build")
+	writeLog(t, target, "old build")
+	if err := os.Chmod(target, 0750); err != nil {
+		t.Fatal(err)
+	}
+	root := os.Geteuid() == 0
+	if root {
+		if err := os.Chown(target, 1234, 5678); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := replaceBinary(source, target); err != nil {
+		t.Fatalf("replaceBinary() failed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(target); string(data) != "new build" {
+		t.Errorf("target = %q; want the new build", data)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("mode = %v; want 0750", info.Mode().Perm())
+	}
+	if stat := info.Sys().(*syscall.Stat_t); root && (stat.Uid != 1234 || stat.Gid != 5678) {
+		t.Errorf("owner = %d:%d; want 1234:5678", stat.Uid, stat.Gid)
+	}
+	if _, err := os.Stat(target + ".new"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+// TestReplaceBinaryFirstInstall verifies that a binary installed for the
+// first time is executable
+func TestReplaceBinaryFirstInstall(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "new")
+	writeLog(t, source, "new build")
+	os.Chmod(source, 0600)
+	target := filepath.Join(dir, "sentinel")
+
+	if err := replaceBinary(source, target); err != nil {
+		t.Fatalf("replaceBinary() failed: %v", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("mode = %v; want 0755", info.Mode().Perm())
+	}
+}
+
+// TestReplaceBinaryKeepsSymlink verifies that replacing a binary installed
+// as a symbolic link, absolute or relative, replaces the file it points to
+// and leaves the link in place
+func TestReplaceBinaryKeepsSymlink(t *testing.T) {
+	for _, relative := range []bool{false, true} {
+		dir := t.TempDir()
+		source := filepath.Join(dir, "new")
+		real := filepath.Join(dir, "gobin", "sentinel")
+		link := filepath.Join(dir, "bin", "sentinel")
+		for _, subdir := range []string{"gobin", "bin"} {
+			if err := os.Mkdir(filepath.Join(dir, subdir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeLog(t, source, "new build")
+		writeLog(t, real, "old build")
+		if err := os.Chmod(real, 0750); err != nil {
+			t.Fatal(err)
+		}
+		linkTarget := real
+		if relative {
+			linkTarget = filepath.Join("..", "gobin", "sentinel")
+		}
+		if err := os.Symlink(linkTarget, link); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := replaceBinary(source, link); err != nil {
+			t.Fatalf("replaceBinary() through a link to %s failed: %v", linkTarget, err)
+		}
+
+		if got, err := os.Readlink(link); err != nil || got != linkTarget {
+			t.Errorf("link to %s now points to %q, %v", linkTarget, got, err)
+		}
+		if data, _ := os.ReadFile(real); string(data) != "new build" {
+			t.Errorf("link target = %q; want the new build", data)
+		}
+		if info, err := os.Stat(real); err != nil || info.Mode().Perm() != 0750 {
+			t.Errorf("link target mode = %v, %v; want 0750", info.Mode().Perm(), err)
+		}
+		if _, err := os.Stat(real + ".new"); !os.IsNotExist(err) {
+			t.Errorf("temporary file left behind: %v", err)
+		}
+	}
+}
+
+// TestReplaceBinaryDanglingSymlink verifies that a link to a missing binary
+// gets the binary written where it points
+func TestReplaceBinaryDanglingSymlink(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "new")
+	writeLog(t, source, "new build")
+	real := filepath.Join(dir, "gobin", "sentinel")
+	link := filepath.Join(dir, "sentinel")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if target, linked, err := resolveBinaryLink(link); err != nil || !linked || target != real {
+		t.Errorf("resolveBinaryLink(%s) = %q, %v, %v; want %s", link, target, linked, err, real)
+	}
+	if err := replaceBinary(source, link); err != nil {
+		t.Fatalf("replaceBinary() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(link); string(data) != "new build" {
+		t.Errorf("binary through the link = %q; want the new build", data)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s is no longer a symbolic link", link)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package updater
+
+// captureBinaryAttributes returns the defaults; the ACL of the install
+// directory applies to a replaced binary on Windows
+func captureBinaryAttributes(path string) (*binaryAttributes, error) {
+	return defaultBinaryAttributes(), nil
+}
+
+// applyBinaryAttributes does nothing on Windows
+func applyBinaryAttributes(path string, attrs *binaryAttributes) ([]string, error) {
+	return nil, nil
+}
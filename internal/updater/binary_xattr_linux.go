@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// selinuxEnforceFile exists when SELinux is enabled
+const selinuxEnforceFile = "/sys/fs/selinux/enforce"
+
+// readSecurityXattrs returns the file capabilities and SELinux context of
+// the file at path, each empty when not set or not supported
+func readSecurityXattrs(path string) ([]byte, []byte, error) {
+	capability, err := getXattr(path, capabilityXattr)
+	if err != nil {
+		return nil, nil, err
+	}
+	context, err := getXattr(path, selinuxXattr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return capability, context, nil
+}
+
+// getXattr reads one extended attribute, returning nil when it is not set or
+// the filesystem does not support extended attributes
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := unix.Getxattr(path, name, nil)
+		if err != nil {
+			if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) {
+				return nil, nil
+			}
+			return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		}
+		value := make([]byte, size)
+		n, err := unix.Getxattr(path, name, value)
+		if errors.Is(err, unix.ERANGE) {
+			// The attribute grew between the two calls
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		}
+		return value[:n], nil
+	}
+}
+
+// setSecurityXattr sets one extended attribute on the file at path
+func setSecurityXattr(path, name string, value []byte) error {
+	if err := unix.Setxattr(path, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr " + name, Path: path, Err: err}
+	}
+	return nil
+}
+
+// relabelBinary gives the file at path the SELinux context the policy
+// defines for it, when SELinux is enabled and restorecon is installed. It
+// reports whether restorecon ran.
+func relabelBinary(path string) (bool, error) {
+	if _, err := os.Stat(selinuxEnforceFile); err != nil {
+		return false, nil
+	}
+	restorecon, err := exec.LookPath("restorecon")
+	if err != nil {
+		return false, nil
+	}
+	if output, err := exec.Command(restorecon, path).CombinedOutput(); err != nil {
+		return false, errors.New(strings.TrimSpace(string(output)) + ": " + err.Error())
+	}
+	return true, nil
+}
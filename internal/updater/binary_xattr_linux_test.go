@@ -0,0 +1,58 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// netRawCapability returns a security.capability value granting an
+// effective cap_net_raw, as setcap cap_net_raw+ep writes it
+func netRawCapability() []byte {
+	const (
+		vfsCapRevision2 = 0x02000000
+		vfsCapEffective = 0x000001
+		capNetRaw       = 13
+	)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{vfsCapRevision2 | vfsCapEffective, 1 << capNetRaw, 0, 0, 0})
+	return buf.Bytes()
+}
+
+// TestReplaceBinaryPreservesSecurityXattrs verifies that the file
+// capabilities and SELinux context of the replaced binary are carried over,
+// on filesystems that allow setting them
+func TestReplaceBinaryPreservesSecurityXattrs(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "new")
+	target := filepath.Join(dir, "sentinel")
+	writeLog(t, source, "new build")
+	writeLog(t, target, "old build")
+	os.Chmod(target, 0755)
+
+	want := map[string][]byte{
+		selinuxXattr:    []byte("system_u:object_r:bin_t:s0\x00"),
+		capabilityXattr: netRawCapability(),
+	}
+	for name, value := range want {
+		if err := setSecurityXattr(target, name, value); err != nil {
+			t.Skipf("cannot set %s here: %v", name, err)
+		}
+	}
+
+	if err := replaceBinary(source, target); err != nil {
+		t.Fatalf("replaceBinary() failed: %v", err)
+	}
+
+	for name, value := range want {
+		got, err := getXattr(target, name)
+		if err != nil {
+			t.Fatalf("getXattr(%s) failed: %v", name, err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Errorf("%s = %q; want %q", name, got, value)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package updater
+
+// readSecurityXattrs returns nothing where file capabilities and SELinux do
+// not exist
+func readSecurityXattrs(path string) ([]byte, []byte, error) {
+	return nil, nil, nil
+}
+
+// setSecurityXattr does nothing where file capabilities and SELinux do not
+// exist; it is only called with attributes read on Linux
+func setSecurityXattr(path, name string, value []byte) error {
+	return nil
+}
+
+// relabelBinary does nothing without SELinux
+func relabelBinary(path string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,91 @@
+package updater
+
+import (
+	"fmt"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// BootstrapResult is what RunBootstrap did
+type BootstrapResult struct {
+	// Version is the agent version installed, or the one already installed
+	Version string
+
+	// BinaryPath is where the agent binary is
+	BinaryPath string
+
+	// AlreadyInstalled is set when a working agent was found and nothing
+	// was done
+	AlreadyInstalled bool
+}
+
+// RunBootstrap installs the agent on a machine that has none: it builds the
+// given version, or the latest on the configured channel, installs it to
+// the configured binary path or the system binary directory, registers and
+// starts the agent service and records the install in the update history.
+// When a working agent binary is already detected it does nothing, so it is
+// safe to run again on a provisioned machine.
+func RunBootstrap(version string, noCache bool) (*BootstrapResult, error) {
+	if err := checkPrivileges(); err != nil {
+		return nil, err
+	}
+	if err := paths.EnsureDataDirectory(); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := InitLogger(); err != nil {
+		return nil, fmt.Errorf("failed to initialize logging system: %w", err)
+	}
+	defer CloseLogger()
+	loadConfig()
+
+	if path, _, err := getMainAgentBinaryPathWithDetails(); err == nil {
+		if installed, err := installedVersionAt(path); err == nil {
+			LogInfo("Agent %s is already installed at %s, nothing to bootstrap", installed, path)
+			return &BootstrapResult{Version: installed, BinaryPath: path, AlreadyInstalled: true}, nil
+		}
+	}
+
+	if _, err := findGoBinary(); err != nil {
+		return nil, fmt.Errorf("bootstrap needs the Go toolchain: %w", err)
+	}
+
+	if version != "" {
+		if err := verifyVersionExists(version); err != nil {
+			return nil, err
+		}
+	} else {
+		check, err := getLatestVersion(paths.GetDataDirectory(), true)
+		if err != nil {
+			return nil, err
+		}
+		if check.Selected == "" {
+			return nil, fmt.Errorf("no version of %s found on the %s channel", getConfig().AgentModule, getConfig().Channel)
+		}
+		version = check.Selected
+	}
+
+	binaryPath := freshInstallPath()
+	if err := performBootstrap(version, binaryPath, noCache); err != nil {
+		return nil, err
+	}
+	return &BootstrapResult{Version: version, BinaryPath: binaryPath}, nil
+}
+
+// performBootstrap installs targetVersion at binaryPath under the update
+// lock, as performUpdate does when no agent is detected
+func performBootstrap(targetVersion, binaryPath string, noCache bool) (err error) {
+	LogInfo("=== Bootstrapping agent %s ===", targetVersion)
+
+	dataDir, release, err := beginUpdate(targetVersion)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	started := now()
+	defer func() {
+		reportUpdateTelemetry(dataDir, "", targetVersion, now().Sub(started), err)
+	}()
+
+	return performFreshInstall(dataDir, targetVersion, binaryPath, noCache)
+}
@@ -0,0 +1,61 @@
+package updater
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// saveConfigFile writes the active configuration to the updater config file,
+// which the entry points such as RunBootstrap load
+func saveConfigFile(t *testing.T) {
+	data, err := json.Marshal(getConfig())
+	if err != nil {
+		t.Fatalf("failed to encode config: %v", err)
+	}
+	writeLog(t, paths.GetUpdaterConfigPath(), string(data))
+}
+
+// TestRunBootstrap verifies that bootstrap installs the requested version
+// and starts its service when no agent is installed, and does nothing when
+// run again
+func TestRunBootstrap(t *testing.T) {
+	update := useFakeUpdate(t)
+	if err := os.Remove(update.binary); err != nil {
+		t.Fatalf("failed to remove agent binary: %v", err)
+	}
+	saveConfigFile(t)
+
+	result, err := RunBootstrap("v1.1.0", false)
+	if err != nil {
+		t.Fatalf("RunBootstrap() failed: %v", err)
+	}
+	if result.AlreadyInstalled || result.Version != "v1.1.0" || result.BinaryPath != update.binary {
+		t.Errorf("RunBootstrap() = %+v; want v1.1.0 installed at %s", result, update.binary)
+	}
+	if version, err := installedVersionAt(update.binary); err != nil || version != "v1.1.0" {
+		t.Errorf("installed version = %q, %v; want v1.1.0", version, err)
+	}
+	want := []string{"install sentinelgo " + update.binary, "start sentinelgo"}
+	if calls := update.manager.CallLog(); !slices.Equal(calls, want) {
+		t.Errorf("service calls = %q; want %q", calls, want)
+	}
+	entries, err := loadHistory(paths.GetDataDirectory())
+	if err != nil || len(entries) != 1 || entries[0].Action != HistoryActionInstall || !entries[0].Success {
+		t.Errorf("history = %+v, %v; want a successful install", entries, err)
+	}
+
+	result, err = RunBootstrap("v1.2.0", false)
+	if err != nil || !result.AlreadyInstalled || result.Version != "v1.1.0" {
+		t.Errorf("RunBootstrap() again = %+v, %v; want v1.1.0 already installed", result, err)
+	}
+	if calls := update.manager.CallLog(); !slices.Equal(calls, want) {
+		t.Errorf("service calls after bootstrapping again = %q; want %q", calls, want)
+	}
+	if version, err := installedVersionAt(update.binary); err != nil || version != "v1.1.0" {
+		t.Errorf("installed version after bootstrapping again = %q, %v; want v1.1.0", version, err)
+	}
+}
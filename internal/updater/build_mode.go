@@ -0,0 +1,90 @@
+package updater
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// CGOMode is the cgoEnabled setting. It accepts a JSON string or boolean.
+type CGOMode string
+
+const (
+	CGOModeAuto  CGOMode = "auto"
+	CGOModeTrue  CGOMode = "true"
+	CGOModeFalse CGOMode = "false"
+)
+
+// UnmarshalJSON accepts "auto", "true", "false" or a JSON boolean
+func (m *CGOMode) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		if enabled {
+			*m = CGOModeTrue
+		} else {
+			*m = CGOModeFalse
+		}
+		return nil
+	}
+
+	var mode string
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return err
+	}
+	*m = CGOMode(strings.ToLower(mode))
+	return nil
+}
+
+// Build modes recorded for an installed binary
+const (
+	BuildModeCGO    = "cgo"
+	BuildModePureGo = "pure_go"
+)
+
+// cgoErrorPatterns appear in go build output when a package cannot be built
+// without cgo
+var cgoErrorPatterns = []string{
+	"build constraints exclude all Go files",
+	"requires cgo",
+	"cgo is disabled",
+	"CGO_ENABLED=0",
+	`import "C"`,
+}
+
+// isCGOError reports whether go build output shows the build failed because
+// cgo was disabled
+func isCGOError(output string) bool {
+	for _, pattern := range cgoErrorPatterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldFallBackToCGO decides whether a failed pure Go build is retried with
+// CGO. Only auto mode falls back, and only for cgo-related failures; other
+// failures such as network errors would fail the CGO build the same way.
+func shouldFallBackToCGO(cgoMode CGOMode, output string) bool {
+	return cgoMode == CGOModeAuto && isCGOError(output)
+}
+
+// toolchainRequirement describes the CGO_ENABLED setting of m and whether a
+// C toolchain is needed for it
+func (m CGOMode) toolchainRequirement() string {
+	switch m {
+	case CGOModeTrue:
+		return "CGO_ENABLED=1, C toolchain required"
+	case CGOModeFalse:
+		return "CGO_ENABLED=0, no C toolchain needed"
+	}
+	return "CGO_ENABLED=0 first, C toolchain only if the agent needs CGO"
+}
+
+// valid reports whether m is a recognized cgoEnabled value
+func (m CGOMode) valid() bool {
+	switch m {
+	case CGOModeAuto, CGOModeTrue, CGOModeFalse:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestShouldFallBackToCGO verifies the auto-mode fallback decision against
+// captured go build error output
+func TestShouldFallBackToCGO(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     CGOMode
+		output   string
+		expected bool
+	}{
+		{
+			name:     "cgo-only package excluded",
+			mode:     CGOModeAuto,
+			output:   "package github.com/mattn/go-sqlite3: build constraints exclude all Go files in /root/go/pkg/mod/github.com/mattn/go-sqlite3@v1.14.22",
+			expected: true,
+		},
+		{
+			name:     "package requires cgo",
+			mode:     CGOModeAuto,
+			output:   "# runtime/cgo\ngo: github.com/example/agent requires cgo",
+			expected: true,
+		},
+		{
+			name:     "network failure",
+			mode:     CGOModeAuto,
+			output:   "go: github.com/BrainStation-23/SentinelGo@v1.2.0: Get \"https://proxy.golang.org/...\": dial tcp: lookup proxy.golang.org: no such host",
+			expected: false,
+		},
+		{
+			name:     "type error",
+			mode:     CGOModeAuto,
+			output:   "./main.go:12:2: undefined: foo",
+			expected: false,
+		},
+		{
+			name:     "cgo disabled by configuration",
+			mode:     CGOModeFalse,
+			output:   "build constraints exclude all Go files",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldFallBackToCGO(tt.mode, tt.output); got != tt.expected {
+				t.Errorf("shouldFallBackToCGO(%s) = %v; want %v", tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCGOModeUnmarshal verifies that cgoEnabled accepts strings and booleans
+func TestCGOModeUnmarshal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CGOMode
+	}{
+		{`"auto"`, CGOModeAuto},
+		{`"AUTO"`, CGOModeAuto},
+		{`"false"`, CGOModeFalse},
+		{`true`, CGOModeTrue},
+		{`false`, CGOModeFalse},
+	}
+
+	for _, tt := range tests {
+		var mode CGOMode
+		if err := json.Unmarshal([]byte(tt.input), &mode); err != nil {
+			t.Errorf("Unmarshal(%s) failed: %v", tt.input, err)
+			continue
+		}
+		if mode != tt.expected {
+			t.Errorf("Unmarshal(%s) = %s; want %s", tt.input, mode, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package updater
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Build priorities: how much the go install process yields to other work
+const (
+	BuildPriorityNormal = "normal"
+	BuildPriorityLow    = "low"
+	BuildPriorityIdle   = "idle"
+)
+
+// validBuildPriority reports whether priority is a known build priority
+func validBuildPriority(priority string) bool {
+	switch priority {
+	case BuildPriorityNormal, BuildPriorityLow, BuildPriorityIdle:
+		return true
+	}
+	return false
+}
+
+// prioritizeBuild prepares cmd to run at the configured build priority and
+// returns the function to call once it has started. The compiler and linker
+// processes go starts inherit the priority.
+func prioritizeBuild(cmd *exec.Cmd, priority string) func(*os.Process) {
+	if priority == BuildPriorityNormal {
+		return nil
+	}
+	setBuildCreationPriority(cmd, priority)
+
+	return func(process *os.Process) {
+		if err := lowerProcessPriority(process.Pid, priority); err != nil {
+			LogWarning("Failed to lower the build priority: %v", err)
+		}
+	}
+}
+
+// limitBuildParallelism caps the packages built in parallel and the threads
+// of each go process at parallelism, adding -p to any GOFLAGS already set
+func limitBuildParallelism(env []string, parallelism int) []string {
+	if parallelism <= 0 {
+		return env
+	}
+	flags := strings.TrimSpace(getEnvVar(env, "GOFLAGS") + " -p=" + strconv.Itoa(parallelism))
+	env = setEnvVar(env, "GOFLAGS", flags)
+	return setEnvVar(env, "GOMAXPROCS", strconv.Itoa(parallelism))
+}
@@ -0,0 +1,52 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadConfigPathBuildPriority verifies that the build priority defaults
+// to low, is case-insensitive, and falls back to low when unknown
+func TestLoadConfigPathBuildPriority(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{}`, BuildPriorityLow},
+		{`{"buildPriority": "IDLE"}`, BuildPriorityIdle},
+		{`{"buildPriority": "normal"}`, BuildPriorityNormal},
+		{`{"buildPriority": "turbo"}`, BuildPriorityLow},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		if config.BuildPriority != tt.want {
+			t.Errorf("loadConfigPath(%s).BuildPriority = %q; want %q", tt.content, config.BuildPriority, tt.want)
+		}
+	}
+}
+
+// TestLimitBuildParallelism verifies that -p is added to the GOFLAGS already
+// set and GOMAXPROCS is capped
+func TestLimitBuildParallelism(t *testing.T) {
+	env := limitBuildParallelism([]string{"GOFLAGS=-mod=mod"}, 2)
+	if got := getEnvVar(env, "GOFLAGS"); got != "-mod=mod -p=2" {
+		t.Errorf("GOFLAGS = %q; want \"-mod=mod -p=2\"", got)
+	}
+	if got := getEnvVar(env, "GOMAXPROCS"); got != "2" {
+		t.Errorf("GOMAXPROCS = %q; want \"2\"", got)
+	}
+
+	if env := limitBuildParallelism(nil, 0); len(env) != 0 {
+		t.Errorf("limitBuildParallelism(0) = %v; want no change", env)
+	}
+}
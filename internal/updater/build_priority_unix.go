@@ -0,0 +1,27 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// buildNiceness maps each reduced build priority to a nice value
+var buildNiceness = map[string]int{
+	BuildPriorityLow:  10,
+	BuildPriorityIdle: 19,
+}
+
+// setBuildCreationPriority does nothing on Unix, where the priority can only
+// be changed once the process exists
+func setBuildCreationPriority(cmd *exec.Cmd, priority string) {}
+
+// lowerProcessPriority renices the process with pid and lowers its I/O
+// priority where the platform supports it
+func lowerProcessPriority(pid int, priority string) error {
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, buildNiceness[priority]); err != nil {
+		return err
+	}
+	return setIOPriority(pid, priority)
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// TestPrioritizeBuild verifies that the started process is reniced for the
+// reduced priorities, and that no SysProcAttr is needed for it on Unix
+func TestPrioritizeBuild(t *testing.T) {
+	for _, priority := range []string{BuildPriorityLow, BuildPriorityIdle} {
+		cmd := exec.Command("sleep", "5")
+		started := prioritizeBuild(cmd, priority)
+		if cmd.SysProcAttr != nil {
+			t.Errorf("prioritizeBuild(%s) set SysProcAttr = %+v; want nil", priority, cmd.SysProcAttr)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Skipf("cannot start sleep: %v", err)
+		}
+		started(cmd.Process)
+
+		got, err := syscall.Getpriority(syscall.PRIO_PROCESS, cmd.Process.Pid)
+		cmd.Process.Kill()
+		cmd.Wait()
+		if err != nil {
+			t.Fatalf("Getpriority() failed: %v", err)
+		}
+		// The Linux system call reports 20 - nice
+		if runtime.GOOS == "linux" {
+			got = 20 - got
+		}
+		if got != buildNiceness[priority] {
+			t.Errorf("prioritizeBuild(%s) nice = %d; want %d", priority, got, buildNiceness[priority])
+		}
+	}
+
+	if started := prioritizeBuild(exec.Command("sleep", "5"), BuildPriorityNormal); started != nil {
+		t.Errorf("prioritizeBuild(normal) returned a start hook; want nil")
+	}
+}
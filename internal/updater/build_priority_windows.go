@@ -0,0 +1,31 @@
+//go:build windows
+
+package updater
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// buildPriorityClass maps each reduced build priority to a process priority class
+var buildPriorityClass = map[string]uint32{
+	BuildPriorityLow:  windows.BELOW_NORMAL_PRIORITY_CLASS,
+	BuildPriorityIdle: windows.IDLE_PRIORITY_CLASS,
+}
+
+// setBuildCreationPriority creates the process in the priority class for
+// priority, which the processes it starts inherit
+func setBuildCreationPriority(cmd *exec.Cmd, priority string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= buildPriorityClass[priority]
+}
+
+// lowerProcessPriority does nothing on Windows, where the priority class is
+// set when the process is created
+func lowerProcessPriority(pid int, priority string) error {
+	return nil
+}
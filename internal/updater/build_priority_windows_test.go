@@ -0,0 +1,36 @@
+//go:build windows
+
+package updater
+
+import (
+	"os/exec"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// TestPrioritizeBuild verifies that the build is created in the priority
+// class for the configured priority
+func TestPrioritizeBuild(t *testing.T) {
+	tests := []struct {
+		priority string
+		want     uint32
+	}{
+		{BuildPriorityLow, windows.BELOW_NORMAL_PRIORITY_CLASS},
+		{BuildPriorityIdle, windows.IDLE_PRIORITY_CLASS},
+	}
+
+	for _, tt := range tests {
+		cmd := exec.Command("go", "version")
+		prioritizeBuild(cmd, tt.priority)
+		if cmd.SysProcAttr == nil || cmd.SysProcAttr.CreationFlags != tt.want {
+			t.Errorf("prioritizeBuild(%s) SysProcAttr = %+v; want CreationFlags %#x", tt.priority, cmd.SysProcAttr, tt.want)
+		}
+	}
+
+	cmd := exec.Command("go", "version")
+	prioritizeBuild(cmd, BuildPriorityNormal)
+	if cmd.SysProcAttr != nil {
+		t.Errorf("prioritizeBuild(normal) SysProcAttr = %+v; want nil", cmd.SysProcAttr)
+	}
+}
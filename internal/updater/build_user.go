@@ -0,0 +1,52 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// buildAccount is the unprivileged user the agent build runs as
+type buildAccount struct {
+	Name string
+	UID  int
+	GID  int
+}
+
+// resolveBuildAccount looks up the configured build user. It returns nil when
+// none is configured or the updater is not root, since only root can switch
+// users; an unknown user is an error rather than a silent build as root.
+func resolveBuildAccount(name string) (*buildAccount, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if os.Geteuid() != 0 {
+		LogWarning("buildUser %q is ignored because the updater is not running as root", name)
+		return nil, nil
+	}
+
+	account, err := lookupBuildAccount(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up build user %q: %w", name, err)
+	}
+	return account, nil
+}
+
+// prepareBuildAccount hands the build directories under dataDir to account
+// and points HOME at its build home, returning the updated environment. Only
+// installing the compiled binary is left to root.
+func prepareBuildAccount(account *buildAccount, dataDir string, dirs *goDirs, env []string) ([]string, error) {
+	home := paths.BuildHomeDirectory(dataDir)
+	for _, dir := range []string{dirs.GOPATH, dirs.GOCACHE, dirs.GOMODCACHE, dirs.GOBIN, home} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create build directory %s: %w", dir, err)
+		}
+	}
+	for _, dir := range []string{dirs.GOPATH, dirs.GOBIN, home} {
+		if err := chownBuildTree(dir, account); err != nil {
+			return nil, fmt.Errorf("failed to give %s to build user %s: %w", dir, account.Name, err)
+		}
+	}
+	return setEnvVar(env, "HOME", home), nil
+}
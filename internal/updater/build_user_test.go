@@ -0,0 +1,30 @@
+package updater
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestResolveGoDirsForBuildUser verifies that a build user gets its own
+// GOPATH and caches under the data directory instead of root's
+func TestResolveGoDirsForBuildUser(t *testing.T) {
+	t.Setenv("GOPATH", "/root/go")
+	t.Setenv("GOCACHE", "/root/.cache/go-build")
+	withConfig(t, &UpdaterConfig{BuildUser: "sentinelgo-build"})
+
+	dataDir := t.TempDir()
+	dirs, err := resolveGoDirs(dataDir)
+	if err != nil {
+		t.Fatalf("resolveGoDirs() failed: %v", err)
+	}
+	gopath := filepath.Join(dataDir, "build", "gopath")
+	want := goDirs{
+		GOPATH:     gopath,
+		GOBIN:      filepath.Join(dataDir, "build", "bin"),
+		GOCACHE:    filepath.Join(gopath, "cache"),
+		GOMODCACHE: filepath.Join(gopath, "pkg", "mod"),
+	}
+	if *dirs != want {
+		t.Errorf("resolveGoDirs() = %+v; want %+v", *dirs, want)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+
+package updater
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// lookupBuildAccount resolves name to its uid and primary gid
+func lookupBuildAccount(name string) (*buildAccount, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, err
+	}
+	return &buildAccount{Name: u.Username, UID: uid, GID: gid}, nil
+}
+
+// runAsBuildAccount makes cmd run with the uid and gid of account and no
+// supplementary groups, so nothing of root's group memberships is kept
+func runAsBuildAccount(cmd *exec.Cmd, account *buildAccount) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    uint32(account.UID),
+		Gid:    uint32(account.GID),
+		Groups: []uint32{},
+	}
+}
+
+// chownBuildTree gives account everything under dir that it does not own yet,
+// such as caches left by builds that ran as root
+func chownBuildTree(dir string, account *buildAccount) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) == account.UID && int(stat.Gid) == account.GID {
+			return nil
+		}
+		return os.Lchown(path, account.UID, account.GID)
+	})
+}
@@ -0,0 +1,98 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestRunAsBuildAccount verifies the uid and gid set on the build process and
+// that supplementary groups are dropped
+func TestRunAsBuildAccount(t *testing.T) {
+	cmd := exec.Command("id")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	runAsBuildAccount(cmd, &buildAccount{Name: "sentinelgo-build", UID: 1234, GID: 5678})
+
+	credential := cmd.SysProcAttr.Credential
+	if credential == nil {
+		t.Fatal("runAsBuildAccount() left Credential unset")
+	}
+	if credential.Uid != 1234 || credential.Gid != 5678 {
+		t.Errorf("Credential = uid %d, gid %d; want uid 1234, gid 5678", credential.Uid, credential.Gid)
+	}
+	if credential.Groups == nil || len(credential.Groups) != 0 || credential.NoSetGroups {
+		t.Errorf("Credential groups = %v (NoSetGroups %v); want them cleared", credential.Groups, credential.NoSetGroups)
+	}
+	if !cmd.SysProcAttr.Setpgid {
+		t.Error("runAsBuildAccount() replaced the existing SysProcAttr")
+	}
+}
+
+// TestBuildAccountProcess verifies that a process started as the build user
+// really runs with its uid and gid, and can write to the directories handed
+// over to it
+func TestBuildAccountProcess(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users needs root")
+	}
+	account, err := lookupBuildAccount("nobody")
+	if err != nil {
+		t.Skipf("no nobody user: %v", err)
+	}
+
+	// The build user must be able to reach the data directory, as it can in
+	// production
+	dataDir := t.TempDir()
+	os.Chmod(filepath.Dir(dataDir), 0755)
+	os.Chmod(dataDir, 0755)
+	withConfig(t, &UpdaterConfig{BuildUser: "nobody"})
+	dirs, err := resolveGoDirs(dataDir)
+	if err != nil {
+		t.Fatalf("resolveGoDirs() failed: %v", err)
+	}
+
+	// A cache file left by a build that ran as root
+	stale := filepath.Join(dirs.GOMODCACHE, "cache", "stale")
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := prepareBuildAccount(account, dataDir, dirs, os.Environ())
+	if err != nil {
+		t.Fatalf("prepareBuildAccount() failed: %v", err)
+	}
+	if home := getEnvVar(env, "HOME"); home != filepath.Join(dataDir, "build", "home") {
+		t.Errorf("HOME = %q; want the build home", home)
+	}
+	info, err := os.Stat(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat := info.Sys().(*syscall.Stat_t); int(stat.Uid) != account.UID || int(stat.Gid) != account.GID {
+		t.Errorf("stale cache owned by %d:%d; want %d:%d", stat.Uid, stat.Gid, account.UID, account.GID)
+	}
+
+	cmd := exec.Command("sh", "-c", `id -u; id -g; touch "$GOBIN/built"`)
+	cmd.Env = setEnvVar(env, "GOBIN", dirs.GOBIN)
+	runAsBuildAccount(cmd, account)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("build process failed: %v\n%s", err, output)
+	}
+	want := strconv.Itoa(account.UID) + "\n" + strconv.Itoa(account.GID)
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Errorf("build process ids = %q; want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dirs.GOBIN, "built")); err != nil {
+		t.Errorf("build user could not write to GOBIN: %v", err)
+	}
+}
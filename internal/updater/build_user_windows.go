@@ -0,0 +1,22 @@
+//go:build windows
+
+package updater
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// lookupBuildAccount always fails: Windows services cannot start a process as
+// another user without that user's password
+func lookupBuildAccount(name string) (*buildAccount, error) {
+	return nil, errors.New("a build user is not supported on Windows")
+}
+
+// runAsBuildAccount does nothing on Windows
+func runAsBuildAccount(cmd *exec.Cmd, account *buildAccount) {}
+
+// chownBuildTree does nothing on Windows
+func chownBuildTree(dir string, account *buildAccount) error {
+	return nil
+}
@@ -0,0 +1,43 @@
+package updater
+
+import "fmt"
+
+// UpdaterVersion is the version of the updater itself, set by SetBuildInfo
+var UpdaterVersion = "dev"
+
+// BuildInfo identifies the updater build, as stamped into main by the
+// release's ldflags
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+}
+
+// updaterBuild holds the commit and build time set by SetBuildInfo; the
+// version is UpdaterVersion
+var updaterBuild BuildInfo
+
+// SetBuildInfo records the build of this updater, which the log, status,
+// update history, inventory reports and telemetry events then name
+func SetBuildInfo(version, commit, buildTime string) {
+	UpdaterVersion = version
+	updaterBuild = BuildInfo{Commit: commit, BuildTime: buildTime}
+}
+
+// currentBuild returns the build of this updater
+func currentBuild() BuildInfo {
+	build := updaterBuild
+	build.Version = UpdaterVersion
+	return build
+}
+
+func (b BuildInfo) String() string {
+	commit, buildTime := b.Commit, b.BuildTime
+	if commit == "" {
+		commit = "unknown"
+	}
+	if buildTime == "" {
+		buildTime = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s)", b.Version, commit, buildTime)
+}
@@ -0,0 +1,358 @@
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+const (
+	// DefaultBundleAgentLogKB is how much of the end of agent.log a
+	// diagnostic bundle includes
+	DefaultBundleAgentLogKB = 512
+
+	// bundleLogFileLimit caps each updater log file in a bundle; the end
+	// of a longer current log is kept
+	bundleLogFileLimit = 20 * 1024 * 1024
+
+	// bundleStateFileLimit caps each state file in a bundle
+	bundleStateFileLimit = 1024 * 1024
+
+	// bundleCommandOutputLimit caps the output of each system command
+	bundleCommandOutputLimit = 256 * 1024
+
+	// bundleCommandTimeout bounds each system command
+	bundleCommandTimeout = 10 * time.Second
+
+	// bundleServiceLogLines is how many lines of the agent service's output
+	// the service manager is asked for
+	bundleServiceLogLines = 200
+)
+
+// bundleStateFiles are the state files of the data directory a bundle
+// includes. The agent database is never included.
+var bundleStateFiles = []string{
+	statusFileName,
+	heartbeatFileName,
+	pauseFileName,
+	historyFileName,
+	versionCheckFileName,
+	manifestFileName,
+	updateMarkerFileName,
+	backupMetadataFileName,
+	toolchainCacheFileName,
+	cgoProbeCacheFileName,
+	machinePathRecordFileName,
+	telemetryQueueFileName,
+}
+
+// BundleOptions configures a diagnostic bundle
+type BundleOptions struct {
+	// AgentLogKB is how much of the end of agent.log is included
+	AgentLogKB int
+}
+
+// BundleManifest describes what a diagnostic bundle holds; it is written to
+// the bundle as manifest.json
+type BundleManifest struct {
+	CreatedAt      time.Time    `json:"createdAt"`
+	UpdaterVersion string       `json:"updaterVersion"`
+	Hostname       string       `json:"hostname"`
+	OS             string       `json:"os"`
+	Arch           string       `json:"arch"`
+	Files          []BundleFile `json:"files"`
+}
+
+// BundleFile is one file of a diagnostic bundle, or one that is missing on
+// this host or could not be included, with why
+type BundleFile struct {
+	Name      string `json:"name"`
+	Source    string `json:"source,omitempty"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Missing   bool   `json:"missing,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Included returns the files of the manifest that are in the bundle
+func (m *BundleManifest) Included() []BundleFile {
+	var files []BundleFile
+	for _, file := range m.Files {
+		if !file.Missing && file.Error == "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// diagnosticBundle writes files to a zip archive and records them in its
+// manifest
+type diagnosticBundle struct {
+	archive  *zip.Writer
+	manifest BundleManifest
+}
+
+// add writes data to the bundle as name
+func (b *diagnosticBundle) add(name, source string, data []byte, truncated bool) {
+	file := BundleFile{Name: name, Source: source, Size: int64(len(data)), Truncated: truncated}
+	writer, err := b.archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now()})
+	if err == nil {
+		_, err = writer.Write(data)
+	}
+	if err != nil {
+		file.Error = err.Error()
+	}
+	b.manifest.Files = append(b.manifest.Files, file)
+}
+
+// addError records that name could not be included
+func (b *diagnosticBundle) addError(name, source string, err error) {
+	b.manifest.Files = append(b.manifest.Files, BundleFile{Name: name, Source: source, Error: err.Error()})
+}
+
+// addFile adds the file at path as name. A file larger than limit is cut to
+// its last limit bytes, or left out when it is compressed and cannot be cut.
+func (b *diagnosticBundle) addFile(name, path string, limit int64, compressed bool) {
+	data, truncated, err := readFileTail(path, limit)
+	if err == nil && truncated && compressed {
+		err = fmt.Errorf("compressed file larger than %d MB", limit/(1024*1024))
+	}
+	if os.IsNotExist(err) {
+		b.manifest.Files = append(b.manifest.Files, BundleFile{Name: name, Source: path, Missing: true})
+		return
+	}
+	if err != nil {
+		b.addError(name, path, err)
+		return
+	}
+	b.add(name, path, data, truncated)
+}
+
+// addJSON adds v encoded as indented JSON as name
+func (b *diagnosticBundle) addJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.addError(name, "", err)
+		return
+	}
+	b.add(name, "", data, false)
+}
+
+// addCommands adds the combined output of commands, each preceded by the
+// command line, as name. A command that fails is recorded with its error.
+func (b *diagnosticBundle) addCommands(name string, commands [][]string) {
+	var output bytes.Buffer
+	for _, command := range commands {
+		fmt.Fprintf(&output, "$ %s\n", strings.Join(command, " "))
+		ctx, cancel := context.WithTimeout(context.Background(), bundleCommandTimeout)
+		result, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+		cancel()
+		output.Write(result)
+		if err != nil {
+			fmt.Fprintf(&output, "[%v]\n", err)
+		}
+		output.WriteString("\n")
+	}
+	data, truncated := output.Bytes(), false
+	if len(data) > bundleCommandOutputLimit {
+		data, truncated = data[:bundleCommandOutputLimit], true
+	}
+	b.add(name, "", data, truncated)
+}
+
+// readFileTail returns the file at path, or its last limit bytes and true
+// when it is larger
+func readFileTail(path string, limit int64) ([]byte, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := info.Size() > limit
+	if truncated {
+		if _, err := file.Seek(-limit, io.SeekEnd); err != nil {
+			return nil, false, err
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(file, limit))
+	return data, truncated, err
+}
+
+// redactConfigFile returns the config file at path as indented JSON, with
+// the values of secret settings and URL credentials hidden. A file that does
+// not parse is not included at all, as it cannot be redacted.
+func redactConfigFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLConfig(path) {
+		// Redacted as the JSON the YAML stands for; its comments are lost
+		if raw, err = yamlToJSON(raw); err != nil {
+			return nil, fmt.Errorf("not included, it is not valid YAML and cannot be redacted: %w", err)
+		}
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("not included, it is not valid JSON and cannot be redacted: %w", err)
+	}
+	return json.MarshalIndent(redactJSONValue("", config), "", "  ")
+}
+
+// redactJSONValue hides the values of secret settings in v, the value of
+// the setting called name, at any depth
+func redactJSONValue(name string, v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if isSecretSetting(key) {
+				value[key] = "[REDACTED]"
+			} else {
+				value[key] = redactJSONValue(key, item)
+			}
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactJSONValue(name, item)
+		}
+		return value
+	case string:
+		return redactConfigValue(name, value)
+	default:
+		return v
+	}
+}
+
+// collectDiagnostics adds the logs, the redacted config and the state files
+// of dataDir to the bundle
+func collectDiagnostics(b *diagnosticBundle, dataDir, configPath string, options BundleOptions) {
+	if files, err := listLogFiles(filepath.Join(dataDir, "updater.log")); err != nil {
+		b.addError("logs/updater.log", filepath.Join(dataDir, "updater.log"), err)
+	} else {
+		for _, file := range files {
+			b.addFile("logs/"+filepath.Base(file.Path), file.Path, bundleLogFileLimit, file.Compressed)
+		}
+	}
+	agentLogKB := options.AgentLogKB
+	if agentLogKB <= 0 {
+		agentLogKB = DefaultBundleAgentLogKB
+	}
+	b.addFile("logs/agent.log", filepath.Join(dataDir, "agent.log"), int64(agentLogKB)*1024, false)
+
+	if data, err := redactConfigFile(configPath); os.IsNotExist(err) {
+		b.manifest.Files = append(b.manifest.Files, BundleFile{Name: "config/updater-config.json", Source: configPath, Missing: true})
+	} else if err != nil {
+		b.addError("config/updater-config.json", configPath, err)
+	} else {
+		b.add("config/updater-config.json", configPath, data, false)
+	}
+	b.add("config/effective-config.txt", "", []byte(effectiveConfigSummary(getConfig())+"\n"), false)
+
+	for _, name := range bundleStateFiles {
+		b.addFile("state/"+name, filepath.Join(dataDir, name), bundleStateFileLimit, false)
+	}
+	b.addFile("state/backups-index.json", filepath.Join(paths.GetBackupDirectory(), backupIndexFileName), bundleStateFileLimit, false)
+}
+
+// systemCommands returns the commands whose output describes the operating
+// system and the state of the agent and updater services
+func systemCommands() (osVersion, services [][]string) {
+	names := []string{agentServiceName(), updaterServiceName}
+	switch runtime.GOOS {
+	case "windows":
+		osVersion = [][]string{{"cmd", "/c", "ver"}}
+		for _, name := range names {
+			services = append(services, []string{"sc", "queryex", name}, []string{"sc", "qc", name})
+		}
+	case "darwin":
+		osVersion = [][]string{{"sw_vers"}, {"uname", "-a"}}
+		for _, name := range names {
+			services = append(services, []string{"launchctl", "print", "system/" + name})
+		}
+	default:
+		osVersion = [][]string{{"cat", "/etc/os-release"}, {"uname", "-a"}}
+		services = [][]string{append([]string{"systemctl", "status", "--no-pager", "--lines=50"}, names...)}
+	}
+	return osVersion, services
+}
+
+// WriteDiagnosticBundle writes a zip archive for support to path: the updater
+// logs, the end of agent.log, the configuration with secrets redacted, the
+// state files, the doctor report and system facts, listed in manifest.json.
+// The agent database is never included.
+func WriteDiagnosticBundle(path string, options BundleOptions) (*BundleManifest, error) {
+	config, err := loadConfigPath(paths.GetUpdaterConfigPath())
+	if err != nil {
+		LogDebug("Failed to load configuration: %v", err)
+	}
+	activeConfig.Store(config)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer file.Close()
+
+	hostname, _ := os.Hostname()
+	b := &diagnosticBundle{
+		archive: zip.NewWriter(file),
+		manifest: BundleManifest{
+			CreatedAt:      now(),
+			UpdaterVersion: UpdaterVersion,
+			Hostname:       hostname,
+			OS:             runtime.GOOS,
+			Arch:           runtime.GOARCH,
+		},
+	}
+
+	collectDiagnostics(b, paths.GetDataDirectory(), paths.GetUpdaterConfigPath(), options)
+	b.addJSON("doctor.json", RunDoctor())
+	if output, err := serviceManager.RecentLogs(agentServiceName(), bundleServiceLogLines); err != nil {
+		b.addError("logs/agent-service.log", agentServiceName(), err)
+	} else {
+		b.add("logs/agent-service.log", agentServiceName(), []byte(output), false)
+	}
+	b.addJSON("system/facts.json", map[string]interface{}{
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+		"cpus":           runtime.NumCPU(),
+		"hostname":       hostname,
+		"updaterVersion": UpdaterVersion,
+		"updaterCommit":  currentBuild().Commit,
+		"updaterBuilt":   currentBuild().BuildTime,
+		"updaterGo":      runtime.Version(),
+		"dataDirectory":  paths.GetDataDirectory(),
+		"configPath":     paths.GetUpdaterConfigPath(),
+		"agentService":   agentServiceName(),
+		"privileged":     isPrivileged(),
+	})
+	osVersion, services := systemCommands()
+	b.addCommands("system/os-version.txt", osVersion)
+	b.addCommands("system/service-status.txt", services)
+
+	b.addJSON("manifest.json", b.manifest)
+	if err := b.archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return &b.manifest, nil
+}
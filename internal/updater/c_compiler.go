@@ -0,0 +1,84 @@
+package updater
+
+import (
+	"strings"
+)
+
+// cCompilers are the C compilers cgo can use, in the order they are tried
+// when CC is not set
+var cCompilers = []string{"cc", "gcc", "clang"}
+
+// lookPath finds an executable on the PATH in env; it is a variable so tests
+// can choose which commands exist
+var lookPath = lookPathIn
+
+// packageManagerHints maps package managers to the command that installs a C
+// compiler with them, in the order they are looked for
+var packageManagerHints = []struct {
+	manager string
+	install string
+}{
+	{"apt-get", "apt-get install -y gcc libc6-dev"},
+	{"dnf", "dnf install -y gcc glibc-devel"},
+	{"yum", "yum install -y gcc glibc-devel"},
+	{"apk", "apk add build-base"},
+	{"zypper", "zypper install -y gcc glibc-devel"},
+	{"pacman", "pacman -S --noconfirm gcc"},
+}
+
+// findCCompiler returns the C compiler cgo would use with env: the command
+// in CC when set, otherwise the first of cc, gcc and clang on PATH
+func findCCompiler(env []string) (string, bool) {
+	candidates := cCompilers
+	if fields := strings.Fields(getEnvVar(env, "CC")); len(fields) > 0 {
+		candidates = fields[:1]
+	}
+	for _, name := range candidates {
+		if path, err := lookPath(env, name); err == nil {
+			return path, true
+		}
+	}
+	return strings.Join(candidates, ", "), false
+}
+
+// cCompilerInstallHint returns how to install a C compiler on goos, using the
+// first package manager available reports as installed
+func cCompilerInstallHint(goos string, available func(string) bool) string {
+	if goos == "darwin" {
+		if available("brew") {
+			return "xcode-select --install (or brew install gcc)"
+		}
+		return "xcode-select --install"
+	}
+	for _, hint := range packageManagerHints {
+		if available(hint.manager) {
+			return hint.install
+		}
+	}
+	var installs []string
+	for _, hint := range packageManagerHints[:4] {
+		installs = append(installs, hint.install)
+	}
+	return strings.Join(installs, " or ")
+}
+
+// ensureCCompiler checks that a C compiler is available for a CGO build on
+// Linux and macOS, so a missing one is reported as C_COMPILER_MISSING with
+// the command that installs it instead of an opaque cgo error deep into the
+// build. Nothing is installed.
+func ensureCCompiler(goos string, env []string) error {
+	compiler, found := findCCompiler(env)
+	if found {
+		LogDebug("C compiler for CGO: %s", compiler)
+		return nil
+	}
+
+	hint := cCompilerInstallHint(goos, func(name string) bool {
+		_, err := lookPath(env, name)
+		return err == nil
+	})
+	LogError("CGO compilation requires a C compiler, but none of %s was found on PATH", compiler)
+	LogError("  Install one with: %s", hint)
+	LogError("  Or set cgoEnabled to \"false\" or \"auto\" if the agent builds without CGO")
+	return newUpdateError(ErrCodeCCompilerMissing, "no C compiler (%s) found on PATH; install one with: %s", compiler, hint)
+}
@@ -0,0 +1,106 @@
+package updater
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// stubLookPath makes only the commands in installed exist
+func stubLookPath(t *testing.T, installed ...string) {
+	original := lookPath
+	lookPath = func(_ []string, name string) (string, error) {
+		for _, command := range installed {
+			if name == command {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+	t.Cleanup(func() { lookPath = original })
+}
+
+// TestFindCCompiler verifies the compilers are tried in order and that CC
+// overrides them
+func TestFindCCompiler(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed []string
+		env       []string
+		want      string
+		found     bool
+	}{
+		{"cc first", []string{"cc", "gcc", "clang"}, nil, "/usr/bin/cc", true},
+		{"clang only", []string{"clang"}, nil, "/usr/bin/clang", true},
+		{"none", []string{"apt-get"}, nil, "cc, gcc, clang", false},
+		{"CC with flags", []string{"cc", "musl-gcc"}, []string{"CC=musl-gcc -static"}, "/usr/bin/musl-gcc", true},
+		{"CC missing", []string{"cc"}, []string{"CC=clang"}, "clang", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubLookPath(t, tt.installed...)
+			got, found := findCCompiler(tt.env)
+			if got != tt.want || found != tt.found {
+				t.Errorf("findCCompiler() = %q, %v; want %q, %v", got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+// TestCCompilerInstallHint verifies the hint matches the package manager
+func TestCCompilerInstallHint(t *testing.T) {
+	tests := []struct {
+		goos     string
+		managers []string
+		want     string
+	}{
+		{"linux", []string{"apt-get"}, "apt-get install -y gcc libc6-dev"},
+		{"linux", []string{"yum"}, "yum install -y gcc glibc-devel"},
+		{"linux", []string{"dnf", "yum"}, "dnf install -y gcc glibc-devel"},
+		{"linux", []string{"apk"}, "apk add build-base"},
+		{"darwin", []string{"brew"}, "xcode-select --install (or brew install gcc)"},
+		{"darwin", nil, "xcode-select --install"},
+	}
+
+	for _, tt := range tests {
+		available := func(name string) bool {
+			for _, manager := range tt.managers {
+				if name == manager {
+					return true
+				}
+			}
+			return false
+		}
+		if got := cCompilerInstallHint(tt.goos, available); got != tt.want {
+			t.Errorf("cCompilerInstallHint(%s, %v) = %q; want %q", tt.goos, tt.managers, got, tt.want)
+		}
+	}
+
+	unknown := cCompilerInstallHint("linux", func(string) bool { return false })
+	for _, want := range []string{"apt-get", "yum", "apk"} {
+		if !strings.Contains(unknown, want) {
+			t.Errorf("hint without a package manager = %q; want it to mention %s", unknown, want)
+		}
+	}
+}
+
+// TestEnsureCCompiler verifies a missing compiler is reported as
+// C_COMPILER_MISSING with an install hint
+func TestEnsureCCompiler(t *testing.T) {
+	stubLookPath(t, "apk")
+	err := ensureCCompiler("linux", nil)
+	var updateErr *UpdateError
+	if !errors.As(err, &updateErr) || updateErr.Code != ErrCodeCCompilerMissing {
+		t.Fatalf("ensureCCompiler() = %v; want %s", err, ErrCodeCCompilerMissing)
+	}
+	if !strings.Contains(err.Error(), "apk add build-base") {
+		t.Errorf("ensureCCompiler() = %v; want the apk install hint", err)
+	}
+
+	stubLookPath(t, "gcc")
+	if err := ensureCCompiler("linux", nil); err != nil {
+		t.Errorf("ensureCCompiler() with gcc = %v; want nil", err)
+	}
+}
@@ -0,0 +1,150 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// cgoProbeCacheFileName records the toolchain that last passed the probe
+	cgoProbeCacheFileName = "cgo-probe.json"
+
+	// cgoProbeTimeout bounds building and running the probe program
+	cgoProbeTimeout = 5 * time.Minute
+
+	// cgoProbeOutput is printed by the probe program when it runs
+	cgoProbeOutput = "cgo probe ok"
+)
+
+// cgoProbeSource is a minimal program that needs a working C compiler,
+// linker and C runtime to build and run
+const cgoProbeSource = `package main
+
+/*
+#include <stdio.h>
+
+static int probe_add(int a, int b) { return a + b; }
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	if C.probe_add(2, 3) != 5 {
+		panic("unexpected result from C")
+	}
+	fmt.Println("` + cgoProbeOutput + `")
+}
+`
+
+// CGOProbeResult identifies a toolchain that passed the probe
+type CGOProbeResult struct {
+	GCCPath  string    `json:"gccPath"`
+	Version  string    `json:"version"`
+	ProbedAt time.Time `json:"probedAt"`
+}
+
+// runCGOProbe builds and runs the probe; it is a variable so tests can count calls
+var runCGOProbe = probeCGOToolchain
+
+// findGCCInEnv returns the gcc executable found on the PATH of env
+func findGCCInEnv(env []string) string {
+	for _, dir := range filepath.SplitList(getEnvVar(env, "PATH")) {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(gccExecutable(dir)); err == nil {
+			return gccExecutable(dir)
+		}
+	}
+	return ""
+}
+
+// probeCGOToolchain compiles and runs a tiny cgo program with goBinary and
+// env, the same toolchain and environment the agent build will use. A gcc
+// that runs but cannot compile, link or produce a working binary fails here
+// instead of deep into the real build.
+func probeCGOToolchain(goBinary string, env []string) error {
+	dir, err := os.MkdirTemp("", "sentinel-cgo-probe-")
+	if err != nil {
+		return fmt.Errorf("failed to create probe directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":  "module cgoprobe\n\ngo 1.21\n",
+		"main.go": cgoProbeSource,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write probe %s: %w", name, err)
+		}
+	}
+
+	probeBinary := filepath.Join(dir, "probe")
+	if runtime.GOOS == "windows" {
+		probeBinary += ".exe"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cgoProbeTimeout)
+	defer cancel()
+
+	stdout, stderr, err := commandRunner.Run(ctx, goBinary, []string{"build", "-o", probeBinary, "."}, env, dir)
+	if err != nil {
+		return fmt.Errorf("probe build failed: %w: %s", err, strings.TrimSpace(string(stdout)+string(stderr)))
+	}
+
+	stdout, stderr, err = commandRunner.Run(ctx, probeBinary, nil, env, "")
+	output := append(stdout, stderr...)
+	if err != nil {
+		return fmt.Errorf("probe binary failed to run: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	if strings.TrimSpace(string(output)) != cgoProbeOutput {
+		return fmt.Errorf("probe binary printed unexpected output: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// verifyCGOToolchain makes sure the toolchain in env can build a cgo program,
+// skipping the probe when the same gcc path and version already passed it.
+// A failure is reported as GCC_INSTALLATION_FAILED.
+func verifyCGOToolchain(dataDir, goBinary string, env []string) error {
+	gccPath := findGCCInEnv(env)
+	if gccPath == "" {
+		return newUpdateError(ErrCodeGCCInstallationFailed, "gcc not found on the build PATH")
+	}
+
+	version, err := gccVersion(filepath.Dir(gccPath))
+	if err != nil {
+		return newUpdateError(ErrCodeGCCInstallationFailed, "%v", err)
+	}
+
+	cachePath := filepath.Join(dataDir, cgoProbeCacheFileName)
+	var cached CGOProbeResult
+	if found, err := readJSONFile(cachePath, &cached); err == nil && found &&
+		cached.GCCPath == gccPath && cached.Version == version {
+		LogInfo("C toolchain %s (%s) already verified at %s", gccPath, version, cached.ProbedAt.Format(time.RFC3339))
+		return nil
+	}
+
+	LogInfo("Verifying C toolchain %s (%s) with a test cgo build...", gccPath, version)
+	if err := runCGOProbe(goBinary, env); err != nil {
+		os.Remove(cachePath)
+		LogError("C toolchain is not working: %v", err)
+		LogError("Reinstall GCC (e.g. winget install %s) and retry", getConfig().WingetPackage)
+		return newUpdateError(ErrCodeGCCInstallationFailed, "C toolchain at %s cannot build cgo programs: %v", gccPath, err)
+	}
+
+	LogInfo("C toolchain verified")
+	result := &CGOProbeResult{GCCPath: gccPath, Version: version, ProbedAt: time.Now()}
+	if err := writeJSONFile(cachePath, result); err != nil {
+		LogWarning("Failed to cache toolchain probe result: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// stubCGOProbe replaces the probe with one returning err and counts its calls
+func stubCGOProbe(t *testing.T, err error) *int {
+	calls := 0
+	original := runCGOProbe
+	runCGOProbe = func(string, []string) error {
+		calls++
+		return err
+	}
+	t.Cleanup(func() { runCGOProbe = original })
+	return &calls
+}
+
+// TestVerifyCGOToolchainCachesResult verifies that a passing probe is cached
+// for the same gcc path and version
+func TestVerifyCGOToolchainCachesResult(t *testing.T) {
+	gccDir := writeFakeGCC(t)
+	dataDir := t.TempDir()
+	env := []string{"PATH=" + gccDir}
+	calls := stubCGOProbe(t, nil)
+
+	for i := 0; i < 2; i++ {
+		if err := verifyCGOToolchain(dataDir, "go", env); err != nil {
+			t.Fatalf("verifyCGOToolchain() failed: %v", err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("probe ran %d times; want 1", *calls)
+	}
+}
+
+// TestVerifyCGOToolchainFailure verifies that a failing probe is classified
+// and clears a cached result
+func TestVerifyCGOToolchainFailure(t *testing.T) {
+	gccDir := writeFakeGCC(t)
+	dataDir := t.TempDir()
+	env := []string{"PATH=" + gccDir}
+
+	cached := &CGOProbeResult{GCCPath: gccExecutable(gccDir), Version: "gcc (old) 12.0.0"}
+	if err := writeJSONFile(filepath.Join(dataDir, cgoProbeCacheFileName), cached); err != nil {
+		t.Fatalf("failed to write probe cache: %v", err)
+	}
+	stubCGOProbe(t, fmt.Errorf("cc1.exe: missing api-ms-win-crt-runtime-l1-1-0.dll"))
+
+	err := verifyCGOToolchain(dataDir, "go", env)
+	if ErrorCodeOf(err) != ErrCodeGCCInstallationFailed {
+		t.Errorf("verifyCGOToolchain() error = %v; want %s", err, ErrCodeGCCInstallationFailed)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, cgoProbeCacheFileName)); !os.IsNotExist(err) {
+		t.Error("probe cache should be removed after a failed probe")
+	}
+}
+
+// TestProbeCGOToolchain builds and runs the probe with the host toolchain
+func TestProbeCGOToolchain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cgo probe build in short mode")
+	}
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not available")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not available")
+	}
+
+	env := setEnvVar(os.Environ(), "CGO_ENABLED", "1")
+	if err := probeCGOToolchain(goBinary, env); err != nil {
+		t.Errorf("probeCGOToolchain() failed: %v", err)
+	}
+}
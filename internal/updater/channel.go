@@ -0,0 +1,367 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UpdateChannel selects which published versions of the agent are installed
+type UpdateChannel string
+
+const (
+	// ChannelStable installs the highest tagged release without a prerelease suffix
+	ChannelStable UpdateChannel = "stable"
+
+	// ChannelBeta also accepts -beta and -rc prereleases
+	ChannelBeta UpdateChannel = "beta"
+
+	// ChannelCanary tracks the head of a branch through its pseudo-version
+	ChannelCanary UpdateChannel = "canary"
+
+	// ChannelDev installs DevRef, a branch, commit or pseudo-version, and
+	// treats any change of the resolved version as an update
+	ChannelDev UpdateChannel = "dev"
+)
+
+const (
+	// DefaultCanaryBranch is the branch the canary channel follows
+	DefaultCanaryBranch = "main"
+
+	// versionCheckFileName records the outcome of the last version check
+	versionCheckFileName = "version-check.json"
+)
+
+const (
+	// ResolverGoProxy lists published versions through the module proxy
+	ResolverGoProxy = "goproxy"
+
+	// ResolverGitHub lists the tags of the agent's GitHub repository
+	ResolverGitHub = "github"
+)
+
+// errNoTaggedVersions is returned when the module has no release tags yet
+var errNoTaggedVersions = errors.New("no tagged versions published")
+
+// VersionCheck is the outcome of a version check: every published version,
+// the retracted ones excluded from selection, and the one selected for the
+// channel
+type VersionCheck struct {
+	Module    string        `json:"module"`
+	Channel   UpdateChannel `json:"channel"`
+	Selected  string        `json:"selected,omitempty"`
+	Available []string      `json:"available"`
+	Retracted []string      `json:"retracted,omitempty"`
+	Branch    string        `json:"branch,omitempty"` // ref followed by canary or dev
+	Resolver  string        `json:"resolver,omitempty"`
+	CheckedAt time.Time     `json:"checkedAt"`
+
+	// Manifest is the update manifest the check was answered from, if any
+	Manifest *UpdateManifest `json:"manifest,omitempty"`
+}
+
+// betaPrereleases are the prerelease prefixes the beta channel accepts
+var betaPrereleases = []string{"beta", "rc"}
+
+func (c UpdateChannel) valid() bool {
+	switch c {
+	case ChannelStable, ChannelBeta, ChannelCanary, ChannelDev:
+		return true
+	}
+	return false
+}
+
+// accepts reports whether a tagged version belongs to the channel
+func (c UpdateChannel) accepts(version string) bool {
+	v, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	if !v.isPrerelease() {
+		return true
+	}
+	if c != ChannelBeta {
+		return false
+	}
+	for _, prefix := range betaPrereleases {
+		if strings.HasPrefix(v.prerelease[0], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectChannelVersion returns the highest version in versions that the
+// channel accepts, or "" when none does
+func selectChannelVersion(versions []string, channel UpdateChannel) string {
+	selected := ""
+	for _, version := range versions {
+		if !channel.accepts(version) {
+			continue
+		}
+		if selected == "" || compareVersions(version, selected) > 0 {
+			selected = version
+		}
+	}
+	return selected
+}
+
+// sortVersions returns the valid versions in ascending semver order
+func sortVersions(versions []string) []string {
+	sorted := []string{}
+	for _, version := range versions {
+		if _, ok := parseVersion(version); ok {
+			sorted = append(sorted, version)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareVersions(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// newVersionCheck selects the version to install from the published tags of
+// module. It fails with errNoTaggedVersions when nothing is tagged.
+func newVersionCheck(module string, channel UpdateChannel, versions []string) (*VersionCheck, error) {
+	check := &VersionCheck{
+		Module:    module,
+		Channel:   channel,
+		Available: sortVersions(versions),
+		CheckedAt: now(),
+	}
+
+	if len(check.Available) == 0 {
+		return check, fmt.Errorf("%s: %w", module, errNoTaggedVersions)
+	}
+
+	check.Selected = selectChannelVersion(check.Available, channel)
+	if check.Selected == "" {
+		return check, fmt.Errorf("no version matching the %s channel among %d published version(s)", channel, len(check.Available))
+	}
+	return check, nil
+}
+
+// isRetracted reports whether version was retracted by the module's authors
+func (c *VersionCheck) isRetracted(version string) bool {
+	for _, retracted := range c.Retracted {
+		if retracted == version {
+			return true
+		}
+	}
+	return false
+}
+
+// needsUpdate reports whether the selected version should replace current:
+// it is newer, or current was retracted and the selected version is the
+// newest release that was not, even if that is a downgrade. On the dev
+// channel any other version is an update, as pseudo-versions of different
+// branches do not order meaningfully, and so is any other version than the
+// one an update manifest pins. An empty current means no agent is installed.
+func (c *VersionCheck) needsUpdate(current string) bool {
+	if c.Selected == "" || sameRevision(current, c.Selected) {
+		return false
+	}
+	if current == "" {
+		return true
+	}
+	if c.Manifest != nil && c.Manifest.Version != "" {
+		return true
+	}
+	return c.Channel == ChannelDev || isNewerVersion(current, c.Selected) || c.isRetracted(current)
+}
+
+// versionRejection returns why config forbids installing version: it is
+// listed in skipVersions or below minVersion. It returns "" when the version
+// may be installed.
+func (c *UpdaterConfig) versionRejection(version string) string {
+	if slices.Contains(c.SkipVersions, version) {
+		return "listed in skipVersions"
+	}
+	if c.MinVersion != "" && compareVersions(version, c.MinVersion) < 0 {
+		return "below minVersion " + c.MinVersion
+	}
+	return ""
+}
+
+// withVersionPolicy returns check with a selected version that minVersion or
+// skipVersions rejects replaced by the highest published version on the
+// channel that neither does. A version pinned by the update manifest or
+// resolved from a tracked branch has no alternative, so rejecting it fails
+// the check, as does finding no other version.
+func (c *VersionCheck) withVersionPolicy(config *UpdaterConfig) (*VersionCheck, error) {
+	reason := config.versionRejection(c.Selected)
+	if reason == "" {
+		return c, nil
+	}
+	LogWarning("Rejecting %s: %s", c.Selected, reason)
+
+	check := *c
+	check.Selected = ""
+	if check.Branch == "" && (check.Manifest == nil || check.Manifest.Version == "") {
+		for _, version := range check.Available {
+			if check.Channel.accepts(version) && config.versionRejection(version) == "" && !check.isRetracted(version) {
+				check.Selected = version
+			}
+		}
+	}
+	if check.Selected == "" {
+		return nil, newUpdateError(ErrCodeVersionRejected, "selected version %s is %s and no other version is allowed", c.Selected, reason)
+	}
+	LogInfo("Selected %s instead of %s", check.Selected, c.Selected)
+	return &check, nil
+}
+
+// manifestDeferral returns why the update manifest holds back an update, or
+// "" when there is none or it does not
+func (c *VersionCheck) manifestDeferral() string {
+	if c.Manifest == nil {
+		return ""
+	}
+	return c.Manifest.deferral()
+}
+
+// logSkippedRetractions logs the retracted versions the channel would
+// otherwise have selected
+func (c *VersionCheck) logSkippedRetractions() {
+	for _, version := range c.Retracted {
+		if c.Channel.accepts(version) && (c.Selected == "" || isNewerVersion(c.Selected, version)) {
+			LogInfo("Skipping %s: the version is retracted", version)
+		}
+	}
+}
+
+// checkAvailableVersions lists the published versions of module and selects
+// the one to install on the configured channel, never a retracted one. The
+// canary and dev channels resolve their ref instead, so they work before
+// anything is tagged.
+func checkAvailableVersions(goBinary, module string, config *UpdaterConfig) (*VersionCheck, error) {
+	versions, retracted, err := listModuleVersions(goBinary, module)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := config.trackedRef()
+	if ref == "" {
+		check, err := newVersionCheck(module, config.Channel, versions)
+		check.Retracted = sortVersions(retracted)
+		check.logSkippedRetractions()
+		return check, err
+	}
+
+	check := &VersionCheck{
+		Module:    module,
+		Channel:   config.Channel,
+		Branch:    ref,
+		Available: sortVersions(versions),
+		Retracted: sortVersions(retracted),
+		CheckedAt: now(),
+	}
+	check.Selected, err = queryModuleVersion(goBinary, fmt.Sprintf("%s@%s", module, ref))
+	return check, err
+}
+
+// versionResolvers are the ways of checking for versions that the
+// versionResolvers setting can list
+var versionResolvers = map[string]func(goBinary, module string, config *UpdaterConfig) (*VersionCheck, error){
+	ResolverGoProxy: checkAvailableVersions,
+	ResolverGitHub: func(_, module string, config *UpdaterConfig) (*VersionCheck, error) {
+		return checkGitHubVersions(module, config)
+	},
+}
+
+// resolveVersion tries the configured resolvers in order until one selects a
+// version, recording which one did. When all fail, the first check made is
+// returned with every resolver's error.
+func resolveVersion(goBinary, module string, config *UpdaterConfig) (*VersionCheck, error) {
+	var first *VersionCheck
+	var errs []error
+
+	for _, name := range config.VersionResolvers {
+		check, err := versionResolvers[name](goBinary, module, config)
+		if check != nil {
+			check.Resolver = name
+			if first == nil {
+				first = check
+			}
+		}
+		if err == nil {
+			return check, nil
+		}
+		LogWarning("Version resolver %s failed: %v", name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no version resolvers configured")
+	}
+	return first, errors.Join(errs...)
+}
+
+// listModuleVersions returns the tagged versions of module known to the
+// module proxy, and separately those retracted by a retract directive in
+// the module's latest go.mod. go list only includes retracted versions with
+// -retracted, so the two listings are compared.
+func listModuleVersions(goBinary, module string) (versions, retracted []string, err error) {
+	all, err := queryModuleVersions(goBinary, "-m", "-retracted", "-versions", "-json", module)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions, err = queryModuleVersions(goBinary, "-m", "-versions", "-json", module)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	active := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		active[version] = true
+	}
+	for _, version := range all {
+		if !active[version] {
+			retracted = append(retracted, version)
+		}
+	}
+	return versions, retracted, nil
+}
+
+// queryModuleVersions runs go list with args and returns the listed versions
+func queryModuleVersions(goBinary string, args ...string) ([]string, error) {
+	output, err := runGoList(goBinary, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list module versions: %w", err)
+	}
+
+	var moduleInfo struct {
+		Versions []string `json:"Versions"`
+	}
+	if err := json.Unmarshal(output, &moduleInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse module versions: %w", err)
+	}
+
+	return moduleInfo.Versions, nil
+}
+
+// queryModuleVersion resolves a module query such as module@main to a
+// concrete version
+func queryModuleVersion(goBinary, query string) (string, error) {
+	output, err := runGoList(goBinary, "-m", "-json", query)
+	if err != nil {
+		return "", fmt.Errorf("failed to query %s: %w", query, err)
+	}
+
+	var moduleInfo struct {
+		Version string `json:"Version"`
+	}
+	if err := json.Unmarshal(output, &moduleInfo); err != nil {
+		return "", fmt.Errorf("failed to parse module info: %w", err)
+	}
+
+	if moduleInfo.Version == "" {
+		return "", fmt.Errorf("no version found in module info")
+	}
+
+	return moduleInfo.Version, nil
+}
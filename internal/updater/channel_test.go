@@ -0,0 +1,276 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+)
+
+// TestSelectChannelVersion verifies that each channel picks the highest
+// version it accepts
+func TestSelectChannelVersion(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.1.0", "v1.2.0-alpha.1", "v1.2.0-beta.1", "v1.2.0-rc.2", "v1.1.1", "not-a-version"}
+
+	tests := []struct {
+		channel UpdateChannel
+		want    string
+	}{
+		{ChannelStable, "v1.1.1"},
+		{ChannelBeta, "v1.2.0-rc.2"},
+	}
+
+	for _, tt := range tests {
+		if got := selectChannelVersion(versions, tt.channel); got != tt.want {
+			t.Errorf("selectChannelVersion(%s) = %q; want %q", tt.channel, got, tt.want)
+		}
+	}
+}
+
+// TestSelectChannelVersionPrereleasesOnly verifies that the stable channel
+// selects nothing when only prereleases are published
+func TestSelectChannelVersionPrereleasesOnly(t *testing.T) {
+	versions := []string{"v0.1.0-beta.1", "v0.1.0-rc.1"}
+
+	if got := selectChannelVersion(versions, ChannelStable); got != "" {
+		t.Errorf("selectChannelVersion(stable) = %q; want \"\"", got)
+	}
+}
+
+// TestLoadConfigPathChannel verifies that the channel is case-insensitive and
+// that an unknown channel, or dev without devRef, falls back to stable
+func TestLoadConfigPathChannel(t *testing.T) {
+	tests := []struct {
+		content string
+		want    UpdateChannel
+	}{
+		{`{}`, ChannelStable},
+		{`{"channel": "Beta"}`, ChannelBeta},
+		{`{"channel": "canary"}`, ChannelCanary},
+		{`{"channel": "nightly"}`, ChannelStable},
+		{`{"channel": "dev", "devRef": "feature/x"}`, ChannelDev},
+		{`{"channel": "dev"}`, ChannelStable},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		if config.Channel != tt.want {
+			t.Errorf("loadConfigPath(%s).Channel = %q; want %q", tt.content, config.Channel, tt.want)
+		}
+		if config.CanaryBranch != DefaultCanaryBranch {
+			t.Errorf("loadConfigPath(%s).CanaryBranch = %q; want %q", tt.content, config.CanaryBranch, DefaultCanaryBranch)
+		}
+	}
+}
+
+// TestNewVersionCheck verifies that the published versions are sorted and the
+// channel's newest version selected
+func TestNewVersionCheck(t *testing.T) {
+	check, err := newVersionCheck(MainAgentModule, ChannelStable, []string{"v1.10.0", "v1.2.0", "v1.10.1-rc.1", "v1.9.0"})
+	if err != nil {
+		t.Fatalf("newVersionCheck() failed: %v", err)
+	}
+
+	want := "v1.2.0 v1.9.0 v1.10.0 v1.10.1-rc.1"
+	if got := strings.Join(check.Available, " "); got != want {
+		t.Errorf("Available = %s; want %s", got, want)
+	}
+	if check.Selected != "v1.10.0" {
+		t.Errorf("Selected = %s; want v1.10.0", check.Selected)
+	}
+}
+
+// TestNewVersionCheckNoTags verifies that a module without tagged versions
+// is reported with errNoTaggedVersions
+func TestNewVersionCheckNoTags(t *testing.T) {
+	check, err := newVersionCheck(MainAgentModule, ChannelStable, nil)
+	if !errors.Is(err, errNoTaggedVersions) {
+		t.Errorf("newVersionCheck() error = %v; want errNoTaggedVersions", err)
+	}
+	if check == nil || len(check.Available) != 0 {
+		t.Errorf("newVersionCheck() = %+v; want an empty check", check)
+	}
+}
+
+// stubModuleVersions makes go list report all as the module's versions, with
+// retracted only listed when -retracted is passed
+func stubModuleVersions(t *testing.T, all, retracted string) {
+	useRunner(t, &commandtest.FakeRunner{Handler: func(call commandtest.Call) commandtest.Result {
+		versions := all
+		if slices.Contains(call.Args, "-retracted") {
+			versions = strings.TrimSpace(all + " " + retracted)
+		}
+		return commandtest.Result{Stdout: `{"Path": "` + MainAgentModule + `", "Versions": ["` + strings.Join(strings.Fields(versions), `", "`) + `"]}`}
+	}})
+}
+
+// TestCheckAvailableVersionsSkipsRetracted verifies that a retracted release
+// is recorded but never selected
+func TestCheckAvailableVersionsSkipsRetracted(t *testing.T) {
+	stubModuleVersions(t, "v1.0.0 v1.1.0", "v1.2.0")
+
+	check, err := checkAvailableVersions("go", MainAgentModule, &UpdaterConfig{Channel: ChannelStable})
+	if err != nil {
+		t.Fatalf("checkAvailableVersions() failed: %v", err)
+	}
+	if check.Selected != "v1.1.0" {
+		t.Errorf("Selected = %s; want v1.1.0", check.Selected)
+	}
+	if got := strings.Join(check.Retracted, " "); got != "v1.2.0" {
+		t.Errorf("Retracted = %s; want v1.2.0", got)
+	}
+}
+
+// TestGetLatestVersionParsesGoList verifies that the versions go list
+// reports are parsed into the recorded check, and that output go list
+// cannot have written is an error
+func TestGetLatestVersionParsesGoList(t *testing.T) {
+	fakeClock(t)
+	resetVersionCache(t)
+	withConfig(t, &UpdaterConfig{AgentModule: MainAgentModule, Channel: ChannelStable, VersionResolvers: []string{ResolverGoProxy}})
+	stubModuleVersions(t, "v1.0.0 v1.2.0 v1.1.0 v1.3.0-rc.1", "v1.2.1")
+	dataDir := t.TempDir()
+
+	check, err := getLatestVersion(dataDir, true)
+	if err != nil {
+		t.Fatalf("getLatestVersion() failed: %v", err)
+	}
+	if check.Selected != "v1.2.0" || check.Resolver != ResolverGoProxy {
+		t.Errorf("getLatestVersion() = %s via %s; want v1.2.0 via %s", check.Selected, check.Resolver, ResolverGoProxy)
+	}
+	if got := strings.Join(check.Retracted, " "); got != "v1.2.1" {
+		t.Errorf("Retracted = %s; want v1.2.1", got)
+	}
+	var recorded VersionCheck
+	if found, err := readJSONFile(filepath.Join(dataDir, versionCheckFileName), &recorded); !found || err != nil || recorded.Selected != "v1.2.0" {
+		t.Errorf("recorded check = %+v, %v, %v; want v1.2.0", recorded, found, err)
+	}
+
+	resetVersionCache(t)
+	useRunner(t, &commandtest.FakeRunner{Handler: func(call commandtest.Call) commandtest.Result {
+		return commandtest.Result{Stdout: "go: downloading"}
+	}})
+	if check, err := getLatestVersion(dataDir, true); err == nil {
+		t.Errorf("getLatestVersion() with unparsable output = %+v; want an error", check)
+	}
+}
+
+// TestVersionCheckNeedsUpdate verifies that a retracted installed version is
+// replaced even by a lower release, and that no installed version is
+// replaced by any
+func TestVersionCheckNeedsUpdate(t *testing.T) {
+	check := &VersionCheck{Selected: "v1.1.0", Retracted: []string{"v1.2.0"}}
+
+	tests := []struct {
+		current string
+		want    bool
+	}{
+		{"v1.0.0", true},
+		{"v1.1.0", false},
+		{"v1.2.0", true},
+		{"v1.3.0", false},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		if got := check.needsUpdate(tt.current); got != tt.want {
+			t.Errorf("needsUpdate(%s) = %v; want %v", tt.current, got, tt.want)
+		}
+	}
+}
+
+// TestCheckAvailableVersionsDevRef verifies that the dev channel resolves
+// devRef instead of selecting a tag
+func TestCheckAvailableVersionsDevRef(t *testing.T) {
+	var queried string
+	useRunner(t, &commandtest.FakeRunner{Handler: func(call commandtest.Call) commandtest.Result {
+		queried = call.Args[len(call.Args)-1]
+		return commandtest.Result{Stdout: `{"Version": "v0.0.0-20260101120000-a1b2c3d4e5f6"}`}
+	}})
+
+	config := &UpdaterConfig{Channel: ChannelDev, DevRef: "feature/x", CanaryBranch: DefaultCanaryBranch}
+	check, err := checkAvailableVersions("go", MainAgentModule, config)
+	if err != nil {
+		t.Fatalf("checkAvailableVersions() failed: %v", err)
+	}
+	if want := MainAgentModule + "@feature/x"; queried != want {
+		t.Errorf("queried %s; want %s", queried, want)
+	}
+	if check.Branch != "feature/x" || check.Selected != "v0.0.0-20260101120000-a1b2c3d4e5f6" {
+		t.Errorf("check = %s@%s; want v0.0.0-20260101120000-a1b2c3d4e5f6@feature/x", check.Selected, check.Branch)
+	}
+}
+
+// TestVersionCheckNeedsUpdateDev verifies that the dev channel installs any
+// other pseudo-version, even an older one, and recognises an agent that
+// reports only its commit hash
+func TestVersionCheckNeedsUpdateDev(t *testing.T) {
+	check := &VersionCheck{Channel: ChannelDev, Selected: "v0.0.0-20260101120000-a1b2c3d4e5f6"}
+
+	tests := []struct {
+		current string
+		want    bool
+	}{
+		{"v0.0.0-20260101120000-a1b2c3d4e5f6", false},
+		{"a1b2c3d", false},
+		{"a1b2c3d4e5f6a7b8c9d0a1b2c3d4e5f6a7b8c9d0", false},
+		{"v0.0.0-20260201120000-0123456789ab", true},
+		{"v1.4.0", true},
+		{"0123456", true},
+	}
+
+	for _, tt := range tests {
+		if got := check.needsUpdate(tt.current); got != tt.want {
+			t.Errorf("needsUpdate(%s) = %v; want %v", tt.current, got, tt.want)
+		}
+	}
+}
+
+// TestWithVersionPolicy verifies that a version below minVersion or in
+// skipVersions is replaced by the highest allowed one, and that the check
+// fails when there is none or the version is pinned
+func TestWithVersionPolicy(t *testing.T) {
+	saveLogger(t)
+	available := []string{"v1.0.0", "v1.2.0", "v1.3.0-rc.1", "v1.3.0", "v1.4.0"}
+	tests := []struct {
+		name     string
+		selected string
+		config   UpdaterConfig
+		manifest *UpdateManifest
+		want     string
+	}{
+		{"allowed", "v1.4.0", UpdaterConfig{MinVersion: "v1.2.0"}, nil, "v1.4.0"},
+		{"skipped", "v1.4.0", UpdaterConfig{SkipVersions: []string{"v1.4.0"}}, nil, "v1.3.0"},
+		{"below floor", "v1.0.0", UpdaterConfig{MinVersion: "v1.2.0"}, nil, "v1.4.0"},
+		{"skipped down to the floor", "v1.4.0", UpdaterConfig{MinVersion: "v1.4.0", SkipVersions: []string{"v1.4.0"}}, nil, ""},
+		{"pinned below floor", "v1.0.0", UpdaterConfig{MinVersion: "v1.2.0"}, &UpdateManifest{Version: "v1.0.0"}, ""},
+	}
+	for _, tt := range tests {
+		check := &VersionCheck{Channel: ChannelStable, Selected: tt.selected, Available: available, Manifest: tt.manifest}
+		got, err := check.withVersionPolicy(&tt.config)
+		if check.Selected != tt.selected {
+			t.Errorf("%s: withVersionPolicy() changed the original check to %s", tt.name, check.Selected)
+		}
+		if tt.want == "" {
+			if ErrorCodeOf(err) != ErrCodeVersionRejected {
+				t.Errorf("%s: withVersionPolicy() = %+v, %v; want VERSION_REJECTED", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got.Selected != tt.want {
+			t.Errorf("%s: withVersionPolicy() = %+v, %v; want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
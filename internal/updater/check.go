@@ -0,0 +1,128 @@
+package updater
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// CheckOptions configures RunCheck
+type CheckOptions struct {
+	// Refresh bypasses the version cache
+	Refresh bool
+	// Ref resolves that branch, commit or pseudo-version as the dev channel
+	// would, without changing the configuration file
+	Ref string
+	// Timeout bounds the installed-version probe and the latest-version
+	// query together; 0 waits for them as long as the updater loop would
+	Timeout time.Duration
+}
+
+// CheckResult is the outcome of a version check that installs nothing
+type CheckResult struct {
+	Installed          string        `json:"installed,omitempty"`
+	Latest             string        `json:"latest,omitempty"`
+	Channel            UpdateChannel `json:"channel,omitempty"`
+	UpdateAvailable    bool          `json:"updateAvailable"`
+	InstalledRetracted bool          `json:"installedRetracted,omitempty"`
+	CheckedAt          time.Time     `json:"checkedAt"`
+}
+
+// String describes the result as "up to date (v1.6.116)" or "update
+// available: v1.6.116 → v1.7.0"
+func (r *CheckResult) String() string {
+	if !r.UpdateAvailable {
+		return fmt.Sprintf("up to date (%s)", r.Installed)
+	}
+	description := fmt.Sprintf("update available: %s → %s", r.Installed, r.Latest)
+	if r.InstalledRetracted {
+		description += " (installed version retracted)"
+	}
+	return description
+}
+
+// VersionChecker compares the installed agent version with the latest one
+// on the configured channel, the way the updater loop decides to update.
+// Its functions can be replaced to check against other sources.
+type VersionChecker struct {
+	// InstalledVersion detects the agent binary and returns its version
+	InstalledVersion func() (string, error)
+	// LatestVersion queries the versions published on the configured
+	// channel, from the cache in dataDir unless refresh is set
+	LatestVersion func(dataDir string, refresh bool) (*VersionCheck, error)
+}
+
+// DefaultVersionChecker probes the installed agent binary and queries the
+// module proxy, or GitHub, like the updater loop
+func DefaultVersionChecker() *VersionChecker {
+	return &VersionChecker{InstalledVersion: getInstalledVersion, LatestVersion: getLatestVersion}
+}
+
+// Check reports whether an update is available, without installing it.
+// A check that takes longer than timeout, if set, fails; the queries it
+// started are left to finish in the background.
+func (v *VersionChecker) Check(dataDir string, refresh bool, timeout time.Duration) (*CheckResult, error) {
+	if timeout <= 0 {
+		return v.check(dataDir, refresh)
+	}
+
+	type outcome struct {
+		result *CheckResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := v.check(dataDir, refresh)
+		done <- outcome{result, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C:
+		return nil, fmt.Errorf("version check timed out after %v", timeout)
+	}
+}
+
+func (v *VersionChecker) check(dataDir string, refresh bool) (*CheckResult, error) {
+	installed, err := v.InstalledVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installed version: %w", err)
+	}
+	check, err := v.LatestVersion(dataDir, refresh)
+	if err != nil {
+		return &CheckResult{Installed: installed, CheckedAt: now()}, fmt.Errorf("failed to check latest version: %w", err)
+	}
+	return &CheckResult{
+		Installed:          installed,
+		Latest:             check.Selected,
+		Channel:            check.Channel,
+		UpdateAvailable:    check.needsUpdate(installed),
+		InstalledRetracted: check.isRetracted(installed),
+		CheckedAt:          now(),
+	}, nil
+}
+
+// RunCheck reports whether an agent update is available on the configured
+// channel, without installing it
+func RunCheck(options CheckOptions) (*CheckResult, error) {
+	if err := InitLogger(); err != nil {
+		return nil, fmt.Errorf("failed to initialize logging system: %w", err)
+	}
+	defer CloseLogger()
+	config := loadConfig()
+
+	refresh := options.Refresh
+	if options.Ref != "" {
+		dev := *config
+		dev.Channel = ChannelDev
+		dev.DevRef = options.Ref
+		activeConfig.Store(&dev)
+		refresh = true
+	}
+
+	return DefaultVersionChecker().Check(paths.GetDataDirectory(), refresh, options.Timeout)
+}
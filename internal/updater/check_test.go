@@ -0,0 +1,82 @@
+package updater
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestVersionCheckerCheck verifies the result and description of a check
+// against stubbed installed and latest versions
+func TestVersionCheckerCheck(t *testing.T) {
+	fakeClock(t)
+	latest := func(dataDir string, refresh bool) (*VersionCheck, error) {
+		return &VersionCheck{Channel: ChannelStable, Selected: "v1.7.0", Retracted: []string{"v1.6.117"}}, nil
+	}
+
+	tests := []struct {
+		installed   string
+		wantUpdate  bool
+		wantMessage string
+	}{
+		{"v1.7.0", false, "up to date (v1.7.0)"},
+		{"v1.6.116", true, "update available: v1.6.116 → v1.7.0"},
+		{"v1.6.117", true, "update available: v1.6.117 → v1.7.0 (installed version retracted)"},
+	}
+	for _, tt := range tests {
+		checker := &VersionChecker{
+			InstalledVersion: func() (string, error) { return tt.installed, nil },
+			LatestVersion:    latest,
+		}
+		result, err := checker.Check(t.TempDir(), false, 0)
+		if err != nil {
+			t.Fatalf("Check() with %s failed: %v", tt.installed, err)
+		}
+		if result.UpdateAvailable != tt.wantUpdate || result.String() != tt.wantMessage {
+			t.Errorf("Check() with %s = %v, %q; want %v, %q", tt.installed, result.UpdateAvailable, result, tt.wantUpdate, tt.wantMessage)
+		}
+		if result.Channel != ChannelStable || !result.CheckedAt.Equal(now()) {
+			t.Errorf("Check() channel, checked at = %s, %v", result.Channel, result.CheckedAt)
+		}
+	}
+}
+
+// TestVersionCheckerCheckFailures verifies that failed probes and queries,
+// and a check outlasting its timeout, are reported as errors
+func TestVersionCheckerCheckFailures(t *testing.T) {
+	installed := func() (string, error) { return "v1.6.116", nil }
+
+	checker := &VersionChecker{
+		InstalledVersion: func() (string, error) { return "", errors.New("binary not found") },
+		LatestVersion: func(string, bool) (*VersionCheck, error) {
+			t.Fatal("queried without an installed version")
+			return nil, nil
+		},
+	}
+	if _, err := checker.Check(t.TempDir(), false, 0); err == nil || !strings.Contains(err.Error(), "binary not found") {
+		t.Errorf("Check() without an installed version = %v; want binary not found", err)
+	}
+
+	checker = &VersionChecker{
+		InstalledVersion: installed,
+		LatestVersion:    func(string, bool) (*VersionCheck, error) { return nil, errors.New("proxy unavailable") },
+	}
+	result, err := checker.Check(t.TempDir(), false, 0)
+	if err == nil || result == nil || result.Installed != "v1.6.116" {
+		t.Errorf("Check() with a failed query = %+v, %v; want installed version and error", result, err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	checker = &VersionChecker{
+		InstalledVersion: installed,
+		LatestVersion: func(string, bool) (*VersionCheck, error) {
+			<-release
+			return &VersionCheck{Channel: ChannelStable, Selected: "v1.7.0"}, nil
+		},
+	}
+	if _, err := checker.Check(t.TempDir(), false, 50*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Check() outlasting its timeout = %v; want timed out", err)
+	}
+}
@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"os"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 10 * time.Second
+
+// configFileStamp identifies a version of the config file by its path, the
+// file it is, its modification time and size; a missing file has a nil info
+type configFileStamp struct {
+	path string
+	info os.FileInfo
+}
+
+func statConfigFile(path string) configFileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return configFileStamp{path: path}
+	}
+	return configFileStamp{path: path, info: info}
+}
+
+// equal reports whether s and other are the same version of the file. A file
+// renamed over the config file is another file, even with the same time and
+// size, and so is one under another name.
+func (s configFileStamp) equal(other configFileStamp) bool {
+	if s.path != other.path {
+		return false
+	}
+	if s.info == nil || other.info == nil {
+		return s.info == nil && other.info == nil
+	}
+	return os.SameFile(s.info, other.info) && s.info.ModTime().Equal(other.info.ModTime()) && s.info.Size() == other.info.Size()
+}
+
+// pollConfigFile calls onChange with the path of the config file whenever it
+// is created, modified, replaced or removed, or resolve returns another one,
+// checking every interval until stop is closed. A change is only reported
+// once the file has stayed the same for a whole interval, so a writer that is
+// not atomic is not read half-way, and a burst of writes is reported once.
+func pollConfigFile(resolve func() string, interval time.Duration, stop <-chan struct{}, onChange func(path string)) {
+	last := statConfigFile(resolve())
+	pending := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			current := statConfigFile(resolve())
+			if !current.equal(last) {
+				last = current
+				pending = true
+				continue
+			}
+			if pending {
+				pending = false
+				onChange(current.path)
+			}
+		}
+	}
+}
+
+// watchConfigFile reloads the configuration whenever the config file changes,
+// until the returned function is called. The file is looked up again on
+// every poll, so an updater-config.yaml dropped in after startup is picked
+// up, and its modification time is polled, which works on every platform and
+// filesystem.
+func watchConfigFile() (stop func()) {
+	done := make(chan struct{})
+
+	go pollConfigFile(paths.GetUpdaterConfigPath, configPollInterval, done, func(path string) {
+		LogInfo("Detected change to %s", path)
+		reloadConfig()
+	})
+
+	LogInfo("Watching %s for changes every %v", paths.GetUpdaterConfigPath(), configPollInterval)
+	return func() { close(done) }
+}
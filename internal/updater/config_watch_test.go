@@ -0,0 +1,145 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// TestPollConfigFile verifies that creating and modifying the config file
+// each trigger one change notification
+func TestPollConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "updater-config.json")
+	changes := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go pollConfigFile(func() string { return configPath }, 10*time.Millisecond, stop, func(string) {
+		changes <- struct{}{}
+	})
+
+	waitForChange := func(what string) {
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no change detected after %s", what)
+		}
+	}
+
+	// Give the poller time to record the initial (missing) state
+	time.Sleep(30 * time.Millisecond)
+
+	if err := os.WriteFile(configPath, []byte(`{}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	waitForChange("create")
+
+	if err := os.WriteFile(configPath, []byte(`{"checkIntervalSeconds": 60}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	waitForChange("modify")
+
+	select {
+	case <-changes:
+		t.Error("unexpected change notification for an unmodified file")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestPollConfigFileDebounces verifies that a file written in pieces is
+// reported once, after the last piece, and that a file renamed over the
+// config file is reported even with the same time and size
+func TestPollConfigFileDebounces(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "updater-config.json")
+	writeLog(t, configPath, `{"checkIntervalSeconds": 60}`)
+	contents := make(chan string, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go pollConfigFile(func() string { return configPath }, 50*time.Millisecond, stop, func(string) {
+		data, _ := os.ReadFile(configPath)
+		contents <- string(data)
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	// A writer that truncates the file and writes it a piece at a time
+	complete := `{"checkIntervalSeconds": 120, "channel": "beta"}`
+	file, err := os.Create(configPath)
+	if err != nil {
+		t.Fatalf("failed to truncate config: %v", err)
+	}
+	for _, piece := range []string{complete[:10], complete[10:30], complete[30:]} {
+		time.Sleep(5 * time.Millisecond)
+		file.WriteString(piece)
+	}
+	file.Close()
+
+	select {
+	case got := <-contents:
+		if got != complete {
+			t.Errorf("change reported with content %q; want %q", got, complete)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change detected after a partial write")
+	}
+	select {
+	case got := <-contents:
+		t.Errorf("partial write reported twice, again with %q", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The replacement has the same size and modification time
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatalf("failed to stat config: %v", err)
+	}
+	replacement := filepath.Join(dir, "updater-config.json.tmp")
+	replaced := strings.Replace(complete, "beta", "dev!", 1)
+	writeLog(t, replacement, replaced)
+	if err := os.Chtimes(replacement, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("failed to set modification time: %v", err)
+	}
+	if err := os.Rename(replacement, configPath); err != nil {
+		t.Fatalf("failed to replace config: %v", err)
+	}
+	select {
+	case got := <-contents:
+		if got != replaced {
+			t.Errorf("replacement reported with content %q; want %q", got, replaced)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change detected after a rename-based replacement")
+	}
+}
+
+// TestPollConfigFileNewName verifies that a config file created after
+// startup under another name the updater reads is picked up
+func TestPollConfigFileNewName(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(paths.DataDirectoryEnv, dir)
+	t.Setenv(paths.ConfigPathEnv, "")
+	changes := make(chan string, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go pollConfigFile(paths.GetUpdaterConfigPath, 10*time.Millisecond, stop, func(path string) {
+		changes <- path
+	})
+	time.Sleep(30 * time.Millisecond)
+
+	yamlPath := filepath.Join(dir, "updater-config.yaml")
+	writeLog(t, yamlPath, "checkIntervalSeconds: 60\n")
+	select {
+	case path := <-changes:
+		if path != yamlPath {
+			t.Errorf("change reported for %s; want %s", path, yamlPath)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change detected after updater-config.yaml was created")
+	}
+}
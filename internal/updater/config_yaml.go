@@ -0,0 +1,425 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isYAMLConfig reports whether the config file at path is YAML, by its
+// extension
+func isYAMLConfig(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// yamlToJSON converts a YAML config file to the JSON the config is decoded
+// from. It supports the YAML a config needs: comments, nested block mappings,
+// block sequences, flow sequences and mappings of scalars, quoted and plain
+// scalars and literal and folded block scalars. Anchors, aliases, tags and
+// multiple documents are rejected.
+func yamlToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+
+	line, ok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if ok && line.text == "---" {
+		p.pos++
+		line, ok, err = p.peek()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return []byte("{}"), nil
+	}
+	if isYAMLSequenceItem(line.text) {
+		return nil, fmt.Errorf("line %d: the configuration must be a mapping of settings, not a list", line.number)
+	}
+
+	config, err := p.parseMapping(line.indent)
+	if err != nil {
+		return nil, err
+	}
+	if line, ok, err := p.peek(); err != nil {
+		return nil, err
+	} else if ok && line.text == "---" {
+		return nil, fmt.Errorf("line %d: multiple documents are not supported", line.number)
+	} else if ok && line.text != "..." {
+		return nil, fmt.Errorf("line %d: unexpected %q", line.number, line.text)
+	}
+	return json.Marshal(config)
+}
+
+// yamlLine is a line of YAML without its indentation and comment
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser parses YAML line by line
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// peek returns the next line that is not blank or a comment, without
+// consuming it
+func (p *yamlParser) peek() (yamlLine, bool, error) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos]
+		content := strings.TrimLeft(raw, " \t")
+		text := stripYAMLComment(content)
+		if text == "" {
+			continue
+		}
+		indent := len(raw) - len(content)
+		if strings.Contains(raw[:indent], "\t") {
+			return yamlLine{}, false, fmt.Errorf("line %d: indent with spaces, not tabs", p.pos+1)
+		}
+		return yamlLine{number: p.pos + 1, indent: indent, text: text}, true, nil
+	}
+	return yamlLine{}, false, nil
+}
+
+// parseMapping parses the block mapping whose keys are at indent
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	mapping := make(map[string]interface{})
+	for {
+		line, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || line.indent < indent || isYAMLDocumentMarker(line.text) {
+			return mapping, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+		if isYAMLSequenceItem(line.text) {
+			return nil, fmt.Errorf("line %d: expected a key, not a list item", line.number)
+		}
+
+		key, rest, err := splitYAMLKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+		if mapping[key], err = p.parseValue(line, rest, true); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseSequence parses the block sequence whose items are at indent
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for {
+		line, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || line.indent != indent || !isYAMLSequenceItem(line.text) {
+			if ok && line.indent > indent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+			}
+			return items, nil
+		}
+
+		rest := strings.TrimSpace(line.text[1:])
+		if _, _, err := splitYAMLKey(yamlLine{text: rest}); err == nil && !strings.ContainsAny(rest[:1], `"'[{|>`) {
+			return nil, fmt.Errorf("line %d: lists of mappings are not supported", line.number)
+		}
+		p.pos++
+		item, err := p.parseValue(line, rest, false)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+// parseValue parses the value that follows a key or list item on line: rest
+// of the line, or the block nested below it. A list may follow a key at the
+// key's own indentation.
+func (p *yamlParser) parseValue(line yamlLine, rest string, sameIndentList bool) (interface{}, error) {
+	if rest != "" {
+		if rest[0] == '|' || rest[0] == '>' {
+			return p.parseBlockScalar(line, rest)
+		}
+		return parseYAMLScalar(rest, line.number)
+	}
+
+	next, ok, err := p.peek()
+	if err != nil || !ok {
+		return nil, err
+	}
+	switch {
+	case next.indent > line.indent && isYAMLSequenceItem(next.text):
+		return p.parseSequence(next.indent)
+	case next.indent > line.indent:
+		return p.parseMapping(next.indent)
+	case next.indent == line.indent && sameIndentList && isYAMLSequenceItem(next.text):
+		return p.parseSequence(next.indent)
+	}
+	return nil, nil
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar with the
+// given header, keeping one final newline unless the header ends in - (none)
+// or + (all of them)
+func (p *yamlParser) parseBlockScalar(line yamlLine, header string) (string, error) {
+	chomping := header[1:]
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return "", fmt.Errorf("line %d: unsupported block scalar header %q", line.number, header)
+	}
+
+	var lines []string
+	indent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos]
+		content := strings.TrimLeft(raw, " ")
+		if content == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lineIndent := len(raw) - len(content)
+		if lineIndent <= line.indent {
+			break
+		}
+		if indent < 0 {
+			indent = lineIndent
+		}
+		if lineIndent < indent {
+			return "", fmt.Errorf("line %d: block scalar lines must be indented at least as much as the first", p.pos+1)
+		}
+		lines = append(lines, raw[indent:])
+	}
+
+	// Trailing blank lines belong to the chomping, not the content
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	trailing := len(lines) - content
+	lines = lines[:content]
+
+	var text strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			if header[0] == '>' && l != "" && lines[i-1] != "" && !strings.HasPrefix(l, " ") {
+				text.WriteString(" ")
+			} else {
+				text.WriteString("\n")
+			}
+		}
+		text.WriteString(l)
+	}
+	if content == 0 {
+		return "", nil
+	}
+	switch chomping {
+	case "":
+		text.WriteString("\n")
+	case "+":
+		text.WriteString(strings.Repeat("\n", trailing+1))
+	}
+	return text.String(), nil
+}
+
+// isYAMLDocumentMarker reports whether text starts or ends a document
+func isYAMLDocumentMarker(text string) bool {
+	return text == "---" || text == "..."
+}
+
+// isYAMLSequenceItem reports whether text is a block sequence item
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits the text of a mapping line into its key and the rest
+// of the line after the colon
+func splitYAMLKey(line yamlLine) (string, string, error) {
+	text := line.text
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", fmt.Errorf("line %d: unterminated quoted key", line.number)
+		}
+		key, err := parseYAMLScalar(text[:end+1], line.number)
+		if err != nil {
+			return "", "", err
+		}
+		after := text[end+1:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", fmt.Errorf("line %d: expected a colon after the key", line.number)
+		}
+		return key.(string), strings.TrimSpace(after[1:]), nil
+	}
+
+	if i := strings.Index(text, ": "); i >= 0 {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), nil
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", nil
+	}
+	return "", "", fmt.Errorf("line %d: expected key: value, got %q", line.number, text)
+}
+
+// closingQuote returns the index of the quote that closes the quoted scalar
+// text starts with, or -1
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a comment from text: a # at its start or after
+// whitespace, outside quotes
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" \t[{,:", rune(text[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimRight(text[:i], " \t")
+		}
+	}
+	return strings.TrimRight(text, " \t")
+}
+
+// parseYAMLScalar parses a scalar or a flow sequence or mapping of scalars
+// on the given line
+func parseYAMLScalar(text string, number int) (interface{}, error) {
+	switch text[0] {
+	case '"':
+		if closingQuote(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: unexpected text after the quoted value %s", number, text)
+		}
+		var value string
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("line %d: invalid double-quoted value %s: %w", number, text, err)
+		}
+		return value, nil
+	case '\'':
+		if closingQuote(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: unexpected text after the quoted value %s", number, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: a flow sequence must end on the line it starts", number)
+		}
+		items := []interface{}{}
+		for _, item := range splitYAMLFlow(text[1 : len(text)-1]) {
+			value, err := parseYAMLScalar(item, number)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case '{':
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("line %d: a flow mapping must end on the line it starts", number)
+		}
+		mapping := make(map[string]interface{})
+		for _, entry := range splitYAMLFlow(text[1 : len(text)-1]) {
+			key, rest, err := splitYAMLKey(yamlLine{number: number, text: entry})
+			if err != nil {
+				return nil, err
+			}
+			if rest == "" {
+				mapping[key] = nil
+				continue
+			}
+			if mapping[key], err = parseYAMLScalar(rest, number); err != nil {
+				return nil, err
+			}
+		}
+		return mapping, nil
+	case '&', '*', '!', '%', '@', '`', '|', '>':
+		return nil, fmt.Errorf("line %d: %q is not supported in the configuration; quote the value", number, text[:1])
+	}
+
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(value, 10)), nil
+	}
+	if (text[0] == '-' || text[0] >= '0' && text[0] <= '9') && json.Valid([]byte(text)) {
+		return json.Number(text), nil
+	}
+	return text, nil
+}
+
+// splitYAMLFlow splits the content of a flow collection at the commas
+// outside quotes and nested collections, dropping empty entries
+func splitYAMLFlow(text string) []string {
+	var entries []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			entries = append(entries, text[start:i])
+			start = i + 1
+		}
+	}
+	entries = append(entries, text[start:])
+
+	var trimmed []string
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			trimmed = append(trimmed, entry)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestYAMLToJSON verifies the YAML a config is written in converts to the
+// JSON it stands for
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "# nothing set yet\n", `{}`},
+		{"document marker", "---\nchannel: beta\n...\n", `{"channel": "beta"}`},
+		{"scalars", "checkIntervalSeconds: 300\nbackupDatabase: false\nminVersion: v1.2.0\nbinaryPath: ~\n",
+			`{"checkIntervalSeconds": 300, "backupDatabase": false, "minVersion": "v1.2.0", "binaryPath": null}`},
+		{"comments", "channel: beta # canaries first\n# maintenance window\ndrainURL: http://127.0.0.1:8080/drain#now\n",
+			`{"channel": "beta", "drainURL": "http://127.0.0.1:8080/drain#now"}`},
+		{"quoted", "a: \"tab\\there # not a comment\"\nb: 'it''s'\n\"c d\": '1.10'\n",
+			`{"a": "tab\there # not a comment", "b": "it's", "c d": "1.10"}`},
+		{"nested mapping", "goEnv:\n  GOPRIVATE: github.com/acme/*\n  GOFLAGS: -mod=mod\nchannel: stable\n",
+			`{"goEnv": {"GOPRIVATE": "github.com/acme/*", "GOFLAGS": "-mod=mod"}, "channel": "stable"}`},
+		{"indented sequence", "skipVersions:\n  - v1.2.3\n  - v1.2.4\n", `{"skipVersions": ["v1.2.3", "v1.2.4"]}`},
+		{"sequence at key indentation", "skipVersions:\n- v1.2.3\nchannel: beta\n", `{"skipVersions": ["v1.2.3"], "channel": "beta"}`},
+		{"flow collections", "logSinks: [file, \"syslog\"]\ngoEnv: {GOPROXY: direct}\nredactKeys: []\n",
+			`{"logSinks": ["file", "syslog"], "goEnv": {"GOPROXY": "direct"}, "redactKeys": []}`},
+		{"literal block", "postUpdateHealthCheck: |\n  curl -fsS http://127.0.0.1:8080/health &&\n    test -s /var/lib/sentinelgo/sentinel.db\n\nchannel: beta\n",
+			`{"postUpdateHealthCheck": "curl -fsS http://127.0.0.1:8080/health &&\n  test -s /var/lib/sentinelgo/sentinel.db\n", "channel": "beta"}`},
+		{"folded block", "drainCommand: >-\n  sentinel drain\n  --timeout 30s\n", `{"drainCommand": "sentinel drain --timeout 30s"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := yamlToJSON([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("yamlToJSON() failed: %v", err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("yamlToJSON() = %s, not JSON: %v", data, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("invalid want %s: %v", tt.want, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("yamlToJSON() = %s; want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+// TestYAMLToJSONErrors verifies that YAML outside the supported subset, or
+// not a mapping of settings, is rejected with the line it is on
+func TestYAMLToJSONErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"- channel: beta\n", "line 1: the configuration must be a mapping"},
+		{"channel: beta\n  minVersion: v1\n", "line 2: unexpected indentation"},
+		{"channel: beta\nchannel: stable\n", `line 2: duplicate key "channel"`},
+		{"channel\n", "line 1: expected key: value"},
+		{"goEnv:\n\tGOPROXY: direct\n", "line 2: indent with spaces, not tabs"},
+		{"trustedSigners:\n  - name: acme\n", "line 2: lists of mappings are not supported"},
+		{"base: &defaults beta\n", `line 1: "&" is not supported`},
+		{"channel: \"beta\n", "line 1: unexpected text after the quoted value"},
+		{"channel: beta\n---\nchannel: stable\n", "line 2: multiple documents are not supported"},
+	}
+	for _, tt := range tests {
+		if data, err := yamlToJSON([]byte(tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("yamlToJSON(%q) = %s, %v; want %q", tt.content, data, err, tt.want)
+		}
+	}
+}
+
+// TestLoadConfigPathYAML verifies that a .yaml config file is read into the
+// same settings as its JSON equivalent, with unknown keys still reported
+// and type errors naming the setting
+func TestLoadConfigPathYAML(t *testing.T) {
+	saveLogger(t)
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "updater-config.yaml")
+	writeLog(t, yamlPath, `# Canary hosts take beta builds
+channel: beta
+checkIntervalSeconds: 600
+skipVersions:
+  - v1.4.0   # breaks the database migration
+goEnv:
+  GOPRIVATE: github.com/acme/*
+postUpdateHealthCheck: curl -fsS http://127.0.0.1:8080/health
+`)
+	jsonPath := filepath.Join(dir, "updater-config.json")
+	writeLog(t, jsonPath, `{"channel": "beta", "checkIntervalSeconds": 600, "skipVersions": ["v1.4.0"],
+		"goEnv": {"GOPRIVATE": "github.com/acme/*"}, "postUpdateHealthCheck": "curl -fsS http://127.0.0.1:8080/health"}`)
+
+	fromYAML, err := loadConfigPath(yamlPath)
+	if err != nil {
+		t.Fatalf("loadConfigPath(yaml) failed: %v", err)
+	}
+	fromJSON, err := loadConfigPath(jsonPath)
+	if err != nil {
+		t.Fatalf("loadConfigPath(json) failed: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("loadConfigPath(yaml) = %+v; want %+v", fromYAML, fromJSON)
+	}
+
+	writeLog(t, yamlPath, "checkIntervalSeconds: five minutes\n")
+	if _, err := loadConfigPath(yamlPath); err == nil || !strings.Contains(err.Error(), "checkIntervalSeconds must be of type int, not a YAML string") {
+		t.Errorf("loadConfigPath() with a string interval = %v; want a type error naming checkIntervalSeconds", err)
+	}
+	writeLog(t, yamlPath, "channel: beta\n  bogus: 1\n")
+	if _, err := loadConfigPath(yamlPath); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("loadConfigPath() with bad indentation = %v; want the line", err)
+	}
+}
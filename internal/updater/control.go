@@ -0,0 +1,211 @@
+package updater
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// controlShutdownTimeout bounds how long the control endpoint waits for
+// requests in flight when the service stops
+const controlShutdownTimeout = 5 * time.Second
+
+// ControlStatus is what GET /status on the control endpoint returns
+type ControlStatus struct {
+	PID              int          `json:"pid"`
+	StartedAt        time.Time    `json:"startedAt"`
+	Activity         string       `json:"activity"`
+	InstalledVersion string       `json:"installedVersion,omitempty"`
+	LatestVersion    string       `json:"latestVersion,omitempty"`
+	Channel          string       `json:"channel,omitempty"`
+	LastCheck        time.Time    `json:"lastCheck,omitempty"`
+	LastResult       string       `json:"lastResult,omitempty"`
+	NextCheck        time.Time    `json:"nextCheck,omitempty"`
+	UpdatePending    bool         `json:"updatePending"`
+	UpdateInProgress string       `json:"updateInProgress,omitempty"`
+	Paused           bool         `json:"paused"`
+	Pause            *PauseRecord `json:"pause,omitempty"`
+
+	// InstalledVersionDetails is the full --version output of the installed
+	// agent when it says more than InstalledVersion
+	InstalledVersionDetails string `json:"installedVersionDetails,omitempty"`
+}
+
+// controlState holds the running control endpoint
+var controlState struct {
+	sync.Mutex
+	server *http.Server
+}
+
+// checkRequests wakes the updater loop for a check; a request made while
+// one is pending is merged into it
+var checkRequests = make(chan struct{}, 1)
+
+// requestCheck asks the updater loop to check now instead of at the end of
+// its interval
+func requestCheck() {
+	select {
+	case checkRequests <- struct{}{}:
+	default:
+	}
+}
+
+// startControlServer serves the control endpoint on 127.0.0.1:controlPort in
+// the background; without controlPort it does nothing. A failure to listen
+// is logged and does not stop the updater.
+func startControlServer(config *UpdaterConfig) {
+	if config.ControlPort == 0 {
+		return
+	}
+	if config.ControlToken == "" {
+		LogWarning("controlToken is not set, the control endpoint refuses POST requests")
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(config.ControlPort)))
+	if err != nil {
+		LogError("Failed to start control endpoint: %v", err)
+		return
+	}
+	server := &http.Server{Handler: newControlHandler(paths.GetDataDirectory()), ReadHeaderTimeout: 10 * time.Second}
+	controlState.Lock()
+	controlState.server = server
+	controlState.Unlock()
+
+	LogInfo("Control endpoint listening on http://%s", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			LogError("Control endpoint stopped: %v", err)
+		}
+	}()
+}
+
+// StopControlServer stops the control endpoint, if it is running, once the
+// requests in flight are answered
+func StopControlServer() {
+	controlState.Lock()
+	server := controlState.server
+	controlState.server = nil
+	controlState.Unlock()
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		LogWarning("Failed to stop control endpoint: %v", err)
+	}
+}
+
+// newControlHandler routes the control endpoint of the updater using
+// dataDir. Handlers only read and write state, so they never wait on the
+// updater loop.
+func newControlHandler(dataDir string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeControlJSON(w, http.StatusOK, currentControlStatus(dataDir))
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeControlJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": UpdaterVersion, "commit": currentBuild().Commit})
+	})
+	mux.HandleFunc("POST /check", requireControlToken(func(w http.ResponseWriter, r *http.Request) {
+		LogInfo("Check requested through the control endpoint")
+		requestCheck()
+		writeControlJSON(w, http.StatusAccepted, map[string]string{"status": "check requested"})
+	}))
+	mux.HandleFunc("POST /pause", requireControlToken(func(w http.ResponseWriter, r *http.Request) {
+		var duration time.Duration
+		if value := r.URL.Query().Get("duration"); value != "" {
+			var err error
+			if duration, err = time.ParseDuration(value); err != nil || duration < 0 {
+				writeControlJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid duration " + strconv.Quote(value)})
+				return
+			}
+		}
+		pause, err := pauseUpdates(dataDir, duration, r.URL.Query().Get("reason"), "control endpoint")
+		if err != nil {
+			writeControlJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		LogInfo("Automatic updates %s", pause)
+		writeControlJSON(w, http.StatusOK, map[string]interface{}{"paused": true, "pause": pause})
+	}))
+	mux.HandleFunc("POST /resume", requireControlToken(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := resumeUpdates(dataDir); err != nil {
+			writeControlJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		LogInfo("Automatic updates resumed through the control endpoint")
+		writeControlJSON(w, http.StatusOK, map[string]bool{"paused": false})
+	}))
+	return mux
+}
+
+// requireControlToken refuses requests without the configured controlToken
+// as a bearer token, and every request when none is configured
+func requireControlToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := getConfig().ControlToken
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeControlJSON(w, http.StatusUnauthorized, map[string]string{"error": "a valid controlToken is required"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// currentControlStatus gathers the published status, the next check time,
+// the update in progress and the pause in dataDir
+func currentControlStatus(dataDir string) ControlStatus {
+	serviceStatus.Lock()
+	status := serviceStatus.status
+	serviceStatus.Unlock()
+	loopHeartbeat.Lock()
+	nextCheck := loopHeartbeat.heartbeat.NextCheck
+	loopHeartbeat.Unlock()
+
+	report := ControlStatus{
+		PID:              status.PID,
+		StartedAt:        status.StartedAt,
+		Activity:         status.Activity,
+		InstalledVersion: status.InstalledVersion,
+		LatestVersion:    status.LatestVersion,
+		Channel:          status.Channel,
+		LastCheck:        status.LastCheck,
+		LastResult:       status.LastResult,
+		NextCheck:        nextCheck,
+		UpdatePending:    status.UpdatePending,
+
+		InstalledVersionDetails: status.InstalledVersionDetails,
+	}
+	if marker, err := loadUpdateMarker(dataDir); err != nil {
+		LogDebug("Failed to read update marker: %v", err)
+	} else if marker != nil {
+		report.UpdateInProgress = marker.TargetVersion + ", " + marker.Progress()
+	}
+	if pause, err := readPause(dataDir); err != nil {
+		LogDebug("Failed to read pause: %v", err)
+	} else {
+		report.Pause, report.Paused = pause, pause != nil
+	}
+	return report
+}
+
+// writeControlJSON writes v as the JSON response with status code
+func writeControlJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		LogDebug("Failed to write control response: %v", err)
+	}
+}
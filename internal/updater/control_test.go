@@ -0,0 +1,133 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// controlRequest sends method path to the control endpoint at server with
+// token, if set, decodes the response into body, if set, and returns the
+// response code
+func controlRequest(t *testing.T, server *httptest.Server, method, path, token string, body interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if body != nil {
+		if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestControlStatus verifies that GET /status and /healthz need no token and
+// report the published status, next check and update in progress
+func TestControlStatus(t *testing.T) {
+	clock := fakeClock(t)
+	withConfig(t, &UpdaterConfig{ControlToken: "secret", CheckIntervalSeconds: 300})
+	dataDir := t.TempDir()
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Cleanup(func() { startHeartbeat(""); startStatus("") })
+
+	startStatus(dataDir)
+	startHeartbeat(dataDir)
+	recordCheckResult("v1.1.0", &VersionCheck{Channel: ChannelStable, Selected: "v1.2.0"}, true, "updating to v1.2.0")
+	heartbeat(ActivityIdle, clock.Add(5*time.Minute))
+	marker := &UpdateMarker{TargetVersion: "v1.2.0", Step: stepCompiled}
+	if err := writeUpdateMarker(dataDir, marker); err != nil {
+		t.Fatalf("writeUpdateMarker() failed: %v", err)
+	}
+
+	server := httptest.NewServer(newControlHandler(dataDir))
+	defer server.Close()
+
+	var status ControlStatus
+	if code := controlRequest(t, server, http.MethodGet, "/status", "", &status); code != http.StatusOK {
+		t.Fatalf("GET /status = %d; want 200", code)
+	}
+	if status.InstalledVersion != "v1.1.0" || status.LatestVersion != "v1.2.0" || status.LastResult != "updating to v1.2.0" {
+		t.Errorf("GET /status = %+v; want v1.1.0 -> v1.2.0", status)
+	}
+	if !status.NextCheck.Equal(clock.Add(5*time.Minute)) || status.UpdateInProgress != "v1.2.0, "+marker.Progress() {
+		t.Errorf("GET /status next check, in progress = %v, %q", status.NextCheck, status.UpdateInProgress)
+	}
+
+	var health map[string]string
+	if code := controlRequest(t, server, http.MethodGet, "/healthz", "", &health); code != http.StatusOK || health["status"] != "ok" {
+		t.Errorf("GET /healthz = %d, %v; want 200 ok", code, health)
+	}
+	if code := controlRequest(t, server, http.MethodGet, "/check", "secret", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /check = %d; want 405", code)
+	}
+}
+
+// TestControlCheckAndPause verifies that the POST routes require the token,
+// that POST /check wakes the sleeping loop and that a pause defers updates
+func TestControlCheckAndPause(t *testing.T) {
+	clock := fakeClock(t)
+	withConfig(t, &UpdaterConfig{ControlToken: "secret", CheckIntervalSeconds: 3600, RolloutPercentage: 100})
+	t.Setenv("NOTIFY_SOCKET", "")
+	dataDir := t.TempDir()
+
+	server := httptest.NewServer(newControlHandler(dataDir))
+	defer server.Close()
+
+	for _, path := range []string{"/check", "/pause", "/resume"} {
+		for _, token := range []string{"", "wrong"} {
+			if code := controlRequest(t, server, http.MethodPost, path, token, nil); code != http.StatusUnauthorized {
+				t.Errorf("POST %s with token %q = %d; want 401", path, token, code)
+			}
+		}
+	}
+	if activePause(dataDir) != nil {
+		t.Fatal("updates paused by an unauthorized request")
+	}
+
+	if code := controlRequest(t, server, http.MethodPost, "/check", "secret", nil); code != http.StatusAccepted {
+		t.Fatalf("POST /check = %d; want 202", code)
+	}
+	woke := make(chan struct{})
+	go func() {
+		sleepUntilNextCheck(context.Background())
+		close(woke)
+	}()
+	select {
+	case <-woke:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sleepUntilNextCheck() did not return after POST /check")
+	}
+
+	check := &VersionCheck{Channel: ChannelStable, Selected: "v1.2.0"}
+	if code := controlRequest(t, server, http.MethodPost, "/pause?duration=bogus", "secret", nil); code != http.StatusBadRequest {
+		t.Errorf("POST /pause with an invalid duration = %d; want 400", code)
+	}
+	var paused struct{ Paused bool }
+	if code := controlRequest(t, server, http.MethodPost, "/pause?duration=1h&reason=freeze", "secret", &paused); code != http.StatusOK || !paused.Paused {
+		t.Fatalf("POST /pause = %d, %+v; want 200 paused", code, paused)
+	}
+	want := "updates paused by control endpoint until " + clock.Add(time.Hour).Format(time.RFC3339) + ": freeze"
+	if deferral := updateDeferral(dataDir, check, "v1.1.0"); deferral != want {
+		t.Errorf("updateDeferral() while paused = %q; want %q", deferral, want)
+	}
+
+	if code := controlRequest(t, server, http.MethodPost, "/resume", "secret", &paused); code != http.StatusOK || paused.Paused {
+		t.Fatalf("POST /resume = %d, %+v; want 200 not paused", code, paused)
+	}
+	if deferral := updateDeferral(dataDir, check, "v1.1.0"); deferral != "" {
+		t.Errorf("updateDeferral() after resume = %q; want none", deferral)
+	}
+}
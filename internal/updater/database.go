@@ -0,0 +1,302 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sqliteHeader is the magic string every SQLite 3 database file starts with
+	sqliteHeader = "SQLite format 3\x00"
+
+	// databaseCheckTimeout bounds the post-update database integrity check
+	databaseCheckTimeout = 2 * time.Minute
+
+	// databaseSnapshotPrefix starts the name of every snapshot directory
+	databaseSnapshotPrefix = "db-"
+
+	// snapshotSpaceMargin is kept free on top of the snapshot size so the copy
+	// never fills the volume the agent needs to keep running
+	snapshotSpaceMargin = 64 * 1024 * 1024
+)
+
+// databaseFileSuffixes lists the main SQLite file and its write-ahead log sidecars
+var databaseFileSuffixes = []string{"", "-wal", "-shm"}
+
+// DatabaseSnapshot records a copy of the agent database taken before an update
+type DatabaseSnapshot struct {
+	SourcePath string    `json:"sourcePath"`
+	Dir        string    `json:"dir"`
+	Files      []string  `json:"files"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// databaseFiles returns the database file and whichever sidecar files exist,
+// along with their combined size
+func databaseFiles(dbPath string) ([]string, int64, error) {
+	var files []string
+	var total int64
+
+	for _, suffix := range databaseFileSuffixes {
+		info, err := os.Stat(dbPath + suffix)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, dbPath+suffix)
+		total += info.Size()
+	}
+
+	return files, total, nil
+}
+
+// existingAncestor returns path or its closest parent directory that exists
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// checkDatabaseSnapshotSpace verifies there is room to snapshot the database
+// into destDir. It runs before the agent is stopped so a full disk fails early.
+func checkDatabaseSnapshotSpace(dbPath, destDir string) error {
+	_, size, err := databaseFiles(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat database files: %w", err)
+	}
+	if size == 0 {
+		return nil
+	}
+
+	volume := existingAncestor(destDir)
+	free, err := diskFreeBytes(volume)
+	if err != nil {
+		LogWarning("Could not determine free space on %s: %v", volume, err)
+		return nil
+	}
+
+	needed := uint64(size) + snapshotSpaceMargin
+	if free < needed {
+		return fmt.Errorf("insufficient disk space for database snapshot: need ~%d MB on %s, have %d MB",
+			needed/(1024*1024), volume, free/(1024*1024))
+	}
+	return nil
+}
+
+// snapshotDatabase copies the database and its sidecar files into a new
+// directory under backupDir. It returns nil if the database does not exist yet.
+func snapshotDatabase(dbPath, backupDir string) (*DatabaseSnapshot, error) {
+	files, size, err := databaseFiles(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database files: %w", err)
+	}
+	if len(files) == 0 {
+		LogInfo("No database found at %s, skipping database snapshot", dbPath)
+		return nil, nil
+	}
+
+	if err := checkDatabaseSnapshotSpace(dbPath, backupDir); err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now()
+	snapshotDir := filepath.Join(backupDir, databaseSnapshotPrefix+createdAt.Format("20060102-150405"))
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	LogInfo("Snapshotting database (%d bytes) to %s", size, snapshotDir)
+	for _, file := range files {
+		dest := filepath.Join(snapshotDir, filepath.Base(file))
+		if err := copyFileStreaming(file, dest); err != nil {
+			os.RemoveAll(snapshotDir)
+			return nil, fmt.Errorf("failed to snapshot %s: %w", file, err)
+		}
+		LogInfo("  Copied %s", filepath.Base(file))
+	}
+
+	return &DatabaseSnapshot{
+		SourcePath: dbPath,
+		Dir:        snapshotDir,
+		Files:      files,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// restoreDatabaseSnapshot copies the snapshot files back over the live
+// database. Sidecar files absent from the snapshot are removed so a newer
+// write-ahead log is never replayed onto the restored database.
+func restoreDatabaseSnapshot(snapshot *DatabaseSnapshot) error {
+	LogInfo("Restoring database snapshot from %s", snapshot.Dir)
+
+	for _, suffix := range databaseFileSuffixes {
+		livePath := snapshot.SourcePath + suffix
+		snapshotPath := filepath.Join(snapshot.Dir, filepath.Base(livePath))
+
+		if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
+			if err := os.Remove(livePath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", livePath, err)
+			}
+			continue
+		}
+
+		if err := copyFileStreaming(snapshotPath, livePath); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", livePath, err)
+		}
+		LogInfo("  Restored %s", livePath)
+	}
+
+	return nil
+}
+
+// pruneDatabaseSnapshots keeps the newest keep snapshot directories in backupDir
+// and deletes the rest. Snapshot names embed their timestamp, so they sort by age.
+func pruneDatabaseSnapshots(backupDir string, keep int) {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			LogWarning("Failed to list database snapshots: %v", err)
+		}
+		return
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), databaseSnapshotPrefix) {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(snapshots)))
+
+	if keep < 1 {
+		keep = 1
+	}
+	for i := keep; i < len(snapshots); i++ {
+		path := filepath.Join(backupDir, snapshots[i])
+		if err := os.RemoveAll(path); err != nil {
+			LogWarning("Failed to prune database snapshot %s: %v", path, err)
+		} else {
+			LogInfo("Pruned old database snapshot: %s", path)
+		}
+	}
+}
+
+// copyFileStreaming copies src to dst without loading the whole file into memory
+func copyFileStreaming(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+// checkDatabaseHeader verifies the database file starts with the SQLite header
+func checkDatabaseHeader(dbPath string) error {
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("failed to read database header: %w", err)
+	}
+	if !bytes.Equal(header, []byte(sqliteHeader)) {
+		return fmt.Errorf("%s is not a SQLite 3 database", dbPath)
+	}
+	return nil
+}
+
+// checkDatabaseIntegrity validates the database after the new agent version
+// has started. It always checks the file header, then runs the configured
+// check command, or `PRAGMA integrity_check` through the sqlite3 CLI when
+// available.
+func checkDatabaseIntegrity(dbPath string) error {
+	info, err := os.Stat(dbPath)
+	if os.IsNotExist(err) || (err == nil && info.Size() == 0) {
+		LogInfo("Database not present or empty at %s, skipping integrity check", dbPath)
+		return nil
+	}
+	if err != nil {
+		return newUpdateError(ErrCodeDatabaseIntegrity, "failed to stat database: %v", err)
+	}
+
+	if err := checkDatabaseHeader(dbPath); err != nil {
+		return newUpdateError(ErrCodeDatabaseIntegrity, "%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), databaseCheckTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if command := getConfig().DatabaseCheckCommand; command != "" {
+		LogInfo("Running configured database check: %s", command)
+		cmd = shellCommand(ctx, command)
+		cmd.Env = append(cmd.Env, "SENTINEL_DB_PATH="+dbPath)
+	} else if sqlite, err := exec.LookPath("sqlite3"); err == nil {
+		LogInfo("Running PRAGMA integrity_check with %s", sqlite)
+		cmd = exec.CommandContext(ctx, sqlite, "-readonly", dbPath, "PRAGMA integrity_check;")
+	} else {
+		LogInfo("sqlite3 not available and no database check command configured, header check only")
+		return nil
+	}
+
+	output, err := cmd.CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err != nil {
+		return newUpdateError(ErrCodeDatabaseIntegrity, "database check failed: %v: %s", err, result)
+	}
+	if getConfig().DatabaseCheckCommand == "" && result != "ok" {
+		return newUpdateError(ErrCodeDatabaseIntegrity, "integrity_check reported: %s", result)
+	}
+
+	LogInfo("Database integrity verified")
+	return nil
+}
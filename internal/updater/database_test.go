@@ -0,0 +1,117 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestSnapshotAndRestoreDatabase verifies that the database and its sidecar
+// files are copied and restored, and that a WAL created after the snapshot is
+// removed on restore
+func TestSnapshotAndRestoreDatabase(t *testing.T) {
+	dataDir := t.TempDir()
+	backupDir := filepath.Join(dataDir, "backups")
+	dbPath := filepath.Join(dataDir, "sentinel.db")
+
+	original := sqliteHeader + "original contents"
+	if err := os.WriteFile(dbPath, []byte(original), 0644); err != nil {
+		t.Fatalf("failed to write database: %v", err)
+	}
+
+	snapshot, err := snapshotDatabase(dbPath, backupDir)
+	if err != nil {
+		t.Fatalf("snapshotDatabase() failed: %v", err)
+	}
+	if snapshot == nil || len(snapshot.Files) != 1 {
+		t.Fatalf("snapshotDatabase() = %+v; want snapshot of 1 file", snapshot)
+	}
+
+	// Simulate the new agent version migrating the database
+	if err := os.WriteFile(dbPath, []byte(sqliteHeader+"migrated"), 0644); err != nil {
+		t.Fatalf("failed to modify database: %v", err)
+	}
+	if err := os.WriteFile(dbPath+"-wal", []byte("new wal"), 0644); err != nil {
+		t.Fatalf("failed to write WAL: %v", err)
+	}
+
+	if err := restoreDatabaseSnapshot(snapshot); err != nil {
+		t.Fatalf("restoreDatabaseSnapshot() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read restored database: %v", err)
+	}
+	if string(data) != original {
+		t.Errorf("restored database = %q; want %q", data, original)
+	}
+	if _, err := os.Stat(dbPath + "-wal"); !os.IsNotExist(err) {
+		t.Error("WAL written after the snapshot should be removed on restore")
+	}
+}
+
+// TestSnapshotDatabaseMissing verifies that a missing database is not an error
+func TestSnapshotDatabaseMissing(t *testing.T) {
+	dataDir := t.TempDir()
+
+	snapshot, err := snapshotDatabase(filepath.Join(dataDir, "sentinel.db"), filepath.Join(dataDir, "backups"))
+	if err != nil || snapshot != nil {
+		t.Errorf("snapshotDatabase() = %v, %v; want nil, nil", snapshot, err)
+	}
+}
+
+// TestCheckDatabaseIntegrityBadHeader verifies that a file that is not a
+// SQLite database fails the integrity check
+func TestCheckDatabaseIntegrityBadHeader(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sentinel.db")
+	if err := os.WriteFile(dbPath, []byte("this is not a database file"), 0644); err != nil {
+		t.Fatalf("failed to write database: %v", err)
+	}
+
+	err := checkDatabaseIntegrity(dbPath)
+	if ErrorCodeOf(err) != ErrCodeDatabaseIntegrity {
+		t.Errorf("checkDatabaseIntegrity() = %v; want %s", err, ErrCodeDatabaseIntegrity)
+	}
+}
+
+// TestPruneDatabaseSnapshots verifies that only the newest snapshots are kept
+// and that unrelated files in the backup directory are left alone
+func TestPruneDatabaseSnapshots(t *testing.T) {
+	backupDir := t.TempDir()
+
+	names := []string{"db-20240101-000000", "db-20240301-000000", "db-20240201-000000", "db-20240401-000000"}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(backupDir, name), 0755); err != nil {
+			t.Fatalf("failed to create snapshot dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, backupIndexFileName), []byte("[]"), 0644); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	pruneDatabaseSnapshots(backupDir, 2)
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("failed to read backup directory: %v", err)
+	}
+
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	sort.Strings(remaining)
+
+	expected := []string{"db-20240301-000000", "db-20240401-000000", backupIndexFileName}
+	if len(remaining) != len(expected) {
+		t.Fatalf("remaining = %v; want %v", remaining, expected)
+	}
+	for i := range expected {
+		if remaining[i] != expected[i] {
+			t.Errorf("remaining = %v; want %v", remaining, expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,603 @@
+package updater
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+const (
+	// doctorNetworkTimeout bounds each request doctor sends
+	doctorNetworkTimeout = 15 * time.Second
+
+	// doctorClockSkewWarning is how far the clock may be from a server's
+	// before doctor warns; TLS and rollout timing go wrong well beyond it
+	doctorClockSkewWarning = 5 * time.Minute
+)
+
+// DoctorStatus is how a diagnostic check turned out
+type DoctorStatus string
+
+const (
+	// DoctorPass means nothing needs attention
+	DoctorPass DoctorStatus = "pass"
+
+	// DoctorWarn means updates may still work, or start working by themselves
+	DoctorWarn DoctorStatus = "warn"
+
+	// DoctorFail means updates will fail until it is fixed
+	DoctorFail DoctorStatus = "fail"
+)
+
+// DoctorCheck is the outcome of one diagnostic check. Fix says what to do
+// about a warning or failure, when there is something to do.
+type DoctorCheck struct {
+	Name   string       `json:"name"`
+	Status DoctorStatus `json:"status"`
+	Detail string       `json:"detail"`
+	Fix    string       `json:"fix,omitempty"`
+}
+
+// doctorEnv is what the diagnostic checks share. Earlier checks fill in what
+// later ones use, such as the go command and the detected agent binary.
+type doctorEnv struct {
+	config     *UpdaterConfig
+	configErr  error
+	dataDir    string
+	goBinary   string
+	binaryPath string
+	client     *http.Client
+	serverTime time.Time
+}
+
+// doctorChecks are the diagnostic checks in the order they run and print
+var doctorChecks = []func(env *doctorEnv) DoctorCheck{
+	doctorConfigCheck,
+	doctorGoCheck,
+	doctorGoEnvCheck,
+	doctorCCompilerCheck,
+	doctorToolchainCheck,
+	doctorBinaryCheck,
+	doctorAgentVersionCheck,
+	doctorAgentServiceCheck,
+	doctorUpdaterServiceCheck,
+	doctorDirectoriesCheck,
+	doctorDiskSpaceCheck,
+	doctorGoCacheCheck,
+	doctorModuleProxyCheck,
+	doctorManifestCheck,
+	doctorClockCheck,
+}
+
+// RunDoctor runs diagnostic checks against the current installation without
+// changing anything
+func RunDoctor() []DoctorCheck {
+	config, err := loadConfigPath(paths.GetUpdaterConfigPath())
+	activeConfig.Store(config)
+
+	env := &doctorEnv{config: config, configErr: err, dataDir: paths.GetDataDirectory()}
+	checks := make([]DoctorCheck, 0, len(doctorChecks))
+	for _, check := range doctorChecks {
+		checks = append(checks, check(env))
+	}
+	return checks
+}
+
+// doctorResult returns a check that passed with detail when err is nil and
+// failed with fix otherwise
+func doctorResult(name string, err error, detail, fix string) DoctorCheck {
+	if err != nil {
+		return DoctorCheck{Name: name, Status: DoctorFail, Detail: err.Error(), Fix: fix}
+	}
+	return DoctorCheck{Name: name, Status: DoctorPass, Detail: detail}
+}
+
+func doctorConfigCheck(env *doctorEnv) DoctorCheck {
+	path := paths.GetUpdaterConfigPath()
+	return doctorResult("Configuration", env.configErr, path, "correct "+path+"; the defaults apply until then")
+}
+
+// doctorGoCheck finds the go command updates build with and its version
+func doctorGoCheck(env *doctorEnv) DoctorCheck {
+	goBinary, err := findGoBinary()
+	if err != nil {
+		return DoctorCheck{Name: "Go", Status: DoctorFail, Detail: "go command not found: " + err.Error(),
+			Fix: "install Go from https://go.dev/dl/ and add its bin directory to PATH"}
+	}
+	settings, err := readGoEnv(goBinary, commandEnvironment(), "GOVERSION")
+	if err != nil {
+		return DoctorCheck{Name: "Go", Status: DoctorFail, Detail: fmt.Sprintf("%s does not run: %v", goBinary, err),
+			Fix: "reinstall Go from https://go.dev/dl/"}
+	}
+	env.goBinary = goBinary
+	return DoctorCheck{Name: "Go", Status: DoctorPass, Detail: fmt.Sprintf("%s (%s)", goBinary, settings["GOVERSION"])}
+}
+
+// doctorGoEnvCheck validates the goEnv and netrcPath settings with go env
+func doctorGoEnvCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Go settings", Status: DoctorFail}
+	config := env.config
+	if len(config.GoEnv) == 0 && config.NetrcPath == "" {
+		check.Status = DoctorPass
+		check.Detail = "defaults"
+		return check
+	}
+	if env.goBinary == "" {
+		check.Detail = "not checked, go command not found"
+		return check
+	}
+	if err := validateGoEnv(env.goBinary, config); err != nil {
+		check.Detail = err.Error()
+		check.Fix = "correct goEnv or netrcPath in " + paths.GetUpdaterConfigPath()
+		return check
+	}
+
+	check.Status = DoctorPass
+	check.Detail = strings.Join(config.goEnvKeys(), ", ")
+	if config.NetrcPath != "" {
+		check.Detail = strings.TrimPrefix(check.Detail+", NETRC", ", ")
+	}
+	return check
+}
+
+// doctorCCompilerCheck looks for the C compiler a CGO build needs: gcc on
+// PATH or cached on Windows, the compiler in CC or a common one elsewhere.
+// Under cgoEnabled auto a missing compiler only fails agents that need CGO,
+// so it is a warning.
+func doctorCCompilerCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "C compiler", Status: DoctorFail}
+	if env.config.CGOEnabled == CGOModeFalse {
+		check.Status = DoctorPass
+		check.Detail = "not needed (cgoEnabled is false)"
+		return check
+	}
+	if env.config.CGOEnabled == CGOModeAuto {
+		check.Status = DoctorWarn
+	}
+
+	if runtime.GOOS != "windows" {
+		compiler, found := findCCompiler(os.Environ())
+		if !found {
+			hint := cCompilerInstallHint(runtime.GOOS, func(name string) bool {
+				_, err := lookPath(os.Environ(), name)
+				return err == nil
+			})
+			check.Detail = fmt.Sprintf("none of %s found on PATH", compiler)
+			check.Fix = "install one with: " + hint
+			if env.config.CGOEnabled == CGOModeAuto {
+				check.Fix += ", or set cgoEnabled to false if the agent needs no CGO"
+			}
+			return check
+		}
+		check.Status = DoctorPass
+		check.Detail = compiler
+		return check
+	}
+
+	gccDir := ""
+	if gccPath, err := exec.LookPath("gcc"); err == nil {
+		gccDir = filepath.Dir(gccPath)
+	} else if cache, err := loadToolchainCache(env.dataDir); err == nil && cache != nil {
+		gccDir = cache.GCCDir
+	}
+	if gccDir == "" {
+		check.Detail = "gcc not found on PATH or cached; it is searched for or installed at the next update"
+		check.Fix = "install MinGW-w64 gcc and add its bin directory to PATH, or set cgoEnabled to false if the agent needs no CGO"
+		return check
+	}
+	version, err := gccVersion(gccDir)
+	if err != nil {
+		check.Detail = fmt.Sprintf("gcc in %s does not run: %v", gccDir, err)
+		check.Fix = "reinstall MinGW-w64 gcc"
+		return check
+	}
+	check.Status = DoctorPass
+	check.Detail = fmt.Sprintf("%s (%s)", gccExecutable(gccDir), version)
+	return check
+}
+
+// doctorToolchainCheck reports the cached gcc location and whether it still
+// runs. A pure Go build needs no toolchain, so none is checked for it.
+func doctorToolchainCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Cached toolchain", Status: DoctorFail}
+	if env.config.CGOEnabled == CGOModeFalse {
+		check.Status = DoctorPass
+		check.Detail = "not checked (cgoEnabled is false: " + env.config.CGOEnabled.toolchainRequirement() + ")"
+		return check
+	}
+
+	cache, err := loadToolchainCache(env.dataDir)
+	switch {
+	case err != nil:
+		check.Detail = err.Error()
+		check.Fix = "remove " + filepath.Join(env.dataDir, toolchainCacheFileName) + "; the toolchain is searched for again at the next update"
+	case cache == nil:
+		check.Status = DoctorPass
+		check.Detail = "none cached"
+		if runtime.GOOS == "windows" {
+			check.Detail += " (gcc on PATH or not yet detected)"
+		}
+	default:
+		version, err := gccVersion(cache.GCCDir)
+		if err != nil {
+			check.Status = DoctorWarn
+			check.Detail = fmt.Sprintf("%s is no longer usable, it is searched for again at the next update: %v", cache.GCCDir, err)
+		} else {
+			check.Status = DoctorPass
+			check.Detail = fmt.Sprintf("%s (%s)", cache.GCCDir, version)
+		}
+	}
+
+	return check
+}
+
+func doctorBinaryCheck(env *doctorEnv) DoctorCheck {
+	path, method, err := getMainAgentBinaryPathWithDetails()
+	if err != nil {
+		return DoctorCheck{Name: "Agent binary", Status: DoctorFail, Detail: err.Error(),
+			Fix: "install the agent, or set binaryPath in " + paths.GetUpdaterConfigPath()}
+	}
+	env.binaryPath = path
+	return DoctorCheck{Name: "Agent binary", Status: DoctorPass, Detail: fmt.Sprintf("%s (%s)", path, method)}
+}
+
+// doctorAgentVersionCheck runs the detected agent for its version, as every
+// version check does
+func doctorAgentVersionCheck(env *doctorEnv) DoctorCheck {
+	if env.binaryPath == "" {
+		return DoctorCheck{Name: "Agent version", Status: DoctorFail, Detail: "not checked, no agent binary detected"}
+	}
+	version, err := installedVersionDetailsAt(env.binaryPath)
+	return doctorResult("Agent version", err, version.String(), "reinstall the agent, or set versionArgs to the arguments that make "+env.binaryPath+" print its version")
+}
+
+// doctorAgentServiceCheck verifies the agent service is installed, runs the
+// detected binary and is running
+func doctorAgentServiceCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Agent service", Status: DoctorFail}
+	name := agentServiceName()
+	servicePath, err := serviceManager.GetServiceBinaryPath(name)
+	if err != nil {
+		check.Detail = fmt.Sprintf("service %s not found: %v", name, err)
+		check.Fix = "install the agent as a service, or set agentServiceName to the name it is installed under"
+		return check
+	}
+
+	check.Status = DoctorPass
+	check.Detail = fmt.Sprintf("%s runs %s", name, servicePath)
+	if env.binaryPath != "" && !sameFile(servicePath, env.binaryPath) {
+		check.Status = DoctorWarn
+		check.Detail += ", not the detected binary " + env.binaryPath
+		check.Fix = "set binaryPath to " + servicePath + ", as updates replace the detected binary"
+	}
+	if running, err := serviceManager.IsRunning(name); err != nil {
+		check.Status = DoctorWarn
+		check.Detail += fmt.Sprintf(", state unknown: %v", err)
+	} else if !running {
+		check.Status = DoctorWarn
+		check.Detail += ", stopped"
+		if check.Fix == "" {
+			check.Fix = "start the " + name + " service and check its logs if it stops again"
+		}
+	}
+	return check
+}
+
+// doctorUpdaterServiceCheck verifies the updater is installed as a service
+// that runs this binary
+func doctorUpdaterServiceCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Updater service", Status: DoctorWarn}
+	servicePath, err := serviceManager.GetServiceBinaryPath(updaterServiceName)
+	if err != nil {
+		check.Detail = fmt.Sprintf("service %s not installed, updates only run by hand: %v", updaterServiceName, err)
+		check.Fix = "run sentinel-updater install as root (Administrator on Windows)"
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s runs %s", updaterServiceName, servicePath)
+	if executable, err := os.Executable(); err == nil && !sameFile(servicePath, executable) {
+		check.Detail += ", not this binary " + executable
+		check.Fix = "run doctor as " + servicePath + ", or reinstall the service for this binary"
+		return check
+	}
+	check.Status = DoctorPass
+	return check
+}
+
+// directories returns the directories updates write to besides the Go
+// directories, with what each holds
+func (env *doctorEnv) directories() []spaceRequirement {
+	installDir := filepath.Dir(agentBinaryPath())
+	if env.binaryPath != "" {
+		installDir = filepath.Dir(env.binaryPath)
+	}
+	return []spaceRequirement{
+		{Dir: env.dataDir, Purpose: "data directory"},
+		{Dir: installDir, Purpose: "install directory"},
+		{Dir: paths.GetBackupDirectory(), Purpose: "backups"},
+	}
+}
+
+// doctorDirectoriesCheck verifies the data, install and backup directories
+// are writable. One that does not exist yet is created by the first update
+// that needs it, as long as its parent is writable.
+func doctorDirectoriesCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Directories", Status: DoctorPass}
+	var details []string
+	for _, dir := range env.directories() {
+		if err := checkWritable(dir.Dir); err != nil {
+			check.Status = DoctorFail
+			check.Fix = "run the updater as root (Administrator on Windows), or grant it write access to the directories listed"
+			details = append(details, fmt.Sprintf("%s %s", dir.Purpose, err))
+			continue
+		}
+		if _, err := os.Stat(dir.Dir); err != nil {
+			if check.Status == DoctorPass {
+				check.Status = DoctorWarn
+			}
+			details = append(details, fmt.Sprintf("%s %s does not exist yet", dir.Purpose, dir.Dir))
+			continue
+		}
+		details = append(details, fmt.Sprintf("%s %s writable", dir.Purpose, dir.Dir))
+	}
+	check.Detail = strings.Join(details, "; ")
+	return check
+}
+
+// doctorDiskSpaceCheck compares the free space on each volume an update
+// writes to with minFreeSpaceMB, and with what an update of the installed
+// binary is expected to write there
+func doctorDiskSpaceCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Disk space", Status: DoctorPass}
+
+	requirements := env.directories()
+	var binarySize uint64
+	if info, err := os.Stat(env.binaryPath); env.binaryPath != "" && err == nil {
+		binarySize = uint64(info.Size())
+	}
+	if dirs, err := resolveGoDirs(env.dataDir); err == nil {
+		requirements = append(requirements, estimateSpaceRequirements(binarySize, 0, dirs, requirements[1].Dir, requirements[2].Dir)...)
+	}
+
+	type volume struct {
+		dir        string
+		free, need uint64
+	}
+	var order []string
+	volumes := make(map[string]*volume)
+	minFree := uint64(env.config.MinFreeSpaceMB) * 1024 * 1024
+	for _, req := range requirements {
+		dir := existingAncestor(req.Dir)
+		id, free, err := hostVolumeInfo(dir)
+		if err != nil {
+			check.Status = DoctorWarn
+			order = append(order, dir)
+			volumes[dir] = &volume{dir: fmt.Sprintf("%s (free space unknown: %v)", dir, err)}
+			continue
+		}
+		v, ok := volumes[id]
+		if !ok {
+			v = &volume{dir: dir, free: free, need: minFree}
+			volumes[id] = v
+			order = append(order, id)
+		}
+		v.need += req.Bytes
+	}
+
+	var details []string
+	for _, id := range order {
+		v := volumes[id]
+		if v.need == 0 {
+			details = append(details, v.dir)
+			continue
+		}
+		switch {
+		case v.free < minFree:
+			check.Status = DoctorFail
+		case v.free < v.need && check.Status == DoctorPass:
+			check.Status = DoctorWarn
+		}
+		details = append(details, fmt.Sprintf("%s %d MB free, an update needs ~%d MB", v.dir, bytesToMB(v.free), bytesToMB(v.need)))
+	}
+	check.Detail = strings.Join(details, "; ")
+	if check.Status != DoctorPass {
+		check.Fix = "free space on the volumes listed; removing old backups or the Go caches helps"
+	}
+	return check
+}
+
+// doctorGoCacheCheck reports the size of the Go caches against goCacheMaxMB
+func doctorGoCacheCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Go caches", Status: DoctorWarn}
+
+	dirs, err := resolveGoDirs(env.dataDir)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	sizes, err := measureGoCaches(dirs)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	check.Status = DoctorPass
+	check.Detail = fmt.Sprintf("build %d MB (%s), modules %d MB (%s)",
+		bytesToMB(sizes.Build), dirs.GOCACHE, bytesToMB(sizes.Module), dirs.GOMODCACHE)
+	if env.config.GoCacheMaxMB > 0 {
+		check.Detail += fmt.Sprintf(", cleaned above %d MB", env.config.GoCacheMaxMB)
+	}
+	return check
+}
+
+// httpClient returns the client doctor sends requests with: the updater's own,
+// with a shorter timeout, recording the time servers report for the clock
+// check
+func (env *doctorEnv) httpClient() (*http.Client, error) {
+	if env.client != nil {
+		return env.client, nil
+	}
+	client, err := newHTTPClient(env.config)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = doctorNetworkTimeout
+	client.Transport = &serverTimeRecorder{base: client.Transport, serverTime: &env.serverTime}
+	env.client = client
+	return client, nil
+}
+
+// serverTimeRecorder records the Date header of every response
+type serverTimeRecorder struct {
+	base       http.RoundTripper
+	serverTime *time.Time
+}
+
+func (r *serverTimeRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	if err == nil {
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			*r.serverTime = date
+		}
+	}
+	return resp, err
+}
+
+// escapeModulePath escapes the upper-case letters of a module path the way
+// the module proxy protocol does, as "!" and the lower-case letter
+func escapeModulePath(module string) string {
+	var escaped strings.Builder
+	for _, r := range module {
+		if unicode.IsUpper(r) {
+			escaped.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// doctorModuleProxyCheck asks the first module proxy in the effective
+// GOPROXY for the agent module's versions, as the goproxy resolver does
+// through go list
+func doctorModuleProxyCheck(env *doctorEnv) DoctorCheck {
+	check := DoctorCheck{Name: "Module proxy", Status: DoctorFail}
+	config := env.config
+	if !slices.Contains(config.VersionResolvers, ResolverGoProxy) && config.ManifestURL == "" {
+		check.Status = DoctorPass
+		check.Detail = "not used (versionResolvers does not include goproxy)"
+		return check
+	}
+	if env.goBinary == "" {
+		check.Detail = "not checked, go command not found"
+		return check
+	}
+
+	settings, err := readGoEnv(env.goBinary, applyGoEnv(commandEnvironment(), config), "GOPROXY", "GONOPROXY")
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	if matchModulePatterns(settings["GONOPROXY"], config.AgentModule) {
+		check.Status = DoctorPass
+		check.Detail = "not used, " + config.AgentModule + " matches GONOPROXY"
+		return check
+	}
+	proxy, _, _ := strings.Cut(strings.ReplaceAll(settings["GOPROXY"], "|", ","), ",")
+	switch proxy {
+	case "off":
+		check.Detail = "GOPROXY is off, no versions can be listed"
+		check.Fix = "set GOPROXY in goEnv, or remove goproxy from versionResolvers"
+		return check
+	case "direct", "":
+		check.Status = DoctorPass
+		check.Detail = "GOPROXY is direct, modules are fetched from their repositories"
+		return check
+	}
+
+	client, err := env.httpClient()
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	listURL := strings.TrimSuffix(proxy, "/") + "/" + escapeModulePath(config.AgentModule) + "/@v/list"
+	resp, err := client.Get(listURL)
+	if err != nil {
+		check.Detail = fmt.Sprintf("%s is unreachable: %s", redactConfigValue("goEnv", proxy), redactConfigValue("goEnv", err.Error()))
+		check.Fix = "allow outbound HTTPS to the proxy, set httpProxy if the network needs one, or point GOPROXY in goEnv at a reachable mirror"
+		return check
+	}
+	resp.Body.Close()
+	if err := checkProxyResponse(resp, config); err != nil {
+		check.Detail = err.Error()
+		check.Fix = "check the proxy's credentials and TLS settings in goEnv and netrcPath"
+		return check
+	}
+
+	check.Detail = fmt.Sprintf("%s answered %s", redactConfigValue("goEnv", proxy), resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		check.Status = DoctorPass
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		check.Status = DoctorWarn
+		check.Detail += " for " + config.AgentModule
+		check.Fix = "set GOPRIVATE in goEnv for a private module, or check agentModule"
+	case resp.StatusCode != http.StatusOK:
+		check.Fix = "retry later, or point GOPROXY in goEnv at another mirror"
+	}
+	return check
+}
+
+// doctorManifestCheck fetches and validates the update manifest, if one is
+// configured
+func doctorManifestCheck(env *doctorEnv) DoctorCheck {
+	if env.config.ManifestURL == "" {
+		return DoctorCheck{Name: "Update manifest", Status: DoctorPass, Detail: "not configured"}
+	}
+	client, err := env.httpClient()
+	if err != nil {
+		return DoctorCheck{Name: "Update manifest", Status: DoctorFail, Detail: err.Error()}
+	}
+	manifest, _, err := requestManifest(client, env.config, "", false)
+	if err != nil {
+		return DoctorCheck{Name: "Update manifest", Status: DoctorFail, Detail: err.Error(),
+			Fix: "check manifestURL, and the manifest's signature and format"}
+	}
+	detail := "valid"
+	if manifest.Version != "" {
+		detail += ", pins " + manifest.Version
+	}
+	return DoctorCheck{Name: "Update manifest", Status: DoctorPass, Detail: detail}
+}
+
+// doctorClockCheck compares the clock with the time the last server reached
+// reported. Without one it is not compared.
+func doctorClockCheck(env *doctorEnv) DoctorCheck {
+	local := now()
+	check := DoctorCheck{Name: "Clock", Status: DoctorPass, Detail: local.Format(time.RFC3339)}
+	if env.serverTime.IsZero() {
+		check.Detail += ", not compared as no server was reached"
+		return check
+	}
+
+	skew := local.Sub(env.serverTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > doctorClockSkewWarning {
+		check.Status = DoctorWarn
+		check.Detail += fmt.Sprintf(", %v off the server time %s", skew.Round(time.Second), env.serverTime.Format(time.RFC3339))
+		check.Fix = "enable time synchronization (NTP)"
+		return check
+	}
+	check.Detail += ", in sync with the server time"
+	return check
+}
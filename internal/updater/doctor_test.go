@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// TestDoctorAgentServiceCheck verifies that the agent service passes when it
+// runs the detected binary and warns when it runs another one or is stopped
+func TestDoctorAgentServiceCheck(t *testing.T) {
+	withConfig(t, &UpdaterConfig{AgentServiceName: "guard-agent"})
+	binary := filepath.Join(t.TempDir(), "guardd")
+
+	tests := []struct {
+		servicePath string
+		running     bool
+		want        DoctorStatus
+	}{
+		{binary, true, DoctorPass},
+		{filepath.Join(t.TempDir(), "guardd"), true, DoctorWarn},
+		{binary, false, DoctorWarn},
+	}
+	for _, tt := range tests {
+		useServiceManager(t, &servicetest.FakeManager{
+			Binaries: map[string]string{"guard-agent": tt.servicePath},
+			Running:  map[string]bool{"guard-agent": tt.running},
+		})
+		check := doctorAgentServiceCheck(&doctorEnv{binaryPath: binary})
+		if check.Status != tt.want {
+			t.Errorf("doctorAgentServiceCheck() running %s, %v = %s (%s); want %s", tt.servicePath, tt.running, check.Status, check.Detail, tt.want)
+		}
+	}
+
+	useServiceManager(t, &servicetest.FakeManager{})
+	if check := doctorAgentServiceCheck(&doctorEnv{binaryPath: binary}); check.Status != DoctorFail {
+		t.Errorf("doctorAgentServiceCheck() without the service = %s; want fail", check.Status)
+	}
+}
+
+// TestDoctorModuleProxyCheck verifies that the first GOPROXY entry is asked
+// for the escaped agent module, that a missing module is a warning, and that
+// the clock is compared with the time the proxy reported
+func TestDoctorModuleProxyCheck(t *testing.T) {
+	goBinary, err := findGoBinary()
+	if err != nil {
+		t.Skipf("go command not found: %v", err)
+	}
+	fakeClock(t)
+
+	status := http.StatusOK
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy", "GOPRIVATE", "GONOPROXY", "GOFLAGS"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("GOPROXY", server.URL+",direct")
+
+	config := &UpdaterConfig{AgentModule: "github.com/BrainStation-23/SentinelGo", VersionResolvers: []string{ResolverGoProxy}}
+	env := &doctorEnv{config: config, goBinary: goBinary}
+	if check := doctorModuleProxyCheck(env); check.Status != DoctorPass {
+		t.Errorf("doctorModuleProxyCheck() = %s (%s); want pass", check.Status, check.Detail)
+	}
+	if want := "/github.com/!brain!station-23/!sentinel!go/@v/list"; requested != want {
+		t.Errorf("doctorModuleProxyCheck() requested %s; want %s", requested, want)
+	}
+	// The fake clock is months away from the proxy's Date header
+	if check := doctorClockCheck(env); check.Status != DoctorWarn || !strings.Contains(check.Detail, "off the server time") {
+		t.Errorf("doctorClockCheck() = %s (%s); want a warning about the skew", check.Status, check.Detail)
+	}
+
+	status = http.StatusNotFound
+	if check := doctorModuleProxyCheck(env); check.Status != DoctorWarn {
+		t.Errorf("doctorModuleProxyCheck() for a missing module = %s (%s); want warn", check.Status, check.Detail)
+	}
+	status = http.StatusInternalServerError
+	if check := doctorModuleProxyCheck(env); check.Status != DoctorFail {
+		t.Errorf("doctorModuleProxyCheck() for a failing proxy = %s (%s); want fail", check.Status, check.Detail)
+	}
+
+	t.Setenv("GONOPROXY", "github.com/BrainStation-23/*")
+	if check := doctorModuleProxyCheck(env); check.Status != DoctorPass || !strings.Contains(check.Detail, "GONOPROXY") {
+		t.Errorf("doctorModuleProxyCheck() for a GONOPROXY module = %s (%s); want pass, not used", check.Status, check.Detail)
+	}
+}
+
+// TestDoctorFixes verifies that failing and warning checks say what to do
+// and passing ones do not
+func TestDoctorFixes(t *testing.T) {
+	withConfig(t, &UpdaterConfig{AgentServiceName: "guard-agent"})
+	binary := filepath.Join(t.TempDir(), "guardd")
+
+	useServiceManager(t, &servicetest.FakeManager{})
+	if check := doctorAgentServiceCheck(&doctorEnv{binaryPath: binary}); check.Fix == "" {
+		t.Errorf("doctorAgentServiceCheck() without the service = %s (%s); want a fix", check.Status, check.Detail)
+	}
+	useServiceManager(t, &servicetest.FakeManager{
+		Binaries: map[string]string{"guard-agent": binary},
+		Running:  map[string]bool{"guard-agent": false},
+	})
+	if check := doctorAgentServiceCheck(&doctorEnv{binaryPath: binary}); !strings.Contains(check.Fix, "start the guard-agent service") {
+		t.Errorf("doctorAgentServiceCheck() stopped = %s (%s); want a fix starting it", check.Fix, check.Detail)
+	}
+
+	env := &doctorEnv{config: &UpdaterConfig{MinFreeSpaceMB: 1}, dataDir: t.TempDir(), binaryPath: binary}
+	if check := doctorDirectoriesCheck(env); check.Status == DoctorFail || check.Fix != "" {
+		t.Errorf("doctorDirectoriesCheck() = %s (%s), fix %q; want writable and no fix", check.Status, check.Detail, check.Fix)
+	}
+	if check := doctorClockCheck(env); check.Fix != "" {
+		t.Errorf("doctorClockCheck() without a server time has fix %q", check.Fix)
+	}
+}
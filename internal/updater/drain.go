@@ -0,0 +1,161 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDrainTimeoutSeconds bounds how long the agent may take to drain
+	DefaultDrainTimeoutSeconds = 60
+
+	// DrainPolicyProceed stops an agent that did not drain, with a warning;
+	// DrainPolicyAbort aborts the update before the agent is stopped
+	DrainPolicyProceed = "proceed"
+	DrainPolicyAbort   = "abort"
+
+	// maxDrainResponseBytes bounds the drain status read from the agent
+	maxDrainResponseBytes = 64 * 1024
+)
+
+// drainPollInterval is the wait between checks of whether the agent is safe
+// to stop; it is a variable so tests can shorten it
+var drainPollInterval = 2 * time.Second
+
+// drainAgent asks the agent to finish its in-flight work and waits until it
+// is safe to stop. It returns an error only when the agent did not drain and
+// drainTimeoutPolicy is abort; without drainURL or drainCommand it does
+// nothing.
+func drainAgent(config *UpdaterConfig) error {
+	if config.DrainURL == "" && config.DrainCommand == "" {
+		return nil
+	}
+
+	LogInfo("Draining main agent before stopping it (timeout %v)...", config.DrainTimeout())
+	start := now()
+	err := runDrain(config)
+	if err == nil {
+		LogInfo("Main agent drained in %v, safe to stop", now().Sub(start).Round(time.Millisecond))
+		return nil
+	}
+	if config.DrainTimeoutPolicy == DrainPolicyAbort {
+		LogError("Main agent did not drain: %v", err)
+		return newUpdateError(ErrCodeDrainFailed, "main agent did not drain: %v", err)
+	}
+	LogWarning("Main agent did not drain, stopping it anyway: %v", err)
+	return nil
+}
+
+// runDrain starts the drain and polls until the agent is safe to stop or the
+// drain timeout passes
+func runDrain(config *UpdaterConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.DrainTimeout())
+	defer cancel()
+
+	check := func() (bool, error) { return drainCommandDone(ctx, config) }
+	if config.DrainURL != "" {
+		client, err := newHTTPClient(config)
+		if err != nil {
+			return err
+		}
+		if err := requestDrain(ctx, client, config); err != nil {
+			return err
+		}
+		check = func() (bool, error) { return drainStatusDone(ctx, client, config) }
+	}
+
+	// A check cut short by the timeout says nothing about the agent
+	var lastErr error
+	for {
+		done, err := check()
+		if done {
+			return nil
+		}
+		if err != nil && ctx.Err() == nil {
+			LogDebug("Main agent not yet safe to stop: %v", err)
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("not safe to stop after %v, last status: %v", config.DrainTimeout(), lastErr)
+			}
+			return fmt.Errorf("not safe to stop after %v", config.DrainTimeout())
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+// requestDrain POSTs to drainURL to ask the agent to stop taking new work
+func requestDrain(ctx context.Context, client *http.Client, config *UpdaterConfig) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.DrainURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "sentinel-updater")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("drain request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("drain request returned %s", resp.Status)
+	}
+	return nil
+}
+
+// drainStatusDone reports whether a GET of drainURL says the agent is safe
+// to stop: a 2xx response containing drainExpectedResponse, if set
+func drainStatusDone(ctx context.Context, client *http.Client, config *UpdaterConfig) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.DrainURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "sentinel-updater")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDrainResponseBytes))
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("drain status returned %s", resp.Status)
+	}
+	return drainResponseMatches(config, string(body))
+}
+
+// drainCommandDone runs drainCommand and reports whether it says the agent
+// is safe to stop: exit status 0 and output containing drainExpectedResponse,
+// if set
+func drainCommandDone(ctx context.Context, config *UpdaterConfig) (bool, error) {
+	cmd := shellCommand(ctx, config.DrainCommand)
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("drain command failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return drainResponseMatches(config, string(output))
+}
+
+// drainResponseMatches reports whether response contains
+// drainExpectedResponse
+func drainResponseMatches(config *UpdaterConfig, response string) (bool, error) {
+	if strings.Contains(response, config.DrainExpectedResponse) {
+		return true, nil
+	}
+	return false, fmt.Errorf("response %q does not contain %q", strings.TrimSpace(response), config.DrainExpectedResponse)
+}
+
+// validDrainPolicy reports whether policy is a known drainTimeoutPolicy
+func validDrainPolicy(policy string) bool {
+	return policy == DrainPolicyProceed || policy == DrainPolicyAbort
+}
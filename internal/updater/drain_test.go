@@ -0,0 +1,147 @@
+package updater
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDrainServer simulates an agent that answers a drain request with
+// drainStatus and reports "drained" once polled polls times, or never when
+// polls is negative
+func newDrainServer(t *testing.T, drainStatus, polls int) (*httptest.Server, *int) {
+	drained, polled := false, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			drained = true
+			w.WriteHeader(drainStatus)
+		case http.MethodGet:
+			polled++
+			if !drained || polls < 0 || polled < polls {
+				fmt.Fprint(w, `{"state": "draining"}`)
+				return
+			}
+			fmt.Fprint(w, `{"state": "drained"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	original := drainPollInterval
+	drainPollInterval = time.Millisecond
+	t.Cleanup(func() { drainPollInterval = original })
+	return server, &polled
+}
+
+// TestDrainAgentSlow verifies that the agent is polled until it reports the
+// expected response
+func TestDrainAgentSlow(t *testing.T) {
+	server, polled := newDrainServer(t, http.StatusAccepted, 5)
+	config := &UpdaterConfig{
+		DrainURL:              server.URL,
+		DrainExpectedResponse: `"drained"`,
+		DrainTimeoutSeconds:   5,
+		DrainTimeoutPolicy:    DrainPolicyAbort,
+	}
+
+	if err := drainAgent(config); err != nil {
+		t.Fatalf("drainAgent() failed: %v", err)
+	}
+	if *polled != 5 {
+		t.Errorf("drain status polled %d times; want 5", *polled)
+	}
+}
+
+// TestDrainAgentFailure verifies that an agent that rejects the drain or
+// never drains is stopped anyway under the proceed policy, and aborts the
+// update under the abort policy
+func TestDrainAgentFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		drainStatus int
+		polls       int
+		want        string
+	}{
+		{"rejected", http.StatusInternalServerError, 1, "drain request returned 500"},
+		{"timeout", http.StatusAccepted, -1, `not safe to stop after 1s, last status: response "{\"state\": \"draining\"}"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newDrainServer(t, tt.drainStatus, tt.polls)
+			config := &UpdaterConfig{
+				DrainURL:              server.URL,
+				DrainExpectedResponse: `"drained"`,
+				DrainTimeoutSeconds:   1,
+				DrainTimeoutPolicy:    DrainPolicyAbort,
+			}
+
+			err := drainAgent(config)
+			if ErrorCodeOf(err) != ErrCodeDrainFailed || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("drainAgent(abort) = %v; want %s containing %q", err, ErrCodeDrainFailed, tt.want)
+			}
+
+			config.DrainTimeoutPolicy = DrainPolicyProceed
+			if err := drainAgent(config); err != nil {
+				t.Errorf("drainAgent(proceed) = %v; want nil", err)
+			}
+		})
+	}
+}
+
+// TestDrainAgentCommand verifies that drainCommand is run until it exits 0
+func TestDrainAgentCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("drain script requires a Unix shell")
+	}
+	original := drainPollInterval
+	drainPollInterval = time.Millisecond
+	t.Cleanup(func() { drainPollInterval = original })
+
+	counter := filepath.Join(t.TempDir(), "polls")
+	config := &UpdaterConfig{
+		DrainCommand:        fmt.Sprintf(`echo x >> %s; test $(wc -l < %s) -ge 3`, counter, counter),
+		DrainTimeoutSeconds: 5,
+		DrainTimeoutPolicy:  DrainPolicyAbort,
+	}
+	if err := drainAgent(config); err != nil {
+		t.Errorf("drainAgent() failed: %v", err)
+	}
+}
+
+// TestLoadConfigPathDrain verifies the drain defaults and that drainURL
+// replaces drainCommand
+func TestLoadConfigPathDrain(t *testing.T) {
+	tests := []struct {
+		content string
+		url     string
+		command string
+		timeout int
+		policy  string
+	}{
+		{`{}`, "", "", DefaultDrainTimeoutSeconds, DrainPolicyProceed},
+		{`{"drainURL": "http://127.0.0.1:8080/drain", "drainCommand": "sentinel drain", "drainTimeoutSeconds": 120, "drainTimeoutPolicy": "Abort"}`,
+			"http://127.0.0.1:8080/drain", "", 120, DrainPolicyAbort},
+		{`{"drainURL": "127.0.0.1:8080", "drainCommand": "sentinel drain", "drainTimeoutSeconds": -1, "drainTimeoutPolicy": "wait"}`,
+			"", "sentinel drain", DefaultDrainTimeoutSeconds, DrainPolicyProceed},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		writeLog(t, configPath, tt.content)
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		if config.DrainURL != tt.url || config.DrainCommand != tt.command || config.DrainTimeoutSeconds != tt.timeout || config.DrainTimeoutPolicy != tt.policy {
+			t.Errorf("loadConfigPath(%s) drain = %q, %q, %ds, %s; want %q, %q, %ds, %s", tt.content,
+				config.DrainURL, config.DrainCommand, config.DrainTimeoutSeconds, config.DrainTimeoutPolicy,
+				tt.url, tt.command, tt.timeout, tt.policy)
+		}
+	}
+}
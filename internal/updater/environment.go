@@ -0,0 +1,94 @@
+package updater
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// processHome is the home directory found for the updater's account, looked
+// up once as it does not change while the updater runs
+var processHome = sync.OnceValues(ensureHomeDirectory)
+
+// commandEnvironment returns the environment for a command the updater runs:
+// its own, with HOME filled in when it is missing, as the go command needs it
+// for its defaults. It is derived afresh for every command and never written
+// back with os.Setenv, so nothing computed for one command leaks into the
+// updater itself or into the next.
+func commandEnvironment() []string {
+	env := os.Environ()
+	if getEnvVar(env, "HOME") != "" {
+		return env
+	}
+	home, err := processHome()
+	if err != nil {
+		LogWarning("HOME is not set and no home directory was found: %v", err)
+		return env
+	}
+	return setEnvVar(env, "HOME", home)
+}
+
+// lookPathIn finds the executable name on the PATH in env, rather than on
+// the updater's own PATH, the way exec.LookPath does
+func lookPathIn(env []string, name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		return exec.LookPath(name)
+	}
+	for _, dir := range filepath.SplitList(getEnvVar(env, "PATH")) {
+		if dir == "" {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// envKeyIs reports whether the environment entry e sets key. Names are
+// case-insensitive on Windows, where PATH is usually spelled Path.
+func envKeyIs(e, key string) bool {
+	name, _, ok := strings.Cut(e, "=")
+	if !ok {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(name, key)
+	}
+	return name == key
+}
+
+// getEnvVar returns the value of key in the env slice, or "" if it is not set
+func getEnvVar(env []string, key string) string {
+	for _, e := range env {
+		if envKeyIs(e, key) {
+			return e[len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// removeEnvVar removes every entry for key from the env slice
+func removeEnvVar(env []string, key string) []string {
+	kept := env[:0:0]
+	for _, e := range env {
+		if !envKeyIs(e, key) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// setEnvVar sets or updates an environment variable in the env slice
+func setEnvVar(env []string, key, value string) []string {
+	for i, e := range env {
+		if envKeyIs(e, key) {
+			env[i] = key + "=" + value
+			return env
+		}
+	}
+	return append(env, key+"="+value)
+}
@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// TestLookPathIn verifies that executables are found on the PATH given in
+// env, not on the updater's own
+func TestLookPathIn(t *testing.T) {
+	name := "fake-cc"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, name), "")
+	if err := os.Chmod(filepath.Join(dir, name), 0755); err != nil {
+		t.Fatalf("failed to make %s executable: %v", name, err)
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	env := []string{"PATH=" + t.TempDir() + string(os.PathListSeparator) + dir}
+	if got, err := lookPathIn(env, "fake-cc"); err != nil || got != filepath.Join(dir, name) {
+		t.Errorf("lookPathIn() = %q, %v; want %s", got, err, filepath.Join(dir, name))
+	}
+	if _, err := lookPathIn(os.Environ(), "fake-cc"); err == nil {
+		t.Error("lookPathIn() found fake-cc on a PATH without it")
+	}
+}
+
+// TestCommandEnvironment verifies that a missing HOME is filled in for
+// commands without being set in the updater's own environment
+func TestCommandEnvironment(t *testing.T) {
+	t.Setenv("HOME", "")
+	before := os.Environ()
+
+	env := commandEnvironment()
+	if home, _ := processHome(); home != "" && getEnvVar(env, "HOME") != home {
+		t.Errorf("command HOME = %q; want %s", getEnvVar(env, "HOME"), home)
+	}
+	if after := os.Environ(); !slices.Equal(after, before) {
+		t.Errorf("commandEnvironment() changed the process environment:\n%q\nwant\n%q", after, before)
+	}
+}
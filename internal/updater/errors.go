@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode classifies update failures so callers can react to them
+type ErrorCode string
+
+const (
+	// ErrCodeArchMismatch indicates a binary targets a different OS or architecture than the host
+	ErrCodeArchMismatch ErrorCode = "ARCH_MISMATCH"
+
+	// ErrCodeHealthCheckFailed indicates the post-update health check did not pass
+	ErrCodeHealthCheckFailed ErrorCode = "HEALTH_CHECK_FAILED"
+
+	// ErrCodeDatabaseIntegrity indicates the agent database failed validation after an update
+	ErrCodeDatabaseIntegrity ErrorCode = "DB_INTEGRITY_FAILED"
+
+	// ErrCodeInsufficientSpace indicates a volume the update writes to lacks free space
+	ErrCodeInsufficientSpace ErrorCode = "INSUFFICIENT_DISK_SPACE"
+
+	// ErrCodeNotWritable indicates a directory the update writes to is not writable
+	ErrCodeNotWritable ErrorCode = "DIRECTORY_NOT_WRITABLE"
+
+	// ErrCodeToolchainMissing indicates the C toolchain required for CGO compilation was not found
+	ErrCodeToolchainMissing ErrorCode = "TOOLCHAIN_MISSING"
+
+	// ErrCodeGCCInstallationFailed indicates gcc is present but cannot build a cgo program
+	ErrCodeGCCInstallationFailed ErrorCode = "GCC_INSTALLATION_FAILED"
+
+	// ErrCodeCCompilerMissing indicates no C compiler was found for a CGO build on Linux or macOS
+	ErrCodeCCompilerMissing ErrorCode = "C_COMPILER_MISSING"
+
+	// ErrCodeCodeSignature indicates a binary without a valid code signature under the enforce codesign policy
+	ErrCodeCodeSignature ErrorCode = "CODE_SIGNATURE_INVALID"
+
+	// ErrCodeVersionNotFound indicates the module proxy has no such module or version
+	ErrCodeVersionNotFound ErrorCode = "VERSION_NOT_FOUND"
+
+	// ErrCodeProxyUnavailable indicates the module proxy kept failing or timing out
+	ErrCodeProxyUnavailable ErrorCode = "PROXY_UNAVAILABLE"
+
+	// ErrCodeDrainFailed indicates the agent did not drain under the abort drainTimeoutPolicy
+	ErrCodeDrainFailed ErrorCode = "AGENT_DRAIN_FAILED"
+
+	// ErrCodeProxyAuthRequired indicates the HTTP proxy answered 407 Proxy Authentication Required
+	ErrCodeProxyAuthRequired ErrorCode = "PROXY_AUTH_REQUIRED"
+
+	// ErrCodeChecksumMismatch indicates a downloaded module did not match go.sum or the checksum database
+	ErrCodeChecksumMismatch ErrorCode = "CHECKSUM_MISMATCH"
+
+	// ErrCodeVersionRejected indicates a version below minVersion or listed in skipVersions
+	ErrCodeVersionRejected ErrorCode = "VERSION_REJECTED"
+
+	// ErrCodeInsufficientPrivileges indicates the updater runs without root or Administrator privileges
+	ErrCodeInsufficientPrivileges ErrorCode = "INSUFFICIENT_PRIVILEGES"
+)
+
+// UpdateError is an error annotated with a classification code
+type UpdateError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+func (e *UpdateError) Unwrap() error {
+	return e.Err
+}
+
+// newUpdateError creates a classified error with a formatted message
+func newUpdateError(code ErrorCode, format string, args ...interface{}) error {
+	return &UpdateError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// ErrorCodeOf returns the classification code of err, or an empty code if err is unclassified
+func ErrorCodeOf(err error) ErrorCode {
+	var updateErr *UpdateError
+	if errors.As(err, &updateErr) {
+		return updateErr.Code
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// freshInstallPath returns where a fresh install puts the agent: the first
+// configured binary path, else the system location
+func freshInstallPath() string {
+	if configured := getConfig().configuredBinaryPaths(); len(configured) > 0 {
+		return configured[0]
+	}
+	return agentBinaryPath()
+}
+
+// performFreshInstall installs targetVersion at binaryPath when no working
+// agent was detected and allowInstallWhenMissing is set. There is nothing to
+// back up or roll back to, so the agent is not stopped or uninstalled first
+// and the steps are not journaled: an interrupted install is simply done
+// again by the next check.
+func performFreshInstall(dataDir, targetVersion, binaryPath string, noCache bool) error {
+	LogInfo("=== Installing %s at %s, no existing agent to back up ===", targetVersion, binaryPath)
+
+	if err := runPreflightChecks(); err != nil {
+		LogError("Pre-flight checks failed: %v", err)
+		return fmt.Errorf("install aborted: %w", err)
+	}
+
+	marker := &UpdateMarker{
+		TargetVersion: targetVersion,
+		NoCache:       noCache,
+		StartedAt:     time.Now(),
+	}
+	run := &updateRun{dataDir: dataDir, marker: marker, backup: &BackupInfo{BinaryPath: binaryPath}}
+
+	var installErr error
+	for _, transition := range run.transitions() {
+		if transition.step == stepServiceStopped || transition.step == stepServiceUninstalled {
+			continue
+		}
+		LogInfo("Installing: %s...", transition.description)
+		heartbeat(fmt.Sprintf("%s: %s", ActivityUpdating, transition.description), time.Time{})
+		if installErr = transition.run(); installErr != nil {
+			break
+		}
+	}
+
+	entry := newHistoryEntry(HistoryActionInstall, "", targetVersion, installErr)
+	entry.BuildMode = marker.BuildMode
+	saveHistoryEntry(dataDir, entry)
+
+	if installErr != nil {
+		LogError("Install failed, no previous version to roll back to: %v", installErr)
+		if err := os.RemoveAll(paths.BuildBinDirectory(dataDir)); err != nil {
+			LogWarning("Failed to clean build directory: %v", err)
+		}
+		return fmt.Errorf("install failed: %w", installErr)
+	}
+
+	collectGoCaches(dataDir)
+	LogInfo("=== Install completed successfully ===")
+	return nil
+}
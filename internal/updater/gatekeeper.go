@@ -0,0 +1,153 @@
+package updater
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// quarantineXattr marks files macOS has not yet let Gatekeeper assess
+const quarantineXattr = "com.apple.quarantine"
+
+// Code signing policies for the agent binary on macOS
+const (
+	CodesignEnforce = "enforce"
+	CodesignWarn    = "warn"
+	CodesignOff     = "off"
+)
+
+// validCodesignPolicy reports whether policy is a known code signing policy
+func validCodesignPolicy(policy string) bool {
+	switch policy {
+	case CodesignEnforce, CodesignWarn, CodesignOff:
+		return true
+	}
+	return false
+}
+
+// runSigningTool runs codesign or spctl and returns their trimmed output; it
+// is a variable so tests can script them
+var runSigningTool = func(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// verifyCodeSignature checks the code signature of the binary at path
+func verifyCodeSignature(path string) error {
+	output, err := runSigningTool("codesign", "--verify", "--strict", path)
+	if err != nil {
+		if output == "" {
+			output = err.Error()
+		}
+		return fmt.Errorf("codesign --verify: %s", output)
+	}
+	return nil
+}
+
+// codesignTeamID returns the Team ID the binary at path was signed with, or
+// an empty string for ad-hoc signatures
+func codesignTeamID(path string) (string, error) {
+	output, err := runSigningTool("codesign", "--display", "--verbose=2", path)
+	if err != nil {
+		return "", fmt.Errorf("codesign --display: %s", output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if teamID, ok := strings.CutPrefix(line, "TeamIdentifier="); ok && teamID != "not set" {
+			return teamID, nil
+		}
+	}
+	return "", nil
+}
+
+// verifySignature checks the signature of the binary at path on goos and,
+// when trusted is not empty, that it was made by one of those identities.
+// It reports false when goos has no signatures to check.
+func verifySignature(goos, path string, trusted []string) (bool, error) {
+	var identity string
+	switch goos {
+	case "darwin":
+		if err := verifyCodeSignature(path); err != nil {
+			return true, err
+		}
+		if len(trusted) == 0 {
+			return true, nil
+		}
+		teamID, err := codesignTeamID(path)
+		if err != nil {
+			return true, err
+		}
+		if teamID == "" {
+			return true, fmt.Errorf("ad-hoc signature has no Team ID")
+		}
+		identity = "Team ID " + teamID
+		if !trustedSigner(teamID, trusted) {
+			return true, fmt.Errorf("signed by %s, which is not in trustedSigners", identity)
+		}
+	case "windows":
+		thumbprint, err := verifyAuthenticode(path)
+		if err != nil {
+			return true, err
+		}
+		identity = "certificate " + thumbprint
+		if len(trusted) > 0 && !trustedSigner(thumbprint, trusted) {
+			return true, fmt.Errorf("signed by %s, which is not in trustedSigners", identity)
+		}
+	default:
+		return false, nil
+	}
+
+	if identity != "" {
+		LogInfo("Signature of %s verified, signed by %s", path, identity)
+	} else {
+		LogInfo("Code signature of %s verified", path)
+	}
+	return true, nil
+}
+
+// checkCodeSignature verifies the signature of the binary at path before it
+// is installed on macOS (codesign) or Windows (Authenticode), and on macOS
+// logs whether Gatekeeper would accept it. Only the enforce policy refuses a
+// binary that is not validly signed by a trusted identity, before anything
+// is replaced; Go's ad-hoc signatures pass codesign but not spctl, which
+// launchd does not need.
+func checkCodeSignature(goos, path, policy string, trusted []string) error {
+	if policy == CodesignOff {
+		return nil
+	}
+
+	checked, err := verifySignature(goos, path, trusted)
+	if !checked {
+		return nil
+	}
+	if err != nil {
+		if policy == CodesignEnforce {
+			LogCritical("Refusing to install %s: signature verification failed: %v", path, err)
+			return newUpdateError(ErrCodeCodeSignature, "refusing to install %s without a valid code signature: %v", path, err)
+		}
+		LogWarning("Agent binary %s has no valid code signature: %v", path, err)
+	}
+
+	if goos != "darwin" {
+		return nil
+	}
+	if output, err := runSigningTool("spctl", "--assess", "--type", "execute", path); err != nil {
+		LogInfo("Gatekeeper does not accept %s: %s", path, output)
+	} else {
+		LogInfo("Gatekeeper accepts %s", path)
+	}
+	return nil
+}
+
+// withGatekeeperHint adds to err, when the agent failed to start on macOS,
+// that Gatekeeper may have blocked its binary at path because it is not
+// validly signed; launchd only reports that the service is not running
+func withGatekeeperHint(goos, path string, err error) error {
+	if goos != "darwin" {
+		return err
+	}
+	if signErr := verifyCodeSignature(path); signErr != nil {
+		return fmt.Errorf("%w; macOS Gatekeeper may have blocked %s because it is not validly signed (%v), check with: spctl --assess --type execute %s",
+			err, path, signErr, path)
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package updater
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// removeQuarantine deletes the quarantine attribute from the file at path,
+// which would keep launchd from starting it, and reports whether it was set
+func removeQuarantine(path string) (bool, error) {
+	if err := unix.Removexattr(path, quarantineXattr); err != nil {
+		if errors.Is(err, unix.ENOATTR) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package updater
+
+// removeQuarantine does nothing outside macOS
+func removeQuarantine(path string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,133 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scriptSigningTool makes codesign and spctl fail with the given output, or
+// succeed when it is empty, and returns the commands run
+func scriptSigningTool(t *testing.T, codesign, spctl string) *[]string {
+	var calls []string
+	original := runSigningTool
+	runSigningTool = func(name string, args ...string) (string, error) {
+		calls = append(calls, name)
+		output := map[string]string{"codesign": codesign, "spctl": spctl}[name]
+		if output != "" {
+			return output, errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	t.Cleanup(func() { runSigningTool = original })
+	return &calls
+}
+
+// TestLoadConfigPathCodesignPolicy verifies that the codesign policy
+// defaults to warn and falls back to it when unknown
+func TestLoadConfigPathCodesignPolicy(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{}`, CodesignWarn},
+		{`{"codesignPolicy": "Enforce"}`, CodesignEnforce},
+		{`{"codesignPolicy": "off"}`, CodesignOff},
+		{`{"codesignPolicy": "strict"}`, CodesignWarn},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		if config.CodesignPolicy != tt.want {
+			t.Errorf("loadConfigPath(%s).CodesignPolicy = %q; want %q", tt.content, config.CodesignPolicy, tt.want)
+		}
+	}
+}
+
+// TestCheckCodeSignature verifies that only the enforce policy refuses an
+// unsigned binary, that a Gatekeeper rejection is only logged, and that
+// nothing runs outside macOS or with the check off
+func TestCheckCodeSignature(t *testing.T) {
+	unsigned := "sentinel: code object is not signed at all"
+
+	scriptSigningTool(t, unsigned, "")
+	err := checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignEnforce, nil)
+	if code := ErrorCodeOf(err); code != ErrCodeCodeSignature || !strings.Contains(err.Error(), unsigned) {
+		t.Errorf("checkCodeSignature(enforce) = %v; want %s with the codesign output", err, ErrCodeCodeSignature)
+	}
+	if err := checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignWarn, nil); err != nil {
+		t.Errorf("checkCodeSignature(warn) = %v; want nil", err)
+	}
+
+	calls := scriptSigningTool(t, "", "sentinel: rejected")
+	if err := checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignEnforce, nil); err != nil {
+		t.Errorf("checkCodeSignature(enforce) of a signed binary Gatekeeper rejects = %v; want nil", err)
+	}
+	if strings.Join(*calls, ",") != "codesign,spctl" {
+		t.Errorf("signing tools run = %v; want codesign, spctl", *calls)
+	}
+
+	calls = scriptSigningTool(t, unsigned, unsigned)
+	checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignOff, nil)
+	checkCodeSignature("linux", "/usr/local/bin/sentinel", CodesignEnforce, nil)
+	if len(*calls) != 0 {
+		t.Errorf("signing tools run = %v; want none", *calls)
+	}
+}
+
+// TestWithGatekeeperHint verifies that a failed start on macOS mentions
+// Gatekeeper only when the binary is not validly signed
+func TestWithGatekeeperHint(t *testing.T) {
+	startErr := errors.New("service not running after 3 verification attempts")
+
+	scriptSigningTool(t, "code object is not signed at all", "")
+	err := withGatekeeperHint("darwin", "/usr/local/bin/sentinel", startErr)
+	if !errors.Is(err, startErr) || !strings.Contains(err.Error(), "Gatekeeper") {
+		t.Errorf("withGatekeeperHint(unsigned) = %v; want the start error with a Gatekeeper hint", err)
+	}
+	if err := withGatekeeperHint("linux", "/usr/local/bin/sentinel", startErr); err != startErr {
+		t.Errorf("withGatekeeperHint(linux) = %v; want the start error unchanged", err)
+	}
+
+	scriptSigningTool(t, "", "")
+	if err := withGatekeeperHint("darwin", "/usr/local/bin/sentinel", startErr); err != startErr {
+		t.Errorf("withGatekeeperHint(signed) = %v; want the start error unchanged", err)
+	}
+}
+
+// TestCheckCodeSignatureTeamID verifies that with trusted signers a macOS
+// binary must carry one of their Team IDs, so an ad-hoc signature is refused
+func TestCheckCodeSignatureTeamID(t *testing.T) {
+	display := "Identifier=sentinel\nTeamIdentifier=ABCDE12345"
+	original := runSigningTool
+	runSigningTool = func(name string, args ...string) (string, error) {
+		if name == "codesign" && args[0] == "--display" {
+			return display, nil
+		}
+		return "", nil
+	}
+	t.Cleanup(func() { runSigningTool = original })
+
+	if err := checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignEnforce, []string{"abcde12345"}); err != nil {
+		t.Errorf("checkCodeSignature(trusted Team ID) = %v; want nil", err)
+	}
+	err := checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignEnforce, []string{"ZZZZZ99999"})
+	if code := ErrorCodeOf(err); code != ErrCodeCodeSignature || !strings.Contains(err.Error(), "ABCDE12345") {
+		t.Errorf("checkCodeSignature(untrusted Team ID) = %v; want %s naming the Team ID", err, ErrCodeCodeSignature)
+	}
+
+	display = "Identifier=sentinel\nSignature=adhoc\nTeamIdentifier=not set"
+	if code := ErrorCodeOf(checkCodeSignature("darwin", "/usr/local/bin/sentinel", CodesignEnforce, []string{"ABCDE12345"})); code != ErrCodeCodeSignature {
+		t.Errorf("checkCodeSignature(ad-hoc) code = %q; want %s", code, ErrCodeCodeSignature)
+	}
+}
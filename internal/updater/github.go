@@ -0,0 +1,156 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultGitHubAPIURL is the GitHub REST API used by the github resolver
+	DefaultGitHubAPIURL = "https://api.github.com"
+
+	// githubTagsPerPage and githubMaxPages bound the tag listing
+	githubTagsPerPage = 100
+	githubMaxPages    = 10
+)
+
+// linkNext extracts the next page URL from a GitHub Link header
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// githubRepository returns the owner/name of the GitHub repository holding
+// module, or "" when the module is not hosted on GitHub
+func githubRepository(module string) string {
+	parts := strings.Split(module, "/")
+	if len(parts) < 3 || parts[0] != "github.com" {
+		return ""
+	}
+	return parts[1] + "/" + parts[2]
+}
+
+// normalizeTag turns a release tag such as "1.4.0" or "v1.4.0" into a
+// semver string, returning "" for tags that are not versions
+func normalizeTag(tag string) string {
+	version := "v" + strings.TrimPrefix(strings.TrimSpace(tag), "v")
+	if _, ok := parseVersion(version); !ok {
+		return ""
+	}
+	return version
+}
+
+// githubRateLimitError describes an exhausted GitHub API rate limit
+func githubRateLimitError(resp *http.Response) error {
+	reset := resp.Header.Get("X-RateLimit-Reset")
+	if seconds, err := strconv.ParseInt(reset, 10, 64); err == nil {
+		return fmt.Errorf("GitHub API rate limit exceeded, resets at %s; set githubToken to raise the limit",
+			time.Unix(seconds, 0).UTC().Format(time.RFC3339))
+	}
+	return fmt.Errorf("GitHub API rate limit exceeded; set githubToken to raise the limit")
+}
+
+// fetchGitHubTags lists the tag names of repo, following pagination
+func fetchGitHubTags(client *http.Client, config *UpdaterConfig, repo string) ([]string, error) {
+	url := fmt.Sprintf("%s/repos/%s/tags?per_page=%d", strings.TrimRight(config.GitHubAPIURL, "/"), repo, githubTagsPerPage)
+	var tags []string
+
+	for page := 0; url != "" && page < githubMaxPages; page++ {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("User-Agent", "sentinel-updater")
+		if config.GitHubToken != "" {
+			req.Header.Set("Authorization", "Bearer "+config.GitHubToken)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if isProxyAuthError(err.Error()) {
+				return nil, newProxyAuthError(config)
+			}
+			return nil, fmt.Errorf("GitHub API request failed: %w", err)
+		}
+
+		var tagPage []struct {
+			Name string `json:"name"`
+		}
+		err = decodeGitHubResponse(resp, config, &tagPage)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tagPage {
+			tags = append(tags, tag.Name)
+		}
+
+		url = ""
+		if match := linkNext.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			url = match[1]
+		}
+	}
+
+	return tags, nil
+}
+
+// decodeGitHubResponse checks the status of a GitHub API response and
+// decodes its JSON body into v
+func decodeGitHubResponse(resp *http.Response, config *UpdaterConfig, v interface{}) error {
+	if err := checkProxyResponse(resp, config); err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0":
+		return githubRateLimitError(resp)
+	case resp.StatusCode == http.StatusNotFound:
+		return newUpdateError(ErrCodeVersionNotFound, "GitHub repository not found (private repositories need githubToken)")
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse GitHub API response: %w", err)
+	}
+	return nil
+}
+
+// checkGitHubVersions selects the version to install from the tags of the
+// agent's GitHub repository
+func checkGitHubVersions(module string, config *UpdaterConfig) (*VersionCheck, error) {
+	if ref := config.trackedRef(); ref != "" {
+		return nil, fmt.Errorf("the %s channel needs the module proxy to resolve %s", config.Channel, ref)
+	}
+
+	repo := config.GitHubRepository
+	if repo == "" {
+		repo = githubRepository(module)
+	}
+	if repo == "" {
+		return nil, fmt.Errorf("%s is not hosted on GitHub; set githubRepository", module)
+	}
+
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := fetchGitHubTags(client, config, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, tag := range tags {
+		if version := normalizeTag(tag); version != "" {
+			versions = append(versions, version)
+		}
+	}
+	return newVersionCheck(module, config.Channel, versions)
+}
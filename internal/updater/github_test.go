@@ -0,0 +1,159 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newGitHubServer serves the tags of BrainStation-23/SentinelGo in two pages
+func newGitHubServer(t *testing.T, token string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/BrainStation-23/SentinelGo/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"name": "v1.1.0"}, {"name": "nightly"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=2>; rel="next"`, server.URL, r.URL.Path))
+		fmt.Fprint(w, `[{"name": "1.3.0"}, {"name": "v1.4.0-beta.1"}]`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestGitHubRepository verifies deriving owner/name from module paths
+func TestGitHubRepository(t *testing.T) {
+	tests := map[string]string{
+		"github.com/BrainStation-23/SentinelGo":    "BrainStation-23/SentinelGo",
+		"github.com/BrainStation-23/SentinelGo/v2": "BrainStation-23/SentinelGo",
+		"gitlab.com/BrainStation-23/SentinelGo":    "",
+		"github.com/BrainStation-23":               "",
+	}
+
+	for module, want := range tests {
+		if got := githubRepository(module); got != want {
+			t.Errorf("githubRepository(%q) = %q; want %q", module, got, want)
+		}
+	}
+}
+
+// TestNormalizeTag verifies that tags become semver strings
+func TestNormalizeTag(t *testing.T) {
+	tests := map[string]string{
+		"v1.2.3":      "v1.2.3",
+		"1.2.3":       "v1.2.3",
+		"1.2.3-rc.1":  "v1.2.3-rc.1",
+		"nightly":     "",
+		"release-1.2": "",
+	}
+
+	for tag, want := range tests {
+		if got := normalizeTag(tag); got != want {
+			t.Errorf("normalizeTag(%q) = %q; want %q", tag, got, want)
+		}
+	}
+}
+
+// TestCheckGitHubVersions verifies that tags across pages are normalized and
+// filtered by channel, with the token sent
+func TestCheckGitHubVersions(t *testing.T) {
+	server := newGitHubServer(t, "secret")
+	config := &UpdaterConfig{Channel: ChannelStable, GitHubAPIURL: server.URL, GitHubToken: "secret"}
+
+	check, err := checkGitHubVersions(MainAgentModule, config)
+	if err != nil {
+		t.Fatalf("checkGitHubVersions() failed: %v", err)
+	}
+	if check.Selected != "v1.3.0" {
+		t.Errorf("Selected = %q; want v1.3.0", check.Selected)
+	}
+	if len(check.Available) != 3 {
+		t.Errorf("Available = %v; want 3 versions", check.Available)
+	}
+}
+
+// TestCheckGitHubVersionsRateLimited verifies that a 403 with an exhausted
+// rate limit reports when the limit resets
+func TestCheckGitHubVersionsRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+	}))
+	defer server.Close()
+
+	_, err := checkGitHubVersions(MainAgentModule, &UpdaterConfig{Channel: ChannelStable, GitHubAPIURL: server.URL})
+	if err == nil || !strings.Contains(err.Error(), "rate limit exceeded, resets at 2023-11-14T22:13:20Z") {
+		t.Errorf("checkGitHubVersions() error = %v; want rate limit error with reset time", err)
+	}
+}
+
+// TestCheckGitHubVersionsForbidden verifies that a 403 without an exhausted
+// rate limit is not reported as rate limiting
+func TestCheckGitHubVersionsForbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "59")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := checkGitHubVersions(MainAgentModule, &UpdaterConfig{Channel: ChannelStable, GitHubAPIURL: server.URL})
+	if err == nil || strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("checkGitHubVersions() error = %v; want a plain 403 error", err)
+	}
+}
+
+// TestResolveVersionFallsBackToGitHub verifies that the github resolver is
+// used when the module proxy is unreachable, and recorded in the check
+func TestResolveVersionFallsBackToGitHub(t *testing.T) {
+	unreachable := errors.New("dial tcp: lookup proxy.golang.org: no such host")
+	scriptGoList(t, unreachable, unreachable, unreachable)
+	server := newGitHubServer(t, "")
+	config := &UpdaterConfig{
+		Channel:          ChannelBeta,
+		VersionResolvers: []string{ResolverGoProxy, ResolverGitHub},
+		GitHubAPIURL:     server.URL,
+	}
+	withConfig(t, config)
+
+	check, err := resolveVersion("go", MainAgentModule, config)
+	if err != nil {
+		t.Fatalf("resolveVersion() failed: %v", err)
+	}
+	if check.Resolver != ResolverGitHub || check.Selected != "v1.4.0-beta.1" {
+		t.Errorf("resolveVersion() = %s via %s; want v1.4.0-beta.1 via github", check.Selected, check.Resolver)
+	}
+}
+
+// TestResolveVersionAllFail verifies that every resolver's error is kept
+func TestResolveVersionAllFail(t *testing.T) {
+	scriptGoList(t, errors.New("no matching versions for query"))
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	config := &UpdaterConfig{
+		Channel:          ChannelStable,
+		VersionResolvers: []string{ResolverGoProxy, ResolverGitHub},
+		GitHubAPIURL:     server.URL,
+	}
+	withConfig(t, config)
+
+	_, err := resolveVersion("go", MainAgentModule, config)
+	if err == nil || !strings.Contains(err.Error(), "goproxy:") || !strings.Contains(err.Error(), "github:") {
+		t.Errorf("resolveVersion() error = %v; want errors from both resolvers", err)
+	}
+	if got := ErrorCodeOf(err); got != ErrCodeVersionNotFound {
+		t.Errorf("ErrorCodeOf() = %q; want %q", got, ErrCodeVersionNotFound)
+	}
+}
@@ -0,0 +1,142 @@
+package updater
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultGoCacheMaxMB is the combined size of the Go build and module caches
+// above which they are cleaned after an update
+const DefaultGoCacheMaxMB = 2048
+
+// goCacheSizes holds the size in bytes of the Go caches used for builds
+type goCacheSizes struct {
+	Build  uint64
+	Module uint64
+}
+
+// Total returns the combined size of both caches
+func (s goCacheSizes) Total() uint64 {
+	return s.Build + s.Module
+}
+
+// dirSize returns the total size of the regular files under dir, 0 when dir
+// does not exist
+func dirSize(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
+
+// measureGoCaches returns the size of the build and module caches in dirs
+func measureGoCaches(dirs *goDirs) (goCacheSizes, error) {
+	build, err := dirSize(dirs.GOCACHE)
+	if err != nil {
+		return goCacheSizes{}, fmt.Errorf("failed to measure %s: %w", dirs.GOCACHE, err)
+	}
+	module, err := dirSize(dirs.GOMODCACHE)
+	if err != nil {
+		return goCacheSizes{}, fmt.Errorf("failed to measure %s: %w", dirs.GOMODCACHE, err)
+	}
+	return goCacheSizes{Build: build, Module: module}, nil
+}
+
+// removeCacheDir deletes a Go cache directory. The module cache is written
+// read-only, so everything is made writable first; otherwise the removal
+// fails on directories (Unix) and files (Windows) alike.
+func removeCacheDir(dir string) error {
+	if !filepath.IsAbs(dir) || filepath.Dir(dir) == dir {
+		return fmt.Errorf("refusing to remove cache directory %q", dir)
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		mode := os.FileMode(0644)
+		if entry.IsDir() {
+			mode = 0755
+		}
+		return os.Chmod(path, mode)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to make %s writable: %w", dir, err)
+	}
+	return os.RemoveAll(dir)
+}
+
+// cleanGoCaches removes the build and module caches when together they are
+// larger than maxBytes, and returns the sizes before and the bytes reclaimed.
+// Both are refilled on demand by the next build.
+func cleanGoCaches(dirs *goDirs, maxBytes uint64) (goCacheSizes, uint64, error) {
+	sizes, err := measureGoCaches(dirs)
+	if err != nil {
+		return sizes, 0, err
+	}
+	if sizes.Total() <= maxBytes {
+		return sizes, 0, nil
+	}
+
+	var reclaimed uint64
+	for _, cache := range []struct {
+		dir  string
+		size uint64
+	}{{dirs.GOCACHE, sizes.Build}, {dirs.GOMODCACHE, sizes.Module}} {
+		if err := removeCacheDir(cache.dir); err != nil {
+			remaining, _ := dirSize(cache.dir)
+			return sizes, reclaimed + cache.size - remaining, err
+		}
+		reclaimed += cache.size
+	}
+	return sizes, reclaimed, nil
+}
+
+// collectGoCaches cleans the Go caches after an update when they exceed
+// goCacheMaxMB, logging the bytes reclaimed and publishing the resulting size
+func collectGoCaches(dataDir string) {
+	maxMB := getConfig().GoCacheMaxMB
+	if maxMB == 0 {
+		return
+	}
+
+	dirs, err := resolveGoDirs(dataDir)
+	if err != nil {
+		LogWarning("Skipping Go cache cleanup: %v", err)
+		return
+	}
+
+	sizes, reclaimed, err := cleanGoCaches(dirs, uint64(maxMB)*1024*1024)
+	if err != nil {
+		LogWarning("Go cache cleanup failed after reclaiming %d MB: %v", bytesToMB(reclaimed), err)
+	} else if reclaimed > 0 {
+		LogInfo("Go caches were %d MB (build %d MB, modules %d MB), over the %d MB cap: reclaimed %d MB",
+			bytesToMB(sizes.Total()), bytesToMB(sizes.Build), bytesToMB(sizes.Module), maxMB, bytesToMB(reclaimed))
+	} else {
+		LogInfo("Go caches use %d MB of the %d MB cap", bytesToMB(sizes.Total()), maxMB)
+	}
+
+	setStatus(func(s *UpdaterStatus) { s.GoCacheBytes = sizes.Total() - reclaimed })
+}
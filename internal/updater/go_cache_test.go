@@ -0,0 +1,63 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeModCache fills dir like the module cache: a read-only module version
+// directory with read-only files
+func writeModCache(t *testing.T, dir string, size int) {
+	moduleDir := filepath.Join(dir, "example.com", "agent@v1.0.0")
+	if err := os.MkdirAll(moduleDir, 0755); err != nil {
+		t.Fatalf("failed to create module cache: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(moduleDir, "go.mod"), make([]byte, size), 0444); err != nil {
+		t.Fatalf("failed to write module file: %v", err)
+	}
+	if err := os.Chmod(moduleDir, 0555); err != nil {
+		t.Fatalf("failed to make module directory read-only: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(moduleDir, 0755) })
+}
+
+// TestCleanGoCaches verifies that the caches are kept under the cap and
+// removed, read-only module directories included, above it
+func TestCleanGoCaches(t *testing.T) {
+	root := t.TempDir()
+	dirs := &goDirs{GOCACHE: filepath.Join(root, "cache"), GOMODCACHE: filepath.Join(root, "pkg", "mod")}
+	writeModCache(t, dirs.GOMODCACHE, 600)
+	if err := os.MkdirAll(dirs.GOCACHE, 0755); err != nil {
+		t.Fatalf("failed to create build cache: %v", err)
+	}
+	writeLog(t, filepath.Join(dirs.GOCACHE, "entry"), string(make([]byte, 400)))
+
+	sizes, reclaimed, err := cleanGoCaches(dirs, 1000)
+	if err != nil || sizes.Total() != 1000 || reclaimed != 0 {
+		t.Fatalf("cleanGoCaches(1000) = %+v, %d, %v; want 1000 bytes kept", sizes, reclaimed, err)
+	}
+
+	sizes, reclaimed, err = cleanGoCaches(dirs, 999)
+	if err != nil {
+		t.Fatalf("cleanGoCaches(999) failed: %v", err)
+	}
+	if sizes.Build != 400 || sizes.Module != 600 || reclaimed != 1000 {
+		t.Errorf("cleanGoCaches(999) = %+v, %d; want build 400, modules 600, 1000 reclaimed", sizes, reclaimed)
+	}
+	for _, dir := range []string{dirs.GOCACHE, dirs.GOMODCACHE} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after cleanup", dir)
+		}
+	}
+}
+
+// TestRemoveCacheDirRefusesRoot verifies that a relative or root path is
+// never removed
+func TestRemoveCacheDirRefusesRoot(t *testing.T) {
+	for _, dir := range []string{"", "cache", string(filepath.Separator)} {
+		if err := removeCacheDir(dir); err == nil {
+			t.Errorf("removeCacheDir(%q) = nil; want an error", dir)
+		}
+	}
+}
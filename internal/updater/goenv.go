@@ -0,0 +1,149 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// goEnvValidationTimeout bounds the `go env` round trip at startup
+const goEnvValidationTimeout = 30 * time.Second
+
+// allowedGoEnvKeys are the Go settings goEnv may override
+var allowedGoEnvKeys = map[string]bool{
+	"GOPROXY":    true,
+	"GOPRIVATE":  true,
+	"GONOPROXY":  true,
+	"GONOSUMDB":  true,
+	"GOSUMDB":    true,
+	"GOFLAGS":    true,
+	"GOINSECURE": true,
+}
+
+// goEnvKeys returns the configured goEnv keys in sorted order
+func (c *UpdaterConfig) goEnvKeys() []string {
+	keys := make([]string, 0, len(c.GoEnv))
+	for key := range c.GoEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyGoEnv returns a copy of env with the configured Go settings, netrc
+// file, proxies and CA bundle applied. The updater's own environment is never
+// changed, so the overrides only reach the go commands given the result.
+func applyGoEnv(env []string, config *UpdaterConfig) []string {
+	env = applyProxyEnv(append([]string(nil), env...), config)
+	for _, key := range config.goEnvKeys() {
+		env = setEnvVar(env, key, config.GoEnv[key])
+	}
+	if config.NetrcPath != "" {
+		env = setEnvVar(env, "NETRC", config.NetrcPath)
+	}
+	return env
+}
+
+// logGoEnv logs the configured Go settings with credentials redacted
+func logGoEnv(config *UpdaterConfig) {
+	for _, key := range config.goEnvKeys() {
+		LogInfo("  %s=%s", key, redactConfigValue(key, config.GoEnv[key]))
+	}
+	if config.NetrcPath != "" {
+		LogInfo("  NETRC=%s", config.NetrcPath)
+	}
+}
+
+// readGoEnv returns the values go reports for keys when run with env, which
+// include settings written with go env -w
+func readGoEnv(goBinary string, env []string, keys ...string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), goEnvValidationTimeout)
+	defer cancel()
+
+	output, errOutput, err := commandRunner.Run(ctx, goBinary, append([]string{"env", "-json"}, keys...), env, "")
+	if err != nil {
+		combined := string(output) + string(errOutput)
+		return nil, fmt.Errorf("%w: %s", err, redactConfigValue("goEnv", strings.TrimSpace(combined)))
+	}
+
+	var effective map[string]string
+	if err := json.Unmarshal(output, &effective); err != nil {
+		return nil, fmt.Errorf("failed to parse go env output: %w", err)
+	}
+	return effective, nil
+}
+
+// validateGoEnv checks that the go command accepts the configured settings by
+// reading them back with `go env`, and that the netrc file is readable
+func validateGoEnv(goBinary string, config *UpdaterConfig) error {
+	if config.NetrcPath != "" {
+		if _, err := os.Stat(config.NetrcPath); err != nil {
+			return fmt.Errorf("netrc file %s: %w", config.NetrcPath, err)
+		}
+	}
+
+	keys := config.goEnvKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	effective, err := readGoEnv(goBinary, applyGoEnv(commandEnvironment(), config), keys...)
+	if err != nil {
+		return fmt.Errorf("go env rejected the goEnv settings: %w", err)
+	}
+	for _, key := range keys {
+		if effective[key] != config.GoEnv[key] {
+			return fmt.Errorf("go env reports %s=%s, want %s", key,
+				redactConfigValue(key, effective[key]), redactConfigValue(key, config.GoEnv[key]))
+		}
+	}
+
+	return nil
+}
+
+// checkGoEnv validates the Go settings at startup, logging the outcome
+func checkGoEnv(config *UpdaterConfig) {
+	if len(config.GoEnv) == 0 && config.NetrcPath == "" {
+		return
+	}
+
+	LogInfo("Go settings for module queries and builds:")
+	logGoEnv(config)
+
+	goBinary, err := findGoBinary()
+	if err != nil {
+		LogWarning("Cannot validate goEnv settings: %v", err)
+		return
+	}
+	if err := validateGoEnv(goBinary, config); err != nil {
+		LogError("Invalid Go settings: %v", err)
+		return
+	}
+	LogInfo("Go settings validated with go env")
+}
+
+// matchModulePatterns reports whether module matches one of the
+// comma-separated glob patterns of a setting such as GOPRIVATE, each of
+// which matches a module path prefix
+func matchModulePatterns(patterns, module string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		elements := strings.Split(module, "/")
+		n := strings.Count(pattern, "/") + 1
+		if len(elements) < n {
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.Join(elements[:n], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// goListAttempts bounds how often a module query is tried per check
+	goListAttempts = 3
+
+	// goListTimeout bounds a single module query
+	goListTimeout = 60 * time.Second
+)
+
+// goListBackoff is the wait before the first retry, doubled for each later
+// one; it is a variable so tests can shorten it
+var goListBackoff = 2 * time.Second
+
+// notFoundPatterns appear in go list output when the module or version does
+// not exist, so retrying cannot help
+var notFoundPatterns = []string{
+	"no matching versions",
+	"not found",
+	"unknown revision",
+	"invalid version",
+	"410 gone",
+	"malformed module path",
+}
+
+// isNotFoundOutput reports whether go list output says the module or
+// version does not exist
+func isNotFoundOutput(output string) bool {
+	output = strings.ToLower(output)
+	for _, pattern := range notFoundPatterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// runGoList runs `go list <args>` against the module proxy, retrying
+// transient failures with exponential backoff. The configured goEnv
+// settings and netrc file apply to the query. A module or version that does
+// not exist fails immediately as VERSION_NOT_FOUND; a proxy that keeps
+// failing is reported as PROXY_UNAVAILABLE.
+func runGoList(goBinary string, args ...string) ([]byte, error) {
+	backoff := goListBackoff
+	env := applyGoEnv(commandEnvironment(), getConfig())
+	var lastErr error
+
+	for attempt := 1; attempt <= goListAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), goListTimeout)
+		output, errOutput, err := commandRunner.Run(ctx, goBinary, append([]string{"list"}, args...), env, "")
+		timedOut := ctx.Err() == context.DeadlineExceeded
+		cancel()
+		if err == nil {
+			return output, nil
+		}
+		// The output can echo a GOPROXY URL with credentials
+		stderr := redactConfigValue("", strings.TrimSpace(string(errOutput)))
+
+		switch {
+		case timedOut:
+			lastErr = fmt.Errorf("timed out after %v", goListTimeout)
+		case isProxyAuthError(stderr):
+			return nil, newProxyAuthError(getConfig())
+		case isNotFoundOutput(stderr):
+			return nil, newUpdateError(ErrCodeVersionNotFound, "%s", stderr)
+		case stderr != "":
+			lastErr = fmt.Errorf("%w: %s", err, stderr)
+		default:
+			lastErr = err
+		}
+
+		if attempt < goListAttempts {
+			LogWarning("go list %s failed (attempt %d/%d): %v", strings.Join(args, " "), attempt, goListAttempts, lastErr)
+			LogInfo("Retrying in %v", backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return nil, newUpdateError(ErrCodeProxyUnavailable, "module query failed after %d attempts: %v", goListAttempts, lastErr)
+}
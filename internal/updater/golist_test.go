@@ -0,0 +1,83 @@
+package updater
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+)
+
+// scriptGoList makes go list fail with the messages of results, in order,
+// or succeed for a nil one, and returns a pointer to the call count
+func scriptGoList(t *testing.T, results ...error) *int {
+	originalBackoff := goListBackoff
+	t.Cleanup(func() { goListBackoff = originalBackoff })
+	goListBackoff = time.Millisecond
+
+	calls := 0
+	useRunner(t, &commandtest.FakeRunner{Handler: func(call commandtest.Call) commandtest.Result {
+		err := results[calls]
+		calls++
+		if err != nil {
+			return commandtest.Failure(err.Error())
+		}
+		return commandtest.Result{Stdout: `{"Version": "v1.0.0"}`}
+	}})
+	return &calls
+}
+
+// TestRunGoListRetriesTransientErrors verifies that proxy errors are retried
+// until a query succeeds
+func TestRunGoListRetriesTransientErrors(t *testing.T) {
+	calls := scriptGoList(t, errors.New("503 Service Unavailable"), errors.New("i/o timeout"), nil)
+
+	if _, err := runGoList("go", "-m", "-json", MainAgentModule+"@latest"); err != nil {
+		t.Fatalf("runGoList() failed: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d; want 3", *calls)
+	}
+}
+
+// TestRunGoListGivesUp verifies that a proxy failing every attempt is
+// classified as PROXY_UNAVAILABLE
+func TestRunGoListGivesUp(t *testing.T) {
+	unavailable := errors.New("502 Bad Gateway")
+	calls := scriptGoList(t, unavailable, unavailable, unavailable)
+
+	_, err := runGoList("go", "-m", "-versions", "-json", MainAgentModule)
+	if ErrorCodeOf(err) != ErrCodeProxyUnavailable {
+		t.Errorf("ErrorCodeOf() = %s; want %s", ErrorCodeOf(err), ErrCodeProxyUnavailable)
+	}
+	if *calls != goListAttempts {
+		t.Errorf("calls = %d; want %d", *calls, goListAttempts)
+	}
+}
+
+// TestRunGoListNotFound verifies that a missing version is not retried
+func TestRunGoListNotFound(t *testing.T) {
+	calls := scriptGoList(t, errors.New("go: "+MainAgentModule+"@v9.9.9: invalid version: unknown revision v9.9.9"))
+
+	_, err := runGoList("go", "-m", "-json", MainAgentModule+"@v9.9.9")
+	if ErrorCodeOf(err) != ErrCodeVersionNotFound {
+		t.Errorf("ErrorCodeOf() = %s; want %s", ErrorCodeOf(err), ErrCodeVersionNotFound)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d; want 1", *calls)
+	}
+}
+
+// TestRunGoListProxyAuthRequired verifies that a 407 from the proxy is not
+// retried and is classified as PROXY_AUTH_REQUIRED
+func TestRunGoListProxyAuthRequired(t *testing.T) {
+	calls := scriptGoList(t, errors.New(`go: module lookup: Get "https://proxy.golang.org/": Proxy Authentication Required`))
+
+	_, err := runGoList("go", "-m", "-versions", "-json", MainAgentModule)
+	if ErrorCodeOf(err) != ErrCodeProxyAuthRequired {
+		t.Errorf("ErrorCodeOf() = %s; want %s", ErrorCodeOf(err), ErrCodeProxyAuthRequired)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d; want 1", *calls)
+	}
+}
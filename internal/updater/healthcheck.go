@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
+)
+
+// shellArgs returns the platform shell and the arguments that make it run
+// the given command line
+func shellArgs(command string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", command}
+	}
+	return "/bin/sh", []string{"-c", command}
+}
+
+// shellCommand builds a command that runs the given command line through the
+// platform shell, with the environment every command the updater runs gets
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	name, args := shellArgs(command)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = commandEnvironment()
+	return cmd
+}
+
+// runPostUpdateHealthCheck runs the operator-defined health check command and
+// fails unless it exits 0 within the timeout. This catches agents whose service
+// is up but which are not actually working.
+func runPostUpdateHealthCheck(commandLine string, timeout time.Duration) error {
+	LogInfo("Running post-update health check (timeout %v): %s", timeout, commandLine)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	runner := processRunner(func(process *command.Exec) {
+		// Don't wait forever on grandchildren that inherited the output pipes
+		process.Prepare = func(cmd *exec.Cmd) { cmd.WaitDelay = 5 * time.Second }
+	})
+	name, args := shellArgs(commandLine)
+	stdout, stderr, err := runner.Run(ctx, name, args, commandEnvironment(), "")
+	output := append(stdout, stderr...)
+	if trimmed := strings.TrimSpace(string(output)); trimmed != "" {
+		LogInfo("Health check output:\n%s", trimmed)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return newUpdateError(ErrCodeHealthCheckFailed, "health check timed out after %v", timeout)
+	}
+	if err != nil {
+		return newUpdateError(ErrCodeHealthCheckFailed, "health check failed: %v", err)
+	}
+
+	LogInfo("Post-update health check passed")
+	return nil
+}
+
+// runConfiguredHealthCheck runs the post-update health check if one is configured
+func runConfiguredHealthCheck() error {
+	config := getConfig()
+	if config.PostUpdateHealthCheck == "" {
+		LogInfo("No post-update health check configured, skipping")
+		return nil
+	}
+
+	if err := runPostUpdateHealthCheck(config.PostUpdateHealthCheck, config.HealthCheckTimeout()); err != nil {
+		return fmt.Errorf("post-update health check: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package updater
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestRunPostUpdateHealthCheck verifies that the health check passes only when
+// the command exits 0
+func TestRunPostUpdateHealthCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		wantErr bool
+	}{
+		{name: "success", command: "exit 0", wantErr: false},
+		{name: "failure", command: "exit 3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runPostUpdateHealthCheck(tt.command, 10*time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runPostUpdateHealthCheck(%q) error = %v; wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if err != nil && ErrorCodeOf(err) != ErrCodeHealthCheckFailed {
+				t.Errorf("error code = %q; want %q", ErrorCodeOf(err), ErrCodeHealthCheckFailed)
+			}
+		})
+	}
+}
+
+// TestRunPostUpdateHealthCheckTimeout verifies that a hanging health check is
+// killed and reported as a failure
+func TestRunPostUpdateHealthCheckTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Uses a POSIX sleep command")
+	}
+
+	start := time.Now()
+	err := runPostUpdateHealthCheck("exec sleep 30", 200*time.Millisecond)
+	if err == nil {
+		t.Fatal("runPostUpdateHealthCheck() should fail when the command times out")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("runPostUpdateHealthCheck() took %v; the timeout was not enforced", elapsed)
+	}
+}
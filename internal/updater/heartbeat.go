@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// heartbeatFileName holds the last sign of life of the updater loop, for
+// monitoring to tell a wedged updater from a running one
+const heartbeatFileName = "heartbeat.json"
+
+// Heartbeat is what the updater loop writes to heartbeat.json at the top of
+// every cycle, at every update step and before it sleeps
+type Heartbeat struct {
+	Timestamp time.Time `json:"timestamp"`
+	PID       int       `json:"pid"`
+	Cycle     uint64    `json:"cycle"`
+	State     string    `json:"state"`
+	NextCheck time.Time `json:"nextCheck,omitempty"`
+}
+
+// loopHeartbeat is the heartbeat of this process
+var loopHeartbeat struct {
+	sync.Mutex
+	heartbeat Heartbeat
+	dataDir   string
+}
+
+// startHeartbeat begins writing heartbeats to dataDir and tells systemd the
+// updater is ready
+func startHeartbeat(dataDir string) {
+	loopHeartbeat.Lock()
+	loopHeartbeat.dataDir = dataDir
+	loopHeartbeat.heartbeat = Heartbeat{PID: os.Getpid()}
+	loopHeartbeat.Unlock()
+
+	if sent, err := sdNotify("READY=1"); err != nil {
+		LogWarning("Failed to notify systemd that the updater is ready: %v", err)
+	} else if sent {
+		LogInfo("Notified systemd that the updater is ready")
+		if interval := watchdogInterval(); interval > 0 {
+			LogInfo("Systemd watchdog enabled, restarting the updater after %v without a heartbeat", interval)
+		}
+	}
+}
+
+// beginCycle starts a new cycle of the updater loop and writes its heartbeat
+func beginCycle() {
+	loopHeartbeat.Lock()
+	loopHeartbeat.heartbeat.Cycle++
+	loopHeartbeat.Unlock()
+	heartbeat(ActivityChecking, time.Time{})
+}
+
+// heartbeat records that the updater loop is alive and in state, writes
+// heartbeat.json and pings the systemd watchdog. Failures are logged at
+// debug only, like those of the status file.
+func heartbeat(state string, nextCheck time.Time) {
+	loopHeartbeat.Lock()
+	defer loopHeartbeat.Unlock()
+
+	if loopHeartbeat.dataDir == "" {
+		return
+	}
+	loopHeartbeat.heartbeat.Timestamp = now()
+	loopHeartbeat.heartbeat.State = state
+	loopHeartbeat.heartbeat.NextCheck = nextCheck
+	if err := writeJSONFile(filepath.Join(loopHeartbeat.dataDir, heartbeatFileName), loopHeartbeat.heartbeat); err != nil {
+		LogDebug("Failed to write heartbeat: %v", err)
+	}
+	if _, err := sdNotify("WATCHDOG=1"); err != nil {
+		LogDebug("Failed to ping systemd watchdog: %v", err)
+	}
+}
+
+// sleepUntilNextCheck waits out the check interval, or until a check is
+// requested through the control endpoint or SIGUSR1, or ctx is done. Sleeping is not being stuck, so the
+// systemd watchdog is pinged at half its interval meanwhile; heartbeat.json
+// records when the next check is due instead.
+func sleepUntilNextCheck(ctx context.Context) {
+	interval := getConfig().CheckIntervalDuration()
+	heartbeat(ActivityIdle, now().Add(interval))
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	var ping <-chan time.Time
+	if half := watchdogInterval() / 2; half > 0 {
+		ticker := time.NewTicker(half)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	for {
+		select {
+		case <-timer.C:
+			return
+		case <-checkRequests:
+			return
+		case <-ctx.Done():
+			return
+		case <-ping:
+			if _, err := sdNotify("WATCHDOG=1"); err != nil {
+				LogDebug("Failed to ping systemd watchdog: %v", err)
+			}
+		}
+	}
+}
+
+// readHeartbeat returns the heartbeat last written to dataDir, or nil when
+// there is none
+func readHeartbeat(dataDir string) (*Heartbeat, error) {
+	var beat Heartbeat
+	found, err := readJSONFile(filepath.Join(dataDir, heartbeatFileName), &beat)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &beat, nil
+}
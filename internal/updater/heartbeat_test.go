@@ -0,0 +1,104 @@
+package updater
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestHeartbeatWriter verifies that each cycle and update step is written to
+// heartbeat.json and read back by the status command
+func TestHeartbeatWriter(t *testing.T) {
+	clock := fakeClock(t)
+	dataDir := t.TempDir()
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Cleanup(func() { startHeartbeat(""); startStatus("") })
+
+	startStatus(dataDir)
+	startHeartbeat(dataDir)
+	beginCycle()
+	*clock = clock.Add(time.Minute)
+	beginCycle()
+
+	beat, err := readHeartbeat(dataDir)
+	if err != nil || beat == nil {
+		t.Fatalf("readHeartbeat() = %v, %v; want a heartbeat", beat, err)
+	}
+	if beat.Cycle != 2 || beat.State != ActivityChecking || !beat.Timestamp.Equal(*clock) || beat.PID != os.Getpid() {
+		t.Errorf("readHeartbeat() = %+v; want cycle 2 checking at %v", beat, *clock)
+	}
+
+	next := clock.Add(time.Hour)
+	heartbeat(ActivityIdle, next)
+	report, err := readStatus(dataDir)
+	if err != nil || report == nil || report.Heartbeat == nil {
+		t.Fatalf("readStatus() = %+v, %v; want a heartbeat", report, err)
+	}
+	if report.Heartbeat.State != ActivityIdle || !report.Heartbeat.NextCheck.Equal(next) || report.Heartbeat.Cycle != 2 {
+		t.Errorf("status heartbeat = %+v; want cycle 2 idle until %v", report.Heartbeat, next)
+	}
+}
+
+// TestSDNotify verifies the notify socket addresses and that the state is
+// sent as one datagram of newline separated assignments
+func TestSDNotify(t *testing.T) {
+	addrs := map[string]string{
+		"/run/systemd/notify": "/run/systemd/notify",
+		"@notify":             "\x00notify",
+	}
+	for name, want := range addrs {
+		addr, err := notifySocketAddr(name)
+		if err != nil || addr == nil || addr.Name != want {
+			t.Errorf("notifySocketAddr(%q) = %v, %v; want %q", name, addr, err, want)
+		}
+	}
+	if addr, err := notifySocketAddr("notify"); err == nil {
+		t.Errorf("notifySocketAddr(relative) = %v; want an error", addr)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := sdNotify("READY=1"); sent || err != nil {
+		t.Errorf("sdNotify() without a socket = %v, %v; want false, nil", sent, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("notify socket requires unixgram sockets")
+	}
+	socketPath := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	if sent, err := sdNotify("READY=1", "STATUS=checking"); !sent || err != nil {
+		t.Fatalf("sdNotify() = %v, %v; want true, nil", sent, err)
+	}
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notify message: %v", err)
+	}
+	if got := string(buf[:n]); got != "READY=1\nSTATUS=checking" {
+		t.Errorf("notify message = %q; want %q", got, "READY=1\nSTATUS=checking")
+	}
+}
+
+// TestWatchdogInterval verifies that the watchdog is only enabled for the
+// process systemd expects pings from
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if got := watchdogInterval(); got != 30*time.Second {
+		t.Errorf("watchdogInterval() = %v; want 30s", got)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := watchdogInterval(); got != 0 {
+		t.Errorf("watchdogInterval() for another pid = %v; want 0", got)
+	}
+}
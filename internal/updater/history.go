@@ -0,0 +1,123 @@
+package updater
+
+import (
+	"path/filepath"
+	"time"
+)
+
+const (
+	// historyFileName holds the record of update and rollback attempts
+	historyFileName = "update-history.json"
+
+	// MaxHistoryEntries is the number of history entries kept on disk
+	MaxHistoryEntries = 100
+)
+
+// HistoryAction identifies the kind of operation recorded in the update history
+type HistoryAction string
+
+const (
+	HistoryActionUpdate         HistoryAction = "update"
+	HistoryActionRollback       HistoryAction = "rollback"
+	HistoryActionManualRollback HistoryAction = "manual_rollback"
+	HistoryActionInstall        HistoryAction = "install"
+)
+
+// HistoryEntry records the outcome of a single update or rollback
+type HistoryEntry struct {
+	Timestamp   time.Time     `json:"timestamp"`
+	Action      HistoryAction `json:"action"`
+	FromVersion string        `json:"fromVersion,omitempty"`
+	ToVersion   string        `json:"toVersion,omitempty"`
+	Success     bool          `json:"success"`
+	Error       string        `json:"error,omitempty"`
+	BuildMode   string        `json:"buildMode,omitempty"`
+
+	// FromVersionDetails is the full --version output of the agent the
+	// operation replaced, with the commit and build details FromVersion drops
+	FromVersionDetails string `json:"fromVersionDetails,omitempty"`
+
+	// UpdaterVersion is the updater that recorded the entry
+	UpdaterVersion string `json:"updaterVersion,omitempty"`
+}
+
+// loadHistory returns the recorded history, oldest entry first
+func loadHistory(dataDir string) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	if _, err := readJSONFile(filepath.Join(dataDir, historyFileName), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// appendHistory adds entry to the history file, keeping at most MaxHistoryEntries
+func appendHistory(dataDir string, entry HistoryEntry) error {
+	entries, err := loadHistory(dataDir)
+	if err != nil {
+		// A corrupt history must not block recording new outcomes
+		entries = nil
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > MaxHistoryEntries {
+		entries = entries[len(entries)-MaxHistoryEntries:]
+	}
+
+	return writeJSONFile(filepath.Join(dataDir, historyFileName), entries)
+}
+
+// newHistoryEntry describes the outcome of an operation
+func newHistoryEntry(action HistoryAction, fromVersion, toVersion string, err error) HistoryEntry {
+	entry := HistoryEntry{
+		Action:      action,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Success:     err == nil,
+
+		UpdaterVersion: UpdaterVersion,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// recordHistory appends an entry for the given outcome, logging instead of failing
+func recordHistory(dataDir string, action HistoryAction, fromVersion, toVersion string, err error) {
+	saveHistoryEntry(dataDir, newHistoryEntry(action, fromVersion, toVersion, err))
+}
+
+// recordUpdateHistory appends the outcome of the update described by marker,
+// including the build mode of the compiled binary
+func recordUpdateHistory(dataDir string, marker *UpdateMarker, err error) {
+	entry := newHistoryEntry(HistoryActionUpdate, marker.PreviousVersion, marker.TargetVersion, err)
+	entry.BuildMode = marker.BuildMode
+	entry.FromVersionDetails = marker.PreviousVersionDetails
+	saveHistoryEntry(dataDir, entry)
+}
+
+func saveHistoryEntry(dataDir string, entry HistoryEntry) {
+	if err := appendHistory(dataDir, entry); err != nil {
+		LogWarning("Failed to record %s in update history: %v", entry.Action, err)
+	}
+}
+
+// wasManuallyRolledBack reports whether an operator rolled back away from version,
+// in which case the update loop must not reinstall it automatically
+func wasManuallyRolledBack(dataDir, version string) bool {
+	entries, err := loadHistory(dataDir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if entry.Action == HistoryActionManualRollback && entry.Success && entry.FromVersion == version {
+			return true
+		}
+	}
+	return false
+}
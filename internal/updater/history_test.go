@@ -0,0 +1,52 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestAppendHistoryBounded verifies that the history keeps only the most
+// recent MaxHistoryEntries entries
+func TestAppendHistoryBounded(t *testing.T) {
+	dataDir := t.TempDir()
+
+	for i := 0; i < MaxHistoryEntries+5; i++ {
+		entry := HistoryEntry{Action: HistoryActionUpdate, ToVersion: fmt.Sprintf("v1.0.%d", i), Success: true}
+		if err := appendHistory(dataDir, entry); err != nil {
+			t.Fatalf("appendHistory() failed: %v", err)
+		}
+	}
+
+	entries, err := loadHistory(dataDir)
+	if err != nil {
+		t.Fatalf("loadHistory() failed: %v", err)
+	}
+	if len(entries) != MaxHistoryEntries {
+		t.Fatalf("len(entries) = %d; want %d", len(entries), MaxHistoryEntries)
+	}
+	if entries[0].ToVersion != "v1.0.5" {
+		t.Errorf("oldest entry = %s; want v1.0.5", entries[0].ToVersion)
+	}
+}
+
+// TestWasManuallyRolledBack verifies that only successful manual rollbacks
+// hold a version back from automatic updates
+func TestWasManuallyRolledBack(t *testing.T) {
+	dataDir := t.TempDir()
+
+	recordHistory(dataDir, HistoryActionRollback, "v1.7.0", "v1.6.0", nil)
+	recordHistory(dataDir, HistoryActionManualRollback, "v1.8.0", "v1.7.0", errors.New("stop failed"))
+	recordHistory(dataDir, HistoryActionManualRollback, "v1.9.0", "v1.7.0", nil)
+
+	tests := map[string]bool{
+		"v1.7.0": false,
+		"v1.8.0": false,
+		"v1.9.0": true,
+	}
+	for version, expected := range tests {
+		if actual := wasManuallyRolledBack(dataDir, version); actual != expected {
+			t.Errorf("wasManuallyRolledBack(%s) = %v; want %v", version, actual, expected)
+		}
+	}
+}
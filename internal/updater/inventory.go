@@ -0,0 +1,164 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInventoryIntervalSeconds is the minimum time between inventory reports
+	DefaultInventoryIntervalSeconds = 3600
+
+	// inventoryAttempts bounds how often one report is sent
+	inventoryAttempts = 3
+)
+
+// inventoryBackoff is the wait before the first retry, doubled for each later
+// one; it is a variable so tests can shorten it
+var inventoryBackoff = 2 * time.Second
+
+// InventoryReport is the body posted to inventoryURL
+type InventoryReport struct {
+	Hostname       string    `json:"hostname"`
+	OS             string    `json:"os"`
+	Arch           string    `json:"arch"`
+	AgentVersion   string    `json:"agentVersion"`
+	UpdaterVersion string    `json:"updaterVersion"`
+	UpdaterCommit  string    `json:"updaterCommit,omitempty"`
+	LastCheck      time.Time `json:"lastCheck"`
+}
+
+// inventoryState tracks the last report so reports follow their own interval
+var inventoryState struct {
+	sync.Mutex
+	lastReport time.Time
+	sending    bool
+}
+
+// newInventoryReport describes this host running agentVersion
+func newInventoryReport(agentVersion string, lastCheck time.Time) InventoryReport {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return InventoryReport{
+		Hostname:       hostname,
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		AgentVersion:   agentVersion,
+		UpdaterVersion: UpdaterVersion,
+		UpdaterCommit:  currentBuild().Commit,
+		LastCheck:      lastCheck,
+	}
+}
+
+// inventoryDue reports whether a report should be sent now, and if so marks
+// one as being sent
+func inventoryDue(config *UpdaterConfig) bool {
+	if config.InventoryURL == "" {
+		return false
+	}
+
+	inventoryState.Lock()
+	defer inventoryState.Unlock()
+	if inventoryState.sending {
+		return false
+	}
+	if !inventoryState.lastReport.IsZero() && now().Sub(inventoryState.lastReport) < config.InventoryInterval() {
+		return false
+	}
+	inventoryState.sending = true
+	return true
+}
+
+// reportInventory posts the agent version after a successful check, at most
+// once per inventory interval. It runs in the background so a slow endpoint
+// never delays an update.
+func reportInventory(agentVersion string, lastCheck time.Time) {
+	config := getConfig()
+	if !inventoryDue(config) {
+		return
+	}
+
+	go func() {
+		err := sendInventoryReport(config, newInventoryReport(agentVersion, lastCheck))
+
+		inventoryState.Lock()
+		defer inventoryState.Unlock()
+		inventoryState.sending = false
+		if err != nil {
+			LogWarning("Inventory report failed: %v", err)
+			return
+		}
+		inventoryState.lastReport = now()
+		LogDebug("Reported agent version %s to the inventory", agentVersion)
+	}()
+}
+
+// sendInventoryReport posts report to the inventory URL, retrying network
+// errors and server errors with exponential backoff
+func sendInventoryReport(config *UpdaterConfig, report InventoryReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return err
+	}
+
+	backoff := inventoryBackoff
+	var lastErr error
+	for attempt := 1; attempt <= inventoryAttempts; attempt++ {
+		retry, err := postReport(client, config, config.InventoryURL, "inventory endpoint", body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == inventoryAttempts {
+			break
+		}
+		LogDebug("Inventory report attempt %d/%d failed, retrying in %v: %v", attempt, inventoryAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return lastErr
+}
+
+// postReport posts one JSON report to endpoint, named what in errors, and
+// reports whether a failure may succeed on retry
+func postReport(client *http.Client, config *UpdaterConfig, endpoint, what string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sentinel-updater")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if isProxyAuthError(err.Error()) {
+			return false, newProxyAuthError(config)
+		}
+		return true, err
+	}
+	resp.Body.Close()
+
+	if err := checkProxyResponse(resp, config); err != nil {
+		return false, err
+	}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("%s returned %s", what, resp.Status)
+	default:
+		return false, fmt.Errorf("%s returned %s", what, resp.Status)
+	}
+}
@@ -0,0 +1,93 @@
+package updater
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newInventoryServer returns a server that answers with statuses in order,
+// then 204, recording the reports it receives
+func newInventoryServer(t *testing.T, statuses ...int) (*httptest.Server, *[]InventoryReport) {
+	var reports []InventoryReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report InventoryReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reports = append(reports, report)
+		status := http.StatusNoContent
+		if len(reports) <= len(statuses) {
+			status = statuses[len(reports)-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	original := inventoryBackoff
+	inventoryBackoff = time.Millisecond
+	t.Cleanup(func() { inventoryBackoff = original })
+	return server, &reports
+}
+
+// TestSendInventoryReportRetries verifies that server errors are retried and
+// the report carries the agent and updater versions
+func TestSendInventoryReportRetries(t *testing.T) {
+	server, reports := newInventoryServer(t, http.StatusServiceUnavailable)
+	config := &UpdaterConfig{InventoryURL: server.URL}
+
+	lastCheck := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := sendInventoryReport(config, newInventoryReport("v1.2.0", lastCheck)); err != nil {
+		t.Fatalf("sendInventoryReport() failed: %v", err)
+	}
+	if len(*reports) != 2 {
+		t.Fatalf("received %d reports; want 2", len(*reports))
+	}
+	report := (*reports)[1]
+	if report.AgentVersion != "v1.2.0" || report.UpdaterVersion != UpdaterVersion || !report.LastCheck.Equal(lastCheck) || report.Hostname == "" {
+		t.Errorf("report = %+v; want agent v1.2.0, updater %s, last check %v", report, UpdaterVersion, lastCheck)
+	}
+}
+
+// TestSendInventoryReportClientError verifies that a 4xx answer is not retried
+func TestSendInventoryReportClientError(t *testing.T) {
+	server, reports := newInventoryServer(t, http.StatusForbidden)
+
+	if err := sendInventoryReport(&UpdaterConfig{InventoryURL: server.URL}, newInventoryReport("v1.2.0", time.Now())); err == nil {
+		t.Errorf("sendInventoryReport() = nil; want an error")
+	}
+	if len(*reports) != 1 {
+		t.Errorf("received %d reports; want 1", len(*reports))
+	}
+}
+
+// TestInventoryDue verifies that reports follow their own interval and are
+// never sent while one is in flight or without a URL
+func TestInventoryDue(t *testing.T) {
+	clock := fakeClock(t)
+	t.Cleanup(func() { inventoryState.lastReport, inventoryState.sending = time.Time{}, false })
+	config := &UpdaterConfig{InventoryURL: "https://inventory.example.com", InventoryIntervalSeconds: 3600}
+
+	if inventoryDue(&UpdaterConfig{}) {
+		t.Errorf("inventoryDue() without a URL = true; want false")
+	}
+	if !inventoryDue(config) {
+		t.Fatalf("first inventoryDue() = false; want true")
+	}
+	if inventoryDue(config) {
+		t.Errorf("inventoryDue() while sending = true; want false")
+	}
+
+	inventoryState.sending, inventoryState.lastReport = false, *clock
+	*clock = clock.Add(30 * time.Minute)
+	if inventoryDue(config) {
+		t.Errorf("inventoryDue() within the interval = true; want false")
+	}
+	*clock = clock.Add(time.Hour)
+	if !inventoryDue(config) {
+		t.Errorf("inventoryDue() after the interval = false; want true")
+	}
+}
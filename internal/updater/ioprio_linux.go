@@ -0,0 +1,26 @@
+package updater
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// I/O scheduling classes and the ioprio_set target, from linux/ioprio.h
+const (
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+	ioprioClassShift      = 13
+	ioprioWhoProcess      = 1
+)
+
+// setIOPriority moves the process with pid to the lowest best-effort I/O
+// priority, or to the idle I/O class for the idle build priority
+func setIOPriority(pid int, priority string) error {
+	ioprio := ioprioClassBestEffort<<ioprioClassShift | 7
+	if priority == BuildPriorityIdle {
+		ioprio = ioprioClassIdle << ioprioClassShift
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(ioprio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package updater
+
+// setIOPriority does nothing where the I/O priority cannot be set per process
+func setIOPriority(pid int, priority string) error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// updateLockFileName exists while an update or rollback is modifying the agent
+	updateLockFileName = "update.lock"
+
+	// staleLockAge is how old a lock must be before it is ignored even if its owner looks alive
+	staleLockAge = 2 * time.Hour
+)
+
+// acquireUpdateLock ensures only one process (the service loop or a manual CLI
+// command) modifies the agent at a time. The returned function releases the lock.
+func acquireUpdateLock(dataDir string) (func(), error) {
+	lockPath := filepath.Join(dataDir, updateLockFileName)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n%s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+			file.Close()
+			return func() {
+				if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+					LogWarning("Failed to release update lock: %v", err)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create update lock %s: %w", lockPath, err)
+		}
+
+		pid, started := readUpdateLock(lockPath)
+		if isLockStale(pid, started) {
+			LogWarning("Removing stale update lock held by PID %d since %s", pid, started.Format(time.RFC3339))
+			os.Remove(lockPath)
+			continue
+		}
+
+		return nil, fmt.Errorf("another update or rollback is in progress (PID %d since %s)", pid, started.Format(time.RFC3339))
+	}
+
+	return nil, fmt.Errorf("failed to acquire update lock %s", lockPath)
+}
+
+// readUpdateLock returns the PID and start time recorded in the lock file
+func readUpdateLock(lockPath string) (int, time.Time) {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0, time.Time{}
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, _ := strconv.Atoi(strings.TrimSpace(lines[0]))
+
+	var started time.Time
+	if len(lines) > 1 {
+		started, _ = time.Parse(time.RFC3339, strings.TrimSpace(lines[1]))
+	}
+	return pid, started
+}
+
+// isLockStale reports whether a lock's owner is gone or has held it implausibly long
+func isLockStale(pid int, started time.Time) bool {
+	if pid <= 0 || !processExists(pid) {
+		return true
+	}
+	return !started.IsZero() && time.Since(started) > staleLockAge
+}
@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAcquireUpdateLockExclusive verifies that a second lock attempt fails
+// while the first is held and succeeds after release
+func TestAcquireUpdateLockExclusive(t *testing.T) {
+	dataDir := t.TempDir()
+
+	release, err := acquireUpdateLock(dataDir)
+	if err != nil {
+		t.Fatalf("acquireUpdateLock() failed: %v", err)
+	}
+
+	if _, err := acquireUpdateLock(dataDir); err == nil {
+		t.Fatal("acquireUpdateLock() should fail while the lock is held")
+	}
+
+	release()
+
+	release, err = acquireUpdateLock(dataDir)
+	if err != nil {
+		t.Fatalf("acquireUpdateLock() after release failed: %v", err)
+	}
+	release()
+}
+
+// TestAcquireUpdateLockStale verifies that a lock left behind by a dead
+// process is taken over
+func TestAcquireUpdateLockStale(t *testing.T) {
+	dataDir := t.TempDir()
+
+	// PIDs are far below this value on every supported platform
+	content := fmt.Sprintf("%d\n%s\n", 1<<30, time.Now().Format(time.RFC3339))
+	if err := os.WriteFile(filepath.Join(dataDir, updateLockFileName), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write lock file: %v", err)
+	}
+
+	release, err := acquireUpdateLock(dataDir)
+	if err != nil {
+		t.Fatalf("acquireUpdateLock() should take over a stale lock: %v", err)
+	}
+	release()
+}
@@ -1,28 +1,42 @@
 package updater
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
 )
 
 const (
-	// MaxLogFileSize is the maximum size of a log file before rotation (10MB)
+	// MaxLogFileSize is the default maximum size of a log file before rotation (10MB)
 	MaxLogFileSize = 10 * 1024 * 1024
 
-	// MaxLogFiles is the number of rotated log files to keep
+	// MaxLogFiles is the default number of rotated log files to keep
 	MaxLogFiles = 5
+
+	// minLogSizeMB and minLogFiles are the smallest accepted log limits
+	minLogSizeMB = 1
+	minLogFiles  = 1
+
+	// compressedLogSuffix is appended to rotated log files that are gzipped
+	compressedLogSuffix = ".gz"
 )
 
 // LogLevel represents the severity of a log message
 type LogLevel string
 
 const (
+	LogLevelDebug    LogLevel = "DEBUG"
 	LogLevelInfo     LogLevel = "INFO"
 	LogLevelWarning  LogLevel = "WARNING"
 	LogLevelError    LogLevel = "ERROR"
@@ -30,60 +44,212 @@ const (
 )
 
 var (
+	// logMu serializes writing a message with the rotation that may follow
+	// it, so no message is written to a file that is being closed or renamed
+	logMu sync.Mutex
+
 	logFile     *os.File
+	logFilePath string
 	multiWriter io.Writer
 	initialized bool
+
+	// logger writes the package's messages. It is not the standard logger,
+	// so a program embedding the updater keeps its own log output.
+	logger = log.New(os.Stderr, "", 0)
+
+	// logConsole receives every message when the stderr sink is enabled
+	logConsole io.Writer = os.Stderr
+
+	// logSinks are the enabled sinks, read from the configuration by InitLogger
+	logSinks = defaultLogSinks
+
+	// systemLog writes to syslog or the Event Log when that sink is enabled
+	systemLog io.WriteCloser
+
+	// logMaxSize and logMaxFiles are read from the configuration by InitLogger
+	logMaxSize  int64 = MaxLogFileSize
+	logMaxFiles       = MaxLogFiles
 )
 
-// InitLogger initializes the logging system with file rotation
+// InitLogger initializes the logging system with file rotation. It is safe
+// to call from several goroutines; only the first call opens the log, and
+// after CloseLogger the next call opens it again.
 func InitLogger() error {
-	if initialized {
-		return nil
-	}
-
 	// Ensure data directory exists
 	if err := paths.EnsureDataDirectory(); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	logPath := paths.GetUpdaterLogPath()
+	return initLogger(paths.GetUpdaterLogPath(), paths.GetUpdaterConfigPath())
+}
+
+// initLogger opens logPath with the limits from configPath unless logging is
+// already initialized
+func initLogger(logPath, configPath string) error {
+	var maxSize int64
+	var maxFiles int
+	var sinks []string
+
+	opened, err := func() (bool, error) {
+		logMu.Lock()
+		defer logMu.Unlock()
+		if initialized {
+			return false, nil
+		}
 
-	// Check if log rotation is needed
-	if err := rotateLogIfNeeded(logPath); err != nil {
-		return fmt.Errorf("failed to rotate log: %w", err)
+		// Logging starts before the configuration is loaded, so read the limits now
+		logMaxSize, logMaxFiles = readLogLimits(configPath)
+		maxSize, maxFiles = logMaxSize, logMaxFiles
+		logSinks = readLogSinks(configPath)
+		sinks = logSinks
+
+		if hasLogSink(LogSinkFile) {
+			// Check if log rotation is needed
+			if err := rotateLogIfNeeded(logPath); err != nil {
+				return false, fmt.Errorf("failed to rotate log: %w", err)
+			}
+
+			if err := openLogFile(logPath); err != nil {
+				return false, err
+			}
+		}
+		openSystemLogSinks()
+		setLogOutput()
+
+		initialized = true
+		return true, nil
+	}()
+	if !opened {
+		return err
 	}
 
-	// Open log file for appending
-	var err error
-	logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	LogInfo("Logging system initialized")
+	LogInfo("Updater %s", currentBuild())
+	LogInfo("Log sinks: %s", strings.Join(sinks, ", "))
+	LogInfo("Log file: %s", logPath)
+	LogInfo("Max log file size: %d bytes (%.2f MB)", maxSize, float64(maxSize)/(1024*1024))
+	LogInfo("Max log files to keep: %d", maxFiles)
+
+	return nil
+}
+
+// openLogFile opens logPath for appending and points the logger at
+// it and the other enabled sinks. The caller holds logMu.
+func openLogFile(logPath string) error {
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
-	// Create multi-writer to write to both file and stderr
-	multiWriter = io.MultiWriter(logFile, os.Stderr)
+	logFile = file
+	logFilePath = logPath
+	setLogOutput()
+	return nil
+}
+
+// openSystemLogSinks connects the enabled syslog or Event Log sink. A sink
+// that cannot be opened is reported on stderr and skipped. The caller holds
+// logMu.
+func openSystemLogSinks() {
+	for _, name := range logSinks {
+		if name != LogSinkSyslog && name != LogSinkEventLog {
+			continue
+		}
+		sink, err := openSystemLog(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s log sink: %v\n", name, err)
+			continue
+		}
+		systemLog = systemLogWriter{sink: sink}
+	}
+}
+
+// setLogOutput points the logger at the open sinks. The caller
+// holds logMu.
+func setLogOutput() {
+	var writers []io.Writer
+	if logFile != nil {
+		writers = append(writers, logFile)
+	}
+	if hasLogSink(LogSinkStderr) {
+		writers = append(writers, logConsole)
+	}
+	if systemLog != nil {
+		writers = append(writers, systemLog)
+	}
+	multiWriter = io.MultiWriter(writers...)
+	logger.SetOutput(multiWriter)
+}
 
-	// Configure standard logger to use our multi-writer
-	log.SetOutput(multiWriter)
-	log.SetFlags(0) // We'll add our own timestamps and formatting
+// useLogOutput sends every message to w instead of the log file and the
+// configured sinks, for a program that embeds the updater
+func useLogOutput(w io.Writer) {
+	logMu.Lock()
+	defer logMu.Unlock()
 
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+	if systemLog != nil {
+		systemLog.Close()
+		systemLog = nil
+	}
+	logConsole, logSinks = w, []string{LogSinkStderr}
+	setLogOutput()
 	initialized = true
+}
 
-	LogInfo("Logging system initialized")
-	LogInfo("Log file: %s", logPath)
-	LogInfo("Max log file size: %d bytes (%.2f MB)", MaxLogFileSize, float64(MaxLogFileSize)/(1024*1024))
-	LogInfo("Max log files to keep: %d", MaxLogFiles)
+// readLogLimits returns the maximum log size in bytes and the number of
+// rotated files to keep from the config file at configPath, falling back to
+// the defaults for missing or invalid values
+func readLogLimits(configPath string) (int64, int) {
+	defaults := defaultConfig()
+	limits := struct {
+		MaxLogSizeMB int `json:"maxLogSizeMB"`
+		MaxLogFiles  int `json:"maxLogFiles"`
+	}{defaults.MaxLogSizeMB, defaults.MaxLogFiles}
+
+	if data, err := os.ReadFile(configPath); err == nil {
+		json.Unmarshal(data, &limits)
+	}
+	if limits.MaxLogSizeMB < minLogSizeMB {
+		limits.MaxLogSizeMB = defaults.MaxLogSizeMB
+	}
+	if limits.MaxLogFiles < minLogFiles {
+		limits.MaxLogFiles = defaults.MaxLogFiles
+	}
 
-	return nil
+	return int64(limits.MaxLogSizeMB) * 1024 * 1024, limits.MaxLogFiles
 }
 
-// CloseLogger closes the log file
+// CloseLogger closes the log file; a later InitLogger opens it again
 func CloseLogger() error {
+	logMu.Lock()
+	open := initialized
+	logMu.Unlock()
+	if !open {
+		return nil
+	}
+	LogInfo("Closing log file")
+
+	logMu.Lock()
+	defer logMu.Unlock()
+	if !initialized {
+		return nil
+	}
+	logger.SetOutput(logConsole)
+	var err error
 	if logFile != nil {
-		LogInfo("Closing log file")
-		return logFile.Close()
+		err = logFile.Close()
+		logFile = nil
 	}
-	return nil
+	if systemLog != nil {
+		systemLog.Close()
+		systemLog = nil
+	}
+	initialized = false
+	return err
 }
 
 // rotateLogIfNeeded checks if the log file needs rotation and performs it
@@ -99,7 +265,7 @@ func rotateLogIfNeeded(logPath string) error {
 	}
 
 	// Check if file size exceeds limit
-	if fileInfo.Size() < MaxLogFileSize {
+	if fileInfo.Size() < logMaxSize {
 		// No rotation needed
 		return nil
 	}
@@ -108,7 +274,14 @@ func rotateLogIfNeeded(logPath string) error {
 	return rotateLogFiles(logPath)
 }
 
-// rotateLogFiles rotates log files, keeping MaxLogFiles versions
+// rotatedLogName returns the name of the rotated log file with index i
+func rotatedLogName(logPath string, i int) string {
+	return fmt.Sprintf("%s.%d", logPath, i)
+}
+
+// rotateLogFiles rotates log files, keeping logMaxFiles versions. Rotated
+// files may be plain or gzipped; both are shifted so switching compression
+// on or off keeps the history in order. The current log is never compressed.
 func rotateLogFiles(logPath string) error {
 	// Close current log file if open
 	if logFile != nil {
@@ -116,33 +289,153 @@ func rotateLogFiles(logPath string) error {
 		logFile = nil
 	}
 
-	// Delete the oldest log file if it exists
-	oldestLog := fmt.Sprintf("%s.%d", logPath, MaxLogFiles)
-	if err := os.Remove(oldestLog); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove oldest log file: %w", err)
+	// Delete the oldest log file, and any beyond it left by a larger limit
+	if err := pruneRotatedLogs(logPath, logMaxFiles-1); err != nil {
+		return err
 	}
 
 	// Rotate existing log files
-	for i := MaxLogFiles - 1; i >= 1; i-- {
-		oldName := fmt.Sprintf("%s.%d", logPath, i)
-		newName := fmt.Sprintf("%s.%d", logPath, i+1)
-
-		if _, err := os.Stat(oldName); err == nil {
-			if err := os.Rename(oldName, newName); err != nil {
-				return fmt.Errorf("failed to rotate log file %s to %s: %w", oldName, newName, err)
+	for i := logMaxFiles - 1; i >= 1; i-- {
+		for _, suffix := range []string{"", compressedLogSuffix} {
+			oldName := rotatedLogName(logPath, i) + suffix
+			newName := rotatedLogName(logPath, i+1) + suffix
+
+			if _, err := os.Stat(oldName); err == nil {
+				if err := os.Rename(oldName, newName); err != nil {
+					return fmt.Errorf("failed to rotate log file %s to %s: %w", oldName, newName, err)
+				}
 			}
 		}
 	}
 
 	// Rename current log file to .1
-	rotatedName := fmt.Sprintf("%s.1", logPath)
+	rotatedName := rotatedLogName(logPath, 1)
 	if err := os.Rename(logPath, rotatedName); err != nil {
 		return fmt.Errorf("failed to rotate current log file: %w", err)
 	}
 
+	if getConfig().CompressRotatedLogs {
+		if err := gzipFile(rotatedName); err != nil {
+			// Keep the uncompressed file rather than fail the rotation
+			fmt.Fprintf(os.Stderr, "Failed to compress rotated log %s: %v\n", rotatedName, err)
+		}
+	}
+
 	return nil
 }
 
+// pruneRotatedLogs removes rotated files of logPath whose index is above keep
+func pruneRotatedLogs(logPath string, keep int) error {
+	matches, err := filepath.Glob(logPath + ".*")
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, logPath+"."), compressedLogSuffix)
+		index, err := strconv.Atoi(suffix)
+		if err != nil || index <= keep {
+			continue
+		}
+		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old log file %s: %w", match, err)
+		}
+	}
+	return nil
+}
+
+// gzipFile replaces path with path.gz
+func gzipFile(path string) error {
+	tmpPath := path + compressedLogSuffix + ".tmp"
+	if err := writeGzip(path, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path+compressedLogSuffix); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// writeGzip writes a gzipped copy of srcPath to dstPath
+func writeGzip(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// logLevelRanks orders the levels from most to least verbose
+var logLevelRanks = map[LogLevel]int{
+	LogLevelDebug:    0,
+	LogLevelInfo:     1,
+	LogLevelWarning:  2,
+	LogLevelError:    3,
+	LogLevelCritical: 4,
+}
+
+// parseLogLevel returns the level named by a logLevel setting such as
+// "debug" or "warning"
+func parseLogLevel(name string) (LogLevel, bool) {
+	level := LogLevel(strings.ToUpper(name))
+	if level == "WARN" {
+		level = LogLevelWarning
+	}
+	_, ok := logLevelRanks[level]
+	return level, ok
+}
+
+// logLevelOverride replaces the configured logLevel when set, for
+// --log-level and --verbose
+var logLevelOverride atomic.Value
+
+// EnableDebugLogging writes debug messages whatever logLevel is configured,
+// including after a config reload
+func EnableDebugLogging() {
+	logLevelOverride.Store(LogLevelDebug)
+}
+
+// SetLogLevel writes messages at the level called name and above, whatever
+// logLevel is configured, including after a config reload
+func SetLogLevel(name string) error {
+	level, ok := parseLogLevel(name)
+	if !ok {
+		return fmt.Errorf("unknown log level %q, use debug, info, warning, error or critical", name)
+	}
+	logLevelOverride.Store(level)
+	return nil
+}
+
+// logEnabled reports whether messages at level pass the configured minimum.
+// Critical messages are always written.
+func logEnabled(level LogLevel) bool {
+	threshold, ok := parseLogLevel(getConfig().LogLevel)
+	if !ok {
+		threshold = LogLevelInfo
+	}
+	if override, ok := logLevelOverride.Load().(LogLevel); ok {
+		threshold = override
+	}
+	return level == LogLevelCritical || logLevelRanks[level] >= logLevelRanks[threshold]
+}
+
 // formatLogMessage formats a log message with timestamp and level
 func formatLogMessage(level LogLevel, format string, args ...interface{}) string {
 	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
@@ -150,78 +443,84 @@ func formatLogMessage(level LogLevel, format string, args ...interface{}) string
 	return fmt.Sprintf("[%s] [%s] %s", timestamp, level, message)
 }
 
+// LogDebug logs a verbose diagnostic message, written only at the debug level
+func LogDebug(format string, args ...interface{}) {
+	if !logEnabled(LogLevelDebug) {
+		return
+	}
+	writeLogMessage(LogLevelDebug, format, args...)
+}
+
 // LogInfo logs an informational message
 func LogInfo(format string, args ...interface{}) {
-	message := formatLogMessage(LogLevelInfo, format, args...)
-	log.Println(message)
-
-	// Check if rotation is needed after each log
-	checkAndRotate()
+	if !logEnabled(LogLevelInfo) {
+		return
+	}
+	writeLogMessage(LogLevelInfo, format, args...)
 }
 
 // LogWarning logs a warning message
 func LogWarning(format string, args ...interface{}) {
-	message := formatLogMessage(LogLevelWarning, format, args...)
-	log.Println(message)
-
-	checkAndRotate()
+	if !logEnabled(LogLevelWarning) {
+		return
+	}
+	writeLogMessage(LogLevelWarning, format, args...)
 }
 
 // LogError logs an error message
 func LogError(format string, args ...interface{}) {
-	message := formatLogMessage(LogLevelError, format, args...)
-	log.Println(message)
-
-	checkAndRotate()
+	if !logEnabled(LogLevelError) {
+		return
+	}
+	writeLogMessage(LogLevelError, format, args...)
 }
 
 // LogCritical logs a critical error message
 func LogCritical(format string, args ...interface{}) {
-	message := formatLogMessage(LogLevelCritical, format, args...)
-	log.Println(message)
+	writeLogMessage(LogLevelCritical, format, args...)
+}
+
+// writeLogMessage writes a message and rotates the log once it passes the
+// size limit, as one step under logMu
+func writeLogMessage(level LogLevel, format string, args ...interface{}) {
+	message := formatLogMessage(level, format, args...)
 
+	logMu.Lock()
+	defer logMu.Unlock()
+	logger.Println(message)
 	checkAndRotate()
 }
 
-// checkAndRotate checks if log rotation is needed and performs it
+// checkAndRotate checks if log rotation is needed and performs it. The
+// caller holds logMu.
 func checkAndRotate() {
 	if !initialized || logFile == nil {
 		return
 	}
 
-	logPath := paths.GetUpdaterLogPath()
-
 	// Get current file size
-	fileInfo, err := os.Stat(logPath)
-	if err != nil {
+	fileInfo, err := os.Stat(logFilePath)
+	if err != nil || fileInfo.Size() < logMaxSize {
 		return
 	}
 
-	// Check if rotation is needed
-	if fileInfo.Size() >= MaxLogFileSize {
-		// Close current file
-		logFile.Close()
-
-		// Rotate logs
-		if err := rotateLogFiles(logPath); err != nil {
-			// Can't log this error since we're in the logging system
-			fmt.Fprintf(os.Stderr, "Failed to rotate log files: %v\n", err)
-			return
-		}
-
-		// Reopen log file
-		var err error
-		logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to reopen log file after rotation: %v\n", err)
-			return
-		}
+	// rotateLogFiles closes the current file; reopen the log even if the
+	// rotation fails part way so later messages are not lost
+	rotateErr := rotateLogFiles(logFilePath)
+	if rotateErr != nil {
+		// Can't log this error since we're in the logging system
+		fmt.Fprintf(os.Stderr, "Failed to rotate log files: %v\n", rotateErr)
+	}
 
-		// Update multi-writer
-		multiWriter = io.MultiWriter(logFile, os.Stderr)
-		log.SetOutput(multiWriter)
+	if err := openLogFile(logFilePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reopen log file after rotation: %v\n", err)
+		logFile = nil
+		setLogOutput()
+		return
+	}
 
-		LogInfo("Log file rotated")
+	if rotateErr == nil {
+		logger.Println(formatLogMessage(LogLevelInfo, "Log file rotated"))
 	}
 }
 
@@ -230,18 +529,21 @@ func GetLogFilePath() string {
 	return paths.GetUpdaterLogPath()
 }
 
-// GetRotatedLogFiles returns a list of all rotated log files
+// GetRotatedLogFiles returns a list of all rotated log files, plain or gzipped
 func GetRotatedLogFiles() []string {
-	logPath := paths.GetUpdaterLogPath()
-	logDir := filepath.Dir(logPath)
-	logBaseName := filepath.Base(logPath)
+	return rotatedLogFiles(paths.GetUpdaterLogPath())
+}
 
+// rotatedLogFiles returns the rotated files of logPath, newest first
+func rotatedLogFiles(logPath string) []string {
 	var rotatedFiles []string
 
-	for i := 1; i <= MaxLogFiles; i++ {
-		rotatedFile := filepath.Join(logDir, fmt.Sprintf("%s.%d", logBaseName, i))
-		if _, err := os.Stat(rotatedFile); err == nil {
-			rotatedFiles = append(rotatedFiles, rotatedFile)
+	for i := 1; i <= logMaxFiles; i++ {
+		rotatedFile := rotatedLogName(logPath, i)
+		for _, name := range []string{rotatedFile, rotatedFile + compressedLogSuffix} {
+			if _, err := os.Stat(name); err == nil {
+				rotatedFiles = append(rotatedFiles, name)
+			}
 		}
 	}
 
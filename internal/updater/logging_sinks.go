@@ -0,0 +1,106 @@
+package updater
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+const (
+	// LogSinkFile writes to updater.log in the data directory, with rotation
+	LogSinkFile = "file"
+
+	// LogSinkStderr writes to standard error, captured by systemd and launchd
+	LogSinkStderr = "stderr"
+
+	// LogSinkSyslog writes to syslog on Linux and macOS
+	LogSinkSyslog = "syslog"
+
+	// LogSinkEventLog writes to the Windows Event Log
+	LogSinkEventLog = "eventlog"
+
+	// systemLogSource is the syslog tag and Event Log source, registered for
+	// the Event Log when the service is installed
+	systemLogSource = "sentinelgo-updater"
+)
+
+// defaultLogSinks are used when logSinks is not configured
+var defaultLogSinks = []string{LogSinkFile, LogSinkStderr}
+
+// validLogSink reports whether name is a known sink
+func validLogSink(name string) bool {
+	switch name {
+	case LogSinkFile, LogSinkStderr, LogSinkSyslog, LogSinkEventLog:
+		return true
+	}
+	return false
+}
+
+// systemLogSink writes a message to the OS log at the matching severity
+type systemLogSink interface {
+	write(level LogLevel, message string) error
+	Close() error
+}
+
+// systemLogWriter adapts a systemLogSink to the writer used by the standard
+// logger, recovering each line's level from its "[LEVEL]" tag
+type systemLogWriter struct {
+	sink systemLogSink
+}
+
+func (w systemLogWriter) Write(p []byte) (int, error) {
+	level, message := splitLogLine(strings.TrimRight(string(p), "\n"))
+	return len(p), w.sink.write(level, message)
+}
+
+func (w systemLogWriter) Close() error {
+	return w.sink.Close()
+}
+
+// splitLogLine splits a line made by formatLogMessage into its level and
+// message, dropping the timestamp the OS log records itself
+func splitLogLine(line string) (LogLevel, string) {
+	parts := strings.SplitN(line, "] [", 2)
+	if len(parts) == 2 {
+		if end := strings.Index(parts[1], "] "); end >= 0 {
+			level := LogLevel(parts[1][:end])
+			if _, ok := logLevelRanks[level]; ok {
+				return level, parts[1][end+2:]
+			}
+		}
+	}
+	return LogLevelInfo, line
+}
+
+// readLogSinks returns the sinks configured in the config file at
+// configPath, without unknown names, falling back to the defaults
+func readLogSinks(configPath string) []string {
+	var settings struct {
+		LogSinks []string `json:"logSinks"`
+	}
+	if data, err := os.ReadFile(configPath); err == nil {
+		json.Unmarshal(data, &settings)
+	}
+
+	var sinks []string
+	for _, name := range settings.LogSinks {
+		name = strings.ToLower(name)
+		if validLogSink(name) {
+			sinks = append(sinks, name)
+		}
+	}
+	if len(sinks) == 0 {
+		return defaultLogSinks
+	}
+	return sinks
+}
+
+// hasLogSink reports whether sink is enabled. The caller holds logMu.
+func hasLogSink(sink string) bool {
+	for _, name := range logSinks {
+		if name == sink {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package updater
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink writes to the local syslog daemon, which forwards to the
+// unified log on macOS
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func (s syslogSink) write(level LogLevel, message string) error {
+	switch level {
+	case LogLevelDebug:
+		return s.writer.Debug(message)
+	case LogLevelWarning:
+		return s.writer.Warning(message)
+	case LogLevelError:
+		return s.writer.Err(message)
+	case LogLevelCritical:
+		return s.writer.Crit(message)
+	default:
+		return s.writer.Info(message)
+	}
+}
+
+func (s syslogSink) Close() error {
+	return s.writer.Close()
+}
+
+// openSystemLog opens the OS log named by sink
+func openSystemLog(sink string) (systemLogSink, error) {
+	if sink != LogSinkSyslog {
+		return nil, fmt.Errorf("log sink %q is only available on Windows", sink)
+	}
+
+	writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, systemLogSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return syslogSink{writer: writer}, nil
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventLogID is the event ID used for every updater message
+const eventLogID = 1
+
+// eventLogSink writes to the Application log under the service's source.
+// The Event Log has no debug or critical types, so those map to
+// information and error.
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+func (s eventLogSink) write(level LogLevel, message string) error {
+	switch level {
+	case LogLevelWarning:
+		return s.log.Warning(eventLogID, message)
+	case LogLevelError, LogLevelCritical:
+		return s.log.Error(eventLogID, message)
+	default:
+		return s.log.Info(eventLogID, message)
+	}
+}
+
+func (s eventLogSink) Close() error {
+	return s.log.Close()
+}
+
+// openSystemLog opens the OS log named by sink
+func openSystemLog(sink string) (systemLogSink, error) {
+	if sink != LogSinkEventLog {
+		return nil, fmt.Errorf("log sink %q is not available on Windows", sink)
+	}
+
+	log, err := eventlog.Open(systemLogSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the event log: %w", err)
+	}
+	return eventLogSink{log: log}, nil
+}
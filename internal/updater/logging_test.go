@@ -0,0 +1,392 @@
+package updater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeLog writes content to path, failing the test on error
+func writeLog(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// TestRotateLogFilesCompresses verifies that the rotated log is gzipped,
+// older plain and compressed files shift together, and the current log is
+// left for a fresh uncompressed file
+func TestRotateLogFilesCompresses(t *testing.T) {
+	withConfig(t, &UpdaterConfig{CompressRotatedLogs: true})
+
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	writeLog(t, logPath, "current\n")
+	writeLog(t, logPath+".1.gz", "compressed")
+	writeLog(t, logPath+".2", "plain")
+
+	if err := rotateLogFiles(logPath); err != nil {
+		t.Fatalf("rotateLogFiles() failed: %v", err)
+	}
+
+	want := []string{logPath + ".1.gz", logPath + ".2.gz", logPath + ".3"}
+	got := rotatedLogFiles(logPath)
+	if len(got) != len(want) {
+		t.Fatalf("rotatedLogFiles() = %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("rotatedLogFiles()[%d] = %s; want %s", i, got[i], want[i])
+		}
+	}
+
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("current log still exists after rotation: %v", err)
+	}
+
+	f, err := os.Open(logPath + ".1.gz")
+	if err != nil {
+		t.Fatalf("failed to open rotated log: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("rotated log is not gzipped: %v", err)
+	}
+	content, _ := io.ReadAll(zr)
+	if string(content) != "current\n" {
+		t.Errorf("rotated log content = %q; want %q", content, "current\n")
+	}
+}
+
+// TestRotateLogFilesUncompressed verifies that compression can be disabled
+func TestRotateLogFilesUncompressed(t *testing.T) {
+	withConfig(t, &UpdaterConfig{CompressRotatedLogs: false})
+
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	writeLog(t, logPath, "current\n")
+
+	if err := rotateLogFiles(logPath); err != nil {
+		t.Fatalf("rotateLogFiles() failed: %v", err)
+	}
+	if got := rotatedLogFiles(logPath); len(got) != 1 || got[0] != logPath+".1" {
+		t.Errorf("rotatedLogFiles() = %v; want [%s.1]", got, logPath)
+	}
+}
+
+// TestReadLogLimits verifies that log limits are read from the config file
+// and invalid values fall back to the defaults
+func TestReadLogLimits(t *testing.T) {
+	tests := []struct {
+		content   string
+		wantSize  int64
+		wantFiles int
+	}{
+		{`{"maxLogSizeMB": 50, "maxLogFiles": 10}`, 50 * 1024 * 1024, 10},
+		{`{"maxLogSizeMB": 0, "maxLogFiles": -1}`, MaxLogFileSize, MaxLogFiles},
+		{`{not json`, MaxLogFileSize, MaxLogFiles},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		writeLog(t, configPath, tt.content)
+
+		size, files := readLogLimits(configPath)
+		if size != tt.wantSize || files != tt.wantFiles {
+			t.Errorf("readLogLimits(%s) = %d, %d; want %d, %d", tt.content, size, files, tt.wantSize, tt.wantFiles)
+		}
+	}
+}
+
+// TestRotateLogFilesPrunesAfterLimitReduced verifies that lowering the file
+// count removes rotated files beyond the new limit and keeps the rest in order
+func TestRotateLogFilesPrunesAfterLimitReduced(t *testing.T) {
+	withConfig(t, &UpdaterConfig{CompressRotatedLogs: false})
+	original := logMaxFiles
+	logMaxFiles = 2
+	t.Cleanup(func() { logMaxFiles = original })
+
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	writeLog(t, logPath, "current\n")
+	for _, name := range []string{".1", ".2.gz", ".3", ".4.gz", ".5"} {
+		writeLog(t, logPath+name, name)
+	}
+
+	if err := rotateLogFiles(logPath); err != nil {
+		t.Fatalf("rotateLogFiles() failed: %v", err)
+	}
+
+	matches, _ := filepath.Glob(logPath + ".*")
+	want := []string{logPath + ".1", logPath + ".2"}
+	if len(matches) != len(want) || matches[0] != want[0] || matches[1] != want[1] {
+		t.Errorf("rotated files = %v; want %v", matches, want)
+	}
+	if content, _ := os.ReadFile(logPath + ".2"); string(content) != ".1" {
+		t.Errorf("%s.2 content = %q; want the previous .1", logPath, content)
+	}
+}
+
+// TestLogEnabled verifies the minimum level filter, including the info
+// default for an unset level and critical messages always passing
+func TestLogEnabled(t *testing.T) {
+	tests := []struct {
+		minimum string
+		level   LogLevel
+		want    bool
+	}{
+		{"", LogLevelDebug, false},
+		{"", LogLevelInfo, true},
+		{"debug", LogLevelDebug, true},
+		{"warning", LogLevelInfo, false},
+		{"warn", LogLevelWarning, true},
+		{"error", LogLevelWarning, false},
+		{"error", LogLevelCritical, true},
+	}
+
+	for _, tt := range tests {
+		withConfig(t, &UpdaterConfig{LogLevel: tt.minimum})
+		if got := logEnabled(tt.level); got != tt.want {
+			t.Errorf("logEnabled(%s) with logLevel %q = %v; want %v", tt.level, tt.minimum, got, tt.want)
+		}
+	}
+}
+
+// saveLogger silences the console and restores the logger state when the
+// test ends
+func saveLogger(t *testing.T) {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	origFile, origPath, origInitialized := logFile, logFilePath, initialized
+	origWriter, origConsole := logger.Writer(), logConsole
+	origSinks, origSystemLog := logSinks, systemLog
+	origMaxSize, origMaxFiles := logMaxSize, logMaxFiles
+	t.Cleanup(func() {
+		logMu.Lock()
+		defer logMu.Unlock()
+		if logFile != nil {
+			logFile.Close()
+		}
+		logFile, logFilePath, initialized = origFile, origPath, origInitialized
+		logConsole, logMaxSize, logMaxFiles = origConsole, origMaxSize, origMaxFiles
+		logSinks, systemLog = origSinks, origSystemLog
+		logger.SetOutput(origWriter)
+	})
+
+	logConsole = io.Discard
+	logFile, initialized = nil, false
+	logSinks, systemLog = defaultLogSinks, nil
+	logger.SetOutput(logConsole)
+}
+
+// useTestLog points the logger at logPath with the given limits and no
+// console output, restoring the previous logger when the test ends
+func useTestLog(t *testing.T, logPath string, maxSize int64, maxFiles int) {
+	saveLogger(t)
+
+	logMu.Lock()
+	defer logMu.Unlock()
+	logMaxSize, logMaxFiles = maxSize, maxFiles
+	if err := openLogFile(logPath); err != nil {
+		t.Fatal(err)
+	}
+	initialized = true
+}
+
+// TestConcurrentLoggingDuringRotation verifies that messages logged from many
+// goroutines while the log keeps rotating all reach a log file
+func TestConcurrentLoggingDuringRotation(t *testing.T) {
+	withConfig(t, &UpdaterConfig{LogLevel: "info"})
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	useTestLog(t, logPath, 4096, 500)
+
+	const goroutines, messages = 20, 100
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				LogInfo("hammer goroutine %d message %d", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	rotated := rotatedLogFiles(logPath)
+	if len(rotated) < 2 {
+		t.Fatalf("rotatedLogFiles() = %d files; want the log to rotate several times", len(rotated))
+	}
+
+	count := 0
+	for _, path := range append(rotated, logPath) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count += bytes.Count(data, []byte("hammer goroutine"))
+	}
+	if count != goroutines*messages {
+		t.Errorf("logged messages = %d; want %d", count, goroutines*messages)
+	}
+}
+
+// TestInitLoggerConcurrent verifies that concurrent initialization opens the
+// log once, and that logging can be initialized again after CloseLogger
+func TestInitLoggerConcurrent(t *testing.T) {
+	withConfig(t, &UpdaterConfig{LogLevel: "info"})
+	saveLogger(t)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "updater.log")
+	configPath := filepath.Join(dir, "updater-config.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := initLogger(logPath, configPath); err != nil {
+				t.Errorf("initLogger() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := CloseLogger(); err != nil {
+		t.Fatalf("CloseLogger() failed: %v", err)
+	}
+
+	if err := initLogger(logPath, configPath); err != nil {
+		t.Fatalf("initLogger() after close failed: %v", err)
+	}
+	LogInfo("logged after reopening")
+	if err := CloseLogger(); err != nil {
+		t.Fatalf("CloseLogger() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bytes.Count(data, []byte("Logging system initialized")); got != 2 {
+		t.Errorf("initializations logged = %d; want 2", got)
+	}
+	if !bytes.Contains(data, []byte("logged after reopening")) {
+		t.Error("message logged after reopening is missing")
+	}
+}
+
+// recordingSink records the messages written to a system log sink
+type recordingSink struct {
+	levels   []LogLevel
+	messages []string
+}
+
+func (s *recordingSink) write(level LogLevel, message string) error {
+	s.levels = append(s.levels, level)
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+// TestSystemLogWriterLevels verifies that messages reach a system log sink
+// at their own level, without the timestamp
+func TestSystemLogWriterLevels(t *testing.T) {
+	withConfig(t, &UpdaterConfig{LogLevel: "info"})
+	useTestLog(t, filepath.Join(t.TempDir(), "updater.log"), MaxLogFileSize, MaxLogFiles)
+	sink := &recordingSink{}
+	logMu.Lock()
+	systemLog = systemLogWriter{sink: sink}
+	setLogOutput()
+	logMu.Unlock()
+
+	LogWarning("disk nearly full")
+	LogCritical("rollback failed")
+
+	wantLevels := []LogLevel{LogLevelWarning, LogLevelCritical}
+	wantMessages := []string{"disk nearly full", "rollback failed"}
+	if len(sink.messages) != len(wantMessages) {
+		t.Fatalf("sink messages = %q; want %q", sink.messages, wantMessages)
+	}
+	for i := range wantMessages {
+		if sink.levels[i] != wantLevels[i] || sink.messages[i] != wantMessages[i] {
+			t.Errorf("sink message %d = %s %q; want %s %q", i, sink.levels[i], sink.messages[i], wantLevels[i], wantMessages[i])
+		}
+	}
+}
+
+// TestReadLogSinks verifies that unknown sinks are dropped and an empty list
+// falls back to the defaults
+func TestReadLogSinks(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{}`, "file stderr"},
+		{`{"logSinks": ["File", "syslog"]}`, "file syslog"},
+		{`{"logSinks": ["journal"]}`, "file stderr"},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		writeLog(t, configPath, tt.config)
+		if got := strings.Join(readLogSinks(configPath), " "); got != tt.want {
+			t.Errorf("readLogSinks(%s) = %s; want %s", tt.config, got, tt.want)
+		}
+	}
+}
+
+// TestInitLoggerWithoutFileSink verifies that no log file is written when
+// the file sink is not enabled
+func TestInitLoggerWithoutFileSink(t *testing.T) {
+	withConfig(t, &UpdaterConfig{LogLevel: "info"})
+	saveLogger(t)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "updater.log")
+	configPath := filepath.Join(dir, "updater-config.json")
+	writeLog(t, configPath, `{"logSinks": ["stderr"]}`)
+
+	if err := initLogger(logPath, configPath); err != nil {
+		t.Fatalf("initLogger() failed: %v", err)
+	}
+	LogInfo("console only")
+	if err := CloseLogger(); err != nil {
+		t.Fatalf("CloseLogger() failed: %v", err)
+	}
+
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("log file exists with only the stderr sink: %v", err)
+	}
+}
+
+// TestInitLoggerLogsBuildInfo verifies that the build set by SetBuildInfo is
+// named among the startup lines of the log
+func TestInitLoggerLogsBuildInfo(t *testing.T) {
+	saveLogger(t)
+	originalVersion, originalBuild := UpdaterVersion, updaterBuild
+	t.Cleanup(func() { UpdaterVersion, updaterBuild = originalVersion, originalBuild })
+	SetBuildInfo("v2.3.4", "a1b2c3d", "2026-10-01T12:00:00Z")
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "updater.log")
+	if err := initLogger(logPath, filepath.Join(dir, "updater-config.json")); err != nil {
+		t.Fatalf("initLogger() failed: %v", err)
+	}
+	if err := CloseLogger(); err != nil {
+		t.Fatalf("CloseLogger() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[INFO] Updater v2.3.4 (commit a1b2c3d, built 2026-10-01T12:00:00Z)"; !strings.Contains(string(data), want) {
+		t.Errorf("startup log does not contain %q:\n%s", want, data)
+	}
+}
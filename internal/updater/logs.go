@@ -0,0 +1,218 @@
+package updater
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// maxLogLineBytes bounds the length of a log line read back
+const maxLogLineBytes = 1024 * 1024
+
+// logFollowInterval is how often a followed log is checked for new lines; it
+// is a variable so tests can shorten it
+var logFollowInterval = 500 * time.Millisecond
+
+// UpdaterLogFile is the current or a rotated updater log file
+type UpdaterLogFile struct {
+	Path       string
+	Size       int64
+	ModTime    time.Time
+	Compressed bool
+}
+
+// ListUpdaterLogs returns the current updater log and its rotated files,
+// newest first
+func ListUpdaterLogs() ([]UpdaterLogFile, error) {
+	return listLogFiles(paths.GetUpdaterLogPath())
+}
+
+// TailUpdaterLog writes the last lines lines of the updater log to w
+func TailUpdaterLog(w io.Writer, lines int) error {
+	return tailLog(w, paths.GetUpdaterLogPath(), lines)
+}
+
+// FollowUpdaterLog writes lines as they are appended to the updater log to
+// w until ctx is done
+func FollowUpdaterLog(ctx context.Context, w io.Writer) error {
+	logPath := paths.GetUpdaterLogPath()
+	info, err := os.Stat(logPath)
+	if err != nil {
+		return err
+	}
+	return followLog(ctx, w, logPath, info.Size())
+}
+
+// logFilePaths returns logPath followed by its rotated files, newest first.
+// Unlike rotatedLogFiles it does not depend on maxLogFiles, which the CLI
+// does not read: rotated files are numbered from 1 without gaps.
+func logFilePaths(logPath string) []string {
+	files := []string{logPath}
+	for i := 1; ; i++ {
+		rotated := rotatedLogName(logPath, i)
+		found := false
+		for _, name := range []string{rotated, rotated + compressedLogSuffix} {
+			if _, err := os.Stat(name); err == nil {
+				files = append(files, name)
+				found = true
+			}
+		}
+		if !found {
+			return files
+		}
+	}
+}
+
+// listLogFiles describes the files of logPath that exist
+func listLogFiles(logPath string) ([]UpdaterLogFile, error) {
+	var files []UpdaterLogFile
+	for _, path := range logFilePaths(logPath) {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, UpdaterLogFile{
+			Path:       path,
+			Size:       info.Size(),
+			ModTime:    info.ModTime(),
+			Compressed: strings.HasSuffix(path, compressedLogSuffix),
+		})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no updater log at %s", logPath)
+	}
+	return files, nil
+}
+
+// tailLog writes the last lines lines of the log at logPath to w. When the
+// current file is shorter, the lines before it are read from the rotated
+// files, gzipped or not.
+func tailLog(w io.Writer, logPath string, lines int) error {
+	files, err := listLogFiles(logPath)
+	if err != nil {
+		return err
+	}
+
+	var chunks [][]string
+	needed := lines
+	for _, file := range files {
+		if needed <= 0 {
+			break
+		}
+		last, err := lastLogLines(file, needed)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, last)
+		needed -= len(last)
+	}
+
+	for i := len(chunks) - 1; i >= 0; i-- {
+		for _, line := range chunks[i] {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lastLogLines returns up to the last n lines of file
+func lastLogLines(file UpdaterLogFile, n int) ([]string, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if file.Compressed {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", file.Path, err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	// Keep a ring of the last n lines rather than the whole file
+	ring := make([]string, 0, n)
+	start := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineBytes)
+	for scanner.Scan() {
+		if len(ring) < n {
+			ring = append(ring, scanner.Text())
+			continue
+		}
+		ring[start] = scanner.Text()
+		start = (start + 1) % n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+	return append(ring[start:], ring[:start]...), nil
+}
+
+// followLog copies the log at logPath from offset, and what is appended to
+// it, to w until ctx is done. After a rotation the new file is followed from its start. The file
+// is only held open while it is read, so the updater can rotate it even on
+// Windows.
+func followLog(ctx context.Context, w io.Writer, logPath string, offset int64) error {
+	info, err := os.Stat(logPath)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// A missing file has been rotated away and not yet recreated
+		current, err := os.Stat(logPath)
+		if err != nil {
+			continue
+		}
+		if !os.SameFile(current, info) || current.Size() < offset {
+			offset = 0
+		}
+		info = current
+		if current.Size() == offset {
+			continue
+		}
+
+		copied, err := copyLogFrom(w, logPath, offset)
+		offset += copied
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+}
+
+// copyLogFrom copies the log at logPath from offset to w
+func copyLogFrom(w io.Writer, logPath string, offset int64) (int64, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, file)
+}
@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTailLogRotated verifies that the tail continues into rotated files,
+// gzipped or not, when the current log is shorter
+func TestTailLogRotated(t *testing.T) {
+	withConfig(t, &UpdaterConfig{CompressRotatedLogs: true})
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+
+	writeLog(t, logPath, "one\ntwo\n")
+	if err := rotateLogFiles(logPath); err != nil {
+		t.Fatalf("rotateLogFiles() failed: %v", err)
+	}
+	writeLog(t, logPath, "three\nfour\nfive\n")
+	if err := rotateLogFiles(logPath); err != nil {
+		t.Fatalf("rotateLogFiles() failed: %v", err)
+	}
+	writeLog(t, logPath, "six\nseven\n")
+
+	files, err := listLogFiles(logPath)
+	if err != nil || len(files) != 3 || !files[1].Compressed || files[2].Path != logPath+".2.gz" {
+		t.Fatalf("listLogFiles() = %+v, %v; want the log, .1.gz and .2.gz", files, err)
+	}
+
+	tests := map[int]string{
+		1:  "seven\n",
+		4:  "four\nfive\nsix\nseven\n",
+		10: "one\ntwo\nthree\nfour\nfive\nsix\nseven\n",
+	}
+	for lines, want := range tests {
+		var out bytes.Buffer
+		if err := tailLog(&out, logPath, lines); err != nil {
+			t.Fatalf("tailLog(%d) failed: %v", lines, err)
+		}
+		if out.String() != want {
+			t.Errorf("tailLog(%d) = %q; want %q", lines, out.String(), want)
+		}
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for a follower and a test to share
+type lockedBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+// TestFollowLogRotation verifies that only appended lines are followed, and
+// that the new file is followed from its start after a rotation
+func TestFollowLogRotation(t *testing.T) {
+	withConfig(t, &UpdaterConfig{CompressRotatedLogs: true})
+	original := logFollowInterval
+	logFollowInterval = time.Millisecond
+	t.Cleanup(func() { logFollowInterval = original })
+
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	writeLog(t, logPath, "before\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &lockedBuffer{}
+	done := make(chan error)
+	go func() { done <- followLog(ctx, out, logPath, int64(len("before\n"))) }()
+
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for out.String() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("followed %q; want %q", out.String(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	appendLog := func(line string) {
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatalf("failed to open log: %v", err)
+		}
+		f.WriteString(line)
+		f.Close()
+	}
+
+	appendLog("appended\n")
+	waitFor("appended\n")
+
+	if err := rotateLogFiles(logPath); err != nil {
+		t.Fatalf("rotateLogFiles() failed: %v", err)
+	}
+	appendLog("rotated\n")
+	waitFor("appended\nrotated\n")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("followLog() = %v; want nil", err)
+	}
+	if strings.Contains(out.String(), "before") {
+		t.Errorf("followed %q; want only appended lines", out.String())
+	}
+}
@@ -0,0 +1,59 @@
+package updater
+
+import (
+	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// machinePathRecordFileName records the directories the updater added to
+// the machine-wide PATH so they can be removed on uninstall
+const machinePathRecordFileName = "machine-path.json"
+
+// MachinePathRecord lists directories the updater appended to the machine PATH
+type MachinePathRecord struct {
+	Added []string `json:"added"`
+}
+
+// samePathEntry compares PATH entries the way Windows does: case-insensitive
+// and ignoring a trailing separator
+func samePathEntry(a, b string) bool {
+	trim := func(s string) string { return strings.TrimRight(strings.TrimSpace(s), `\/`) }
+	return strings.EqualFold(trim(a), trim(b))
+}
+
+// appendPathEntry appends dir to a ';'-separated PATH value unless it is
+// already listed, reporting whether it was added
+func appendPathEntry(pathList, dir string) (string, bool) {
+	for _, entry := range strings.Split(pathList, ";") {
+		if samePathEntry(entry, dir) {
+			return pathList, false
+		}
+	}
+
+	if pathList == "" {
+		return dir, true
+	}
+	return strings.TrimRight(pathList, ";") + ";" + dir, true
+}
+
+// removePathEntry removes every occurrence of dir from a ';'-separated PATH
+// value, reporting whether anything was removed
+func removePathEntry(pathList, dir string) (string, bool) {
+	var kept []string
+	removed := false
+	for _, entry := range strings.Split(pathList, ";") {
+		if samePathEntry(entry, dir) {
+			removed = true
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return strings.Join(kept, ";"), removed
+}
+
+// RevertMachinePath removes the GCC directories the updater added to the
+// machine-wide PATH; it is called when the updater is uninstalled
+func RevertMachinePath() error {
+	return revertMachinePath(paths.GetDataDirectory())
+}
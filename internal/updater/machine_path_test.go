@@ -0,0 +1,39 @@
+package updater
+
+import "testing"
+
+// TestAppendPathEntry verifies that a directory is appended once and not
+// duplicated when it is already listed with different case or a trailing
+// separator
+func TestAppendPathEntry(t *testing.T) {
+	tests := []struct {
+		pathList  string
+		want      string
+		wantAdded bool
+	}{
+		{"", `C:\mingw64\bin`, true},
+		{`C:\Windows;C:\Windows\System32`, `C:\Windows;C:\Windows\System32;C:\mingw64\bin`, true},
+		{`C:\Windows;`, `C:\Windows;C:\mingw64\bin`, true},
+		{`C:\Windows;c:\MINGW64\bin\`, `C:\Windows;c:\MINGW64\bin\`, false},
+	}
+
+	for _, tt := range tests {
+		got, added := appendPathEntry(tt.pathList, `C:\mingw64\bin`)
+		if got != tt.want || added != tt.wantAdded {
+			t.Errorf("appendPathEntry(%q) = %q, %v; want %q, %v", tt.pathList, got, added, tt.want, tt.wantAdded)
+		}
+	}
+}
+
+// TestRemovePathEntry verifies that every occurrence of the directory is
+// removed and other entries are kept in order
+func TestRemovePathEntry(t *testing.T) {
+	got, removed := removePathEntry(`C:\Windows;C:\mingw64\bin;C:\Tools;C:\MinGW64\Bin\`, `C:\mingw64\bin`)
+	if got != `C:\Windows;C:\Tools` || !removed {
+		t.Errorf("removePathEntry() = %q, %v; want %q, true", got, removed, `C:\Windows;C:\Tools`)
+	}
+
+	if _, removed := removePathEntry(`C:\Windows`, `C:\mingw64\bin`); removed {
+		t.Error("removePathEntry() reported a removal for a missing entry")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package updater
+
+// persistMachinePath is only needed on Windows, where gcc may live outside PATH
+func persistMachinePath(dataDir, gccDir string) error {
+	return nil
+}
+
+// revertMachinePath is only needed on Windows
+func revertMachinePath(dataDir string) error {
+	return nil
+}
@@ -0,0 +1,140 @@
+//go:build windows
+
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// machineEnvironmentKey holds the machine-wide environment under HKLM
+const machineEnvironmentKey = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+
+const (
+	hwndBroadcast     = 0xFFFF
+	wmSettingChange   = 0x001A
+	smtoAbortIfHung   = 0x0002
+	settingChangeWait = 5000 // milliseconds
+)
+
+var procSendMessageTimeout = windows.NewLazySystemDLL("user32.dll").NewProc("SendMessageTimeoutW")
+
+// addRegistryPath appends dir to the Path value under root\keyPath unless it
+// is already present, preserving the value's REG_EXPAND_SZ type
+func addRegistryPath(root registry.Key, keyPath, dir string) (bool, error) {
+	return updateRegistryPath(root, keyPath, func(pathList string) (string, bool) {
+		return appendPathEntry(pathList, dir)
+	})
+}
+
+// removeRegistryPath removes dir from the Path value under root\keyPath
+func removeRegistryPath(root registry.Key, keyPath, dir string) (bool, error) {
+	return updateRegistryPath(root, keyPath, func(pathList string) (string, bool) {
+		return removePathEntry(pathList, dir)
+	})
+}
+
+func updateRegistryPath(root registry.Key, keyPath string, update func(string) (string, bool)) (bool, error) {
+	key, err := registry.OpenKey(root, keyPath, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return false, fmt.Errorf("failed to open registry key %s: %w", keyPath, err)
+	}
+	defer key.Close()
+
+	pathList, valueType, err := key.GetStringValue("Path")
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return false, fmt.Errorf("failed to read Path: %w", err)
+	}
+
+	newPathList, changed := update(pathList)
+	if !changed {
+		return false, nil
+	}
+
+	if valueType == registry.SZ {
+		err = key.SetStringValue("Path", newPathList)
+	} else {
+		err = key.SetExpandStringValue("Path", newPathList)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write Path: %w", err)
+	}
+	return true, nil
+}
+
+// broadcastEnvironmentChange tells running processes, including the service
+// control manager, to reload the environment
+func broadcastEnvironmentChange() {
+	environment, err := windows.UTF16PtrFromString("Environment")
+	if err != nil {
+		return
+	}
+	var result uintptr
+	procSendMessageTimeout.Call(
+		hwndBroadcast,
+		wmSettingChange,
+		0,
+		uintptr(unsafe.Pointer(environment)),
+		smtoAbortIfHung,
+		settingChangeWait,
+		uintptr(unsafe.Pointer(&result)),
+	)
+}
+
+// persistMachinePath appends gccDir to the machine-wide PATH so it survives
+// restarts and is inherited by the agent service, recording the change in
+// dataDir so RevertMachinePath can undo it
+func persistMachinePath(dataDir, gccDir string) error {
+	added, err := addRegistryPath(registry.LOCAL_MACHINE, machineEnvironmentKey, gccDir)
+	if err != nil {
+		return err
+	}
+	if !added {
+		LogInfo("GCC directory already on the machine PATH: %s", gccDir)
+		return nil
+	}
+
+	recordPath := filepath.Join(dataDir, machinePathRecordFileName)
+	var record MachinePathRecord
+	if _, err := readJSONFile(recordPath, &record); err != nil {
+		LogWarning("Failed to read %s: %v", machinePathRecordFileName, err)
+	}
+	record.Added = append(record.Added, gccDir)
+	if err := writeJSONFile(recordPath, &record); err != nil {
+		LogWarning("Failed to record machine PATH change: %v", err)
+	}
+
+	broadcastEnvironmentChange()
+	LogInfo("Added GCC directory to the machine PATH: %s", gccDir)
+	return nil
+}
+
+// revertMachinePath removes the directories recorded in dataDir from the
+// machine-wide PATH
+func revertMachinePath(dataDir string) error {
+	recordPath := filepath.Join(dataDir, machinePathRecordFileName)
+	var record MachinePathRecord
+	found, err := readJSONFile(recordPath, &record)
+	if err != nil || !found {
+		return err
+	}
+
+	for _, dir := range record.Added {
+		if _, err := removeRegistryPath(registry.LOCAL_MACHINE, machineEnvironmentKey, dir); err != nil {
+			return err
+		}
+		LogInfo("Removed %s from the machine PATH", dir)
+	}
+
+	broadcastEnvironmentChange()
+	if err := os.Remove(recordPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
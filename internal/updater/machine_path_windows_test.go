@@ -0,0 +1,83 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// scratchEnvironmentKey creates a temporary key under HKCU with a Path value
+func scratchEnvironmentKey(t *testing.T, pathList string) string {
+	keyPath := fmt.Sprintf(`Software\SentinelGoUpdaterTest\%d`, time.Now().UnixNano())
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, keyPath, registry.ALL_ACCESS)
+	if err != nil {
+		t.Fatalf("failed to create scratch key: %v", err)
+	}
+	defer key.Close()
+	t.Cleanup(func() { registry.DeleteKey(registry.CURRENT_USER, keyPath) })
+
+	if err := key.SetExpandStringValue("Path", pathList); err != nil {
+		t.Fatalf("failed to set Path: %v", err)
+	}
+	return keyPath
+}
+
+// TestAddRegistryPathIdempotent verifies that repeated runs add the directory
+// once and keep the REG_EXPAND_SZ type
+func TestAddRegistryPathIdempotent(t *testing.T) {
+	keyPath := scratchEnvironmentKey(t, `%SystemRoot%;%SystemRoot%\System32`)
+
+	for i, wantAdded := range []bool{true, false, false} {
+		added, err := addRegistryPath(registry.CURRENT_USER, keyPath, `C:\mingw64\bin`)
+		if err != nil {
+			t.Fatalf("addRegistryPath() run %d failed: %v", i+1, err)
+		}
+		if added != wantAdded {
+			t.Errorf("addRegistryPath() run %d = %v; want %v", i+1, added, wantAdded)
+		}
+	}
+
+	key, err := registry.OpenKey(registry.CURRENT_USER, keyPath, registry.QUERY_VALUE)
+	if err != nil {
+		t.Fatalf("failed to open scratch key: %v", err)
+	}
+	defer key.Close()
+
+	value, valueType, err := key.GetStringValue("Path")
+	if err != nil {
+		t.Fatalf("failed to read Path: %v", err)
+	}
+	if want := `%SystemRoot%;%SystemRoot%\System32;C:\mingw64\bin`; value != want {
+		t.Errorf("Path = %q; want %q", value, want)
+	}
+	if valueType != registry.EXPAND_SZ {
+		t.Errorf("Path type = %d; want REG_EXPAND_SZ", valueType)
+	}
+}
+
+// TestRemoveRegistryPath verifies that removing the directory restores the
+// original value
+func TestRemoveRegistryPath(t *testing.T) {
+	keyPath := scratchEnvironmentKey(t, `C:\Windows`)
+
+	if _, err := addRegistryPath(registry.CURRENT_USER, keyPath, `C:\mingw64\bin`); err != nil {
+		t.Fatalf("addRegistryPath() failed: %v", err)
+	}
+	removed, err := removeRegistryPath(registry.CURRENT_USER, keyPath, `C:\mingw64\bin`)
+	if err != nil || !removed {
+		t.Fatalf("removeRegistryPath() = %v, %v; want true, nil", removed, err)
+	}
+
+	key, err := registry.OpenKey(registry.CURRENT_USER, keyPath, registry.QUERY_VALUE)
+	if err != nil {
+		t.Fatalf("failed to open scratch key: %v", err)
+	}
+	defer key.Close()
+	if value, _, _ := key.GetStringValue("Path"); value != `C:\Windows` {
+		t.Errorf("Path = %q; want C:\\Windows", value)
+	}
+}
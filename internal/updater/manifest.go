@@ -0,0 +1,216 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// manifestFileName caches the last manifest and its ETag in the data
+	// directory
+	manifestFileName = "manifest.json"
+
+	// manifestStaleLimit is how long a cached manifest stands in for one the
+	// server cannot deliver
+	manifestStaleLimit = 24 * time.Hour
+
+	// ResolverManifest marks a version check answered by the update manifest
+	ResolverManifest = "manifest"
+)
+
+// UpdateManifest is the document served at manifestURL that decides which
+// agent version this host runs
+type UpdateManifest struct {
+	Version           string        `json:"version,omitempty"`
+	Channel           UpdateChannel `json:"channel,omitempty"`
+	MinUpdaterVersion string        `json:"minUpdaterVersion,omitempty"`
+	RolloutPercent    *int          `json:"rolloutPercent,omitempty"`
+	Paused            bool          `json:"paused,omitempty"`
+}
+
+// cachedManifest is a manifest as last fetched, with what is needed to ask
+// the server whether it changed
+type cachedManifest struct {
+	Manifest  UpdateManifest `json:"manifest"`
+	ETag      string         `json:"etag,omitempty"`
+	FetchedAt time.Time      `json:"fetchedAt"`
+}
+
+// validate checks the fields the updater acts on
+func (m *UpdateManifest) validate() error {
+	if m.Version != "" {
+		if _, ok := parseVersion(m.Version); !ok {
+			return fmt.Errorf("version %q is not a semantic version", m.Version)
+		}
+	}
+	if m.Channel != "" && !m.Channel.valid() {
+		return fmt.Errorf("unknown channel %q", m.Channel)
+	}
+	if m.Version == "" && m.Channel == "" && !m.Paused {
+		return fmt.Errorf("manifest names neither a version nor a channel")
+	}
+	if m.RolloutPercent != nil && (*m.RolloutPercent < 0 || *m.RolloutPercent > 100) {
+		return fmt.Errorf("rolloutPercent %d is not between 0 and 100", *m.RolloutPercent)
+	}
+	return nil
+}
+
+// deferral returns why the manifest holds back an update, or ""
+func (m *UpdateManifest) deferral() string {
+	if m.Paused {
+		return "updates are paused by the update manifest"
+	}
+	if m.MinUpdaterVersion == "" {
+		return ""
+	}
+	if _, ok := parseVersion(UpdaterVersion); !ok {
+		LogDebug("Updater version %s cannot be compared with minUpdaterVersion %s", UpdaterVersion, m.MinUpdaterVersion)
+		return ""
+	}
+	if isNewerVersion(UpdaterVersion, m.MinUpdaterVersion) {
+		return fmt.Sprintf("the update manifest needs updater %s or newer, this is %s", m.MinUpdaterVersion, UpdaterVersion)
+	}
+	return ""
+}
+
+// fetchManifest returns the manifest at config.ManifestURL, asking the
+// server only whether it changed since the copy cached in dataDir. When the
+// server is unreachable or failing, a cached copy younger than
+// manifestStaleLimit is used instead; a rejected token or a malformed
+// manifest is always an error.
+func fetchManifest(client *http.Client, config *UpdaterConfig, dataDir string) (*UpdateManifest, error) {
+	cachePath := filepath.Join(dataDir, manifestFileName)
+	var cached cachedManifest
+	found, err := readJSONFile(cachePath, &cached)
+	if err != nil {
+		LogWarning("Cached update manifest unreadable: %v", err)
+		found = false
+	}
+
+	manifest, etag, err := requestManifest(client, config, cached.ETag, found)
+	if err != nil {
+		var unavailable *manifestUnavailableError
+		if !errors.As(err, &unavailable) || !found {
+			return nil, err
+		}
+		age := now().Sub(cached.FetchedAt)
+		if age > manifestStaleLimit {
+			return nil, fmt.Errorf("%w; the cached manifest is %v old", err, age.Round(time.Minute))
+		}
+		LogWarning("Using the update manifest cached %v ago: %v", age.Round(time.Minute), err)
+		return &cached.Manifest, nil
+	}
+
+	if manifest == nil {
+		LogDebug("Update manifest unchanged (ETag %s)", cached.ETag)
+		manifest = &cached.Manifest
+		etag = cached.ETag
+	}
+	cached = cachedManifest{Manifest: *manifest, ETag: etag, FetchedAt: now()}
+	if err := writeJSONFile(cachePath, cached); err != nil {
+		LogWarning("Failed to cache update manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// manifestUnavailableError is a failure to reach the manifest server that a
+// cached manifest may cover for
+type manifestUnavailableError struct {
+	err error
+}
+
+func (e *manifestUnavailableError) Error() string { return e.err.Error() }
+func (e *manifestUnavailableError) Unwrap() error { return e.err }
+
+// requestManifest fetches the manifest, sending etag when a cached copy
+// exists. It returns a nil manifest when the server answers 304 Not
+// Modified.
+func requestManifest(client *http.Client, config *UpdaterConfig, etag string, conditional bool) (*UpdateManifest, string, error) {
+	req, err := http.NewRequest(http.MethodGet, config.ManifestURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "sentinel-updater")
+	if config.ManifestToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.ManifestToken)
+	}
+	if conditional && etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if isProxyAuthError(err.Error()) {
+			return nil, "", newProxyAuthError(config)
+		}
+		return nil, "", &manifestUnavailableError{fmt.Errorf("failed to fetch update manifest: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if err := checkProxyResponse(resp, config); err != nil {
+		return nil, "", err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		return nil, "", nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, "", fmt.Errorf("update manifest server rejected the request (%s), check manifestToken", resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, "", &manifestUnavailableError{fmt.Errorf("update manifest server returned %s", resp.Status)}
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", fmt.Errorf("update manifest server returned %s", resp.Status)
+	}
+
+	var manifest UpdateManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to parse update manifest: %w", err)
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid update manifest: %w", err)
+	}
+	return &manifest, resp.Header.Get("ETag"), nil
+}
+
+// checkManifestVersion answers a version check from the update manifest: the
+// version it names, or else the newest version on its channel
+func checkManifestVersion(goBinary string, config *UpdaterConfig, dataDir string) (*VersionCheck, error) {
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := fetchManifest(client, config, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Paused {
+		LogWarning("The update manifest pauses updates")
+	}
+
+	if manifest.Version == "" && manifest.Channel != "" {
+		channelConfig := *config
+		channelConfig.Channel = manifest.Channel
+		check, err := resolveVersion(goBinary, config.AgentModule, &channelConfig)
+		if check != nil {
+			check.Manifest = manifest
+		}
+		return check, err
+	}
+
+	channel := manifest.Channel
+	if channel == "" {
+		channel = config.Channel
+	}
+	return &VersionCheck{
+		Module:    config.AgentModule,
+		Channel:   channel,
+		Selected:  manifest.Version,
+		Resolver:  ResolverManifest,
+		Manifest:  manifest,
+		CheckedAt: now(),
+	}, nil
+}
@@ -0,0 +1,165 @@
+package updater
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// manifestServer serves body with ETag etag to requests carrying token,
+// answering 304 when the client already has etag
+type manifestServer struct {
+	*httptest.Server
+	body        string
+	etag        string
+	status      int
+	notModified int
+}
+
+func newManifestServer(t *testing.T, token, body string) *manifestServer {
+	s := &manifestServer{body: body, etag: `"v1"`, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		if r.Header.Get("If-None-Match") == s.etag {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", s.etag)
+		fmt.Fprint(w, s.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// TestFetchManifestConditional verifies that an unchanged manifest is not
+// downloaded again and a changed one replaces the cached copy
+func TestFetchManifestConditional(t *testing.T) {
+	dataDir := t.TempDir()
+	server := newManifestServer(t, "s3cret", `{"version": "v1.2.0", "channel": "stable"}`)
+	config := &UpdaterConfig{ManifestURL: server.URL, ManifestToken: "s3cret"}
+
+	for i := 0; i < 2; i++ {
+		manifest, err := fetchManifest(server.Client(), config, dataDir)
+		if err != nil {
+			t.Fatalf("fetchManifest() #%d failed: %v", i+1, err)
+		}
+		if manifest.Version != "v1.2.0" {
+			t.Errorf("fetchManifest() #%d version = %q; want v1.2.0", i+1, manifest.Version)
+		}
+	}
+	if server.notModified != 1 {
+		t.Errorf("server answered 304 %d times; want 1", server.notModified)
+	}
+
+	server.body, server.etag = `{"version": "v1.3.0"}`, `"v2"`
+	manifest, err := fetchManifest(server.Client(), config, dataDir)
+	if err != nil || manifest.Version != "v1.3.0" {
+		t.Errorf("fetchManifest() after a change = %+v, %v; want v1.3.0", manifest, err)
+	}
+}
+
+// TestFetchManifestStale verifies that a cached manifest covers for a
+// failing server for a while, but never for a rejected token
+func TestFetchManifestStale(t *testing.T) {
+	current := fakeClock(t)
+	dataDir := t.TempDir()
+	server := newManifestServer(t, "s3cret", `{"version": "v1.2.0"}`)
+	config := &UpdaterConfig{ManifestURL: server.URL, ManifestToken: "s3cret"}
+	if _, err := fetchManifest(server.Client(), config, dataDir); err != nil {
+		t.Fatalf("fetchManifest() failed: %v", err)
+	}
+
+	server.status = http.StatusServiceUnavailable
+	*current = current.Add(time.Hour)
+	if manifest, err := fetchManifest(server.Client(), config, dataDir); err != nil || manifest.Version != "v1.2.0" {
+		t.Errorf("fetchManifest() while unavailable = %+v, %v; want the cached v1.2.0", manifest, err)
+	}
+	*current = current.Add(manifestStaleLimit)
+	if _, err := fetchManifest(server.Client(), config, dataDir); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("fetchManifest() with an expired cache = %v; want the 503 error", err)
+	}
+
+	server.status = http.StatusOK
+	config.ManifestToken = "wrong"
+	*current = current.Add(-manifestStaleLimit)
+	if _, err := fetchManifest(server.Client(), config, dataDir); err == nil || !strings.Contains(err.Error(), "manifestToken") {
+		t.Errorf("fetchManifest() with a rejected token = %v; want an error naming manifestToken", err)
+	}
+}
+
+// TestFetchManifestInvalid verifies that malformed or meaningless manifests
+// are errors
+func TestFetchManifestInvalid(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"version": "v1.2.0"`:   "failed to parse",
+		`{"version": "latest"}`:  "not a semantic version",
+		`{"channel": "nightly"}`: "unknown channel",
+		`{}`:                     "neither a version nor a channel",
+		`{"version": "v1.2.0", "rolloutPercent": 150}`: "not between 0 and 100",
+	} {
+		server := newManifestServer(t, "", body)
+		_, err := fetchManifest(server.Client(), &UpdaterConfig{ManifestURL: server.URL}, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("fetchManifest(%s) = %v; want an error containing %q", body, err, want)
+		}
+	}
+}
+
+// TestManifestDeferral verifies the pause flag, the minimum updater version,
+// and that a pinned version is installed even when it is a downgrade
+func TestManifestDeferral(t *testing.T) {
+	original := UpdaterVersion
+	t.Cleanup(func() { UpdaterVersion = original })
+	UpdaterVersion = "v1.4.0"
+
+	check := &VersionCheck{Channel: ChannelStable, Selected: "v1.1.0", Manifest: &UpdateManifest{Version: "v1.1.0"}}
+	if !check.needsUpdate("v1.2.0") {
+		t.Error("needsUpdate() of a pinned downgrade = false; want true")
+	}
+	if got := check.manifestDeferral(); got != "" {
+		t.Errorf("manifestDeferral() = %q; want none", got)
+	}
+
+	check.Manifest.Paused = true
+	if got := check.manifestDeferral(); !strings.Contains(got, "paused") {
+		t.Errorf("manifestDeferral(paused) = %q; want paused", got)
+	}
+
+	check.Manifest = &UpdateManifest{Version: "v1.1.0", MinUpdaterVersion: "v1.5.0"}
+	if got := check.manifestDeferral(); !strings.Contains(got, "v1.5.0") {
+		t.Errorf("manifestDeferral(minUpdaterVersion v1.5.0) = %q; want it named", got)
+	}
+	UpdaterVersion = "v1.5.0"
+	if got := check.manifestDeferral(); got != "" {
+		t.Errorf("manifestDeferral(updater v1.5.0) = %q; want none", got)
+	}
+}
+
+// TestCheckRolloutManifestPercent verifies that the manifest's rollout
+// percentage replaces the configured one
+func TestCheckRolloutManifestPercent(t *testing.T) {
+	config := defaultConfig()
+	config.RolloutBucket = 40
+	withConfig(t, config)
+
+	zero, half := 0, 50
+	check := &VersionCheck{Selected: "v1.2.0", Manifest: &UpdateManifest{Version: "v1.2.0", RolloutPercent: &zero}}
+	if got := checkRollout(check); !strings.Contains(got, "outside the first 0%") {
+		t.Errorf("checkRollout(rolloutPercent 0) = %q; want deferred", got)
+	}
+	check.Manifest.RolloutPercent = &half
+	if got := checkRollout(check); got != "" {
+		t.Errorf("checkRollout(rolloutPercent 50) = %q; want none", got)
+	}
+}
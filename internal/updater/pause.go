@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// pauseFileName holds the pause of automatic updates, if any, so that it
+// survives restarts and reboots
+const pauseFileName = "pause.json"
+
+// PauseRecord is a pause of automatic updates. Version checks keep running
+// while it holds; only installing is skipped.
+type PauseRecord struct {
+	PausedAt time.Time `json:"pausedAt"`
+	Until    time.Time `json:"until,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	By       string    `json:"by"`
+}
+
+// expired reports whether the pause has ended by itself at t
+func (p *PauseRecord) expired(t time.Time) bool {
+	return !p.Until.IsZero() && !t.Before(p.Until)
+}
+
+// String describes the pause for logs and the status command
+func (p *PauseRecord) String() string {
+	description := "paused by " + p.By
+	if p.Until.IsZero() {
+		description += " until resumed"
+	} else {
+		description += " until " + p.Until.Format(time.RFC3339)
+	}
+	if p.Reason != "" {
+		description += ": " + p.Reason
+	}
+	return description
+}
+
+// PauseUpdates pauses automatic updates for duration, or until resumed when
+// it is 0, and returns the pause recorded
+func PauseUpdates(duration time.Duration, reason string) (*PauseRecord, error) {
+	return pauseUpdates(paths.GetDataDirectory(), duration, reason, pausedBy())
+}
+
+// ResumeUpdates lifts the pause of automatic updates and returns it, or nil
+// when updates were not paused
+func ResumeUpdates() (*PauseRecord, error) {
+	return resumeUpdates(paths.GetDataDirectory())
+}
+
+// ReadPause returns the pause of automatic updates in effect, or nil
+func ReadPause() (*PauseRecord, error) {
+	return readPause(paths.GetDataDirectory())
+}
+
+func pauseUpdates(dataDir string, duration time.Duration, reason, by string) (*PauseRecord, error) {
+	if duration < 0 {
+		return nil, fmt.Errorf("pause duration %v is negative", duration)
+	}
+	pause := &PauseRecord{PausedAt: now(), Reason: reason, By: by}
+	if duration > 0 {
+		pause.Until = pause.PausedAt.Add(duration)
+	}
+	if err := writeJSONFile(filepath.Join(dataDir, pauseFileName), pause); err != nil {
+		return nil, fmt.Errorf("failed to record pause: %w", err)
+	}
+	return pause, nil
+}
+
+// resumeUpdates removes the pause in dataDir, even one that cannot be read
+func resumeUpdates(dataDir string) (*PauseRecord, error) {
+	pause, err := readPause(dataDir)
+	if err != nil {
+		pause = &PauseRecord{By: "unknown", Reason: "unreadable " + pauseFileName}
+	}
+	if err := os.Remove(filepath.Join(dataDir, pauseFileName)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove pause: %w", err)
+	}
+	return pause, nil
+}
+
+// readPause returns the pause recorded in dataDir, or nil when there is none
+// or it has expired
+func readPause(dataDir string) (*PauseRecord, error) {
+	var pause PauseRecord
+	found, err := readJSONFile(filepath.Join(dataDir, pauseFileName), &pause)
+	if err != nil || !found || pause.expired(now()) {
+		return nil, err
+	}
+	return &pause, nil
+}
+
+// activePause returns the pause in effect for the updater loop. An expired
+// pause is removed and logged as an automatic resume, and an unreadable one
+// is treated as a pause, since it was meant to keep the agent untouched.
+func activePause(dataDir string) *PauseRecord {
+	var pause PauseRecord
+	found, err := readJSONFile(filepath.Join(dataDir, pauseFileName), &pause)
+	if err != nil {
+		LogError("Failed to read pause, treating updates as paused: %v", err)
+		return &PauseRecord{By: "unknown", Reason: "unreadable " + pauseFileName}
+	}
+	if !found {
+		return nil
+	}
+	if pause.expired(now()) {
+		LogInfo("Pause set by %s expired at %s, resuming automatic updates", pause.By, pause.Until.Format(time.RFC3339))
+		if err := os.Remove(filepath.Join(dataDir, pauseFileName)); err != nil && !os.IsNotExist(err) {
+			LogWarning("Failed to remove expired pause: %v", err)
+		}
+		return nil
+	}
+	return &pause
+}
+
+// pausedBy names the user pausing updates from the command line: the user
+// who ran sudo, if any
+func pausedBy() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
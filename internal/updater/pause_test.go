@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPauseExpires verifies that a pause survives being read back, holds
+// until its end and is then removed as an automatic resume
+func TestPauseExpires(t *testing.T) {
+	clock := fakeClock(t)
+	dataDir := t.TempDir()
+
+	if _, err := pauseUpdates(dataDir, 48*time.Hour, "change freeze", "alice"); err != nil {
+		t.Fatalf("pauseUpdates() failed: %v", err)
+	}
+	*clock = clock.Add(47 * time.Hour)
+	pause := activePause(dataDir)
+	if pause == nil || pause.By != "alice" || pause.Reason != "change freeze" {
+		t.Fatalf("activePause() = %+v; want alice's change freeze", pause)
+	}
+
+	*clock = clock.Add(time.Hour)
+	if pause := activePause(dataDir); pause != nil {
+		t.Errorf("activePause() after 48h = %+v; want nil", pause)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, pauseFileName)); !os.IsNotExist(err) {
+		t.Errorf("expired pause was not removed: %v", err)
+	}
+}
+
+// TestPauseUntilResumed verifies that a pause without a duration holds until
+// resumed, and that resuming twice is not an error
+func TestPauseUntilResumed(t *testing.T) {
+	clock := fakeClock(t)
+	dataDir := t.TempDir()
+
+	if _, err := pauseUpdates(dataDir, 0, "", "bob"); err != nil {
+		t.Fatalf("pauseUpdates() failed: %v", err)
+	}
+	*clock = clock.Add(365 * 24 * time.Hour)
+	if pause, err := readPause(dataDir); err != nil || pause == nil || !pause.Until.IsZero() {
+		t.Fatalf("readPause() = %+v, %v; want a pause until resumed", pause, err)
+	}
+
+	if pause, err := resumeUpdates(dataDir); err != nil || pause == nil || pause.By != "bob" {
+		t.Errorf("resumeUpdates() = %+v, %v; want bob's pause", pause, err)
+	}
+	if pause, err := resumeUpdates(dataDir); err != nil || pause != nil {
+		t.Errorf("resumeUpdates() again = %+v, %v; want nil, nil", pause, err)
+	}
+}
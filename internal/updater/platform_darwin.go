@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"syscall"
 )
 
 // ensureHomeDirectory determines the home directory using multiple fallback strategies
@@ -34,29 +35,30 @@ func ensureHomeDirectory() (string, error) {
 	return "", fmt.Errorf("unable to determine home directory: all detection strategies failed")
 }
 
-// getPossibleBinaryPaths returns platform-specific possible paths for the sentinel binary
+// getPossibleBinaryPaths returns platform-specific possible paths for the agent binary
 func getPossibleBinaryPaths() []string {
 	var possiblePaths []string
+	binaryName := agentBinaryFileName()
 
 	// Method 1: Check GOPATH environment variable
 	if gopath := os.Getenv("GOPATH"); gopath != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(gopath, "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(gopath, "bin", binaryName))
 	}
 
 	// Method 2: Check SUDO_USER's home directory
 	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
 		userHome := filepath.Join("/Users", sudoUser)
-		possiblePaths = append(possiblePaths, filepath.Join(userHome, "go", "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(userHome, "go", "bin", binaryName))
 	}
 
 	// Method 3: Check current HOME
 	if home := os.Getenv("HOME"); home != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(home, "go", "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(home, "go", "bin", binaryName))
 	}
 
 	// Method 4: Try os.UserHomeDir()
 	if homeDir, err := os.UserHomeDir(); err == nil {
-		possiblePaths = append(possiblePaths, filepath.Join(homeDir, "go", "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(homeDir, "go", "bin", binaryName))
 	}
 
 	// Method 5: Scan /Users directory (macOS-specific)
@@ -64,10 +66,35 @@ func getPossibleBinaryPaths() []string {
 	if entries, err := os.ReadDir(usersDir); err == nil {
 		for _, entry := range entries {
 			if entry.IsDir() && entry.Name() != "Shared" && entry.Name() != "Guest" {
-				possiblePaths = append(possiblePaths, filepath.Join(usersDir, entry.Name(), "go", "bin", "sentinel"))
+				possiblePaths = append(possiblePaths, filepath.Join(usersDir, entry.Name(), "go", "bin", binaryName))
 			}
 		}
 	}
 
 	return possiblePaths
 }
+
+// processExists reports whether a process with the given PID is alive
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// diskFreeBytes returns the space available to unprivileged users on the volume holding path
+func diskFreeBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// volumeID identifies the filesystem holding path, so paths on the same
+// volume can share one free space check
+func volumeID(path string) (string, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(stat.Dev), nil
+}
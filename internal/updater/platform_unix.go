@@ -11,6 +11,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
 )
 
 // ensureHomeDirectory determines the home directory using multiple fallback strategies
@@ -34,28 +37,40 @@ func ensureHomeDirectory() (string, error) {
 	}
 
 	// Strategy 4: Parse /etc/passwd for current UID (Linux fallback)
-	if home, err := getHomeFromPasswd(); err == nil && home != "" {
+	home, err := getHomeFromPasswd()
+	if err == nil {
 		LogInfo("Home directory detected from /etc/passwd: %s", home)
 		return home, nil
 	}
 
-	// All strategies failed
-	return "", fmt.Errorf("unable to determine home directory: all detection strategies failed")
+	// Strategy 5: A UID without a passwd entry, common with LDAP through
+	// nsswitch and in distroless containers, gets a home in the data
+	// directory so updates can still build
+	home = filepath.Join(paths.GetDataDirectory(), "home")
+	LogWarning("No home directory found for UID %d (%v), using %s", os.Getuid(), err, home)
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return "", fmt.Errorf("unable to determine home directory: all detection strategies failed, and %s cannot be created: %w", home, err)
+	}
+	return home, nil
 }
 
 // getHomeFromPasswd reads /etc/passwd to find the home directory for the current UID
 func getHomeFromPasswd() (string, error) {
-	// Get current UID
-	uid := os.Getuid()
+	return findHomeInPasswd("/etc/passwd", os.Getuid())
+}
 
-	// Open /etc/passwd
-	file, err := os.Open("/etc/passwd")
+// findHomeInPasswd returns the home directory of the first entry for uid in
+// the passwd file at path whose home exists and is a directory. Duplicate
+// entries, as odd NSS setups in containers produce, are scanned past an
+// unusable home.
+func findHomeInPasswd(path string, uid int) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to open /etc/passwd: %w", err)
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
 	}
 	defer file.Close()
 
-	// Parse /etc/passwd line by line
+	entries := 0
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -71,50 +86,83 @@ func getHomeFromPasswd() (string, error) {
 			continue
 		}
 
-		// Check if UID matches
 		entryUID, err := strconv.Atoi(fields[2])
-		if err != nil {
+		if err != nil || entryUID != uid {
 			continue
 		}
+		entries++
 
-		if entryUID == uid {
-			homeDir := fields[5]
-			if homeDir != "" {
-				return homeDir, nil
-			}
+		homeDir := fields[5]
+		if homeDir == "" {
+			LogDebug("Skipping %s entry %s for UID %d: no home directory", path, fields[0], uid)
+			continue
 		}
+		if info, err := os.Stat(homeDir); err != nil || !info.IsDir() {
+			LogDebug("Skipping %s entry %s for UID %d: home %s is not a directory", path, fields[0], uid, homeDir)
+			continue
+		}
+		return homeDir, nil
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading /etc/passwd: %w", err)
+		return "", fmt.Errorf("error reading %s: %w", path, err)
 	}
 
-	return "", fmt.Errorf("home directory not found in /etc/passwd for UID %d", uid)
+	if entries > 0 {
+		return "", fmt.Errorf("none of the %d entries for UID %d in %s has an existing home directory", entries, uid, path)
+	}
+	return "", fmt.Errorf("no entry for UID %d in %s", uid, path)
 }
 
-// getPossibleBinaryPaths returns platform-specific possible paths for the sentinel binary
+// getPossibleBinaryPaths returns platform-specific possible paths for the agent binary
 func getPossibleBinaryPaths() []string {
 	var possiblePaths []string
+	binaryName := agentBinaryFileName()
 
 	// Method 1: Check GOPATH environment variable
 	if gopath := os.Getenv("GOPATH"); gopath != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(gopath, "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(gopath, "bin", binaryName))
 	}
 
 	// Method 2: Check current HOME
 	if home := os.Getenv("HOME"); home != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(home, "go", "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(home, "go", "bin", binaryName))
 	}
 
 	// Method 3: Try os.UserHomeDir()
 	if homeDir, err := os.UserHomeDir(); err == nil {
-		possiblePaths = append(possiblePaths, filepath.Join(homeDir, "go", "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(homeDir, "go", "bin", binaryName))
 	}
 
 	// Method 4: Try user.Current() to get home directory
 	if currentUser, err := user.Current(); err == nil && currentUser.HomeDir != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(currentUser.HomeDir, "go", "bin", "sentinel"))
+		possiblePaths = append(possiblePaths, filepath.Join(currentUser.HomeDir, "go", "bin", binaryName))
 	}
 
 	return possiblePaths
 }
+
+// processExists reports whether a process with the given PID is alive
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// diskFreeBytes returns the space available to unprivileged users on the volume holding path
+func diskFreeBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// volumeID identifies the filesystem holding path, so paths on the same
+// volume can share one free space check
+func volumeID(path string) (string, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(stat.Dev), nil
+}
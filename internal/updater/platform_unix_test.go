@@ -0,0 +1,50 @@
+//go:build linux
+
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFindHomeInPasswd verifies that entries whose home is missing, a file or
+// empty are scanned past, and that a UID without a usable entry is reported
+func TestFindHomeInPasswd(t *testing.T) {
+	saveLogger(t)
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home", "agent")
+	file := filepath.Join(dir, "not-a-dir")
+	writeLog(t, file, "")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		t.Fatalf("failed to create home: %v", err)
+	}
+
+	passwd := filepath.Join(dir, "passwd")
+	writeLog(t, passwd, strings.Join([]string{
+		"# crafted passwd",
+		"root:x:0:0:root:/root:/bin/sh",
+		"broken:x:1500",
+		"ghost:x:1500:1500::" + filepath.Join(dir, "missing") + ":/bin/sh",
+		"stale:x:1500:1500::" + file + ":/bin/sh",
+		"empty:x:1500:1500:::/bin/sh",
+		"agent:x:1500:1500::" + home + ":/bin/sh",
+		"later:x:1500:1500::" + dir + ":/bin/sh",
+		"orphan:x:1600:1600::" + filepath.Join(dir, "missing") + ":/bin/sh",
+		"",
+	}, "\n"))
+
+	if got, err := findHomeInPasswd(passwd, 1500); err != nil || got != home {
+		t.Errorf("findHomeInPasswd(1500) = %q, %v; want %s", got, err, home)
+	}
+	if _, err := findHomeInPasswd(passwd, 1600); err == nil || !strings.Contains(err.Error(), "none of the 1 entries for UID 1600") {
+		t.Errorf("findHomeInPasswd(1600) error = %v; want no existing home", err)
+	}
+	if _, err := findHomeInPasswd(passwd, 1700); err == nil || !strings.Contains(err.Error(), "no entry for UID 1700") {
+		t.Errorf("findHomeInPasswd(1700) error = %v; want no entry", err)
+	}
+	if _, err := findHomeInPasswd(filepath.Join(dir, "absent"), 1500); err == nil {
+		t.Error("findHomeInPasswd() should fail for a missing passwd file")
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
 )
 
 // ensureHomeDirectory determines the home directory using multiple fallback strategies
@@ -34,24 +37,59 @@ func ensureHomeDirectory() (string, error) {
 	return "", fmt.Errorf("unable to determine home directory: all detection strategies failed")
 }
 
-// getPossibleBinaryPaths returns platform-specific possible paths for the sentinel binary
+// getPossibleBinaryPaths returns platform-specific possible paths for the agent binary
 func getPossibleBinaryPaths() []string {
 	var possiblePaths []string
+	binaryName := agentBinaryFileName()
 
 	// Method 1: Check GOPATH environment variable
 	if gopath := os.Getenv("GOPATH"); gopath != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(gopath, "bin", "sentinel.exe"))
+		possiblePaths = append(possiblePaths, filepath.Join(gopath, "bin", binaryName))
 	}
 
 	// Method 2: Check HOME
 	if home := os.Getenv("HOME"); home != "" {
-		possiblePaths = append(possiblePaths, filepath.Join(home, "go", "bin", "sentinel.exe"))
+		possiblePaths = append(possiblePaths, filepath.Join(home, "go", "bin", binaryName))
 	}
 
 	// Method 3: Try os.UserHomeDir()
 	if homeDir, err := os.UserHomeDir(); err == nil {
-		possiblePaths = append(possiblePaths, filepath.Join(homeDir, "go", "bin", "sentinel.exe"))
+		possiblePaths = append(possiblePaths, filepath.Join(homeDir, "go", "bin", binaryName))
 	}
 
 	return possiblePaths
 }
+
+// processExists reports whether a process with the given PID is alive
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// diskFreeBytes returns the space available to the caller on the volume holding path
+func diskFreeBytes(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, nil, nil); err != nil {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
+
+// volumeID identifies the drive holding path, so paths on the same volume can
+// share one free space check
+func volumeID(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(filepath.VolumeName(absPath)), nil
+}
@@ -0,0 +1,204 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+const (
+	// DefaultMinFreeSpaceMB is kept free on every volume an update writes to
+	DefaultMinFreeSpaceMB = 100
+
+	// minBinarySizeEstimate is used when the current binary size is unknown
+	minBinarySizeEstimate = 50 * 1024 * 1024
+
+	// Multiples of the current binary size expected to be written to each
+	// location. The module and build caches hold sources and intermediate
+	// objects for every dependency, so they are estimated generously.
+	modCacheSpaceFactor   = 3
+	buildCacheSpaceFactor = 5
+	goBinSpaceFactor      = 2
+	installSpaceFactor    = 3 // backup copy plus the new binary, which may be larger
+	backupSpaceFactor     = 1
+)
+
+// spaceRequirement is the space an update expects to write under Dir
+type spaceRequirement struct {
+	Dir     string
+	Bytes   uint64
+	Purpose string
+}
+
+// volumeInfoFunc returns the volume identifier and free bytes for a path
+type volumeInfoFunc func(path string) (id string, free uint64, err error)
+
+// estimateSpaceRequirements returns the space needed in each location an
+// update writes to, based on the size of the currently installed binary
+func estimateSpaceRequirements(binarySize, databaseSize uint64, dirs *goDirs, installDir, backupDir string) []spaceRequirement {
+	if binarySize < minBinarySizeEstimate {
+		binarySize = minBinarySizeEstimate
+	}
+
+	return []spaceRequirement{
+		{Dir: dirs.GOMODCACHE, Bytes: binarySize * modCacheSpaceFactor, Purpose: "module cache"},
+		{Dir: dirs.GOCACHE, Bytes: binarySize * buildCacheSpaceFactor, Purpose: "build cache"},
+		{Dir: dirs.GOBIN, Bytes: binarySize * goBinSpaceFactor, Purpose: "compiled binary"},
+		{Dir: installDir, Bytes: binarySize * installSpaceFactor, Purpose: "install directory"},
+		{Dir: backupDir, Bytes: binarySize*backupSpaceFactor + databaseSize, Purpose: "backups"},
+	}
+}
+
+// checkFreeSpace sums the requirements that share a volume and verifies each
+// volume has that much free space plus minFree
+func checkFreeSpace(requirements []spaceRequirement, minFree uint64, volumeInfo volumeInfoFunc) error {
+	type volume struct {
+		dir      string
+		free     uint64
+		need     uint64
+		purposes []string
+	}
+
+	var order []string
+	volumes := make(map[string]*volume)
+
+	for _, req := range requirements {
+		dir := existingAncestor(req.Dir)
+		id, free, err := volumeInfo(dir)
+		if err != nil {
+			LogWarning("Could not determine free space for %s (%s): %v", req.Purpose, dir, err)
+			continue
+		}
+
+		v, ok := volumes[id]
+		if !ok {
+			v = &volume{dir: dir, free: free, need: minFree}
+			volumes[id] = v
+			order = append(order, id)
+		}
+		v.need += req.Bytes
+		v.purposes = append(v.purposes, req.Purpose)
+	}
+
+	for _, id := range order {
+		v := volumes[id]
+		LogInfo("  %s: need ~%d MB, have %d MB (%s)",
+			v.dir, bytesToMB(v.need), bytesToMB(v.free), strings.Join(v.purposes, ", "))
+		if v.free < v.need {
+			return newUpdateError(ErrCodeInsufficientSpace, "insufficient disk space: need ~%d MB on %s, have %d MB",
+				bytesToMB(v.need), v.dir, bytesToMB(v.free))
+		}
+	}
+
+	return nil
+}
+
+// checkWritable verifies a file can be created in dir, or in its closest
+// existing parent when dir does not exist yet
+func checkWritable(dir string) error {
+	dir = existingAncestor(dir)
+
+	file, err := os.CreateTemp(dir, ".sentinel-write-test-*")
+	if err != nil {
+		return newUpdateError(ErrCodeNotWritable, "directory %s is not writable: %v", dir, err)
+	}
+	name := file.Name()
+	file.Close()
+	os.Remove(name)
+	return nil
+}
+
+// runPreflightChecks verifies a C toolchain is available when CGO may be
+// needed, that there is enough disk space, and that the install and data directories are
+// writable. It runs before the backup is written or
+// any service is touched, so a failure leaves the agent untouched.
+func runPreflightChecks() error {
+	LogInfo("Running pre-flight checks...")
+
+	dirs, err := resolveGoDirs(paths.GetDataDirectory())
+	if err != nil {
+		return err
+	}
+
+	// A missing or broken toolchain is known before the agent is stopped. In
+	// auto mode it is only needed if the pure Go build fails, so it is not required.
+	if getConfig().CGOEnabled != CGOModeFalse {
+		err := checkCGOToolchain()
+		if err != nil && getConfig().CGOEnabled == CGOModeTrue {
+			return err
+		}
+		if err != nil {
+			LogWarning("No working C toolchain, the update will fail if the agent requires CGO")
+		}
+	}
+
+	installDir := filepath.Dir(agentBinaryPath())
+
+	for _, dir := range []string{installDir, paths.GetDataDirectory()} {
+		if err := checkWritable(dir); err != nil {
+			return err
+		}
+	}
+
+	var binarySize uint64
+	if info, err := os.Stat(agentBinaryPath()); err == nil {
+		binarySize = uint64(info.Size())
+	}
+
+	var databaseSize uint64
+	if getConfig().BackupDatabase {
+		_, size, err := databaseFiles(paths.GetDatabasePath())
+		if err != nil {
+			LogWarning("Could not determine database size: %v", err)
+		}
+		databaseSize = uint64(size)
+	}
+
+	requirements := estimateSpaceRequirements(binarySize, databaseSize, dirs, installDir, paths.GetBackupDirectory())
+	minFree := uint64(getConfig().MinFreeSpaceMB) * 1024 * 1024
+	if err := checkFreeSpace(requirements, minFree, hostVolumeInfo); err != nil {
+		return err
+	}
+
+	LogInfo("Pre-flight checks passed")
+	return nil
+}
+
+// checkCGOToolchain locates the C compiler using the same environment as the
+// agent build and, on Windows, verifies gcc can build a cgo program
+func checkCGOToolchain() error {
+	goBinary, _, env, err := buildEnvironment(paths.GetDataDirectory())
+	if err != nil {
+		return err
+	}
+
+	env, err = cgoBuildEnvironment(env)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+
+	return verifyCGOToolchain(paths.GetDataDirectory(), goBinary, env)
+}
+
+// hostVolumeInfo reports volume information using the platform helpers
+func hostVolumeInfo(path string) (string, uint64, error) {
+	id, err := volumeID(path)
+	if err != nil {
+		return "", 0, err
+	}
+	free, err := diskFreeBytes(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return id, free, nil
+}
+
+func bytesToMB(b uint64) uint64 {
+	return b / (1024 * 1024)
+}
@@ -0,0 +1,119 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mb = 1024 * 1024
+
+// fakeVolumes maps directory prefixes to a volume ID and its free space
+type fakeVolumes map[string]struct {
+	id   string
+	free uint64
+}
+
+func (f fakeVolumes) info(path string) (string, uint64, error) {
+	for prefix, v := range f {
+		if strings.HasPrefix(path, prefix) {
+			return v.id, v.free, nil
+		}
+	}
+	return "root", 1 << 40, nil
+}
+
+// TestEstimateSpaceRequirementsMinimumBinarySize verifies that a small or
+// unknown binary size is raised to the minimum estimate
+func TestEstimateSpaceRequirementsMinimumBinarySize(t *testing.T) {
+	dirs := &goDirs{GOBIN: "/gobin", GOCACHE: "/gocache", GOMODCACHE: "/gomodcache"}
+	requirements := estimateSpaceRequirements(0, 0, dirs, "/install", "/backups")
+
+	for _, req := range requirements {
+		if req.Purpose == "compiled binary" && req.Bytes != minBinarySizeEstimate*goBinSpaceFactor {
+			t.Errorf("compiled binary requirement = %d; want %d", req.Bytes, minBinarySizeEstimate*goBinSpaceFactor)
+		}
+	}
+}
+
+// TestEstimateSpaceRequirementsIncludesDatabase verifies that the database
+// size is added to the backup directory requirement
+func TestEstimateSpaceRequirementsIncludesDatabase(t *testing.T) {
+	dirs := &goDirs{GOBIN: "/gobin", GOCACHE: "/gocache", GOMODCACHE: "/gomodcache"}
+	requirements := estimateSpaceRequirements(100*mb, 40*mb, dirs, "/install", "/backups")
+
+	for _, req := range requirements {
+		if req.Dir == "/backups" && req.Bytes != 140*mb {
+			t.Errorf("backup requirement = %d MB; want 140 MB", req.Bytes/mb)
+		}
+		if req.Dir == "/install" && req.Bytes != 300*mb {
+			t.Errorf("install requirement = %d MB; want 300 MB", req.Bytes/mb)
+		}
+	}
+}
+
+// TestCheckFreeSpace verifies that requirements on a shared volume are summed
+// together with the minimum before being compared against free space
+func TestCheckFreeSpace(t *testing.T) {
+	requirements := []spaceRequirement{
+		{Dir: "/usr/local/bin", Bytes: 60 * mb, Purpose: "install directory"},
+		{Dir: "/usr/local/backups", Bytes: 30 * mb, Purpose: "backups"},
+		{Dir: "/home/go", Bytes: 500 * mb, Purpose: "build cache"},
+	}
+
+	tests := []struct {
+		name      string
+		localFree uint64
+		minFree   uint64
+		wantErr   bool
+	}{
+		{"enough space", 200 * mb, 100 * mb, false},
+		{"exactly enough", 190 * mb, 100 * mb, false},
+		{"short by minimum", 150 * mb, 100 * mb, true},
+		{"short without minimum", 80 * mb, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volumes := fakeVolumes{
+				"/usr/local": {id: "local", free: tt.localFree},
+				"/home":      {id: "home", free: 1000 * mb},
+			}
+
+			err := checkFreeSpace(requirements, tt.minFree, volumes.info)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkFreeSpace() error = %v; wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if ErrorCodeOf(err) != ErrCodeInsufficientSpace {
+					t.Errorf("ErrorCodeOf() = %s; want %s", ErrorCodeOf(err), ErrCodeInsufficientSpace)
+				}
+				if !strings.Contains(err.Error(), "on /usr/local") {
+					t.Errorf("error %q should name the full volume", err)
+				}
+			}
+		})
+	}
+}
+
+// TestCheckWritable verifies that a writable directory passes and a missing
+// directory falls back to its closest existing parent
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := checkWritable(dir); err != nil {
+		t.Errorf("checkWritable(%s) failed: %v", dir, err)
+	}
+	if err := checkWritable(filepath.Join(dir, "missing", "child")); err != nil {
+		t.Errorf("checkWritable() on missing directory failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("checkWritable() left %d file(s) behind", len(entries))
+	}
+}
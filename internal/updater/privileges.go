@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+// isPrivileged reports whether the updater runs with the privileges an update
+// needs; it is a variable so tests can replace it
+var isPrivileged = hasPrivileges
+
+// missingPrivilegesReported is set once the updater has logged that it lacks
+// privileges, so a service without them says so once rather than every check
+var missingPrivilegesReported atomic.Bool
+
+// checkPrivileges fails with guidance when the updater lacks the privileges
+// to stop, replace and reinstall the agent. It runs before anything is
+// touched, so an update cannot be left half applied by a permission error.
+// User mode does not lift it: only the data directory is per-user, while the
+// agent binary and services stay the system's.
+func checkPrivileges() error {
+	if isPrivileged() {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return newUpdateError(ErrCodeInsufficientPrivileges, "the updater must run as Administrator: run the command from an elevated prompt (Run as administrator)")
+	}
+	return newUpdateError(ErrCodeInsufficientPrivileges, "the updater must run as root: run the command with sudo")
+}
+
+// RequirePrivileges is checkPrivileges for the commands that manage services
+// or the agent binaries, so they stop before changing anything
+func RequirePrivileges() error {
+	err := checkPrivileges()
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("this command requires administrator privileges: %w", err)
+}
+
+// reportMissingPrivileges logs err as critical the first time the updater
+// finds it lacks privileges, and at debug level after that
+func reportMissingPrivileges(err error) {
+	if missingPrivilegesReported.CompareAndSwap(false, true) {
+		LogCritical("Updates are skipped until the service is reinstalled with enough privileges: %v", err)
+		return
+	}
+	LogDebug("Skipping the update: %v", err)
+}
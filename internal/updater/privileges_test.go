@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// TestManualCommandsUnprivileged verifies that update, rollback and bootstrap
+// fail with guidance before touching anything when the updater lacks
+// privileges, in user mode too
+func TestManualCommandsUnprivileged(t *testing.T) {
+	original := isPrivileged
+	isPrivileged = func() bool { return false }
+	t.Cleanup(func() { isPrivileged = original })
+
+	if _, err := RunUpdate("v1.2.0", false); ErrorCodeOf(err) != ErrCodeInsufficientPrivileges {
+		t.Errorf("RunUpdate() = %v; want %s", err, ErrCodeInsufficientPrivileges)
+	}
+	if err := RunRollback(""); ErrorCodeOf(err) != ErrCodeInsufficientPrivileges {
+		t.Errorf("RunRollback() = %v; want %s", err, ErrCodeInsufficientPrivileges)
+	}
+	if _, err := RunBootstrap("", false); ErrorCodeOf(err) != ErrCodeInsufficientPrivileges {
+		t.Errorf("RunBootstrap() = %v; want %s", err, ErrCodeInsufficientPrivileges)
+	}
+	if err := performUpdate("v1.2.0", false); ErrorCodeOf(err) != ErrCodeInsufficientPrivileges {
+		t.Errorf("performUpdate() = %v; want %s", err, ErrCodeInsufficientPrivileges)
+	}
+	if err := RequirePrivileges(); ErrorCodeOf(err) != ErrCodeInsufficientPrivileges || !strings.Contains(err.Error(), "requires administrator privileges") {
+		t.Errorf("RequirePrivileges() = %v; want %s", err, ErrCodeInsufficientPrivileges)
+	}
+
+	t.Setenv(paths.UserModeEnv, "1")
+	if err := RequirePrivileges(); ErrorCodeOf(err) != ErrCodeInsufficientPrivileges {
+		t.Errorf("RequirePrivileges() in user mode = %v; want %s", err, ErrCodeInsufficientPrivileges)
+	}
+}
+
+// TestCheckOnceUnprivileged verifies that the service loop skips an update it
+// lacks the privileges to install, without touching the agent, and reports
+// it as critical only once
+func TestCheckOnceUnprivileged(t *testing.T) {
+	saveLogger(t)
+	withConfig(t, getConfig())
+	useServiceManager(t, serviceManager)
+	original := isPrivileged
+	isPrivileged = func() bool { return false }
+	t.Cleanup(func() { isPrivileged = original })
+	missingPrivilegesReported.Store(false)
+	t.Cleanup(func() { missingPrivilegesReported.Store(false) })
+
+	manager := &servicetest.FakeManager{}
+	var output bytes.Buffer
+	u := New(Options{
+		Config:         DefaultConfig(),
+		ServiceManager: manager,
+		Versions: &VersionChecker{
+			InstalledVersion: func() (string, error) { return "v1.7.0", nil },
+			LatestVersion: func(string, bool) (*VersionCheck, error) {
+				return &VersionCheck{Channel: ChannelStable, Selected: "v1.8.0"}, nil
+			},
+		},
+		LogOutput: &output,
+	})
+
+	for i := 0; i < 2; i++ {
+		result, err := u.CheckOnce()
+		if err != nil || result.Updated || !strings.HasPrefix(result.Summary, "skipped v1.8.0") {
+			t.Errorf("CheckOnce() = %+v, %v; want the update skipped", result, err)
+		}
+	}
+	if calls := manager.CallLog(); len(calls) != 0 {
+		t.Errorf("service calls = %q; want none", calls)
+	}
+	if n := strings.Count(output.String(), "CRITICAL"); n != 1 {
+		t.Errorf("logged %d critical messages; want 1:\n%s", n, output.String())
+	}
+}
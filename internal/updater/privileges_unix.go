@@ -0,0 +1,11 @@
+//go:build !windows
+
+package updater
+
+import "os"
+
+// hasPrivileges reports whether the updater runs as root, which managing the
+// agent service and writing its install directory require
+func hasPrivileges() bool {
+	return os.Geteuid() == 0
+}
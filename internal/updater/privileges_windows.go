@@ -0,0 +1,12 @@
+//go:build windows
+
+package updater
+
+import "golang.org/x/sys/windows"
+
+// hasPrivileges reports whether the updater runs elevated, which managing the
+// agent service and writing its install directory require. LocalSystem, which
+// the service runs as, is always elevated.
+func hasPrivileges() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
@@ -0,0 +1,212 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// PurgeOptions selects what a purge removes
+type PurgeOptions struct {
+	// AgentOnly removes the agent service and binaries but keeps the data
+	// directory
+	AgentOnly bool
+
+	// IncludeDatabase also deletes the agent database and its snapshots,
+	// which a purge otherwise keeps
+	IncludeDatabase bool
+}
+
+// PurgeItem is an action of a purge, such as "delete /usr/local/bin/sentinel",
+// and its error when it failed
+type PurgeItem struct {
+	What string
+	Err  error
+}
+
+// purgeStep is one action of a purge
+type purgeStep struct {
+	what   string
+	remove func() error
+}
+
+// PurgeTargets lists the actions RunPurge would take with options, without
+// taking them. The error reports a configuration file that could not
+// be read, in which case the targets are those of the defaults.
+func PurgeTargets(options PurgeOptions) ([]string, error) {
+	agent, data, err := purgePlan(options)
+	var targets []string
+	for _, step := range append(agent, data...) {
+		targets = append(targets, step.what)
+	}
+	return targets, err
+}
+
+// RunPurge decommissions the agent: it stops and uninstalls its service,
+// removes its binaries with their .backup and .old copies and, unless
+// AgentOnly is set, the contents of the data directory. The agent database
+// and its snapshots are kept unless IncludeDatabase is set. A failure to
+// remove one item is reported in its PurgeItem and the purge carries on; the
+// error is returned only when the purge could not start.
+func RunPurge(options PurgeOptions) ([]PurgeItem, error) {
+	if err := checkPrivileges(); err != nil {
+		return nil, err
+	}
+
+	// Keep an update from installing the agent again while it is removed
+	release := func() {}
+	if dataDir := paths.GetDataDirectory(); !isMissing(dataDir) {
+		var err error
+		if release, err = acquireUpdateLock(dataDir); err != nil {
+			return nil, fmt.Errorf("cannot start purge: %w", err)
+		}
+	}
+	agent, data, _ := purgePlan(options)
+
+	items := runPurgeSteps(agent)
+	// The lock file is in the data directory, so it goes before the data does
+	release()
+	return append(items, runPurgeSteps(data)...), nil
+}
+
+// runPurgeSteps runs steps, carrying on past failures
+func runPurgeSteps(steps []purgeStep) []PurgeItem {
+	items := make([]PurgeItem, 0, len(steps))
+	for _, step := range steps {
+		items = append(items, PurgeItem{What: step.what, Err: step.remove()})
+	}
+	return items
+}
+
+// purgePlan returns the removals of the agent's service and binaries and
+// those of the data directory, in the order they are done
+func purgePlan(options PurgeOptions) (agent, data []purgeStep, configErr error) {
+	config, configErr := loadConfigPath(paths.GetUpdaterConfigPath())
+	activeConfig.Store(config)
+
+	name := agentServiceName()
+	if running, err := serviceManager.IsRunning(name); err == nil && running {
+		agent = append(agent, purgeStep{"stop service " + name, func() error { return serviceManager.Stop(name) }})
+	}
+	registered, err := serviceManager.GetServiceBinaryPath(name)
+	if err == nil {
+		agent = append(agent, purgeStep{"uninstall service " + name, func() error { return serviceManager.Uninstall(name) }})
+	}
+
+	for _, binary := range purgeBinaryPaths(registered) {
+		for _, path := range []string{binary, binary + ".backup", binary + ".old"} {
+			if _, err := os.Lstat(path); err == nil {
+				agent = append(agent, purgeStep{"delete " + path, removeFile(path)})
+			}
+		}
+	}
+
+	if !options.AgentOnly {
+		data = purgeDataSteps(paths.GetDataDirectory(), options.IncludeDatabase)
+	}
+	return agent, data, configErr
+}
+
+// purgeBinaryPaths returns every agent binary a purge removes: the one the
+// service runs, the detected one, the configured ones and the one at the
+// system location
+func purgeBinaryPaths(registered string) []string {
+	candidates := []string{registered}
+	if detected, _, err := getMainAgentBinaryPathWithDetails(); err == nil {
+		candidates = append(candidates, detected)
+	}
+	candidates = append(candidates, getConfig().configuredBinaryPaths()...)
+	candidates = append(candidates, agentBinaryPath())
+
+	var binaries []string
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		if path == "" || seen[filepath.Clean(path)] {
+			continue
+		}
+		seen[filepath.Clean(path)] = true
+		binaries = append(binaries, path)
+	}
+	return binaries
+}
+
+// purgeDataSteps removes each entry of dataDir, and dataDir itself when
+// nothing is kept. Without includeDatabase the database files and the
+// database snapshots in the backups directory are kept.
+func purgeDataSteps(dataDir string, includeDatabase bool) []purgeStep {
+	entries, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []purgeStep{{"delete the contents of " + dataDir, func() error { return err }}}
+	}
+
+	database := filepath.Base(paths.GetDatabasePath())
+	backups := filepath.Base(paths.GetBackupDirectory())
+	var steps []purgeStep
+	for _, entry := range entries {
+		path := filepath.Join(dataDir, entry.Name())
+		switch {
+		case entry.Name() == updateLockFileName:
+			// Released, and so removed, before the data directory is purged
+			continue
+		case !includeDatabase && isDatabaseFile(database, entry.Name()):
+			continue
+		case !includeDatabase && entry.Name() == backups && entry.IsDir():
+			steps = append(steps, purgeBackupSteps(path)...)
+			continue
+		}
+		steps = append(steps, purgeStep{"delete " + path, removeAll(path)})
+	}
+	if includeDatabase {
+		steps = append(steps, purgeStep{"delete " + dataDir, removeFile(dataDir)})
+	}
+	return steps
+}
+
+// purgeBackupSteps removes the binary backups in backupDir, keeping the
+// database snapshots
+func purgeBackupSteps(backupDir string) []purgeStep {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return []purgeStep{{"delete the backups in " + backupDir, func() error { return err }}}
+	}
+	var steps []purgeStep
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), databaseSnapshotPrefix) {
+			continue
+		}
+		path := filepath.Join(backupDir, entry.Name())
+		steps = append(steps, purgeStep{"delete " + path, removeAll(path)})
+	}
+	return steps
+}
+
+// isDatabaseFile reports whether name is the database called database or
+// one of its sidecar files
+func isDatabaseFile(database, name string) bool {
+	for _, suffix := range databaseFileSuffixes {
+		if name == database+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// isMissing reports whether nothing exists at path
+func isMissing(path string) bool {
+	_, err := os.Lstat(path)
+	return os.IsNotExist(err)
+}
+
+func removeFile(path string) func() error {
+	return func() error { return os.Remove(path) }
+}
+
+func removeAll(path string) func() error {
+	return func() error { return os.RemoveAll(path) }
+}
@@ -0,0 +1,189 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// purgeFixture is an installed agent with its data, for a purge to remove
+type purgeFixture struct {
+	dataDir string
+	binary  string
+	manager *servicetest.FakeManager
+}
+
+// usePurgeFixture installs a fake agent service with its binary, its
+// backups and a data directory holding a database, a snapshot and logs
+func usePurgeFixture(t *testing.T) *purgeFixture {
+	saveLogger(t)
+	original := isPrivileged
+	isPrivileged = func() bool { return true }
+	t.Cleanup(func() { isPrivileged = original })
+
+	dataDir := filepath.Join(t.TempDir(), "sentinelgo")
+	for _, dir := range []string{"backups/db-20240101-000000", "build/bin"} {
+		if err := os.MkdirAll(filepath.Join(dataDir, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatalf("failed to create data directory: %v", err)
+		}
+	}
+	paths.SetDataDirectory(dataDir)
+	t.Cleanup(func() { paths.SetDataDirectory("") })
+
+	binary := filepath.Join(t.TempDir(), "sentinel")
+	for _, path := range []string{binary, binary + ".backup", binary + ".old"} {
+		writeLog(t, path, "agent")
+	}
+	if err := os.Chmod(binary, 0755); err != nil {
+		t.Fatalf("failed to make agent binary executable: %v", err)
+	}
+
+	config := defaultConfig()
+	config.BinaryPath = binary
+	config.EnableAutoDetection = false
+	// Keep the system location out of reach should a real agent be there
+	config.AgentBinaryName = "sentinel-purge-test"
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("failed to encode config: %v", err)
+	}
+	withConfig(t, config)
+	writeLog(t, paths.GetUpdaterConfigPath(), string(data))
+
+	for _, name := range []string{"sentinel.db", "sentinel.db-wal", "updater.log", "agent.log",
+		"backups/sentinel-v1.0.0", "backups/db-20240101-000000/sentinel.db", "build/bin/sentinel"} {
+		writeLog(t, filepath.Join(dataDir, filepath.FromSlash(name)), name)
+	}
+
+	manager := &servicetest.FakeManager{
+		Binaries: map[string]string{MainAgentServiceName: binary},
+		Running:  map[string]bool{MainAgentServiceName: true},
+	}
+	useServiceManager(t, manager)
+	return &purgeFixture{dataDir: dataDir, binary: binary, manager: manager}
+}
+
+// remaining returns the files left in the data directory, relative to it
+func (f *purgeFixture) remaining() []string {
+	var files []string
+	filepath.WalkDir(f.dataDir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			rel, _ := filepath.Rel(f.dataDir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files
+}
+
+// checkPurgeItems fails the test if an item failed or the items are not want
+func checkPurgeItems(t *testing.T, items []PurgeItem, want []string) {
+	t.Helper()
+	var done []string
+	for _, item := range items {
+		if item.Err != nil {
+			t.Errorf("%s failed: %v", item.What, item.Err)
+		}
+		done = append(done, item.What)
+	}
+	if !slices.Equal(done, want) {
+		t.Errorf("purge did %q; want %q", done, want)
+	}
+}
+
+// TestRunPurgeAgentOnly verifies that --agent-only removes the service and
+// the binaries with their copies, and leaves the data directory alone
+func TestRunPurgeAgentOnly(t *testing.T) {
+	fixture := usePurgeFixture(t)
+	before := fixture.remaining()
+
+	want := []string{"stop service sentinelgo", "uninstall service sentinelgo",
+		"delete " + fixture.binary, "delete " + fixture.binary + ".backup", "delete " + fixture.binary + ".old"}
+	if targets, err := PurgeTargets(PurgeOptions{AgentOnly: true}); err != nil || !slices.Equal(targets, want) {
+		t.Errorf("PurgeTargets() = %q, %v; want %q", targets, err, want)
+	}
+	items, err := RunPurge(PurgeOptions{AgentOnly: true})
+	if err != nil {
+		t.Fatalf("RunPurge() failed: %v", err)
+	}
+	checkPurgeItems(t, items, want)
+
+	if calls := fixture.manager.CallLog(); !slices.Equal(calls, []string{"stop sentinelgo", "uninstall sentinelgo"}) {
+		t.Errorf("service calls = %q; want stop and uninstall", calls)
+	}
+	for _, path := range []string{fixture.binary, fixture.binary + ".backup", fixture.binary + ".old"} {
+		if !isMissing(path) {
+			t.Errorf("%s still exists", path)
+		}
+	}
+	if after := fixture.remaining(); !slices.Equal(after, before) {
+		t.Errorf("data directory after --agent-only = %q; want %q", after, before)
+	}
+}
+
+// TestRunPurge verifies that a purge deletes the data directory except the
+// database and its snapshots, unless the database is included
+func TestRunPurge(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  PurgeOptions
+		wantLeft []string
+	}{
+		{"keep database", PurgeOptions{}, []string{"backups/db-20240101-000000/sentinel.db", "sentinel.db", "sentinel.db-wal"}},
+		{"include database", PurgeOptions{IncludeDatabase: true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := usePurgeFixture(t)
+
+			items, err := RunPurge(tt.options)
+			if err != nil {
+				t.Fatalf("RunPurge() failed: %v", err)
+			}
+			for _, item := range items {
+				if item.Err != nil {
+					t.Errorf("%s failed: %v", item.What, item.Err)
+				}
+			}
+			if left := fixture.remaining(); !slices.Equal(left, tt.wantLeft) {
+				t.Errorf("data directory after purge = %q; want %q", left, tt.wantLeft)
+			}
+			if tt.options.IncludeDatabase && !isMissing(fixture.dataDir) {
+				t.Errorf("data directory %s still exists", fixture.dataDir)
+			}
+			if !isMissing(fixture.binary) {
+				t.Errorf("agent binary %s still exists", fixture.binary)
+			}
+		})
+	}
+}
+
+// TestRunPurgeReportsFailures verifies that a failed action is reported on
+// its own and the purge carries on with the rest
+func TestRunPurgeReportsFailures(t *testing.T) {
+	fixture := usePurgeFixture(t)
+	fixture.manager.Errors = map[string]error{"uninstall": errors.New("access denied")}
+
+	items, err := RunPurge(PurgeOptions{})
+	if err != nil {
+		t.Fatalf("RunPurge() failed: %v", err)
+	}
+	var failed []string
+	for _, item := range items {
+		if item.Err != nil {
+			failed = append(failed, item.What)
+		}
+	}
+	if !slices.Equal(failed, []string{"uninstall service sentinelgo"}) {
+		t.Errorf("failed actions = %q; want only the uninstall", failed)
+	}
+	if !isMissing(fixture.binary) || !isMissing(filepath.Join(fixture.dataDir, "updater.log")) {
+		t.Error("purge stopped at the failed uninstall")
+	}
+}
@@ -0,0 +1,88 @@
+package updater
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// reloadConfig re-reads the configuration file and makes it active, logging
+// each changed setting. An unreadable or invalid file keeps the current
+// configuration. Every setting is read where it is used, so changes apply from
+// the next check or update without a restart.
+func reloadConfig() {
+	configPath := paths.GetUpdaterConfigPath()
+	LogInfo("Reloading configuration from: %s", configPath)
+
+	controlPort := getConfig().ControlPort
+	changes, err := reloadConfigPath(configPath)
+	if err != nil {
+		LogError("Configuration reload failed, keeping current configuration: %v", err)
+		return
+	}
+
+	// The control endpoint listens on the port it started with, so it is
+	// restarted on a new one
+	if config := getConfig(); config.ControlPort != controlPort {
+		StopControlServer()
+		startControlServer(config)
+	}
+
+	if len(changes) == 0 {
+		LogInfo("Configuration reloaded, no changes")
+		return
+	}
+
+	LogInfo("Configuration reloaded, %d setting(s) changed:", len(changes))
+	for _, change := range changes {
+		LogInfo("  %s", change)
+	}
+}
+
+// reloadConfigPath loads the configuration at path and swaps it in, returning
+// the changed settings
+func reloadConfigPath(path string) ([]string, error) {
+	config, err := loadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffConfig(getConfig(), config)
+	activeConfig.Store(config)
+	return changes, nil
+}
+
+// diffConfig describes each setting that differs between old and new as
+// "name: old -> new", using the JSON key as the name
+func diffConfig(old, new *UpdaterConfig) []string {
+	var changes []string
+
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	configType := oldValue.Type()
+
+	for i := 0; i < configType.NumField(); i++ {
+		before := oldValue.Field(i).Interface()
+		after := newValue.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		name := configFieldName(configType.Field(i))
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name,
+			redactConfigValue(name, formatConfigValue(before)),
+			redactConfigValue(name, formatConfigValue(after))))
+	}
+
+	return changes
+}
+
+// formatConfigValue renders a setting for the change log, quoting strings so
+// an empty value remains visible
+func formatConfigValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDiffConfig verifies that only changed settings are reported, by JSON key
+func TestDiffConfig(t *testing.T) {
+	old := defaultConfig()
+	new := defaultConfig()
+	new.CheckIntervalSeconds = 300
+	new.PostUpdateHealthCheck = "exit 0"
+
+	changes := diffConfig(old, new)
+	want := []string{
+		`checkIntervalSeconds: 30 -> 300`,
+		`postUpdateHealthCheck: "" -> "exit 0"`,
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("diffConfig() = %v; want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("diffConfig()[%d] = %s; want %s", i, changes[i], want[i])
+		}
+	}
+}
+
+// TestReloadConfigPath verifies that a reload swaps in the new settings and
+// that an invalid file keeps the current configuration
+func TestReloadConfigPath(t *testing.T) {
+	original := getConfig()
+	defer activeConfig.Store(original)
+	activeConfig.Store(defaultConfig())
+
+	configPath := filepath.Join(t.TempDir(), "updater-config.json")
+	if err := os.WriteFile(configPath, []byte(`{"checkIntervalSeconds": 120}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	changes, err := reloadConfigPath(configPath)
+	if err != nil {
+		t.Fatalf("reloadConfigPath() failed: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("reloadConfigPath() changes = %v; want 1 change", changes)
+	}
+	if got := getConfig().CheckIntervalDuration(); got != 2*time.Minute {
+		t.Errorf("CheckIntervalDuration() = %v; want 2m0s", got)
+	}
+
+	if err := os.WriteFile(configPath, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := reloadConfigPath(configPath); err == nil {
+		t.Error("reloadConfigPath() should fail for malformed JSON")
+	}
+	if got := getConfig().CheckIntervalDuration(); got != 2*time.Minute {
+		t.Errorf("CheckIntervalDuration() after failed reload = %v; want 2m0s", got)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package updater
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSignals reloads the configuration whenever the updater receives SIGHUP
+// and wakes the loop for a check on SIGUSR1, until the returned function is
+// called
+func watchSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				LogInfo("Received %v", sig)
+				if sig == syscall.SIGUSR1 {
+					requestCheck()
+					continue
+				}
+				reloadConfig()
+			}
+		}
+	}()
+
+	LogInfo("Send SIGHUP to reload the configuration, SIGUSR1 to check now")
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build !windows
+
+package updater
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// waitFor polls cond until it holds, failing the test after five seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestWatchSignals verifies that SIGHUP swaps in a valid configuration, keeps
+// the current one when the new file is invalid, and that SIGUSR1 wakes the
+// loop for a check
+func TestWatchSignals(t *testing.T) {
+	saveLogger(t)
+	logs := &lockedBuffer{}
+	useLogOutput(logs)
+	withConfig(t, defaultConfig())
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	configPath := filepath.Join(t.TempDir(), "updater-config.json")
+	paths.SetUpdaterConfigPath(configPath)
+	t.Cleanup(func() { paths.SetUpdaterConfigPath("") })
+	stop := watchSignals()
+	defer stop()
+
+	writeLog(t, configPath, `{"checkIntervalSeconds": 120}`)
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("failed to send SIGHUP: %v", err)
+	}
+	waitFor(t, "the reload", func() bool { return getConfig().CheckIntervalSeconds == 120 })
+	waitFor(t, "the change log", func() bool { return strings.Contains(logs.String(), "checkIntervalSeconds: 30 -> 120") })
+
+	writeLog(t, configPath, `{"checkIntervalSeconds": 60,`)
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	waitFor(t, "the reload error", func() bool {
+		return strings.Contains(logs.String(), "Configuration reload failed, keeping current configuration")
+	})
+	if got := getConfig().CheckIntervalSeconds; got != 120 {
+		t.Errorf("checkIntervalSeconds after an invalid reload = %d; want 120", got)
+	}
+
+	// Drain a request left by another test so only SIGUSR1 can wake the loop
+	select {
+	case <-checkRequests:
+	default:
+	}
+	woke := make(chan struct{})
+	go func() {
+		sleepUntilNextCheck(context.Background())
+		close(woke)
+	}()
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-woke:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sleepUntilNextCheck() did not return after SIGUSR1")
+	}
+}
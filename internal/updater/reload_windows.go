@@ -0,0 +1,10 @@
+//go:build windows
+
+package updater
+
+// watchSignals does nothing on Windows, which has neither SIGHUP nor SIGUSR1:
+// watchConfigFile picks up configuration changes, and a check is requested
+// through the control endpoint instead
+func watchSignals() (stop func()) {
+	return func() {}
+}
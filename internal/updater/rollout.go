@@ -0,0 +1,136 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRolloutPercentage lets every host install a version as soon as
+	// it is selected
+	DefaultRolloutPercentage = 100
+
+	// rolloutBuckets is the number of cohorts hosts are spread over; a
+	// percentage admits that many of them
+	rolloutBuckets = 100
+)
+
+// machineIDFiles hold a stable, random machine ID on Linux
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// hostIdentity returns the machine ID, or the hostname where there is none;
+// it is a variable so tests can pin it
+var hostIdentity = func() string {
+	if id := machineID(); id != "" {
+		return id
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(hostname)
+}
+
+// machineID returns the machine ID, or "" where there is none
+func machineID() string {
+	for _, path := range machineIDFiles {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// rolloutBucket maps identity to a bucket in [0, rolloutBuckets), the same
+// one every time, spreading hosts evenly
+func rolloutBucket(identity string) int {
+	sum := sha256.Sum256([]byte(identity))
+	return int(binary.BigEndian.Uint64(sum[:8]) % rolloutBuckets)
+}
+
+// hostRolloutBucket returns the bucket configured for this host, or the one
+// derived from its identity
+func hostRolloutBucket(config *UpdaterConfig) int {
+	if config.RolloutBucket >= 0 {
+		return config.RolloutBucket
+	}
+	return rolloutBucket(hostIdentity())
+}
+
+// rolloutDeferral returns why a host in bucket should not install a version
+// published at published yet, or "" when it may. Hosts whose bucket is below
+// rolloutPercentage update at once; the others once the version is older
+// than rolloutMinAgeHours, if that is set.
+func rolloutDeferral(config *UpdaterConfig, bucket int, published time.Time) string {
+	if bucket < config.RolloutPercentage {
+		return ""
+	}
+
+	reason := fmt.Sprintf("rollout bucket %d is outside the first %d%%", bucket, config.RolloutPercentage)
+	minAge := config.RolloutMinAge()
+	if minAge <= 0 {
+		return reason
+	}
+	if published.IsZero() {
+		return reason + ", and the version's publish time is unknown"
+	}
+	if ready := published.Add(minAge); now().Before(ready) {
+		return fmt.Sprintf("%s, waiting until %s (%v after it was published)", reason, ready.Format(time.RFC3339), minAge)
+	}
+	return ""
+}
+
+// versionPublishTime returns when version of module was published, as the
+// module proxy reports it
+func versionPublishTime(goBinary, module, version string) (time.Time, error) {
+	output, err := runGoList(goBinary, "-m", "-json", module+"@"+version)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var moduleInfo struct {
+		Time time.Time `json:"Time"`
+	}
+	if err := json.Unmarshal(output, &moduleInfo); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse module info: %w", err)
+	}
+	return moduleInfo.Time, nil
+}
+
+// checkRollout returns why this host should not install the selected
+// version yet, or "" when it may. The publish time is only looked up when
+// the host is outside the rollout percentage, which an update manifest may
+// set, and a minimum age is set.
+func checkRollout(check *VersionCheck) string {
+	config := getConfig()
+	if check.Manifest != nil && check.Manifest.RolloutPercent != nil {
+		manifestConfig := *config
+		manifestConfig.RolloutPercentage = *check.Manifest.RolloutPercent
+		config = &manifestConfig
+	}
+	bucket := hostRolloutBucket(config)
+	if bucket < config.RolloutPercentage {
+		if config.RolloutPercentage < rolloutBuckets {
+			LogInfo("Rollout bucket %d is within the first %d%%, updating", bucket, config.RolloutPercentage)
+		}
+		return ""
+	}
+
+	var published time.Time
+	if config.RolloutMinAge() > 0 {
+		goBinary, err := findGoBinary()
+		if err == nil {
+			published, err = versionPublishTime(goBinary, check.Module, check.Selected)
+		}
+		if err != nil {
+			LogWarning("Failed to look up when %s was published: %v", check.Selected, err)
+		}
+	}
+	return rolloutDeferral(config, bucket, published)
+}
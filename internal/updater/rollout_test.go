@@ -0,0 +1,134 @@
+package updater
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+)
+
+// TestRolloutBucketStable verifies that a host always lands in the same
+// bucket and that hosts spread over every bucket
+func TestRolloutBucketStable(t *testing.T) {
+	identity := "4c4c4544-0042-3510-8052-b4c04f4e3332"
+	bucket := rolloutBucket(identity)
+	for i := 0; i < 10; i++ {
+		if got := rolloutBucket(identity); got != bucket {
+			t.Fatalf("rolloutBucket(%s) = %d, then %d; want the same bucket", identity, bucket, got)
+		}
+	}
+
+	counts := make([]int, rolloutBuckets)
+	for i := 0; i < 100*rolloutBuckets; i++ {
+		b := rolloutBucket(fmt.Sprintf("host-%d", i))
+		if b < 0 || b >= rolloutBuckets {
+			t.Fatalf("rolloutBucket(host-%d) = %d; want 0-%d", i, b, rolloutBuckets-1)
+		}
+		counts[b]++
+	}
+	for b, count := range counts {
+		if count < 50 || count > 150 {
+			t.Errorf("bucket %d has %d of %d hosts; want about 100", b, count, 100*rolloutBuckets)
+		}
+	}
+}
+
+// TestHostRolloutBucket verifies that a configured bucket replaces the one
+// derived from the machine ID
+func TestHostRolloutBucket(t *testing.T) {
+	original := hostIdentity
+	hostIdentity = func() string { return "build-server-7" }
+	t.Cleanup(func() { hostIdentity = original })
+
+	if got, want := hostRolloutBucket(&UpdaterConfig{RolloutBucket: -1}), rolloutBucket("build-server-7"); got != want {
+		t.Errorf("hostRolloutBucket(derived) = %d; want %d", got, want)
+	}
+	if got := hostRolloutBucket(&UpdaterConfig{RolloutBucket: 0}); got != 0 {
+		t.Errorf("hostRolloutBucket(pinned to 0) = %d; want 0", got)
+	}
+}
+
+// TestRolloutDeferral verifies the percentage boundary, that the minimum age
+// admits every host once reached, and that an unknown publish time defers
+func TestRolloutDeferral(t *testing.T) {
+	current := fakeClock(t)
+	published := current.Add(-24 * time.Hour)
+
+	tests := []struct {
+		percentage int
+		minAge     int
+		bucket     int
+		published  time.Time
+		deferred   string
+	}{
+		{100, 0, 99, published, ""},
+		{0, 0, 0, published, "outside the first 0%"},
+		{25, 0, 24, published, ""},
+		{25, 0, 25, published, "bucket 25 is outside the first 25%"},
+		{25, 24, 25, published, ""},
+		{25, 24, 25, published.Add(time.Second), "waiting until 2026-01-01T12:00:01Z"},
+		{0, 48, 0, published, "waiting until 2026-01-02T12:00:00Z"},
+		{25, 24, 99, time.Time{}, "publish time is unknown"},
+	}
+
+	for _, tt := range tests {
+		config := &UpdaterConfig{RolloutPercentage: tt.percentage, RolloutMinAgeHours: tt.minAge}
+		got := rolloutDeferral(config, tt.bucket, tt.published)
+		if (tt.deferred == "") != (got == "") || !strings.Contains(got, tt.deferred) {
+			t.Errorf("rolloutDeferral(%d%%, %dh, bucket %d, %s) = %q; want %q",
+				tt.percentage, tt.minAge, tt.bucket, tt.published.Format(time.RFC3339), got, tt.deferred)
+		}
+	}
+}
+
+// TestVersionPublishTime verifies that the publish time is read from the
+// module proxy's info for the version
+func TestVersionPublishTime(t *testing.T) {
+	var query string
+	useRunner(t, &commandtest.FakeRunner{Handler: func(call commandtest.Call) commandtest.Result {
+		query = call.Args[len(call.Args)-1]
+		return commandtest.Result{Stdout: `{"Path": "` + MainAgentModule + `", "Version": "v1.2.0", "Time": "2026-01-01T09:30:00Z"}`}
+	}})
+
+	published, err := versionPublishTime("go", MainAgentModule, "v1.2.0")
+	if err != nil {
+		t.Fatalf("versionPublishTime() failed: %v", err)
+	}
+	if want := time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC); !published.Equal(want) {
+		t.Errorf("versionPublishTime() = %v; want %v", published, want)
+	}
+	if want := MainAgentModule + "@v1.2.0"; query != want {
+		t.Errorf("queried %s; want %s", query, want)
+	}
+}
+
+// TestLoadConfigPathRollout verifies the rollout defaults and that values
+// out of range fall back to them
+func TestLoadConfigPathRollout(t *testing.T) {
+	tests := []struct {
+		content    string
+		percentage int
+		minAge     int
+		bucket     int
+	}{
+		{`{}`, 100, 0, -1},
+		{`{"rolloutPercentage": 0, "rolloutMinAgeHours": 24, "rolloutBucket": 0}`, 0, 24, 0},
+		{`{"rolloutPercentage": 101, "rolloutMinAgeHours": -1, "rolloutBucket": 100}`, 100, 0, -1},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		writeLog(t, configPath, tt.content)
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		if config.RolloutPercentage != tt.percentage || config.RolloutMinAgeHours != tt.minAge || config.RolloutBucket != tt.bucket {
+			t.Errorf("loadConfigPath(%s) rollout = %d%%, %dh, bucket %d; want %d%%, %dh, bucket %d", tt.content,
+				config.RolloutPercentage, config.RolloutMinAgeHours, config.RolloutBucket, tt.percentage, tt.minAge, tt.bucket)
+		}
+	}
+}
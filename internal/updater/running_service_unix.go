@@ -0,0 +1,11 @@
+//go:build !windows
+
+package updater
+
+import "errors"
+
+// runningServiceBinary is only implemented on Windows, where the service
+// configuration may not name the binary the service actually runs
+func runningServiceBinary(serviceName string) (string, error) {
+	return "", errors.New("not supported on this platform")
+}
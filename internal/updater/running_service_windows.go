@@ -0,0 +1,58 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// runningServiceBinary returns the image path of the process the service
+// serviceName runs as. Unlike matching processes by name, it cannot pick up
+// an unrelated process with the same binary name.
+func runningServiceBinary(serviceName string) (string, error) {
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer windows.CloseServiceHandle(scm)
+
+	name, err := windows.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return "", err
+	}
+	service, err := windows.OpenService(scm, name, windows.SERVICE_QUERY_STATUS)
+	if err != nil {
+		return "", fmt.Errorf("failed to open service %s: %w", serviceName, err)
+	}
+	defer windows.CloseServiceHandle(service)
+
+	var status windows.SERVICE_STATUS_PROCESS
+	var needed uint32
+	if err := windows.QueryServiceStatusEx(service, windows.SC_STATUS_PROCESS_INFO,
+		(*byte)(unsafe.Pointer(&status)), uint32(unsafe.Sizeof(status)), &needed); err != nil {
+		return "", fmt.Errorf("failed to query service %s: %w", serviceName, err)
+	}
+	if status.ProcessId == 0 {
+		return "", fmt.Errorf("service %s is not running", serviceName)
+	}
+	return processImagePath(status.ProcessId)
+}
+
+// processImagePath returns the full path of the executable of process pid
+func processImagePath(pid uint32) (string, error) {
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer windows.CloseHandle(process)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(process, 0, &buf[0], &size); err != nil {
+		return "", fmt.Errorf("failed to read the image path of process %d: %w", pid, err)
+	}
+	return windows.UTF16ToString(buf[:size]), nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProcessImagePath verifies that the image path of a process is resolved
+// from its PID
+func TestProcessImagePath(t *testing.T) {
+	want, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() failed: %v", err)
+	}
+	got, err := processImagePath(uint32(os.Getpid()))
+	if err != nil || !strings.EqualFold(filepath.Clean(got), filepath.Clean(want)) {
+		t.Errorf("processImagePath(self) = %q, %v; want %q", got, err, want)
+	}
+}
+
+// TestRunningServiceBinaryNotInstalled verifies that a service that is not
+// installed is an error rather than a match
+func TestRunningServiceBinaryNotInstalled(t *testing.T) {
+	if path, err := runningServiceBinary("sentinelgo-test-no-such-service"); err == nil {
+		t.Errorf("runningServiceBinary(missing) = %q; want an error", path)
+	}
+}
@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdNotify sends state, a list of KEY=VALUE assignments such as READY=1 or
+// WATCHDOG=1, to the service manager over $NOTIFY_SOCKET. It reports whether
+// a message was sent: outside systemd, and on Windows, the variable is unset
+// and it does nothing.
+func sdNotify(state ...string) (bool, error) {
+	addr, err := notifySocketAddr(os.Getenv("NOTIFY_SOCKET"))
+	if addr == nil || err != nil {
+		return false, err
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(encodeNotifyState(state)); err != nil {
+		return false, fmt.Errorf("failed to write to notify socket: %w", err)
+	}
+	return true, nil
+}
+
+// notifySocketAddr returns the address of the notify socket named by
+// $NOTIFY_SOCKET, or nil when it is unset. A leading @ names a socket in the
+// abstract namespace.
+func notifySocketAddr(name string) (*net.UnixAddr, error) {
+	switch {
+	case name == "":
+		return nil, nil
+	case strings.HasPrefix(name, "@"):
+		return &net.UnixAddr{Name: "\x00" + name[1:], Net: "unixgram"}, nil
+	case strings.HasPrefix(name, "/"):
+		return &net.UnixAddr{Name: name, Net: "unixgram"}, nil
+	}
+	return nil, fmt.Errorf("unsupported notify socket %q", name)
+}
+
+// encodeNotifyState encodes state as one datagram: the assignments separated
+// by newlines
+func encodeNotifyState(state []string) []byte {
+	return []byte(strings.Join(state, "\n"))
+}
+
+// watchdogInterval returns the interval systemd expects WATCHDOG=1 within,
+// from $WATCHDOG_USEC, or 0 when the watchdog is not enabled for this process
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// statusFileName holds what the running updater last did, for the status command
+const statusFileName = "status.json"
+
+// Activities reported by the running updater
+const (
+	ActivityStarting = "starting"
+	ActivityChecking = "checking"
+	ActivityUpdating = "updating"
+	ActivityIdle     = "idle"
+)
+
+// UpdaterStatus is what the running updater publishes in status.json
+type UpdaterStatus struct {
+	PID              int       `json:"pid"`
+	StartedAt        time.Time `json:"startedAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+	Activity         string    `json:"activity"`
+	InstalledVersion string    `json:"installedVersion,omitempty"`
+	LatestVersion    string    `json:"latestVersion,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	LastCheck        time.Time `json:"lastCheck,omitempty"`
+	LastResult       string    `json:"lastResult,omitempty"`
+	UpdatePending    bool      `json:"updatePending"`
+	GoCacheBytes     uint64    `json:"goCacheBytes,omitempty"`
+	Updater          BuildInfo `json:"updater"`
+
+	// InstalledVersionDetails is the full --version output of the installed
+	// agent, such as "SentinelGo v1.6.116 (abcdef, 2024-01-01)", when it says
+	// more than InstalledVersion
+	InstalledVersionDetails string `json:"installedVersionDetails,omitempty"`
+}
+
+// StatusReport is the status command's view of the updater: the published
+// status plus the update in progress, the last heartbeat and the pause of
+// automatic updates, if any
+type StatusReport struct {
+	UpdaterStatus
+	ConfigPath       string
+	UpdateInProgress string
+	Heartbeat        *Heartbeat
+	Pause            *PauseRecord
+}
+
+// serviceStatus is the status of this process, written on every change
+var serviceStatus struct {
+	sync.Mutex
+	status  UpdaterStatus
+	dataDir string
+}
+
+// startStatus begins publishing the status of this process to dataDir
+func startStatus(dataDir string) {
+	serviceStatus.Lock()
+	serviceStatus.dataDir = dataDir
+	serviceStatus.status = UpdaterStatus{PID: os.Getpid(), StartedAt: now(), Updater: currentBuild()}
+	serviceStatus.Unlock()
+
+	setStatus(func(s *UpdaterStatus) { s.Activity = ActivityStarting })
+}
+
+// setStatus applies change to the published status and writes it. Failures
+// are logged at debug only, since the status file is informational.
+func setStatus(change func(*UpdaterStatus)) {
+	serviceStatus.Lock()
+	defer serviceStatus.Unlock()
+
+	if serviceStatus.dataDir == "" {
+		return
+	}
+	change(&serviceStatus.status)
+	serviceStatus.status.UpdatedAt = now()
+	if err := writeJSONFile(filepath.Join(serviceStatus.dataDir, statusFileName), serviceStatus.status); err != nil {
+		LogDebug("Failed to write status: %v", err)
+	}
+}
+
+// recordCheckResult publishes the outcome of a version check
+func recordCheckResult(installed string, check *VersionCheck, pending bool, result string) {
+	setStatus(func(s *UpdaterStatus) {
+		s.Activity = ActivityIdle
+		s.InstalledVersion = installed
+		s.InstalledVersionDetails = agentVersionDetails(installed)
+		if check != nil {
+			s.LatestVersion = check.Selected
+			s.Channel = string(check.Channel)
+		}
+		s.LastCheck = now()
+		s.LastResult = result
+		s.UpdatePending = pending
+	})
+}
+
+// ReadStatus returns the status published by the updater service, or nil
+// when it has never run
+func ReadStatus() (*StatusReport, error) {
+	return readStatus(paths.GetDataDirectory())
+}
+
+func readStatus(dataDir string) (*StatusReport, error) {
+	var status UpdaterStatus
+	found, err := readJSONFile(filepath.Join(dataDir, statusFileName), &status)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	report := &StatusReport{UpdaterStatus: status, ConfigPath: paths.GetUpdaterConfigPath()}
+	marker, err := loadUpdateMarker(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if marker != nil {
+		report.UpdateInProgress = marker.TargetVersion + ", " + marker.Progress()
+	}
+	if report.Heartbeat, err = readHeartbeat(dataDir); err != nil {
+		return nil, err
+	}
+	if report.Pause, err = readPause(dataDir); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,48 @@
+package updater
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStatusRoundTrip verifies that the status published by the service is
+// read back with the update in progress
+func TestStatusRoundTrip(t *testing.T) {
+	clock := fakeClock(t)
+	dataDir := t.TempDir()
+	t.Cleanup(func() { startStatus("") })
+
+	startStatus(dataDir)
+	*clock = clock.Add(time.Minute)
+	check := &VersionCheck{Channel: ChannelStable, Selected: "v1.2.0"}
+	recordCheckResult("v1.1.0", check, true, "updating to v1.2.0")
+	setStatus(func(s *UpdaterStatus) { s.Activity = ActivityUpdating })
+
+	marker := &UpdateMarker{TargetVersion: "v1.2.0", Step: stepCompiled}
+	if err := writeUpdateMarker(dataDir, marker); err != nil {
+		t.Fatalf("writeUpdateMarker() failed: %v", err)
+	}
+
+	report, err := readStatus(dataDir)
+	if err != nil || report == nil {
+		t.Fatalf("readStatus() = %v, %v; want a report", report, err)
+	}
+	if report.Activity != ActivityUpdating || report.InstalledVersion != "v1.1.0" || report.LatestVersion != "v1.2.0" {
+		t.Errorf("readStatus() = %+v; want updating v1.1.0 -> v1.2.0", report.UpdaterStatus)
+	}
+	if !report.LastCheck.Equal(*clock) || !report.UpdatePending {
+		t.Errorf("LastCheck, UpdatePending = %v, %v; want %v, true", report.LastCheck, report.UpdatePending, *clock)
+	}
+	if want := "v1.2.0, " + marker.Progress(); report.UpdateInProgress != want {
+		t.Errorf("UpdateInProgress = %q; want %q", report.UpdateInProgress, want)
+	}
+}
+
+// TestReadStatusNeverRun verifies that no report is returned before the
+// service has published a status
+func TestReadStatusNeverRun(t *testing.T) {
+	report, err := readStatus(t.TempDir())
+	if err != nil || report != nil {
+		t.Errorf("readStatus() = %v, %v; want nil, nil", report, err)
+	}
+}
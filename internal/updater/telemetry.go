@@ -0,0 +1,350 @@
+package updater
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// telemetryQueueFileName holds the telemetry events not yet delivered
+	telemetryQueueFileName = "telemetry-queue.json"
+
+	// DefaultTelemetryQueueSize is the number of undelivered events kept;
+	// the oldest are dropped beyond it
+	DefaultTelemetryQueueSize = 100
+
+	// telemetryAttempts bounds how often one event is sent per flush
+	telemetryAttempts = 3
+
+	// telemetryTimeout bounds each telemetry request
+	telemetryTimeout = 10 * time.Second
+
+	// telemetryHeartbeatInterval is the time between heartbeats
+	telemetryHeartbeatInterval = 24 * time.Hour
+
+	// TelemetryHostHostname, TelemetryHostMachineID and the
+	// TelemetryHostCustomPrefix form select the telemetry host identifier
+	TelemetryHostHostname     = "hostname"
+	TelemetryHostMachineID    = "machine-id"
+	TelemetryHostCustomPrefix = "custom:"
+
+	// TelemetryEventUpdate and TelemetryEventHeartbeat are the event types
+	TelemetryEventUpdate    = "update"
+	TelemetryEventHeartbeat = "heartbeat"
+)
+
+// telemetryRedactableFields are the event fields telemetryRedactFields may name
+var telemetryRedactableFields = []string{"host", "os", "arch", "updaterVersion", "previousVersion", "version"}
+
+// telemetryBackoff is the wait before the first retry, doubled for each later
+// one; it is a variable so tests can shorten it
+var telemetryBackoff = 2 * time.Second
+
+// TelemetryEvent is the body posted to telemetryURL after an update attempt
+// or as a heartbeat
+type TelemetryEvent struct {
+	Sequence        int64     `json:"sequence"`
+	Type            string    `json:"type"`
+	Timestamp       time.Time `json:"timestamp"`
+	Host            string    `json:"host"`
+	OS              string    `json:"os"`
+	Arch            string    `json:"arch"`
+	UpdaterVersion  string    `json:"updaterVersion"`
+	UpdaterCommit   string    `json:"updaterCommit,omitempty"`
+	PreviousVersion string    `json:"previousVersion,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	Result          string    `json:"result,omitempty"`
+	DurationSeconds float64   `json:"durationSeconds,omitempty"`
+	ErrorClass      ErrorCode `json:"errorClass,omitempty"`
+}
+
+// telemetryQueue is the on-disk queue of undelivered events. Sequence
+// numbers let a flush remove exactly the events it delivered, and let the
+// endpoint drop an event it receives twice.
+type telemetryQueue struct {
+	NextSequence  int64            `json:"nextSequence"`
+	LastHeartbeat time.Time        `json:"lastHeartbeat,omitempty"`
+	Events        []TelemetryEvent `json:"events"`
+}
+
+// telemetryState serializes access to the queue file and allows one flush
+// at a time
+var telemetryState struct {
+	sync.Mutex
+	flushing bool
+}
+
+// telemetryHost returns the host identifier selected by telemetryHostID
+func telemetryHost(config *UpdaterConfig) string {
+	if custom, ok := strings.CutPrefix(config.TelemetryHostID, TelemetryHostCustomPrefix); ok {
+		return custom
+	}
+	if config.TelemetryHostID == TelemetryHostMachineID {
+		if id := machineID(); id != "" {
+			return id
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}
+
+// newTelemetryEvent describes an event of eventType on this host
+func newTelemetryEvent(config *UpdaterConfig, eventType string) TelemetryEvent {
+	return TelemetryEvent{
+		Type:           eventType,
+		Timestamp:      now(),
+		Host:           telemetryHost(config),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		UpdaterVersion: UpdaterVersion,
+		UpdaterCommit:  currentBuild().Commit,
+	}
+}
+
+// redact replaces the fields named in fields with [REDACTED]
+func (e *TelemetryEvent) redact(fields []string) {
+	values := map[string]*string{
+		"host":            &e.Host,
+		"os":              &e.OS,
+		"arch":            &e.Arch,
+		"updaterVersion":  &e.UpdaterVersion,
+		"updaterCommit":   &e.UpdaterCommit,
+		"previousVersion": &e.PreviousVersion,
+		"version":         &e.Version,
+	}
+	for _, field := range fields {
+		if value, ok := values[field]; ok && *value != "" {
+			*value = "[REDACTED]"
+		}
+	}
+}
+
+// newUpdateTelemetryEvent describes an update attempt from previousVersion
+// to targetVersion that took duration and failed with err, or succeeded
+func newUpdateTelemetryEvent(config *UpdaterConfig, previousVersion, targetVersion string, duration time.Duration, err error) TelemetryEvent {
+	event := newTelemetryEvent(config, TelemetryEventUpdate)
+	event.PreviousVersion = previousVersion
+	event.Version = targetVersion
+	event.DurationSeconds = duration.Round(time.Millisecond).Seconds()
+	event.Result = "success"
+	if err != nil {
+		event.Result = "failure"
+		event.ErrorClass = ErrorCodeOf(err)
+		if event.ErrorClass == "" {
+			event.ErrorClass = "UNCLASSIFIED"
+		}
+	}
+	return event
+}
+
+// loadTelemetryQueue reads the queue; the caller holds telemetryState
+func loadTelemetryQueue(dataDir string) telemetryQueue {
+	var queue telemetryQueue
+	if _, err := readJSONFile(filepath.Join(dataDir, telemetryQueueFileName), &queue); err != nil {
+		// A corrupt queue must not stop new events from being recorded
+		LogWarning("Telemetry queue unreadable, starting a new one: %v", err)
+		return telemetryQueue{}
+	}
+	return queue
+}
+
+// saveTelemetryQueue writes the queue; the caller holds telemetryState
+func saveTelemetryQueue(dataDir string, queue telemetryQueue) error {
+	return writeJSONFile(filepath.Join(dataDir, telemetryQueueFileName), queue)
+}
+
+// enqueueTelemetry redacts event and appends it to the queue in dataDir,
+// dropping the oldest events beyond telemetryQueueSize
+func enqueueTelemetry(config *UpdaterConfig, dataDir string, event TelemetryEvent) error {
+	event.redact(config.TelemetryRedactFields)
+
+	telemetryState.Lock()
+	defer telemetryState.Unlock()
+	queue := loadTelemetryQueue(dataDir)
+	queue.NextSequence++
+	event.Sequence = queue.NextSequence
+	if event.Type == TelemetryEventHeartbeat {
+		queue.LastHeartbeat = event.Timestamp
+	}
+	queue.Events = append(queue.Events, event)
+	if dropped := len(queue.Events) - config.TelemetryQueueSize; dropped > 0 {
+		LogDebug("Telemetry queue full, dropping the %d oldest events", dropped)
+		queue.Events = queue.Events[dropped:]
+	}
+	return saveTelemetryQueue(dataDir, queue)
+}
+
+// flushTelemetry sends the queued events in order and removes the delivered
+// ones. It stops at the first event the endpoint cannot be reached for,
+// leaving it and later events for the next flush; an event the endpoint
+// rejects is dropped. A proxy that wants credentials keeps the events too.
+func flushTelemetry(config *UpdaterConfig, dataDir string) error {
+	telemetryState.Lock()
+	pending := loadTelemetryQueue(dataDir).Events
+	telemetryState.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return err
+	}
+	client.Timeout = telemetryTimeout
+
+	var done int64
+	var flushErr error
+	for _, event := range pending {
+		retry, err := sendTelemetryEvent(client, config, event)
+		if err != nil && (retry || ErrorCodeOf(err) == ErrCodeProxyAuthRequired) {
+			flushErr = err
+			break
+		}
+		if err != nil {
+			LogWarning("Telemetry event %d dropped: %v", event.Sequence, err)
+		}
+		done = event.Sequence
+	}
+
+	telemetryState.Lock()
+	defer telemetryState.Unlock()
+	queue := loadTelemetryQueue(dataDir)
+	var remaining []TelemetryEvent
+	for _, event := range queue.Events {
+		if event.Sequence > done {
+			remaining = append(remaining, event)
+		}
+	}
+	queue.Events = remaining
+	if err := saveTelemetryQueue(dataDir, queue); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// sendTelemetryEvent posts event, retrying network errors and server errors
+// with exponential backoff, and reports whether a failure may succeed later
+func sendTelemetryEvent(client *http.Client, config *UpdaterConfig, event TelemetryEvent) (bool, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return false, err
+	}
+
+	backoff := telemetryBackoff
+	var retry bool
+	for attempt := 1; attempt <= telemetryAttempts; attempt++ {
+		retry, err = postReport(client, config, config.TelemetryURL, "telemetry endpoint", body)
+		if err == nil || !retry {
+			return retry, err
+		}
+		if attempt < telemetryAttempts {
+			LogDebug("Telemetry attempt %d/%d failed, retrying in %v: %v", attempt, telemetryAttempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return retry, err
+}
+
+// startTelemetryFlush flushes the queue in the background unless a flush is
+// already running, so delivery never delays an update
+func startTelemetryFlush(config *UpdaterConfig, dataDir string) {
+	telemetryState.Lock()
+	if telemetryState.flushing {
+		telemetryState.Unlock()
+		return
+	}
+	telemetryState.flushing = true
+	telemetryState.Unlock()
+
+	go func() {
+		err := flushTelemetry(config, dataDir)
+
+		telemetryState.Lock()
+		telemetryState.flushing = false
+		telemetryState.Unlock()
+		if err != nil {
+			LogDebug("Telemetry endpoint unavailable, events stay queued: %v", err)
+		}
+	}()
+}
+
+// reportUpdateTelemetry queues the outcome of an update attempt and starts
+// delivering it. Failures are logged; they never fail the update.
+func reportUpdateTelemetry(dataDir, previousVersion, targetVersion string, duration time.Duration, err error) {
+	config := getConfig()
+	if config.TelemetryURL == "" {
+		return
+	}
+	event := newUpdateTelemetryEvent(config, previousVersion, targetVersion, duration, err)
+	if err := enqueueTelemetry(config, dataDir, event); err != nil {
+		LogWarning("Failed to queue update telemetry: %v", err)
+		return
+	}
+	startTelemetryFlush(config, dataDir)
+}
+
+// telemetryHeartbeatDue reports whether a heartbeat should be queued now
+func telemetryHeartbeatDue(config *UpdaterConfig, dataDir string) bool {
+	if !config.TelemetryHeartbeat {
+		return false
+	}
+	telemetryState.Lock()
+	defer telemetryState.Unlock()
+	last := loadTelemetryQueue(dataDir).LastHeartbeat
+	return last.IsZero() || now().Sub(last) >= telemetryHeartbeatInterval
+}
+
+// tickTelemetry runs after every check: it queues the daily heartbeat with
+// agentVersion when one is due and delivers events queued while the
+// endpoint was unreachable
+func tickTelemetry(dataDir, agentVersion string) {
+	config := getConfig()
+	if config.TelemetryURL == "" {
+		return
+	}
+	if telemetryHeartbeatDue(config, dataDir) {
+		event := newTelemetryEvent(config, TelemetryEventHeartbeat)
+		event.Version = agentVersion
+		if err := enqueueTelemetry(config, dataDir, event); err != nil {
+			LogWarning("Failed to queue telemetry heartbeat: %v", err)
+		}
+	}
+	startTelemetryFlush(config, dataDir)
+}
+
+// validTelemetryHostID reports whether id selects a host identifier
+func validTelemetryHostID(id string) bool {
+	if custom, ok := strings.CutPrefix(id, TelemetryHostCustomPrefix); ok {
+		return custom != ""
+	}
+	return id == TelemetryHostHostname || id == TelemetryHostMachineID
+}
+
+// checkTelemetryRedactFields returns fields without the names that are not
+// event fields, warning about each
+func checkTelemetryRedactFields(fields []string) []string {
+	var valid []string
+	for _, field := range fields {
+		known := false
+		for _, name := range telemetryRedactableFields {
+			known = known || field == name
+		}
+		if !known {
+			LogWarning("telemetryRedactFields entry %q is not a telemetry field (%s) and is ignored",
+				field, strings.Join(telemetryRedactableFields, ", "))
+			continue
+		}
+		valid = append(valid, field)
+	}
+	return valid
+}
@@ -0,0 +1,176 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTelemetryServer returns a server that answers with *status, recording
+// the events it accepts
+func newTelemetryServer(t *testing.T, status *int) (*httptest.Server, *[]TelemetryEvent) {
+	var events []TelemetryEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event TelemetryEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if *status < 300 {
+			events = append(events, event)
+		}
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(server.Close)
+
+	original := telemetryBackoff
+	telemetryBackoff = time.Millisecond
+	t.Cleanup(func() { telemetryBackoff = original })
+	return server, &events
+}
+
+// TestFlushTelemetryQueued verifies that events stay queued, at most
+// telemetryQueueSize of them, while the endpoint fails, and are delivered
+// in order once it is back
+func TestFlushTelemetryQueued(t *testing.T) {
+	dataDir := t.TempDir()
+	status := http.StatusServiceUnavailable
+	server, events := newTelemetryServer(t, &status)
+	config := &UpdaterConfig{TelemetryURL: server.URL, TelemetryHostID: TelemetryHostHostname, TelemetryQueueSize: 3}
+
+	for i := 1; i <= 4; i++ {
+		event := newUpdateTelemetryEvent(config, "v1.0.0", fmt.Sprintf("v1.%d.0", i), time.Minute, nil)
+		if err := enqueueTelemetry(config, dataDir, event); err != nil {
+			t.Fatalf("enqueueTelemetry() failed: %v", err)
+		}
+	}
+
+	if err := flushTelemetry(config, dataDir); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("flushTelemetry() while unavailable = %v; want the 503 error", err)
+	}
+	if queued := loadTelemetryQueue(dataDir).Events; len(queued) != 3 || queued[0].Version != "v1.2.0" {
+		t.Fatalf("queue after a failed flush = %+v; want v1.2.0 to v1.4.0", queued)
+	}
+
+	status = http.StatusNoContent
+	if err := flushTelemetry(config, dataDir); err != nil {
+		t.Fatalf("flushTelemetry() failed: %v", err)
+	}
+	var delivered []string
+	for _, event := range *events {
+		delivered = append(delivered, fmt.Sprintf("%d:%s", event.Sequence, event.Version))
+	}
+	if got, want := strings.Join(delivered, " "), "2:v1.2.0 3:v1.3.0 4:v1.4.0"; got != want {
+		t.Errorf("delivered %s; want %s", got, want)
+	}
+	if queued := loadTelemetryQueue(dataDir).Events; len(queued) != 0 {
+		t.Errorf("queue after delivery = %+v; want empty", queued)
+	}
+
+	status = http.StatusBadRequest
+	enqueueTelemetry(config, dataDir, newTelemetryEvent(config, TelemetryEventHeartbeat))
+	if err := flushTelemetry(config, dataDir); err != nil {
+		t.Errorf("flushTelemetry() of a rejected event = %v; want it dropped", err)
+	}
+	if queued := loadTelemetryQueue(dataDir).Events; len(queued) != 0 {
+		t.Errorf("queue after a rejected event = %+v; want empty", queued)
+	}
+}
+
+// TestTelemetryEventFields verifies the host identifier, the error class and
+// that redacted fields are not queued
+func TestTelemetryEventFields(t *testing.T) {
+	dataDir := t.TempDir()
+	config := &UpdaterConfig{
+		TelemetryHostID:       TelemetryHostCustomPrefix + "edge-42",
+		TelemetryRedactFields: []string{"previousVersion"},
+		TelemetryQueueSize:    DefaultTelemetryQueueSize,
+	}
+
+	failed := newUpdateError(ErrCodeHealthCheckFailed, "health check exited 1")
+	updates := []error{failed, fmt.Errorf("update failed, rolled back: %w", fmt.Errorf("boom")), nil}
+	for _, err := range updates {
+		event := newUpdateTelemetryEvent(config, "v1.0.0", "v1.1.0", 90*time.Second, err)
+		if err := enqueueTelemetry(config, dataDir, event); err != nil {
+			t.Fatalf("enqueueTelemetry() failed: %v", err)
+		}
+	}
+
+	queued := loadTelemetryQueue(dataDir).Events
+	want := []struct {
+		result string
+		class  ErrorCode
+	}{{"failure", ErrCodeHealthCheckFailed}, {"failure", "UNCLASSIFIED"}, {"success", ""}}
+	for i, event := range queued {
+		if event.Result != want[i].result || event.ErrorClass != want[i].class {
+			t.Errorf("event %d = %s, %s; want %s, %s", i, event.Result, event.ErrorClass, want[i].result, want[i].class)
+		}
+		if event.Host != "edge-42" || event.PreviousVersion != "[REDACTED]" || event.Version != "v1.1.0" || event.DurationSeconds != 90 {
+			t.Errorf("event %d = %+v; want host edge-42, redacted previous version, v1.1.0 after 90s", i, event)
+		}
+	}
+}
+
+// TestTelemetryHeartbeatDue verifies that a heartbeat is queued once a day,
+// and only when enabled
+func TestTelemetryHeartbeatDue(t *testing.T) {
+	current := fakeClock(t)
+	dataDir := t.TempDir()
+	config := &UpdaterConfig{TelemetryHostID: TelemetryHostHostname, TelemetryQueueSize: DefaultTelemetryQueueSize}
+
+	if telemetryHeartbeatDue(config, dataDir) {
+		t.Error("telemetryHeartbeatDue() = true with telemetryHeartbeat off")
+	}
+	config.TelemetryHeartbeat = true
+	if !telemetryHeartbeatDue(config, dataDir) {
+		t.Fatal("telemetryHeartbeatDue() = false before the first heartbeat")
+	}
+
+	enqueueTelemetry(config, dataDir, newTelemetryEvent(config, TelemetryEventHeartbeat))
+	*current = current.Add(telemetryHeartbeatInterval - time.Minute)
+	if telemetryHeartbeatDue(config, dataDir) {
+		t.Error("telemetryHeartbeatDue() = true within a day of the last heartbeat")
+	}
+	*current = current.Add(time.Minute)
+	if !telemetryHeartbeatDue(config, dataDir) {
+		t.Error("telemetryHeartbeatDue() = false a day after the last heartbeat")
+	}
+}
+
+// TestLoadConfigPathTelemetry verifies the telemetry defaults and that
+// invalid values are dropped or fall back to them
+func TestLoadConfigPathTelemetry(t *testing.T) {
+	tests := []struct {
+		content string
+		url     string
+		hostID  string
+		redact  string
+		queue   int
+	}{
+		{`{}`, "", TelemetryHostHostname, "", DefaultTelemetryQueueSize},
+		{`{"telemetryURL": "https://fleet.example.com/updates", "telemetryHostID": "custom:edge-42", "telemetryRedactFields": ["host", "error"], "telemetryQueueSize": 10}`,
+			"https://fleet.example.com/updates", "custom:edge-42", "host", 10},
+		{`{"telemetryURL": "fleet.example.com", "telemetryHostID": "custom:", "telemetryQueueSize": -1}`,
+			"", TelemetryHostHostname, "", DefaultTelemetryQueueSize},
+		{`{"telemetryHostID": "machine-id"}`, "", TelemetryHostMachineID, "", DefaultTelemetryQueueSize},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "updater-config.json")
+		writeLog(t, configPath, tt.content)
+		config, err := loadConfigPath(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigPath(%s) failed: %v", tt.content, err)
+		}
+		redact := strings.Join(config.TelemetryRedactFields, ",")
+		if config.TelemetryURL != tt.url || config.TelemetryHostID != tt.hostID || redact != tt.redact || config.TelemetryQueueSize != tt.queue {
+			t.Errorf("loadConfigPath(%s) telemetry = %q, %q, [%s], %d; want %q, %q, [%s], %d", tt.content,
+				config.TelemetryURL, config.TelemetryHostID, redact, config.TelemetryQueueSize, tt.url, tt.hostID, tt.redact, tt.queue)
+		}
+	}
+}
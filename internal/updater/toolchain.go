@@ -0,0 +1,163 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// toolchainCacheFileName remembers where gcc was found outside PATH
+	toolchainCacheFileName = "toolchain-cache.json"
+
+	// gccVersionTimeout bounds `gcc --version` when validating a toolchain
+	gccVersionTimeout = 30 * time.Second
+)
+
+// ToolchainCache records a gcc directory found outside PATH so later updates
+// can skip the directory scan
+type ToolchainCache struct {
+	GCCDir     string    `json:"gccDir"`
+	Version    string    `json:"version"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// findGCCOutsidePath searches well-known install directories for gcc; it is a
+// variable so tests can assert it is not called when the search is disabled
+var findGCCOutsidePath = findGCCOnWindows
+
+// gccExecutable returns the path of the gcc executable in dir
+func gccExecutable(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "gcc.exe")
+	}
+	return filepath.Join(dir, "gcc")
+}
+
+// gccVersion runs the gcc in dir and returns the first line of its version output
+func gccVersion(dir string) (string, error) {
+	gcc := gccExecutable(dir)
+	if _, err := os.Stat(gcc); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gccVersionTimeout)
+	defer cancel()
+
+	output, _, err := commandRunner.Run(ctx, gcc, []string{"--version"}, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("%s --version failed: %w", gcc, err)
+	}
+
+	version, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(version), nil
+}
+
+// loadToolchainCache returns the cached toolchain, or nil if none is cached
+func loadToolchainCache(dataDir string) (*ToolchainCache, error) {
+	var cache ToolchainCache
+	found, err := readJSONFile(filepath.Join(dataDir, toolchainCacheFileName), &cache)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// cachedGCCDir returns the cached gcc directory if its gcc still runs. An
+// invalid cache entry is removed so the next lookup scans again.
+func cachedGCCDir(dataDir string) string {
+	cache, err := loadToolchainCache(dataDir)
+	if err != nil {
+		LogWarning("Failed to read toolchain cache: %v", err)
+	}
+	if cache == nil {
+		return ""
+	}
+
+	if _, err := gccVersion(cache.GCCDir); err != nil {
+		LogWarning("Cached GCC at %s is no longer usable, rescanning: %v", cache.GCCDir, err)
+		if err := os.Remove(filepath.Join(dataDir, toolchainCacheFileName)); err != nil && !os.IsNotExist(err) {
+			LogWarning("Failed to remove toolchain cache: %v", err)
+		}
+		return ""
+	}
+
+	LogInfo("Using cached GCC location: %s", cache.GCCDir)
+	return cache.GCCDir
+}
+
+// cacheGCCDir records a gcc directory found by the scan
+func cacheGCCDir(dataDir, gccDir string) {
+	version, err := gccVersion(gccDir)
+	if err != nil {
+		LogWarning("Not caching GCC at %s: %v", gccDir, err)
+		return
+	}
+
+	cache := &ToolchainCache{GCCDir: gccDir, Version: version, DetectedAt: time.Now()}
+	if err := writeJSONFile(filepath.Join(dataDir, toolchainCacheFileName), cache); err != nil {
+		LogWarning("Failed to cache GCC location: %v", err)
+	}
+}
+
+// locateGCC checks that gcc is available for CGO compilation with env. It
+// returns the directory to prepend to its PATH, or "" if gcc is already on it. Outside PATH
+// it only looks when searchOutsidePath is set, trying the location cached in
+// dataDir before scanning the common install directories. When gcc is still
+// missing, the configured toolchain providers are tried in order. A missing
+// toolchain is reported as TOOLCHAIN_MISSING.
+func locateGCC(dataDir string, searchOutsidePath bool, env []string) (string, error) {
+	LogDebug("Checking for GCC...")
+	if _, err := lookPathIn(env, "gcc"); err == nil {
+		LogDebug("GCC found in PATH")
+		return "", nil
+	}
+
+	if searchOutsidePath {
+		LogWarning("GCC not found in PATH, attempting to locate...")
+
+		if gccDir := cachedGCCDir(dataDir); gccDir != "" {
+			return gccDir, nil
+		}
+
+		// Try to find GCC in common locations
+		if gccDir := findGCCOutsidePath(); gccDir != "" {
+			LogInfo("Found GCC at: %s", gccDir)
+			cacheGCCDir(dataDir, gccDir)
+			return gccDir, nil
+		}
+		LogError("GCC not found in PATH or common locations")
+	} else {
+		LogError("GCC not found in PATH (search outside PATH disabled by configuration)")
+	}
+
+	var provisionErr error
+	config := getConfig()
+	if providers := configuredToolchainProviders(config, dataDir); len(providers) > 0 {
+		LogInfo("Installing GCC: providers %s, timeout %v per provider, winget package %s",
+			strings.Join(config.ToolchainProviders, ", "), config.ToolchainInstallTimeout(), config.WingetPackage)
+		gccDir, err := provisionToolchain(providers, config.ToolchainInstallTimeout())
+		if err == nil {
+			cacheGCCDir(dataDir, gccDir)
+			return gccDir, nil
+		}
+		LogError("%v", err)
+		provisionErr = err
+	}
+
+	LogError("CGO compilation requires GCC on Windows")
+	LogError("")
+	LogError("INSTALLATION REQUIRED:")
+	LogError("  Install GCC using: winget install %s", getConfig().WingetPackage)
+	LogError("  Or download from: https://winlibs.com/")
+	LogError("")
+	LogError("After installing GCC, the updater will automatically detect it on the next update check")
+	if provisionErr != nil {
+		return "", &UpdateError{Code: ErrCodeToolchainMissing, Err: provisionErr}
+	}
+	return "", newUpdateError(ErrCodeToolchainMissing, "GCC not found - please install GCC and retry")
+}
@@ -0,0 +1,345 @@
+package updater
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultToolchainInstallTimeoutMinutes bounds a single provider's install
+	DefaultToolchainInstallTimeoutMinutes = 30
+
+	// DefaultWingetPackage is the WinLibs package installed by winget
+	DefaultWingetPackage = "BrechtSanders.WinLibs.POSIX.UCRT"
+
+	// installerWaitDelay bounds the wait for output after an installer exits
+	// or is killed, in case a child process it started keeps the pipes open
+	installerWaitDelay = 10 * time.Second
+
+	// toolchainArchiveDirName is where the offline provider extracts its
+	// archive, inside the data directory
+	toolchainArchiveDirName = "toolchain"
+
+	// msys2Root is the default MSYS2 installation directory
+	msys2Root = "C:\\msys64"
+
+	// chocolateyMinGWBin is where `choco install mingw` places gcc.exe
+	chocolateyMinGWBin = "C:\\ProgramData\\chocolatey\\lib\\mingw\\tools\\install\\mingw64\\bin"
+)
+
+// Toolchain provider names accepted in toolchainProviders
+const (
+	ProviderWinget     = "winget"
+	ProviderChocolatey = "chocolatey"
+	ProviderMSYS2      = "msys2"
+	ProviderOffline    = "offline"
+)
+
+// toolchainProvider installs a C toolchain through one package source
+type toolchainProvider interface {
+	// Name identifies the provider in config and logs
+	Name() string
+
+	// Available reports whether the provider can run on this host
+	Available() bool
+
+	// Install provisions the toolchain
+	Install(ctx context.Context) error
+
+	// BinPath returns the directory holding gcc after Install, or ""
+	BinPath() string
+}
+
+// ProviderAttempt records the outcome of one provider
+type ProviderAttempt struct {
+	Provider string
+	Err      error
+}
+
+// ToolchainProvisionError lists every provider tried when none produced a
+// working toolchain
+type ToolchainProvisionError struct {
+	Attempts []ProviderAttempt
+}
+
+func (e *ToolchainProvisionError) Error() string {
+	if len(e.Attempts) == 0 {
+		return "no toolchain providers configured"
+	}
+	var parts []string
+	for _, attempt := range e.Attempts {
+		parts = append(parts, fmt.Sprintf("%s: %v", attempt.Provider, attempt.Err))
+	}
+	return "toolchain provisioning failed (" + strings.Join(parts, "; ") + ")"
+}
+
+// newToolchainProvider returns the provider called name, or nil if the name
+// is unknown
+func newToolchainProvider(name string, config *UpdaterConfig, dataDir string) toolchainProvider {
+	switch name {
+	case ProviderWinget:
+		return &wingetProvider{packageID: config.WingetPackage}
+	case ProviderChocolatey:
+		return &chocolateyProvider{}
+	case ProviderMSYS2:
+		return &msys2Provider{root: msys2Root}
+	case ProviderOffline:
+		return &offlineProvider{
+			archive: config.ToolchainArchivePath,
+			sha256:  config.ToolchainArchiveSHA256,
+			destDir: filepath.Join(dataDir, toolchainArchiveDirName),
+		}
+	}
+	return nil
+}
+
+// configuredToolchainProviders returns the providers listed in config, in order
+func configuredToolchainProviders(config *UpdaterConfig, dataDir string) []toolchainProvider {
+	var providers []toolchainProvider
+	for _, name := range config.ToolchainProviders {
+		if provider := newToolchainProvider(name, config, dataDir); provider != nil {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// provisionToolchain tries each provider in order and returns the gcc
+// directory of the first one that installs a working toolchain
+func provisionToolchain(providers []toolchainProvider, timeout time.Duration) (string, error) {
+	provisionErr := &ToolchainProvisionError{}
+
+	for _, provider := range providers {
+		LogInfo("Trying toolchain provider %s...", provider.Name())
+		gccDir, err := runToolchainProvider(provider, timeout)
+		if err != nil {
+			LogWarning("Toolchain provider %s failed: %v", provider.Name(), err)
+			provisionErr.Attempts = append(provisionErr.Attempts, ProviderAttempt{Provider: provider.Name(), Err: err})
+			continue
+		}
+		LogInfo("Toolchain provider %s installed GCC at: %s", provider.Name(), gccDir)
+		return gccDir, nil
+	}
+
+	return "", provisionErr
+}
+
+// runToolchainProvider installs through one provider and checks that gcc runs
+func runToolchainProvider(provider toolchainProvider, timeout time.Duration) (string, error) {
+	if !provider.Available() {
+		return "", fmt.Errorf("not available on this host")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := provider.Install(ctx); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("install timed out after %v: %w", timeout, err)
+		}
+		return "", err
+	}
+
+	gccDir := provider.BinPath()
+	if gccDir == "" {
+		return "", fmt.Errorf("gcc not found after install")
+	}
+	if _, err := gccVersion(gccDir); err != nil {
+		return "", err
+	}
+	return gccDir, nil
+}
+
+// runInstallCommand runs an installer, killing it when ctx expires, and
+// includes its output in the error
+func runInstallCommand(ctx context.Context, name string, args ...string) error {
+	LogInfo("Executing: %s %s", name, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = installerWaitDelay
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// wingetProvider installs a MinGW package, WinLibs by default, with winget
+type wingetProvider struct {
+	packageID string
+}
+
+func (p *wingetProvider) Name() string { return ProviderWinget }
+
+func (p *wingetProvider) Available() bool {
+	_, err := exec.LookPath("winget")
+	return err == nil
+}
+
+func (p *wingetProvider) Install(ctx context.Context) error {
+	LogInfo("Installing winget package %s", p.packageID)
+	return runInstallCommand(ctx, "winget", "install", "--id", p.packageID, "--exact",
+		"--silent", "--accept-package-agreements", "--accept-source-agreements")
+}
+
+func (p *wingetProvider) BinPath() string {
+	return findGCCOutsidePath()
+}
+
+// chocolateyProvider installs MinGW with Chocolatey
+type chocolateyProvider struct{}
+
+func (p *chocolateyProvider) Name() string { return ProviderChocolatey }
+
+func (p *chocolateyProvider) Available() bool {
+	_, err := exec.LookPath("choco")
+	return err == nil
+}
+
+func (p *chocolateyProvider) Install(ctx context.Context) error {
+	return runInstallCommand(ctx, "choco", "install", "mingw", "-y", "--no-progress")
+}
+
+func (p *chocolateyProvider) BinPath() string {
+	if _, err := os.Stat(gccExecutable(chocolateyMinGWBin)); err == nil {
+		return chocolateyMinGWBin
+	}
+	return findGCCOutsidePath()
+}
+
+// msys2Provider installs the UCRT64 gcc package into an existing MSYS2
+type msys2Provider struct {
+	root string
+}
+
+func (p *msys2Provider) Name() string { return ProviderMSYS2 }
+
+func (p *msys2Provider) pacman() string {
+	return filepath.Join(p.root, "usr", "bin", "pacman.exe")
+}
+
+func (p *msys2Provider) Available() bool {
+	_, err := os.Stat(p.pacman())
+	return err == nil
+}
+
+func (p *msys2Provider) Install(ctx context.Context) error {
+	return runInstallCommand(ctx, p.pacman(), "-S", "--noconfirm", "--needed", "mingw-w64-ucrt-x86_64-gcc")
+}
+
+func (p *msys2Provider) BinPath() string {
+	dir := filepath.Join(p.root, "ucrt64", "bin")
+	if _, err := os.Stat(gccExecutable(dir)); err == nil {
+		return dir
+	}
+	return ""
+}
+
+// offlineProvider extracts a WinLibs zip from a local or UNC path after
+// verifying its SHA-256 checksum
+type offlineProvider struct {
+	archive string
+	sha256  string
+	destDir string
+}
+
+func (p *offlineProvider) Name() string { return ProviderOffline }
+
+func (p *offlineProvider) Available() bool {
+	if p.archive == "" {
+		return false
+	}
+	_, err := os.Stat(p.archive)
+	return err == nil
+}
+
+func (p *offlineProvider) Install(ctx context.Context) error {
+	if p.sha256 == "" {
+		return fmt.Errorf("toolchainArchiveSHA256 is not configured")
+	}
+	sum, err := fileSHA256(p.archive)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, p.sha256) {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", p.archive, sum, p.sha256)
+	}
+
+	LogInfo("Extracting %s to %s", p.archive, p.destDir)
+	if err := os.RemoveAll(p.destDir); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", p.destDir, err)
+	}
+	return extractZip(ctx, p.archive, p.destDir)
+}
+
+func (p *offlineProvider) BinPath() string {
+	for _, dir := range []string{"mingw64", "mingw32", filepath.Join("*", "mingw64"), filepath.Join("*", "mingw32")} {
+		matches, _ := filepath.Glob(filepath.Join(p.destDir, dir, "bin"))
+		for _, match := range matches {
+			if _, err := os.Stat(gccExecutable(match)); err == nil {
+				return match
+			}
+		}
+	}
+	return ""
+}
+
+// extractZip extracts archive into destDir, rejecting entries that would
+// escape it
+func extractZip(ctx context.Context, archive, destDir string) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", archive, err)
+	}
+	defer r.Close()
+
+	root := filepath.Clean(destDir) + string(os.PathSeparator)
+	for _, file := range r.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		target := filepath.Join(destDir, file.Name)
+		if !strings.HasPrefix(target, root) {
+			return fmt.Errorf("archive entry %q escapes the extraction directory", file.Name)
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractZipFile(file, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(file *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s from archive: %w", file.Name, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to extract %s: %w", file.Name, err)
+	}
+	return dst.Close()
+}
@@ -0,0 +1,167 @@
+package updater
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a toolchainProvider with scripted results
+type fakeProvider struct {
+	name       string
+	available  bool
+	installErr error
+	binPath    string
+	installs   int
+}
+
+func (p *fakeProvider) Name() string    { return p.name }
+func (p *fakeProvider) Available() bool { return p.available }
+func (p *fakeProvider) BinPath() string { return p.binPath }
+
+func (p *fakeProvider) Install(ctx context.Context) error {
+	p.installs++
+	return p.installErr
+}
+
+// TestProvisionToolchainOrder verifies that providers are tried in order and
+// the first working one wins
+func TestProvisionToolchainOrder(t *testing.T) {
+	gccDir := writeFakeGCC(t)
+
+	unavailable := &fakeProvider{name: "first"}
+	failing := &fakeProvider{name: "second", available: true, installErr: errors.New("blocked by policy")}
+	working := &fakeProvider{name: "third", available: true, binPath: gccDir}
+	unused := &fakeProvider{name: "fourth", available: true, binPath: gccDir}
+
+	dir, err := provisionToolchain([]toolchainProvider{unavailable, failing, working, unused}, time.Minute)
+	if err != nil {
+		t.Fatalf("provisionToolchain() failed: %v", err)
+	}
+	if dir != gccDir {
+		t.Errorf("provisionToolchain() = %s; want %s", dir, gccDir)
+	}
+	if unavailable.installs != 0 || unused.installs != 0 {
+		t.Errorf("installs = %d, %d; want unavailable and later providers skipped", unavailable.installs, unused.installs)
+	}
+}
+
+// TestProvisionToolchainReportsAttempts verifies that the error names every
+// provider that was tried
+func TestProvisionToolchainReportsAttempts(t *testing.T) {
+	providers := []toolchainProvider{
+		&fakeProvider{name: "winget"},
+		&fakeProvider{name: "chocolatey", available: true, installErr: errors.New("exit status 1")},
+		&fakeProvider{name: "msys2", available: true},
+	}
+
+	_, err := provisionToolchain(providers, time.Minute)
+	var provisionErr *ToolchainProvisionError
+	if !errors.As(err, &provisionErr) {
+		t.Fatalf("provisionToolchain() error = %v; want *ToolchainProvisionError", err)
+	}
+	if len(provisionErr.Attempts) != 3 {
+		t.Errorf("Attempts = %d; want 3", len(provisionErr.Attempts))
+	}
+	for _, name := range []string{"winget", "chocolatey", "msys2"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+}
+
+// writeToolchainZip writes a zip holding mingw64/bin/gcc and returns its path
+// and SHA-256
+func writeToolchainZip(t *testing.T) (string, string) {
+	gcc, err := os.ReadFile(gccExecutable(writeFakeGCC(t)))
+	if err != nil {
+		t.Fatalf("failed to read fake gcc: %v", err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "winlibs.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	w := zip.NewWriter(f)
+	header := &zip.FileHeader{Name: "mingw64/bin/" + filepath.Base(gccExecutable("")), Method: zip.Deflate}
+	header.SetMode(0755)
+	entry, err := w.CreateHeader(header)
+	if err != nil {
+		t.Fatalf("failed to add archive entry: %v", err)
+	}
+	entry.Write(gcc)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	f.Close()
+
+	sum, err := fileSHA256(archive)
+	if err != nil {
+		t.Fatalf("fileSHA256() failed: %v", err)
+	}
+	return archive, sum
+}
+
+// TestOfflineProvider verifies that the archive is extracted only when its
+// checksum matches
+func TestOfflineProvider(t *testing.T) {
+	archive, sum := writeToolchainZip(t)
+
+	bad := &offlineProvider{archive: archive, sha256: strings.Repeat("0", 64), destDir: t.TempDir()}
+	if _, err := runToolchainProvider(bad, time.Minute); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("runToolchainProvider() with wrong checksum error = %v; want checksum mismatch", err)
+	}
+
+	destDir := filepath.Join(t.TempDir(), "toolchain")
+	good := &offlineProvider{archive: archive, sha256: strings.ToUpper(sum), destDir: destDir}
+	dir, err := runToolchainProvider(good, time.Minute)
+	if err != nil {
+		t.Fatalf("runToolchainProvider() failed: %v", err)
+	}
+	if want := filepath.Join(destDir, "mingw64", "bin"); dir != want {
+		t.Errorf("runToolchainProvider() = %s; want %s", dir, want)
+	}
+}
+
+// TestLoadConfigPathToolchainProviders verifies that provider names are
+// normalized and unknown ones dropped
+func TestLoadConfigPathToolchainProviders(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "updater-config.json")
+	content := `{"toolchainProviders": ["Chocolatey", "scoop", "offline"]}`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := loadConfigPath(configPath)
+	if err != nil {
+		t.Fatalf("loadConfigPath() failed: %v", err)
+	}
+	if strings.Join(config.ToolchainProviders, ",") != "chocolatey,offline" {
+		t.Errorf("ToolchainProviders = %v; want [chocolatey offline]", config.ToolchainProviders)
+	}
+}
+
+// blockingProvider waits in Install until its context is cancelled
+type blockingProvider struct{ fakeProvider }
+
+func (p *blockingProvider) Install(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestRunToolchainProviderTimeout verifies that an install is cancelled once
+// the configured timeout elapses
+func TestRunToolchainProviderTimeout(t *testing.T) {
+	provider := &blockingProvider{fakeProvider{name: "slow", available: true}}
+
+	_, err := runToolchainProvider(provider, 20*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("runToolchainProvider() error = %v; want timeout", err)
+	}
+}
@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestLocateGCCSearchDisabled verifies that a missing gcc is classified and
+// the search outside PATH is skipped when disabled
+func TestLocateGCCSearchDisabled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	original := findGCCOutsidePath
+	defer func() { findGCCOutsidePath = original }()
+
+	searched := false
+	findGCCOutsidePath = func() string {
+		searched = true
+		return ""
+	}
+
+	_, err := locateGCC(t.TempDir(), false, os.Environ())
+	if ErrorCodeOf(err) != ErrCodeToolchainMissing {
+		t.Errorf("locateGCC(false) error = %v; want %s", err, ErrCodeToolchainMissing)
+	}
+	if searched {
+		t.Error("locateGCC(false) searched outside PATH")
+	}
+}
+
+// TestLocateGCCSearchEnabled verifies that a gcc found outside PATH is returned
+func TestLocateGCCSearchEnabled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	original := findGCCOutsidePath
+	defer func() { findGCCOutsidePath = original }()
+	findGCCOutsidePath = func() string { return `C:\mingw64\bin` }
+
+	dir, err := locateGCC(t.TempDir(), true, os.Environ())
+	if err != nil {
+		t.Fatalf("locateGCC(true) failed: %v", err)
+	}
+	if dir != `C:\mingw64\bin` {
+		t.Errorf("locateGCC(true) = %s; want C:\\mingw64\\bin", dir)
+	}
+}
+
+// writeFakeGCC creates a gcc script in a new directory that prints a version
+func writeFakeGCC(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake gcc script requires a Unix shell")
+	}
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'gcc (fake) 13.2.0'\n"
+	if err := os.WriteFile(gccExecutable(dir), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake gcc: %v", err)
+	}
+	return dir
+}
+
+// TestLocateGCCCachesScanResult verifies that a gcc found by the scan is cached
+// and reused without scanning on the next lookup
+func TestLocateGCCCachesScanResult(t *testing.T) {
+	gccDir := writeFakeGCC(t)
+	dataDir := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+
+	original := findGCCOutsidePath
+	defer func() { findGCCOutsidePath = original }()
+
+	scans := 0
+	findGCCOutsidePath = func() string {
+		scans++
+		return gccDir
+	}
+
+	for i := 0; i < 2; i++ {
+		dir, err := locateGCC(dataDir, true, os.Environ())
+		if err != nil || dir != gccDir {
+			t.Fatalf("locateGCC() = %s, %v; want %s", dir, err, gccDir)
+		}
+	}
+	if scans != 1 {
+		t.Errorf("scanned %d times; want 1", scans)
+	}
+
+	cache, err := loadToolchainCache(dataDir)
+	if err != nil || cache == nil {
+		t.Fatalf("loadToolchainCache() = %v, %v; want cache", cache, err)
+	}
+	if cache.Version != "gcc (fake) 13.2.0" {
+		t.Errorf("cached version = %q; want %q", cache.Version, "gcc (fake) 13.2.0")
+	}
+}
+
+// TestLocateGCCInvalidCache verifies that a cached gcc that no longer exists
+// is discarded and the scan runs again
+func TestLocateGCCInvalidCache(t *testing.T) {
+	gccDir := writeFakeGCC(t)
+	dataDir := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+
+	stale := &ToolchainCache{GCCDir: filepath.Join(t.TempDir(), "removed")}
+	if err := writeJSONFile(filepath.Join(dataDir, toolchainCacheFileName), stale); err != nil {
+		t.Fatalf("failed to write cache: %v", err)
+	}
+
+	original := findGCCOutsidePath
+	defer func() { findGCCOutsidePath = original }()
+
+	scanned := false
+	findGCCOutsidePath = func() string {
+		scanned = true
+		return gccDir
+	}
+
+	dir, err := locateGCC(dataDir, true, os.Environ())
+	if err != nil || dir != gccDir {
+		t.Fatalf("locateGCC() = %s, %v; want %s", dir, err, gccDir)
+	}
+	if !scanned {
+		t.Error("locateGCC() did not rescan after the cached gcc failed validation")
+	}
+
+	cache, _ := loadToolchainCache(dataDir)
+	if cache == nil || cache.GCCDir != gccDir {
+		t.Errorf("toolchain cache = %+v; want %s", cache, gccDir)
+	}
+}
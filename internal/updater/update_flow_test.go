@@ -0,0 +1,449 @@
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// fakeVersionMarker precedes the version a fake agent binary reports
+const fakeVersionMarker = "sentinel version "
+
+// fakeUpdate is an update faked by useFakeUpdate
+type fakeUpdate struct {
+	// binary is the agent binary
+	binary string
+
+	// header starts the binaries go install writes, making them executables
+	// for the host
+	header []byte
+
+	// install is how go install turns out: "" builds the version, "fail"
+	// fails with a compile error and "checksum" with a checksum mismatch
+	install string
+
+	manager *servicetest.FakeManager
+	runner  *commandtest.FakeRunner
+}
+
+// run answers the commands of an update the way the agent binary and go
+// would. Asked for --version, a binary prints what follows fakeVersionMarker
+// in it. go install writes a binary reporting the requested version to
+// GOBIN, or fails as install says. go list resolves any module@version
+// query to that version.
+func (f *fakeUpdate) run(call commandtest.Call) commandtest.Result {
+	switch {
+	case len(call.Args) > 0 && call.Args[0] == "list" && strings.Contains(call.Args[len(call.Args)-1], "@"):
+		_, version, _ := strings.Cut(call.Args[len(call.Args)-1], "@")
+		return commandtest.Result{Stdout: fmt.Sprintf(`{"Version": %q}`, version)}
+	case slices.Equal(call.Args, []string{"--version"}):
+		data, err := os.ReadFile(call.Name)
+		if i := bytes.Index(data, []byte(fakeVersionMarker)); err == nil && i >= 0 {
+			return commandtest.Result{Stdout: string(data[i:]) + "\n"}
+		}
+		return commandtest.Failure("not an agent binary")
+	case len(call.Args) == 2 && call.Args[0] == "install":
+		module, version, _ := strings.Cut(call.Args[1], "@")
+		switch f.install {
+		case "fail":
+			return commandtest.Failure(fmt.Sprintf("# %s\n./main.go:12:2: undefined: agent.Run\n", module))
+		case "checksum":
+			return commandtest.Failure(fmt.Sprintf("verifying %s@%s: checksum mismatch\n\tdownloaded: h1:AAAA\n\tsum.golang.org: h1:BBBB\n\n"+
+				"SECURITY ERROR\nThis download does NOT match the one reported by the checksum server.\n", module, version))
+		}
+		binary := filepath.Join(call.Getenv("GOBIN"), path.Base(module))
+		if err := os.WriteFile(binary, append(f.header, fakeVersionMarker+version...), 0755); err != nil {
+			return commandtest.Failure(err.Error())
+		}
+		return commandtest.Result{}
+	}
+	return commandtest.Failure(fmt.Sprintf("unexpected command %s", call))
+}
+
+// useFakeUpdate sets up an update of an agent reporting v1.0.0, installed as
+// the sentinelgo service, in a temporary data directory, with the service
+// manager and the commands the update runs faked
+func useFakeUpdate(t *testing.T) *fakeUpdate {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go on PATH is not an executable on Windows")
+	}
+	header := hostBinaryHeader(t)
+	if header == nil {
+		t.Skipf("no executable fixture for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	saveLogger(t)
+	fakeClock(t)
+
+	dataDir := t.TempDir()
+	paths.SetDataDirectory(dataDir)
+	t.Cleanup(func() { paths.SetDataDirectory("") })
+
+	original := isPrivileged
+	isPrivileged = func() bool { return true }
+	t.Cleanup(func() { isPrivileged = original })
+
+	// findGoBinary needs a go on PATH, though the runner fakes it
+	goDir := t.TempDir()
+	writeLog(t, filepath.Join(goDir, "go"), "#!/bin/sh\necho '{}'\n")
+	if err := os.Chmod(filepath.Join(goDir, "go"), 0755); err != nil {
+		t.Fatalf("failed to make fake go executable: %v", err)
+	}
+	t.Setenv("PATH", goDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GOROOT", goDir)
+	// Keep the real Go caches out of reach of the update's cleanup
+	gopath := t.TempDir()
+	t.Setenv("GOPATH", gopath)
+	t.Setenv("GOCACHE", filepath.Join(gopath, "cache"))
+	t.Setenv("GOMODCACHE", filepath.Join(gopath, "pkg", "mod"))
+
+	binary := filepath.Join(t.TempDir(), "sentinel")
+	if err := os.WriteFile(binary, append(header, fakeVersionMarker+"v1.0.0"...), 0755); err != nil {
+		t.Fatalf("failed to write agent binary: %v", err)
+	}
+
+	config := defaultConfig()
+	config.BinaryPath = binary
+	config.EnableAutoDetection = false
+	config.CGOEnabled = CGOModeFalse
+	config.BackupDatabase = false
+	config.ArtifactCacheMaxMB = 0
+	config.GoCacheMaxMB = 0
+	config.MinFreeSpaceMB = 0
+	config.VerifyRetries = 1
+	withConfig(t, config)
+
+	update := &fakeUpdate{
+		binary: binary,
+		header: header,
+		manager: &servicetest.FakeManager{
+			Binaries: map[string]string{MainAgentServiceName: binary},
+			Running:  map[string]bool{MainAgentServiceName: true},
+		},
+	}
+	update.runner = &commandtest.FakeRunner{Handler: update.run}
+	useServiceManager(t, update.manager)
+	useRunner(t, update.runner)
+	return update
+}
+
+// failOnce is a service manager that fails the first call of method, and
+// otherwise is its FakeManager
+type failOnce struct {
+	*servicetest.FakeManager
+	method string
+	failed bool
+}
+
+// fail reports whether method fails this time
+func (m *failOnce) fail(method string) error {
+	if method != m.method || m.failed {
+		return nil
+	}
+	m.failed = true
+	return fmt.Errorf("%s failed", method)
+}
+
+func (m *failOnce) Stop(serviceName string) error {
+	if err := m.fail("stop"); err != nil {
+		return err
+	}
+	return m.FakeManager.Stop(serviceName)
+}
+
+func (m *failOnce) Uninstall(serviceName string) error {
+	if err := m.fail("uninstall"); err != nil {
+		return err
+	}
+	return m.FakeManager.Uninstall(serviceName)
+}
+
+func (m *failOnce) Install(serviceName, binaryPath string) error {
+	if err := m.fail("install"); err != nil {
+		return err
+	}
+	return m.FakeManager.Install(serviceName, binaryPath)
+}
+
+func (m *failOnce) Start(serviceName string) error {
+	if err := m.fail("start"); err != nil {
+		return err
+	}
+	return m.FakeManager.Start(serviceName)
+}
+
+// TestPerformUpdateSuccess verifies that an update builds the version,
+// replaces the binary, cycles the service in order and retains a backup
+func TestPerformUpdateSuccess(t *testing.T) {
+	update := useFakeUpdate(t)
+
+	if err := performUpdate("v1.1.0", true); err != nil {
+		t.Fatalf("performUpdate() failed: %v", err)
+	}
+	if version, err := installedVersionAt(update.binary); err != nil || version != "v1.1.0" {
+		t.Errorf("installed version = %q, %v; want v1.1.0", version, err)
+	}
+	want := []string{"stop sentinelgo", "uninstall sentinelgo", "install sentinelgo " + update.binary, "start sentinelgo"}
+	if calls := update.manager.CallLog(); !slices.Equal(calls, want) {
+		t.Errorf("service calls = %q; want %q", calls, want)
+	}
+	if backups, err := ListBackups(); err != nil || len(backups) != 1 || backups[0].Version != "v1.0.0" {
+		t.Errorf("ListBackups() = %+v, %v; want the v1.0.0 backup", backups, err)
+	}
+	if marker, err := loadUpdateMarker(paths.GetDataDirectory()); err != nil || marker != nil {
+		t.Errorf("update marker after success = %+v, %v; want none", marker, err)
+	}
+	entries, err := loadHistory(paths.GetDataDirectory())
+	if err != nil || len(entries) != 1 || entries[0].FromVersionDetails != fakeVersionMarker+"v1.0.0" {
+		t.Errorf("history = %+v, %v; want the full version string of v1.0.0", entries, err)
+	}
+
+	var installs []commandtest.Call
+	for _, call := range update.runner.Calls {
+		if slices.Contains(call.Args, "install") {
+			installs = append(installs, call)
+		}
+	}
+	if len(installs) != 1 {
+		t.Fatalf("go install ran %d times; want once", len(installs))
+	}
+	if module, want := installs[0].Args[1], getConfig().agentPackagePath()+"@v1.1.0"; module != want {
+		t.Errorf("go install %s; want %s", module, want)
+	}
+	if cgo := installs[0].Getenv("CGO_ENABLED"); cgo != "0" {
+		t.Errorf("go install ran with CGO_ENABLED=%q; want 0", cgo)
+	}
+	if gobin, want := installs[0].Getenv("GOBIN"), paths.BuildBinDirectory(paths.GetDataDirectory()); gobin != want {
+		t.Errorf("go install ran with GOBIN=%s; want %s", gobin, want)
+	}
+}
+
+// TestPerformUpdateFailures verifies that a failure at each step of an
+// update rolls the agent back to the version it ran, restarted
+func TestPerformUpdateFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(update *fakeUpdate)
+		wantCode  ErrorCode
+		wantErr   string
+		wantCalls []string
+	}{
+		{
+			name:      "compile",
+			setup:     func(update *fakeUpdate) { update.install = "fail" },
+			wantErr:   "undefined: agent.Run",
+			wantCalls: []string{"stop", "uninstall", "stop", "install", "start"},
+		},
+		{
+			name:      "checksum",
+			setup:     func(update *fakeUpdate) { update.install = "checksum" },
+			wantCode:  ErrCodeChecksumMismatch,
+			wantErr:   "checksum mismatch",
+			wantCalls: []string{"stop", "uninstall", "stop", "install", "start"},
+		},
+		{
+			name: "install service",
+			setup: func(update *fakeUpdate) {
+				useServiceManager(t, &failOnce{FakeManager: update.manager, method: "install"})
+			},
+			wantErr:   "install failed",
+			wantCalls: []string{"stop", "uninstall", "stop", "install", "start"},
+		},
+		{
+			name: "start service",
+			setup: func(update *fakeUpdate) {
+				useServiceManager(t, &failOnce{FakeManager: update.manager, method: "start"})
+			},
+			wantErr:   "start failed",
+			wantCalls: []string{"stop", "uninstall", "install", "stop", "install", "start"},
+		},
+		{
+			name: "health check",
+			setup: func(update *fakeUpdate) {
+				getConfig().PostUpdateHealthCheck = "check-agent"
+				name, args := shellArgs("check-agent")
+				update.runner.Results = map[string]commandtest.Result{
+					commandtest.Call{Name: name, Args: args}.String(): commandtest.Failure("agent unhealthy"),
+				}
+			},
+			wantCode:  ErrCodeHealthCheckFailed,
+			wantErr:   "health check failed",
+			wantCalls: []string{"stop", "uninstall", "install", "start", "stop", "install", "start"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := useFakeUpdate(t)
+			tt.setup(update)
+
+			err := performUpdate("v1.1.0", true)
+			if err == nil || !strings.Contains(err.Error(), "rolled back to version v1.0.0") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("performUpdate() = %v; want a rollback to v1.0.0 after %q", err, tt.wantErr)
+			}
+			if code := ErrorCodeOf(err); code != tt.wantCode {
+				t.Errorf("ErrorCodeOf() = %q; want %q", code, tt.wantCode)
+			}
+			var updateErr *UpdateError
+			if tt.wantCode == "" && errors.As(err, &updateErr) {
+				t.Errorf("%s failure classified as %s", tt.name, updateErr.Code)
+			}
+
+			if version, err := installedVersionAt(update.binary); err != nil || version != "v1.0.0" {
+				t.Errorf("installed version after rollback = %q, %v; want v1.0.0", version, err)
+			}
+			var calls []string
+			for _, call := range update.manager.CallLog() {
+				method, _, _ := strings.Cut(call, " ")
+				calls = append(calls, method)
+			}
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("service calls = %q; want %q", calls, tt.wantCalls)
+			}
+			if running, _ := update.manager.IsRunning(MainAgentServiceName); !running {
+				t.Error("agent service not running after rollback")
+			}
+		})
+	}
+}
+
+// TestPerformUpdateRefusesRejectedVersion verifies that a version below
+// minVersion is refused before the agent is touched
+func TestPerformUpdateRefusesRejectedVersion(t *testing.T) {
+	update := useFakeUpdate(t)
+	getConfig().MinVersion = "v1.1.0"
+
+	if err := performUpdate("v1.0.5", false); ErrorCodeOf(err) != ErrCodeVersionRejected {
+		t.Fatalf("performUpdate() = %v; want VERSION_REJECTED", err)
+	}
+	if calls := update.manager.CallLog(); len(calls) != 0 {
+		t.Errorf("service calls = %q; want none", calls)
+	}
+	if calls := update.runner.CallLog(); len(calls) != 0 {
+		t.Errorf("commands run = %q; want none", calls)
+	}
+	if version, err := installedVersionAt(update.binary); err != nil || version != "v1.0.0" {
+		t.Errorf("installed version = %q, %v; want v1.0.0", version, err)
+	}
+}
+
+// TestPerformUpdateLeavesEnvironment verifies that an update builds with an
+// environment of its own, leaving the updater's unchanged
+func TestPerformUpdateLeavesEnvironment(t *testing.T) {
+	useFakeUpdate(t)
+	t.Setenv("HOME", "")
+	before := os.Environ()
+
+	if err := performUpdate("v1.1.0", true); err != nil {
+		t.Fatalf("performUpdate() failed: %v", err)
+	}
+	if after := os.Environ(); !slices.Equal(after, before) {
+		t.Errorf("performUpdate() changed the process environment:\n%q\nwant\n%q", after, before)
+	}
+}
+
+// TestPerformUpdateFreshInstall verifies that with allowInstallWhenMissing
+// an agent binary that is missing or does not report its version is
+// replaced by the target version without a backup, and the service is only
+// installed and started
+func TestPerformUpdateFreshInstall(t *testing.T) {
+	tests := []struct {
+		name   string
+		binary func(path string) error
+	}{
+		{"missing", os.Remove},
+		{"broken", func(path string) error { return os.WriteFile(path, []byte("truncated"), 0755) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := useFakeUpdate(t)
+			getConfig().AllowInstallWhenMissing = true
+			if err := tt.binary(update.binary); err != nil {
+				t.Fatalf("failed to prepare agent binary: %v", err)
+			}
+
+			if err := performUpdate("v1.1.0", true); err != nil {
+				t.Fatalf("performUpdate() failed: %v", err)
+			}
+			if version, err := installedVersionAt(update.binary); err != nil || version != "v1.1.0" {
+				t.Errorf("installed version = %q, %v; want v1.1.0", version, err)
+			}
+			want := []string{"install sentinelgo " + update.binary, "start sentinelgo"}
+			if calls := update.manager.CallLog(); !slices.Equal(calls, want) {
+				t.Errorf("service calls = %q; want %q", calls, want)
+			}
+			if backups, err := ListBackups(); err != nil || len(backups) != 0 {
+				t.Errorf("ListBackups() = %+v, %v; want none", backups, err)
+			}
+			if _, err := os.Stat(update.binary + ".backup"); !os.IsNotExist(err) {
+				t.Errorf("backup file exists after fresh install: %v", err)
+			}
+			if marker, err := loadUpdateMarker(paths.GetDataDirectory()); err != nil || marker != nil {
+				t.Errorf("update marker after install = %+v, %v; want none", marker, err)
+			}
+			entries, err := loadHistory(paths.GetDataDirectory())
+			if err != nil || len(entries) != 1 || entries[0].Action != HistoryActionInstall || !entries[0].Success || entries[0].ToVersion != "v1.1.0" {
+				t.Errorf("history = %+v, %v; want a successful install of v1.1.0", entries, err)
+			}
+		})
+	}
+}
+
+// TestPerformUpdateFreshInstallFailure verifies that a failed fresh install
+// reports the failure without attempting a rollback
+func TestPerformUpdateFreshInstallFailure(t *testing.T) {
+	update := useFakeUpdate(t)
+	getConfig().AllowInstallWhenMissing = true
+	update.install = "fail"
+	if err := os.Remove(update.binary); err != nil {
+		t.Fatalf("failed to remove agent binary: %v", err)
+	}
+
+	err := performUpdate("v1.1.0", true)
+	if err == nil || !strings.Contains(err.Error(), "install failed") || strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("performUpdate() = %v; want an install failure without rollback", err)
+	}
+	if calls := update.manager.CallLog(); len(calls) != 0 {
+		t.Errorf("service calls = %q; want none", calls)
+	}
+	if _, err := os.Stat(update.binary); !os.IsNotExist(err) {
+		t.Errorf("agent binary exists after failed install: %v", err)
+	}
+	entries, err := loadHistory(paths.GetDataDirectory())
+	if err != nil || len(entries) != 1 || entries[0].Action != HistoryActionInstall || entries[0].Success {
+		t.Errorf("history = %+v, %v; want a failed install", entries, err)
+	}
+}
+
+// TestPerformUpdateRefusesMissingBinary verifies that without
+// allowInstallWhenMissing an update aborts before touching the service or
+// running a build when the agent binary is missing
+func TestPerformUpdateRefusesMissingBinary(t *testing.T) {
+	update := useFakeUpdate(t)
+	if err := os.Remove(update.binary); err != nil {
+		t.Fatalf("failed to remove agent binary: %v", err)
+	}
+
+	err := performUpdate("v1.1.0", true)
+	if err == nil || !strings.Contains(err.Error(), "current binary not detected") {
+		t.Fatalf("performUpdate() = %v; want current binary not detected", err)
+	}
+	if calls := update.manager.CallLog(); len(calls) != 0 {
+		t.Errorf("service calls = %q; want none", calls)
+	}
+	if calls := update.runner.CallLog(); len(calls) != 0 {
+		t.Errorf("commands run = %q; want none", calls)
+	}
+	if _, err := os.Stat(update.binary); !os.IsNotExist(err) {
+		t.Errorf("agent binary exists after aborted update: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+// updateTransition moves an update into step. The journal records the step
+// only after run succeeds, so a restart repeats an interrupted transition.
+type updateTransition struct {
+	step        updateStep
+	description string
+	run         func() error
+}
+
+// runUpdateTransitions runs the transitions that come after the marker's
+// current step in order, journaling each completed step to dataDir
+func runUpdateTransitions(dataDir string, marker *UpdateMarker, transitions []updateTransition) error {
+	current := stepIndex(marker.Step)
+
+	for _, transition := range transitions {
+		index := stepIndex(transition.step)
+		if index <= current {
+			continue
+		}
+
+		LogInfo("Step %d/%d: %s...", index+1, len(updateSteps), transition.description)
+		heartbeat(fmt.Sprintf("%s: step %d/%d, %s", ActivityUpdating, index+1, len(updateSteps), transition.description), time.Time{})
+		if err := transition.run(); err != nil {
+			return err
+		}
+		markUpdateStep(dataDir, marker, transition.step)
+	}
+
+	return nil
+}
+
+// updateRun carries the state shared by the transitions of one update
+type updateRun struct {
+	dataDir string
+	marker  *UpdateMarker
+	backup  *BackupInfo
+}
+
+// transitions returns every transition after the backup has been created
+func (u *updateRun) transitions() []updateTransition {
+	return []updateTransition{
+		{stepServiceStopped, "Stopping main agent service", u.stopAgent},
+		{stepServiceUninstalled, "Uninstalling main agent service", u.uninstallAgent},
+		{stepCompiled, fmt.Sprintf("Downloading and compiling version %s", u.marker.TargetVersion), u.compile},
+		{stepBinaryInstalled, "Installing new binary", u.installBinary},
+		{stepServiceInstalled, "Reinstalling main agent service", u.installService},
+		{stepServiceStarted, "Starting main agent service", u.startService},
+		{stepVerified, "Verifying updated agent", u.verify},
+	}
+}
+
+func (u *updateRun) stopAgent() error {
+	if err := serviceManager.Stop(agentServiceName()); err != nil {
+		return fmt.Errorf("failed to stop main agent: %w", err)
+	}
+	LogInfo("Main agent service stopped successfully")
+
+	if !getConfig().BackupDatabase {
+		LogInfo("Database backup disabled by configuration")
+		return nil
+	}
+
+	// Snapshot while the agent is stopped so the database files are consistent
+	LogInfo("Snapshotting database before update...")
+	snapshot, err := snapshotDatabase(paths.GetDatabasePath(), paths.GetBackupDirectory())
+	if err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	u.backup.Database = snapshot
+	if err := saveBackupMetadata(u.dataDir, u.backup); err != nil {
+		LogWarning("Failed to persist database snapshot metadata: %v", err)
+	}
+	return nil
+}
+
+func (u *updateRun) uninstallAgent() error {
+	if err := serviceManager.Uninstall(agentServiceName()); err != nil {
+		return fmt.Errorf("failed to uninstall main agent: %w", err)
+	}
+	LogInfo("Main agent service uninstalled successfully")
+	return nil
+}
+
+func (u *updateRun) compile() error {
+	LogInfo("Cleaning up old files...")
+	if err := cleanupOldFiles(u.backup.BinaryPath); err != nil {
+		LogWarning("Cleanup failed: %v", err)
+	}
+
+	newBinaryPath, buildMode, err := downloadAndCompile(u.dataDir, u.marker.TargetVersion, !u.marker.NoCache)
+	if err != nil {
+		return fmt.Errorf("failed to compile: %w", err)
+	}
+	LogInfo("Compilation successful, binary at: %s", newBinaryPath)
+
+	// Journaled with the step so a resumed update can install it
+	u.marker.CompiledPath = newBinaryPath
+	u.marker.BuildMode = buildMode
+	return nil
+}
+
+func (u *updateRun) installBinary() error {
+	if u.marker.CompiledPath == "" {
+		return fmt.Errorf("compiled binary path was not recorded")
+	}
+	if err := installBinary(u.marker.CompiledPath, u.backup.BinaryPath); err != nil {
+		return fmt.Errorf("failed to install binary: %w", err)
+	}
+	LogInfo("Binary installed successfully")
+
+	if err := os.RemoveAll(paths.BuildBinDirectory(u.dataDir)); err != nil {
+		LogWarning("Failed to clean build directory: %v", err)
+	}
+	return nil
+}
+
+// installedPath is the binary the update installed. The service is
+// registered and verified with it rather than a fresh detection, which could
+// find a different copy once the new binary is in place.
+func (u *updateRun) installedPath() string {
+	return u.backup.BinaryPath
+}
+
+func (u *updateRun) installService() error {
+	installedBinaryPath := u.installedPath()
+	LogInfo("Registering binary: %s", installedBinaryPath)
+
+	if err := serviceManager.Install(agentServiceName(), installedBinaryPath); err != nil {
+		return fmt.Errorf("failed to install service: %w", err)
+	}
+	LogInfo("Service reinstalled successfully")
+	return nil
+}
+
+func (u *updateRun) startService() error {
+	if err := serviceManager.Start(agentServiceName()); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+	LogInfo("Service started successfully")
+	return nil
+}
+
+// verify confirms the agent is running, its database is intact, and the
+// configured health check passes
+func (u *updateRun) verify() error {
+	if err := verifyMainAgentRunning(u.installedPath()); err != nil {
+		LogError("Service verification failed: %v", err)
+		return fmt.Errorf("service not running after update: %w", err)
+	}
+	LogInfo("Main agent verified running")
+
+	LogInfo("Checking database integrity...")
+	if err := checkDatabaseIntegrity(paths.GetDatabasePath()); err != nil {
+		LogError("Database integrity check failed: %v", err)
+		return err
+	}
+
+	LogInfo("Running post-update health check...")
+	if err := runConfiguredHealthCheck(); err != nil {
+		LogError("Health check failed: %v", err)
+		return err
+	}
+
+	return nil
+}
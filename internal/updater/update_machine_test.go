@@ -0,0 +1,146 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// fakeTransitions builds one transition per step after backup_created. The
+// transition for failStep fails; every executed step is appended to ran.
+func fakeTransitions(failStep updateStep, ran *[]updateStep) []updateTransition {
+	var transitions []updateTransition
+	for _, step := range updateSteps[1:] {
+		step := step
+		transitions = append(transitions, updateTransition{
+			step:        step,
+			description: string(step),
+			run: func() error {
+				*ran = append(*ran, step)
+				if step == failStep {
+					return fmt.Errorf("interrupted during %s", step)
+				}
+				return nil
+			},
+		})
+	}
+	return transitions
+}
+
+// TestUpdateTransitionsInterruptAndResume interrupts the update at every
+// transition, reloads the journal as a restarted updater would, and verifies
+// that resuming runs exactly the remaining transitions
+func TestUpdateTransitionsInterruptAndResume(t *testing.T) {
+	for i, failStep := range updateSteps[1:] {
+		t.Run(string(failStep), func(t *testing.T) {
+			dataDir := t.TempDir()
+			marker := &UpdateMarker{TargetVersion: "v1.1.0", PreviousVersion: "v1.0.0"}
+			markUpdateStep(dataDir, marker, stepBackupCreated)
+
+			var ran []updateStep
+			if err := runUpdateTransitions(dataDir, marker, fakeTransitions(failStep, &ran)); err == nil {
+				t.Fatal("runUpdateTransitions() should fail at the interrupted step")
+			}
+
+			journal, err := loadUpdateMarker(dataDir)
+			if err != nil || journal == nil {
+				t.Fatalf("loadUpdateMarker() = %v, %v; want journal", journal, err)
+			}
+
+			// The failed transition must not be journaled as completed
+			lastCompleted := updateSteps[i]
+			if journal.Step != lastCompleted {
+				t.Errorf("journal step = %s; want %s", journal.Step, lastCompleted)
+			}
+			if len(journal.Journal) != i+1 {
+				t.Errorf("journal has %d entries; want %d", len(journal.Journal), i+1)
+			}
+
+			ran = nil
+			if err := runUpdateTransitions(dataDir, journal, fakeTransitions("", &ran)); err != nil {
+				t.Fatalf("resumed runUpdateTransitions() failed: %v", err)
+			}
+
+			remaining := updateSteps[i+1:]
+			if len(ran) != len(remaining) || ran[0] != failStep {
+				t.Errorf("resumed transitions = %v; want %v", ran, remaining)
+			}
+
+			final, err := loadUpdateMarker(dataDir)
+			if err != nil || final == nil || final.Step != stepVerified {
+				t.Errorf("final journal = %+v, %v; want step %s", final, err, stepVerified)
+			}
+		})
+	}
+}
+
+// TestUpdateMarkerProgress verifies the step N/M description
+func TestUpdateMarkerProgress(t *testing.T) {
+	marker := &UpdateMarker{Step: stepCompiled}
+	want := "step 4/8 (compiled)"
+	if got := marker.Progress(); got != want {
+		t.Errorf("Progress() = %s; want %s", got, want)
+	}
+}
+
+// serviceTransitions returns the transitions of run that go through the
+// service manager
+func serviceTransitions(run *updateRun) []updateTransition {
+	var transitions []updateTransition
+	for _, transition := range run.transitions() {
+		switch transition.step {
+		case stepServiceStopped, stepServiceUninstalled, stepServiceInstalled, stepServiceStarted:
+			transitions = append(transitions, transition)
+		}
+	}
+	return transitions
+}
+
+// TestUpdateServiceTransitions verifies that an update stops, uninstalls,
+// reinstalls with the installed binary and starts the configured agent
+// service in that order, and stops at the first failing call
+func TestUpdateServiceTransitions(t *testing.T) {
+	withConfig(t, &UpdaterConfig{AgentServiceName: "guard-agent"})
+	binary := filepath.Join(t.TempDir(), "guardd")
+
+	manager := &servicetest.FakeManager{
+		Binaries: map[string]string{"guard-agent": binary},
+		Running:  map[string]bool{"guard-agent": true},
+	}
+	useServiceManager(t, manager)
+	dataDir := t.TempDir()
+	marker := &UpdateMarker{TargetVersion: "v1.1.0", PreviousVersion: "v1.0.0", Step: stepBackupCreated}
+	run := &updateRun{dataDir: dataDir, marker: marker, backup: &BackupInfo{BinaryPath: binary}}
+	if err := runUpdateTransitions(dataDir, marker, serviceTransitions(run)); err != nil {
+		t.Fatalf("runUpdateTransitions() failed: %v", err)
+	}
+	want := []string{"stop guard-agent", "uninstall guard-agent", "install guard-agent " + binary, "start guard-agent"}
+	if calls := manager.CallLog(); !slices.Equal(calls, want) {
+		t.Errorf("service calls = %q; want %q", calls, want)
+	}
+	if running, _ := manager.IsRunning("guard-agent"); !running || marker.Step != stepServiceStarted {
+		t.Errorf("after the transitions running = %v, step = %s; want running, %s", running, marker.Step, stepServiceStarted)
+	}
+
+	manager = &servicetest.FakeManager{
+		Binaries: map[string]string{"guard-agent": binary},
+		Errors:   map[string]error{"install": errors.New("unit file not writable")},
+	}
+	useServiceManager(t, manager)
+	marker = &UpdateMarker{TargetVersion: "v1.1.0", PreviousVersion: "v1.0.0", Step: stepBackupCreated}
+	run = &updateRun{dataDir: dataDir, marker: marker, backup: &BackupInfo{BinaryPath: binary}}
+	if err := runUpdateTransitions(dataDir, marker, serviceTransitions(run)); err == nil {
+		t.Fatal("runUpdateTransitions() with a failing install should fail")
+	}
+	want = []string{"stop guard-agent", "uninstall guard-agent", "install guard-agent " + binary}
+	if calls := manager.CallLog(); !slices.Equal(calls, want) {
+		t.Errorf("service calls with a failing install = %q; want %q", calls, want)
+	}
+	if marker.Step != stepServiceUninstalled {
+		t.Errorf("journal step after a failing install = %s; want %s", marker.Step, stepServiceUninstalled)
+	}
+}
@@ -0,0 +1,332 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+)
+
+const (
+	// backupMetadataFileName holds the BackupInfo of the update in progress
+	backupMetadataFileName = "backup-metadata.json"
+
+	// updateMarkerFileName exists only while an update is in progress
+	updateMarkerFileName = "update-in-progress.json"
+)
+
+// updateStep records the last step an update completed
+type updateStep string
+
+const (
+	stepBackupCreated      updateStep = "backup_created"
+	stepServiceStopped     updateStep = "service_stopped"
+	stepServiceUninstalled updateStep = "service_uninstalled"
+	stepCompiled           updateStep = "compiled"
+	stepBinaryInstalled    updateStep = "binary_installed"
+	stepServiceInstalled   updateStep = "service_installed"
+	stepServiceStarted     updateStep = "service_started"
+	stepVerified           updateStep = "verified"
+)
+
+// updateSteps lists the steps in the order performUpdate completes them
+var updateSteps = []updateStep{
+	stepBackupCreated,
+	stepServiceStopped,
+	stepServiceUninstalled,
+	stepCompiled,
+	stepBinaryInstalled,
+	stepServiceInstalled,
+	stepServiceStarted,
+	stepVerified,
+}
+
+// UpdateMarker is the journal of an update in progress. It is rewritten after
+// every transition so an interrupted update can be resumed or rolled back from
+// the last completed step when the updater restarts.
+type UpdateMarker struct {
+	TargetVersion   string `json:"targetVersion"`
+	PreviousVersion string `json:"previousVersion"`
+	// PreviousVersionDetails is the full --version output of the agent
+	// being replaced
+	PreviousVersionDetails string         `json:"previousVersionDetails,omitempty"`
+	Step                   updateStep     `json:"step"`
+	CompiledPath           string         `json:"compiledPath,omitempty"`
+	BuildMode              string         `json:"buildMode,omitempty"`
+	NoCache                bool           `json:"noCache,omitempty"`
+	StartedAt              time.Time      `json:"startedAt"`
+	UpdatedAt              time.Time      `json:"updatedAt"`
+	Journal                []JournalEntry `json:"journal,omitempty"`
+}
+
+// JournalEntry records when an update completed a step
+type JournalEntry struct {
+	Step updateStep `json:"step"`
+	At   time.Time  `json:"at"`
+}
+
+// Progress describes how far the update got, e.g. "step 4/8 (compiled)"
+func (m *UpdateMarker) Progress() string {
+	return fmt.Sprintf("step %d/%d (%s)", stepIndex(m.Step)+1, len(updateSteps), m.Step)
+}
+
+// recoveryAction is the decision taken for an interrupted update
+type recoveryAction string
+
+const (
+	// recoveryAbandon means the agent was never touched, so the update is simply discarded
+	recoveryAbandon recoveryAction = "abandon"
+
+	// recoveryResume means the new binary was built and the remaining steps can be run again
+	recoveryResume recoveryAction = "resume"
+
+	// recoveryFinish means the update was verified and only the cleanup is missing
+	recoveryFinish recoveryAction = "finish"
+
+	// recoveryRollback means the agent was left in an intermediate state and must be restored
+	recoveryRollback recoveryAction = "rollback"
+)
+
+func stepIndex(step updateStep) int {
+	for i, s := range updateSteps {
+		if s == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// decideRecovery chooses how to recover from an update interrupted after the given step
+func decideRecovery(step updateStep, agentRunning bool) recoveryAction {
+	index := stepIndex(step)
+
+	switch {
+	case index < 0:
+		// Unknown step, assume the worst
+		return recoveryRollback
+	case step == stepBackupCreated && agentRunning:
+		return recoveryAbandon
+	case step == stepVerified:
+		return recoveryFinish
+	case index >= stepIndex(stepCompiled):
+		return recoveryResume
+	default:
+		return recoveryRollback
+	}
+}
+
+// writeJSONFile writes v to path atomically via a temporary file and rename
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readJSONFile decodes path into v, reporting whether the file existed
+func readJSONFile(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return true, nil
+}
+
+// saveBackupMetadata persists backup so rollback remains possible after a restart
+func saveBackupMetadata(dataDir string, backup *BackupInfo) error {
+	return writeJSONFile(filepath.Join(dataDir, backupMetadataFileName), backup)
+}
+
+// loadBackupMetadata returns the persisted backup metadata, or nil if none exists
+func loadBackupMetadata(dataDir string) (*BackupInfo, error) {
+	var backup BackupInfo
+	found, err := readJSONFile(filepath.Join(dataDir, backupMetadataFileName), &backup)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// writeUpdateMarker records that an update is in progress and the last step it completed
+func writeUpdateMarker(dataDir string, marker *UpdateMarker) error {
+	marker.UpdatedAt = time.Now()
+	return writeJSONFile(filepath.Join(dataDir, updateMarkerFileName), marker)
+}
+
+// loadUpdateMarker returns the in-progress update marker, or nil if no update is in progress
+func loadUpdateMarker(dataDir string) (*UpdateMarker, error) {
+	var marker UpdateMarker
+	found, err := readJSONFile(filepath.Join(dataDir, updateMarkerFileName), &marker)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &marker, nil
+}
+
+// clearUpdateState removes the update marker and backup metadata
+func clearUpdateState(dataDir string) error {
+	var errors []string
+	for _, name := range []string{updateMarkerFileName, backupMetadataFileName} {
+		if err := os.Remove(filepath.Join(dataDir, name)); err != nil && !os.IsNotExist(err) {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to clear update state: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// markUpdateStep advances the journal to step, logging rather than failing
+// the update if it cannot be written
+func markUpdateStep(dataDir string, marker *UpdateMarker, step updateStep) {
+	marker.Step = step
+	marker.Journal = append(marker.Journal, JournalEntry{Step: step, At: time.Now()})
+	if err := writeUpdateMarker(dataDir, marker); err != nil {
+		LogWarning("Failed to record update progress (%s): %v", step, err)
+	}
+}
+
+// recoverInterruptedUpdate checks for an update that was interrupted by a crash
+// or restart and either resumes it from the last completed step or rolls it back
+func recoverInterruptedUpdate() {
+	dataDir := paths.GetDataDirectory()
+
+	marker, err := loadUpdateMarker(dataDir)
+	if err != nil {
+		LogError("Failed to read update marker: %v", err)
+		return
+	}
+	if marker == nil {
+		return
+	}
+
+	// Keep a manual update or rollback from racing the recovery
+	release, err := acquireUpdateLock(dataDir)
+	if err != nil {
+		LogWarning("Skipping recovery of the interrupted update to %s: %v", marker.TargetVersion, err)
+		return
+	}
+	defer release()
+
+	LogWarning("Detected interrupted update to %s (completed %s, started %s)",
+		marker.TargetVersion, marker.Progress(), marker.StartedAt.Format(time.RFC3339))
+
+	// Left in place for a run with enough privileges to resume
+	if err := checkPrivileges(); err != nil {
+		LogCritical("Cannot resume the interrupted update: %v", err)
+		return
+	}
+
+	backup, err := loadBackupMetadata(dataDir)
+	if err != nil {
+		LogError("Failed to read backup metadata: %v", err)
+	}
+	if backup == nil {
+		LogCritical("No backup metadata found for interrupted update - manual verification required")
+		if err := clearUpdateState(dataDir); err != nil {
+			LogWarning("%v", err)
+		}
+		return
+	}
+
+	agentRunning, err := serviceManager.IsRunning(agentServiceName())
+	if err != nil {
+		LogWarning("Failed to check main agent status: %v", err)
+	}
+
+	action := decideRecovery(marker.Step, agentRunning)
+	LogInfo("Recovery action for interrupted update: %s", action)
+
+	if action == recoveryAbandon {
+		LogInfo("Main agent was not modified, discarding interrupted update")
+		if err := cleanupBackupFile(backup.BackupPath); err != nil {
+			LogWarning("Failed to clean up backup file: %v", err)
+		}
+		if err := clearUpdateState(dataDir); err != nil {
+			LogWarning("%v", err)
+		}
+		return
+	}
+
+	if action == recoveryFinish {
+		LogInfo("Interrupted update to %s was already verified, finishing", marker.TargetVersion)
+		recordUpdateHistory(dataDir, marker, nil)
+		finishUpdate(dataDir, backup)
+		return
+	}
+
+	if action == recoveryResume {
+		LogInfo("Resuming interrupted update to %s", marker.TargetVersion)
+		run := &updateRun{dataDir: dataDir, marker: marker, backup: backup}
+		err := runUpdateTransitions(dataDir, marker, run.transitions())
+		recordUpdateHistory(dataDir, marker, err)
+		if err == nil {
+			LogInfo("Interrupted update to %s completed successfully", marker.TargetVersion)
+			finishUpdate(dataDir, backup)
+			return
+		}
+		LogError("Resuming interrupted update failed: %v", err)
+	}
+
+	LogInfo("Rolling back interrupted update to version %s...", backup.Version)
+	err = rollback(backup)
+	recordHistory(dataDir, HistoryActionRollback, marker.TargetVersion, backup.Version, err)
+	if err != nil {
+		LogCritical("Rollback of interrupted update failed: %v", err)
+		LogCritical("Update state preserved in %s for the next attempt", dataDir)
+		return
+	}
+
+	if err := clearUpdateState(dataDir); err != nil {
+		LogWarning("%v", err)
+	}
+}
+
+// finishUpdate moves the backup into the retained backups for manual rollback
+// and removes all persisted update state
+func finishUpdate(dataDir string, backup *BackupInfo) {
+	pruneDatabaseSnapshots(paths.GetBackupDirectory(), getConfig().BackupRetention)
+
+	if err := retainBackup(paths.GetBackupDirectory(), backup, getConfig().BackupRetention); err != nil {
+		LogWarning("Failed to retain backup for manual rollback: %v", err)
+		if err := cleanupBackupFile(backup.BackupPath); err != nil {
+			LogWarning("Failed to clean up backup file: %v", err)
+			LogWarning("Backup file may need to be manually deleted: %s", backup.BackupPath)
+		}
+	}
+	if err := clearUpdateState(dataDir); err != nil {
+		LogWarning("%v", err)
+	}
+
+	collectGoCaches(dataDir)
+}
@@ -0,0 +1,259 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// TestBackupMetadataRoundTrip verifies that backup metadata written to the
+// data directory can be read back unchanged
+func TestBackupMetadataRoundTrip(t *testing.T) {
+	dataDir := t.TempDir()
+
+	backup := &BackupInfo{
+		Version:    "v1.6.100",
+		BackupPath: "/usr/local/bin/sentinel.backup",
+		BinaryPath: "/usr/local/bin/sentinel",
+		Timestamp:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	if err := saveBackupMetadata(dataDir, backup); err != nil {
+		t.Fatalf("saveBackupMetadata() failed: %v", err)
+	}
+
+	loaded, err := loadBackupMetadata(dataDir)
+	if err != nil {
+		t.Fatalf("loadBackupMetadata() failed: %v", err)
+	}
+	if loaded == nil {
+		t.Fatal("loadBackupMetadata() = nil; want backup metadata")
+	}
+	if *loaded != *backup {
+		t.Errorf("loadBackupMetadata() = %+v; want %+v", *loaded, *backup)
+	}
+}
+
+// TestLoadUpdateStateMissing verifies that missing state files are reported
+// as "no update in progress" rather than as errors
+func TestLoadUpdateStateMissing(t *testing.T) {
+	dataDir := t.TempDir()
+
+	marker, err := loadUpdateMarker(dataDir)
+	if err != nil || marker != nil {
+		t.Errorf("loadUpdateMarker() = %v, %v; want nil, nil", marker, err)
+	}
+
+	backup, err := loadBackupMetadata(dataDir)
+	if err != nil || backup != nil {
+		t.Errorf("loadBackupMetadata() = %v, %v; want nil, nil", backup, err)
+	}
+}
+
+// TestClearUpdateState verifies that clearing removes both the marker and the
+// backup metadata
+func TestClearUpdateState(t *testing.T) {
+	dataDir := t.TempDir()
+
+	if err := saveBackupMetadata(dataDir, &BackupInfo{Version: "v1.0.0"}); err != nil {
+		t.Fatalf("saveBackupMetadata() failed: %v", err)
+	}
+	if err := writeUpdateMarker(dataDir, &UpdateMarker{TargetVersion: "v1.1.0", Step: stepBackupCreated}); err != nil {
+		t.Fatalf("writeUpdateMarker() failed: %v", err)
+	}
+
+	if err := clearUpdateState(dataDir); err != nil {
+		t.Fatalf("clearUpdateState() failed: %v", err)
+	}
+
+	for _, name := range []string{updateMarkerFileName, backupMetadataFileName} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after clearUpdateState()", name)
+		}
+	}
+}
+
+// TestDecideRecovery verifies the recovery action taken for an update
+// interrupted after each step
+func TestDecideRecovery(t *testing.T) {
+	tests := []struct {
+		step         updateStep
+		agentRunning bool
+		expected     recoveryAction
+	}{
+		{stepBackupCreated, true, recoveryAbandon},
+		{stepBackupCreated, false, recoveryRollback},
+		{stepServiceStopped, false, recoveryRollback},
+		{stepServiceUninstalled, false, recoveryRollback},
+		{stepCompiled, false, recoveryResume},
+		{stepBinaryInstalled, false, recoveryResume},
+		{stepServiceInstalled, false, recoveryResume},
+		{stepServiceStarted, true, recoveryResume},
+		{stepServiceStarted, false, recoveryResume},
+		{stepVerified, true, recoveryFinish},
+		{updateStep("unknown"), true, recoveryRollback},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.step), func(t *testing.T) {
+			dataDir := t.TempDir()
+
+			// The updater dies right after persisting this step
+			if err := writeUpdateMarker(dataDir, &UpdateMarker{TargetVersion: "v1.1.0", Step: tt.step}); err != nil {
+				t.Fatalf("writeUpdateMarker() failed: %v", err)
+			}
+
+			// On restart the marker is read back and a recovery action chosen
+			marker, err := loadUpdateMarker(dataDir)
+			if err != nil || marker == nil {
+				t.Fatalf("loadUpdateMarker() = %v, %v; want marker", marker, err)
+			}
+
+			action := decideRecovery(marker.Step, tt.agentRunning)
+			if action != tt.expected {
+				t.Errorf("decideRecovery(%s, running=%v) = %s; want %s", tt.step, tt.agentRunning, action, tt.expected)
+			}
+		})
+	}
+}
+
+// TestRecoveryAtEachStepBoundary simulates the updater being killed right
+// after each step of an update from v1.0.0 to v1.1.0: the journal, backup,
+// service and binary are left as that step leaves them, and recovery must
+// end with the agent running either version and the journal cleared
+func TestRecoveryAtEachStepBoundary(t *testing.T) {
+	tests := []struct {
+		step updateStep
+		// agentDown means the agent stopped on its own before the crash
+		agentDown   bool
+		wantVersion string
+		wantCalls   []string
+	}{
+		{step: stepBackupCreated, wantVersion: "v1.0.0"},
+		{step: stepBackupCreated, agentDown: true, wantVersion: "v1.0.0", wantCalls: []string{"stop", "install", "start"}},
+		{step: stepServiceStopped, wantVersion: "v1.0.0", wantCalls: []string{"stop", "install", "start"}},
+		{step: stepServiceUninstalled, wantVersion: "v1.0.0", wantCalls: []string{"stop", "install", "start"}},
+		{step: stepCompiled, wantVersion: "v1.1.0", wantCalls: []string{"install", "start"}},
+		{step: stepBinaryInstalled, wantVersion: "v1.1.0", wantCalls: []string{"install", "start"}},
+		{step: stepServiceInstalled, wantVersion: "v1.1.0", wantCalls: []string{"start"}},
+		{step: stepServiceStarted, wantVersion: "v1.1.0"},
+		{step: stepVerified, wantVersion: "v1.1.0"},
+	}
+
+	for _, tt := range tests {
+		name := string(tt.step)
+		if tt.agentDown {
+			name += " agent down"
+		}
+		t.Run(name, func(t *testing.T) {
+			update := useFakeUpdate(t)
+			dataDir := paths.GetDataDirectory()
+			done := func(step updateStep) bool { return stepIndex(tt.step) >= stepIndex(step) }
+
+			backup, err := createBackup("v1.0.0", update.binary, update.binary)
+			if err != nil {
+				t.Fatalf("createBackup() failed: %v", err)
+			}
+			if err := saveBackupMetadata(dataDir, backup); err != nil {
+				t.Fatalf("saveBackupMetadata() failed: %v", err)
+			}
+			marker := &UpdateMarker{TargetVersion: "v1.1.0", PreviousVersion: "v1.0.0", Step: tt.step}
+			newBinary := slices.Concat(update.header, []byte(fakeVersionMarker+"v1.1.0"))
+			if done(stepCompiled) {
+				marker.CompiledPath = filepath.Join(paths.BuildBinDirectory(dataDir), "sentinel")
+				if err := os.MkdirAll(filepath.Dir(marker.CompiledPath), 0755); err != nil {
+					t.Fatalf("failed to create build directory: %v", err)
+				}
+				if err := os.WriteFile(marker.CompiledPath, newBinary, 0755); err != nil {
+					t.Fatalf("failed to write compiled binary: %v", err)
+				}
+			}
+			if err := writeUpdateMarker(dataDir, marker); err != nil {
+				t.Fatalf("writeUpdateMarker() failed: %v", err)
+			}
+
+			if tt.agentDown || done(stepServiceStopped) {
+				delete(update.manager.Running, MainAgentServiceName)
+			}
+			if done(stepServiceUninstalled) {
+				delete(update.manager.Binaries, MainAgentServiceName)
+			}
+			if done(stepBinaryInstalled) {
+				if err := os.WriteFile(update.binary, newBinary, 0755); err != nil {
+					t.Fatalf("failed to install new binary: %v", err)
+				}
+			}
+			if done(stepServiceInstalled) {
+				update.manager.Binaries[MainAgentServiceName] = update.binary
+			}
+			if done(stepServiceStarted) {
+				update.manager.Running[MainAgentServiceName] = true
+			}
+
+			recoverInterruptedUpdate()
+
+			if version, err := installedVersionAt(update.binary); err != nil || version != tt.wantVersion {
+				t.Errorf("installed version = %q, %v; want %s", version, err, tt.wantVersion)
+			}
+			var calls []string
+			for _, call := range update.manager.CallLog() {
+				method, _, _ := strings.Cut(call, " ")
+				calls = append(calls, method)
+			}
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("service calls = %q; want %q", calls, tt.wantCalls)
+			}
+			if binary, err := update.manager.GetServiceBinaryPath(MainAgentServiceName); err != nil || binary != update.binary {
+				t.Errorf("service binary = %q, %v; want %s", binary, err, update.binary)
+			}
+			if running, _ := update.manager.IsRunning(MainAgentServiceName); !running {
+				t.Error("agent service not running after recovery")
+			}
+			for _, name := range []string{updateMarkerFileName, backupMetadataFileName} {
+				if _, err := os.Stat(filepath.Join(dataDir, name)); !os.IsNotExist(err) {
+					t.Errorf("%s still exists after recovery", name)
+				}
+			}
+		})
+	}
+}
+
+// TestRecoverySkippedWhileLocked verifies that recovery leaves the interrupted
+// update alone while another process holds the update lock
+func TestRecoverySkippedWhileLocked(t *testing.T) {
+	saveLogger(t)
+	dataDir := t.TempDir()
+	paths.SetDataDirectory(dataDir)
+	t.Cleanup(func() { paths.SetDataDirectory("") })
+
+	manager := &servicetest.FakeManager{}
+	useServiceManager(t, manager)
+
+	if err := writeUpdateMarker(dataDir, &UpdateMarker{TargetVersion: "v1.1.0", Step: stepServiceStopped}); err != nil {
+		t.Fatalf("writeUpdateMarker() failed: %v", err)
+	}
+	if err := saveBackupMetadata(dataDir, &BackupInfo{Version: "v1.0.0"}); err != nil {
+		t.Fatalf("saveBackupMetadata() failed: %v", err)
+	}
+
+	release, err := acquireUpdateLock(dataDir)
+	if err != nil {
+		t.Fatalf("acquireUpdateLock() failed: %v", err)
+	}
+	defer release()
+
+	recoverInterruptedUpdate()
+
+	if calls := manager.CallLog(); len(calls) != 0 {
+		t.Errorf("service calls = %v; want none while the lock is held", calls)
+	}
+	if marker, err := loadUpdateMarker(dataDir); err != nil || marker == nil {
+		t.Errorf("loadUpdateMarker() = %v, %v; want the marker kept for a later recovery", marker, err)
+	}
+}
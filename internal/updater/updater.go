@@ -1,182 +1,532 @@
 package updater
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
 	"github.com/BrainStation-23/SentinelGo-Updater/internal/paths"
 	"github.com/BrainStation-23/SentinelGo-Updater/internal/service"
 )
 
 const (
-	CheckInterval        = 30 * time.Second
-	MainAgentModule      = "github.com/BrainStation-23/SentinelGo"
+	// CheckInterval is the default time between version checks
+	CheckInterval = 30 * time.Second
+
+	// MainAgentModule is the default agent module, see agentModule
+	MainAgentModule = "github.com/BrainStation-23/SentinelGo"
+
+	// MainAgentServiceName is the default agent service, see agentServiceName
 	MainAgentServiceName = "sentinelgo"
-)
 
-var (
-	serviceManager service.Manager
+	// versionProbeTimeout bounds each run of the agent binary for its
+	// version, in case an argument makes it start instead
+	versionProbeTimeout = 15 * time.Second
 )
 
-func init() {
-	serviceManager = service.NewManager()
+// serviceManager controls the agent service. An Updater replaces it with the
+// one from its Options, such as a servicetest.FakeManager in tests.
+var serviceManager = service.NewManager()
+
+// commandRunner runs the commands an update runs, such as the agent binary
+// for its version and go to build it. An Updater replaces it with the one
+// from its Options, such as a commandtest.FakeRunner in tests.
+var commandRunner command.Runner = command.Exec{}
+
+// Options configures an Updater. The zero value updates the agent the way
+// the updater service does.
+type Options struct {
+	// Config is used instead of updater-config.json, which is then neither
+	// read nor watched, and SIGHUP and SIGUSR1 are left to the caller. Start
+	// from DefaultConfig, as unset fields are only partly filled with their
+	// defaults.
+	Config *UpdaterConfig
+
+	// ServiceManager controls the agent service; nil uses the platform's,
+	// running its commands through Runner
+	ServiceManager service.Manager
+
+	// Runner runs the agent binary, go and the other commands of an
+	// update; nil starts them as processes
+	Runner command.Runner
+
+	// Versions finds the installed and latest agent versions; nil uses
+	// DefaultVersionChecker
+	Versions *VersionChecker
+
+	// LogOutput receives the log messages instead of updater.log and the
+	// configured log sinks
+	LogOutput io.Writer
 }
 
-// setEnvironmentVariables ensures required environment variables are set for child processes
-func setEnvironmentVariables() error {
-	LogInfo("Setting up environment variables for update process...")
+// Result is the outcome of one version check of an Updater
+type Result struct {
+	// Installed is the agent version installed after the check
+	Installed string
 
-	// Ensure $HOME is set using platform-specific function
-	homeDir, err := ensureHomeDirectory()
-	if err != nil {
-		LogError("Failed to determine home directory: %v", err)
-		return fmt.Errorf("failed to determine home directory: %w", err)
+	// Latest is the version selected on the configured channel, "" when
+	// the check failed
+	Latest string
+
+	// Updated reports whether the check installed Latest
+	Updated bool
+
+	// Summary is the outcome as the status command shows it, such as
+	// "up to date" or "deferred v1.7.0: outside the rollout"
+	Summary string
+}
+
+// Updater keeps the agent up to date. It is what the updater service runs,
+// and lets another program of this module run the updater in-process. The
+// configuration, service manager and state files it works with are shared
+// by the package, so only one Updater may run at a time.
+type Updater struct {
+	config         *UpdaterConfig
+	serviceManager service.Manager
+	runner         command.Runner
+	versions       *VersionChecker
+	logOutput      io.Writer
+	prepared       bool
+}
+
+// New returns an Updater configured by opts
+func New(opts Options) *Updater {
+	u := &Updater{
+		config:         opts.Config,
+		serviceManager: opts.ServiceManager,
+		runner:         opts.Runner,
+		versions:       opts.Versions,
+		logOutput:      opts.LogOutput,
 	}
+	if u.runner == nil {
+		u.runner = commandRunner
+	}
+	if u.serviceManager == nil && opts.Runner != nil {
+		u.serviceManager = service.NewManagerWithRunner(opts.Runner)
+	} else if u.serviceManager == nil {
+		u.serviceManager = serviceManager
+	}
+	if u.versions == nil {
+		u.versions = DefaultVersionChecker()
+	}
+	return u
+}
 
-	// Set $HOME if not already set
-	if os.Getenv("HOME") == "" {
-		if err := os.Setenv("HOME", homeDir); err != nil {
-			LogError("Failed to set $HOME environment variable: %v", err)
-			return fmt.Errorf("failed to set $HOME: %w", err)
-		}
-		LogInfo("Set $HOME environment variable to: %s", homeDir)
-	} else {
-		LogInfo("$HOME environment variable already set to: %s", os.Getenv("HOME"))
+// Run runs the updater service until it is stopped
+func Run() {
+	if err := New(Options{}).Run(context.Background()); err != nil {
+		log.Fatalf("Failed to initialize logging system: %v", err)
 	}
+}
 
-	// Set $GOPATH if not already set (default to $HOME/go)
-	if os.Getenv("GOPATH") == "" {
-		gopath := filepath.Join(homeDir, "go")
-		if err := os.Setenv("GOPATH", gopath); err != nil {
-			LogError("Failed to set $GOPATH environment variable: %v", err)
-			return fmt.Errorf("failed to set $GOPATH: %w", err)
-		}
-		LogInfo("Set $GOPATH environment variable to: %s", gopath)
-	} else {
-		LogInfo("$GOPATH environment variable already set to: %s", os.Getenv("GOPATH"))
+// prepare opens the log and makes the Updater's configuration and service
+// manager the package's, once
+func (u *Updater) prepare() error {
+	if u.prepared {
+		return nil
+	}
+	if u.logOutput != nil {
+		useLogOutput(u.logOutput)
+	} else if err := InitLogger(); err != nil {
+		return err
 	}
+	serviceManager = u.serviceManager
+	commandRunner = u.runner
 
-	LogInfo("Environment variables configured successfully")
+	if u.config != nil {
+		config := *u.config
+		config.applyDefaults()
+		activeConfig.Store(&config)
+	} else {
+		loadConfig()
+	}
+	u.prepared = true
 	return nil
 }
 
-func Run() {
-	if err := InitLogger(); err != nil {
-		log.Fatalf("Failed to initialize logging system: %v", err)
+// Run checks for updates and installs them every check interval, until ctx
+// is done. It only returns an error when the log cannot be opened.
+func (u *Updater) Run(ctx context.Context) error {
+	if err := u.prepare(); err != nil {
+		return err
 	}
-	defer CloseLogger()
+	defer func() {
+		CloseLogger()
+		u.prepared = false
+	}()
 
 	LogInfo("Updater service started")
-	LogInfo("Check interval: %v", CheckInterval)
-	LogInfo("Main agent module: %s", MainAgentModule)
-
-	// Set up environment variables at startup
-	LogInfo("Setting up environment variables...")
-	if err := setEnvironmentVariables(); err != nil {
-		LogError("Failed to set up environment variables: %v", err)
-		LogWarning("Continuing anyway, but some operations may fail")
+	if err := checkPrivileges(); err != nil {
+		reportMissingPrivileges(err)
+	}
+	startStatus(paths.GetDataDirectory())
+	startHeartbeat(paths.GetDataDirectory())
+	config := getConfig()
+	LogInfo("Effective configuration: %s", effectiveConfigSummary(config))
+	checkGoEnv(config)
+	checkProxyConfig(config)
+	if u.config == nil {
+		defer watchConfigFile()()
+		defer watchSignals()()
+	}
+	startControlServer(config)
+	defer StopControlServer()
+	LogInfo("Check interval: %v", config.CheckIntervalDuration())
+	LogInfo("Main agent: %s (binary %s)", config.agentPackagePath(), agentBinaryPath())
+
+	if home := getEnvVar(commandEnvironment(), "HOME"); home != "" {
+		LogInfo("Commands run with HOME=%s", home)
 	} else {
-		LogInfo("Environment variables configured successfully")
+		LogWarning("Commands run without HOME, some go commands may fail")
 	}
 
-	for {
-		LogInfo("--- Starting version check ---")
+	recoverInterruptedUpdate()
 
-		currentVersion, err := getInstalledVersion()
-		if err != nil {
-			LogError("Failed to get installed version: %v", err)
-			LogInfo("This is a transient error - detection will be retried automatically")
-			LogInfo("Will retry in %v", CheckInterval)
-			time.Sleep(CheckInterval)
-			continue
+	for {
+		u.CheckOnce()
+		sleepUntilNextCheck(ctx)
+		if ctx.Err() != nil {
+			LogInfo("Updater stopped")
+			return nil
 		}
+	}
+}
 
-		LogInfo("Current installed version: %s", currentVersion)
+// CheckOnce checks for an update and installs it, unless it is deferred,
+// paused or was rolled back by hand. The error is that of a failed check or
+// update; the outcome is also published in the status file while Run runs.
+func (u *Updater) CheckOnce() (Result, error) {
+	if err := u.prepare(); err != nil {
+		return Result{}, err
+	}
 
-		latestVersion, err := getLatestVersion()
-		if err != nil {
-			LogError("Failed to check latest version: %v", err)
-			LogInfo("Will retry in %v", CheckInterval)
-			time.Sleep(CheckInterval)
-			continue
-		}
+	beginCycle()
+	LogInfo("--- Starting version check ---")
+	setStatus(func(s *UpdaterStatus) { s.Activity = ActivityChecking })
+
+	currentVersion, err := u.versions.InstalledVersion()
+	if err != nil && getConfig().AllowInstallWhenMissing {
+		LogWarning("No working agent binary detected, allowInstallWhenMissing installs one: %v", err)
+		currentVersion, err = "", nil
+	}
+	if err != nil {
+		result := Result{Summary: "failed to get installed version: " + err.Error()}
+		recordCheckResult("", nil, false, result.Summary)
+		LogError("Failed to get installed version: %v", err)
+		LogInfo("This is a transient error - detection will be retried automatically")
+		LogInfo("Will retry in %v", getConfig().CheckIntervalDuration())
+		return result, fmt.Errorf("failed to get installed version: %w", err)
+	}
 
-		LogInfo("Latest available version: %s", latestVersion)
+	if currentVersion != "" {
+		LogInfo("Current installed version: %s", agentVersion{currentVersion, agentVersionDetails(currentVersion)})
+	}
 
-		if isNewerVersion(currentVersion, latestVersion) {
+	check, err := u.versions.LatestVersion(paths.GetDataDirectory(), false)
+	if errors.Is(err, errNoTaggedVersions) {
+		result := Result{Installed: currentVersion, Summary: "no tagged versions published"}
+		recordCheckResult(currentVersion, nil, false, result.Summary)
+		LogInfo("No tagged versions of %s are published yet, nothing to update", getConfig().AgentModule)
+		LogInfo("Next check in %v", getConfig().CheckIntervalDuration())
+		return result, nil
+	}
+	if err != nil {
+		result := Result{Installed: currentVersion, Summary: "version check failed: " + err.Error()}
+		recordCheckResult(currentVersion, nil, false, result.Summary)
+		LogError("Failed to check latest version: %v", err)
+		LogInfo("Will retry in %v", getConfig().CheckIntervalDuration())
+		return result, fmt.Errorf("failed to check latest version: %w", err)
+	}
+
+	latestVersion := check.Selected
+	LogInfo("Latest available version: %s", latestVersion)
+
+	if check.isRetracted(currentVersion) {
+		LogWarning("Installed version %s has been retracted", currentVersion)
+	}
+
+	deferral := ""
+	if check.needsUpdate(currentVersion) {
+		deferral = updateDeferral(paths.GetDataDirectory(), check, currentVersion)
+	}
+
+	result := Result{Latest: latestVersion}
+	var updateErr error
+	if check.needsUpdate(currentVersion) && wasManuallyRolledBack(paths.GetDataDirectory(), latestVersion) {
+		result.Summary = "skipped " + latestVersion + ", manually rolled back"
+		recordCheckResult(currentVersion, check, true, result.Summary)
+		LogWarning("Version %s was manually rolled back, skipping automatic update", latestVersion)
+	} else if deferral != "" {
+		result.Summary = "deferred " + latestVersion + ": " + deferral
+		recordCheckResult(currentVersion, check, true, result.Summary)
+		LogInfo("Update to %s deferred: %s", latestVersion, deferral)
+	} else if err := checkPrivileges(); check.needsUpdate(currentVersion) && err != nil {
+		// Attempting the update would only fail once the agent is stopped
+		result.Summary = "skipped " + latestVersion + ": the updater lacks root or Administrator privileges"
+		recordCheckResult(currentVersion, check, true, result.Summary)
+		reportMissingPrivileges(err)
+	} else if check.needsUpdate(currentVersion) {
+		switch {
+		case isNewerVersion(currentVersion, latestVersion):
 			LogInfo("Update available: %s -> %s", currentVersion, latestVersion)
-			LogInfo("Initiating update process...")
-
-			if err := performUpdate(latestVersion); err != nil {
-				LogError("Update failed: %v", err)
-				LogWarning("Main agent may need manual intervention")
-			} else {
-				LogInfo("Update successful: %s", latestVersion)
-			}
+		case check.isRetracted(currentVersion):
+			LogWarning("Downgrading from retracted version %s to %s", currentVersion, latestVersion)
+		default:
+			LogInfo("Switching to %s (%s on the %s channel), installed: %s", latestVersion, check.Branch, check.Channel, currentVersion)
+		}
+		LogInfo("Initiating update process...")
+		recordCheckResult(currentVersion, check, true, "updating to "+latestVersion)
+		setStatus(func(s *UpdaterStatus) { s.Activity = ActivityUpdating })
+
+		if updateErr = performUpdate(latestVersion, false); updateErr != nil {
+			result.Summary = "update to " + latestVersion + " failed: " + updateErr.Error()
+			recordCheckResult(currentVersion, check, true, result.Summary)
+			LogError("Update failed: %v", updateErr)
+			LogWarning("Main agent may need manual intervention")
 		} else {
-			LogInfo("No update needed, already running latest version")
+			result.Summary, result.Updated = "updated to "+latestVersion, true
+			recordCheckResult(latestVersion, check, false, result.Summary)
+			LogInfo("Update successful: %s", latestVersion)
+			currentVersion = latestVersion
 		}
+	} else {
+		result.Summary = "up to date"
+		recordCheckResult(currentVersion, check, false, result.Summary)
+		LogInfo("No update needed, already running latest version")
+	}
+	result.Installed = currentVersion
+	reportInventory(currentVersion, check.CheckedAt)
+	tickTelemetry(paths.GetDataDirectory(), currentVersion)
+
+	LogInfo("Next check in %v", getConfig().CheckIntervalDuration())
+	return result, updateErr
+}
 
-		LogInfo("Next check in %v", CheckInterval)
-		time.Sleep(CheckInterval)
+// updateDeferral returns why the update check selected is held back, or ""
+// when it may be installed. Moving off a retracted version is never held back
+// by the rollout, only by a pause in dataDir or the update manifest.
+func updateDeferral(dataDir string, check *VersionCheck, currentVersion string) string {
+	if pause := activePause(dataDir); pause != nil {
+		return "updates " + pause.String()
 	}
+	if deferral := check.manifestDeferral(); deferral != "" {
+		return deferral
+	}
+	if check.isRetracted(currentVersion) {
+		return ""
+	}
+	return checkRollout(check)
+}
+
+// agentVersion is what an agent binary reports with --version
+type agentVersion struct {
+	// Version is the normalized version, such as v1.6.116, that is compared
+	// with the published ones
+	Version string
+
+	// Raw is the full output, such as "SentinelGo v1.6.116 (abcdef,
+	// 2024-01-01)", with the commit and build details useful for debugging
+	Raw string
+}
+
+// String returns the version followed by the full output when the output
+// says more than the version
+func (v agentVersion) String() string {
+	if v.Raw == "" || v.Raw == v.Version {
+		return v.Version
+	}
+	return v.Version + " (" + v.Raw + ")"
+}
+
+// lastAgentVersion is what the agent binary reported the last time it was
+// probed, so the status can show the full output of the installed version
+var lastAgentVersion atomic.Pointer[agentVersion]
+
+// agentVersionDetails returns the full output the agent reported for
+// version, or "" when it was not the last version probed
+func agentVersionDetails(version string) string {
+	if last := lastAgentVersion.Load(); last != nil && last.Version == version && last.Raw != version {
+		return last.Raw
+	}
+	return ""
 }
 
 func getInstalledVersion() (string, error) {
+	details, err := getInstalledVersionDetails()
+	return details.Version, err
+}
+
+// getInstalledVersionDetails detects the agent binary and returns its
+// normalized version with the full output it reported
+func getInstalledVersionDetails() (agentVersion, error) {
 	binaryPath, detectionMethod, err := getMainAgentBinaryPathWithDetails()
 	if err != nil {
 		LogError("Failed to detect binary path: %v", err)
 		LogWarning("Will retry detection on next update check")
-		LogInfo("Detection will be retried in %v", CheckInterval)
-		return "", fmt.Errorf("binary path detection failed: %w", err)
+		LogInfo("Detection will be retried in %v", getConfig().CheckIntervalDuration())
+		return agentVersion{}, fmt.Errorf("binary path detection failed: %w", err)
 	}
 
-	LogInfo("Binary path successfully detected using method: %s", detectionMethod)
-	LogInfo("Using binary at: %s", binaryPath)
+	LogDebug("Binary path successfully detected using method: %s", detectionMethod)
+	LogDebug("Using binary at: %s", binaryPath)
+	return installedVersionDetailsAt(binaryPath)
+}
 
+// installedVersionAt returns the version the agent binary at binaryPath
+// reports, without detecting the binary again
+func installedVersionAt(binaryPath string) (string, error) {
+	details, err := installedVersionDetailsAt(binaryPath)
+	return details.Version, err
+}
+
+// installedVersionDetailsAt returns the normalized version and the full
+// output the agent binary at binaryPath reports with --version
+func installedVersionDetailsAt(binaryPath string) (agentVersion, error) {
 	if _, err := os.Stat(binaryPath); os.IsNotExist(err) {
 		LogError("Binary not found at detected path: %s", binaryPath)
 		LogWarning("Will retry on next check")
-		return "", fmt.Errorf("main agent binary not found at %s", binaryPath)
+		return agentVersion{}, fmt.Errorf("main agent binary not found at %s", binaryPath)
 	}
 
-	cmd := exec.Command(binaryPath, "--version")
-	output, err := cmd.Output()
-	if err != nil {
-		LogError("Failed to get version from binary at %s: %v", binaryPath, err)
-		LogWarning("Binary may be corrupted or incompatible")
-		LogWarning("Will retry on next check")
-		return "", fmt.Errorf("failed to get version from binary: %w", err)
+	invocations := getConfig().versionInvocations()
+	var firstErr error
+	for i, args := range invocations {
+		raw, err := probeAgentVersion(binaryPath, args)
+		if err == nil && i > 0 && parseReportedVersion(raw) == "" {
+			// A fallback such as -v may mean something else to this agent
+			err = fmt.Errorf("no version in its output: %s", raw)
+		}
+		if err != nil {
+			LogDebug("%s %s failed: %v", binaryPath, strings.Join(args, " "), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if i > 0 {
+			LogInfo("Agent at %s printed its version with %q after %q failed; set versionArgs to use it directly",
+				binaryPath, strings.Join(args, " "), strings.Join(invocations[0], " "))
+		}
+		return reportedAgentVersion(binaryPath, raw), nil
 	}
 
-	version := strings.TrimSpace(string(output))
-	if version == "" {
-		LogError("Binary at %s returned empty version", binaryPath)
-		LogWarning("This may indicate an incompatible or corrupted binary")
-		return "", fmt.Errorf("binary returned empty version")
+	LogError("Failed to get version from binary at %s: %v", binaryPath, firstErr)
+	LogWarning("Binary may be corrupted or incompatible")
+	LogWarning("Will retry on next check")
+	return agentVersion{}, fmt.Errorf("failed to get version from binary: %w", firstErr)
+}
+
+// probeAgentVersion runs the agent binary with args and returns what it
+// printed, failing when it printed nothing
+func probeAgentVersion(binaryPath string, args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+	output, _, err := commandRunner.Run(ctx, binaryPath, args, nil, "")
+	if err != nil {
+		return "", err
+	}
+	raw := strings.TrimSpace(string(output))
+	if raw == "" {
+		return "", errors.New("binary returned empty version")
 	}
+	return raw, nil
+}
+
+// reportedAgentVersion normalizes the version output raw of the agent at
+// binaryPath and remembers it for the status
+func reportedAgentVersion(binaryPath, raw string) agentVersion {
+	details := agentVersion{Version: parseReportedVersion(raw), Raw: raw}
+	if details.Version == "" {
+		LogWarning("Could not extract version number from output: %s", raw)
+		details.Version = raw
+	}
+	LogDebug("Agent at %s reports %q", binaryPath, raw)
+	lastAgentVersion.Store(&details)
+	return details
+}
 
-	versionParts := strings.Fields(version)
-	for _, part := range versionParts {
+// parseReportedVersion extracts the version from the agent's --version
+// output: a semver or pseudo-version such as v1.2.0, or else the commit hash
+// a development build reports. It returns "" when neither is found.
+func parseReportedVersion(output string) string {
+	fields := strings.Fields(output)
+	for _, part := range fields {
 		if len(part) > 1 && part[0] == 'v' && part[1] >= '0' && part[1] <= '9' {
-			return part, nil
+			return part
 		}
 	}
-
-	LogWarning("Could not extract version number from output: %s", version)
-	return version, nil
+	for _, part := range fields {
+		if isCommitHash(part) {
+			return part
+		}
+	}
+	return ""
 }
 
+// autoDetectBinary locates the agent binary without configuration; it is a
+// variable so tests can assert it is not called when auto-detection is disabled
+var autoDetectBinary = autoDetectMainAgentBinaryPath
+
+// getMainAgentBinaryPathWithDetails returns the agent binary path and how it
+// was found. The configured binaryPath and binaryPaths are tried in order and
+// the first valid one wins. When none is valid, auto-detection is used unless
+// enableAutoDetection is false.
 func getMainAgentBinaryPathWithDetails() (path string, method string, err error) {
+	config := getConfig()
+	candidates := config.configuredBinaryPaths()
+
+	for _, candidate := range candidates {
+		err := validateBinaryPath(candidate)
+		if err == nil {
+			return candidate, "manual_configuration", nil
+		}
+		LogWarning("Configured binary path is invalid: %v", err)
+	}
+
+	if !config.EnableAutoDetection {
+		if len(candidates) == 0 {
+			return "", "", fmt.Errorf("auto-detection is disabled and no binaryPath is configured")
+		}
+		return "", "", fmt.Errorf("none of the %d configured binary paths is valid and auto-detection is disabled", len(candidates))
+	}
+	if len(candidates) > 0 {
+		LogWarning("No configured binary path is valid, falling back to auto-detection")
+	}
+
+	return autoDetectBinary()
+}
+
+// validateBinaryPath checks that path is an existing executable file
+func validateBinaryPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+func autoDetectMainAgentBinaryPath() (path string, method string, err error) {
 	// Try to get binary path from paths package
-	detectedPath := paths.GetMainAgentBinaryPath()
+	detectedPath := agentBinaryPath()
 
 	// Check if binary exists at system location
 	if _, err := os.Stat(detectedPath); err == nil {
@@ -184,6 +534,20 @@ func getMainAgentBinaryPathWithDetails() (path string, method string, err error)
 		return detectedPath, method, nil
 	}
 
+	// Then the binary the running agent service was started from
+	if runningPath, err := runningServiceBinary(agentServiceName()); err != nil {
+		LogDebug("No running agent service process: %v", err)
+	} else {
+		return runningPath, "running_service_process", nil
+	}
+
+	// Then where the agent service runs it from
+	if servicePath, err := serviceManager.GetServiceBinaryPath(agentServiceName()); err != nil {
+		LogDebug("No agent binary in the configuration of service %s: %v", agentServiceName(), err)
+	} else if _, err := os.Stat(servicePath); err == nil {
+		return servicePath, "service_configuration", nil
+	}
+
 	// If not found at system location, try platform-specific paths
 	possiblePaths := getPossibleBinaryPaths()
 	for _, path := range possiblePaths {
@@ -197,11 +561,6 @@ func getMainAgentBinaryPathWithDetails() (path string, method string, err error)
 }
 
 func inferDetectionMethod(detectedPath string) string {
-	configPath := filepath.Join(paths.GetDataDirectory(), "updater-config.json")
-	if _, err := os.Stat(configPath); err == nil {
-		return "manual_configuration"
-	}
-
 	pathEnv := os.Getenv("PATH")
 	if pathEnv != "" {
 		separator := ":"
@@ -243,10 +602,7 @@ func inferDetectionMethod(detectedPath string) string {
 }
 
 func getCommonInstallationPaths() []string {
-	binaryName := "sentinel"
-	if runtime.GOOS == "windows" {
-		binaryName = "sentinel.exe"
-	}
+	binaryName := agentBinaryFileName()
 
 	switch runtime.GOOS {
 	case "linux":
@@ -280,32 +636,45 @@ func getCommonInstallationPaths() []string {
 	}
 }
 
-func getLatestVersion() (string, error) {
-	goBinary, err := findGoBinary()
-	if err != nil {
-		return "", fmt.Errorf("go command not found: %w", err)
+// getLatestVersion returns the version to install on the configured channel,
+// reusing a cached check younger than versionCacheTTLMinutes unless refresh
+// is set. The check is recorded in dataDir as resolved, before minVersion and
+// skipVersions are applied.
+func getLatestVersion(dataDir string, refresh bool) (*VersionCheck, error) {
+	config := getConfig()
+	if !refresh && config.ManifestURL == "" {
+		if check := cachedVersionCheck(config, dataDir); check != nil {
+			LogDebug("Using cached version check from %s (%s via %s)",
+				check.CheckedAt.Format(time.RFC3339), check.Selected, check.Resolver)
+			return check.withVersionPolicy(config)
+		}
 	}
-	LogInfo("Using go binary: %s", goBinary)
 
-	cmd := exec.Command(goBinary, "list", "-m", "-json", fmt.Sprintf("%s@latest", MainAgentModule))
-	output, err := cmd.Output()
+	goBinary, err := findGoBinary()
 	if err != nil {
-		return "", fmt.Errorf("failed to query latest version: %w", err)
+		return nil, fmt.Errorf("go command not found: %w", err)
 	}
+	LogDebug("Using go binary: %s", goBinary)
 
-	var moduleInfo struct {
-		Version string `json:"Version"`
+	var check *VersionCheck
+	if config.ManifestURL != "" {
+		check, err = checkManifestVersion(goBinary, config, dataDir)
+	} else {
+		check, err = resolveVersion(goBinary, config.AgentModule, config)
 	}
-
-	if err := json.Unmarshal(output, &moduleInfo); err != nil {
-		return "", fmt.Errorf("failed to parse module info: %w", err)
+	if check != nil {
+		if err := writeJSONFile(filepath.Join(dataDir, versionCheckFileName), check); err != nil {
+			LogWarning("Failed to record version check: %v", err)
+		}
 	}
-
-	if moduleInfo.Version == "" {
-		return "", fmt.Errorf("no version found in module info")
+	if err != nil {
+		return nil, err
 	}
 
-	return moduleInfo.Version, nil
+	storeVersionCheck(check)
+	LogDebug("Found %d published version(s) of %s via %s", len(check.Available), config.AgentModule, check.Resolver)
+	LogInfo("Update channel %s selected version %s", config.Channel, check.Selected)
+	return check.withVersionPolicy(config)
 }
 
 func findGoBinary() (string, error) {
@@ -346,152 +715,214 @@ func findGoBinary() (string, error) {
 	return "", fmt.Errorf("go binary not found in PATH or common locations")
 }
 
-func isNewerVersion(current, latest string) bool {
-	current = strings.TrimPrefix(current, "v")
-	latest = strings.TrimPrefix(latest, "v")
+// RunUpdate checks for the latest version on the configured channel and
+// installs it now, without waiting for the service's next check. A non-empty
+// version is installed instead, even if it is older than the installed one.
+// noCache compiles the agent even when a build of that version is cached. It
+// returns the version installed, or "" when the agent is already up to date.
+// The update lock keeps it from racing an update started by the service.
+func RunUpdate(version string, noCache bool) (string, error) {
+	if err := checkPrivileges(); err != nil {
+		return "", err
+	}
+	if err := InitLogger(); err != nil {
+		return "", fmt.Errorf("failed to initialize logging system: %w", err)
+	}
+	defer CloseLogger()
+	loadConfig()
 
-	if current == latest {
-		return false
+	currentVersion, err := getInstalledVersion()
+	if err != nil && getConfig().AllowInstallWhenMissing {
+		LogWarning("No working agent binary detected, allowInstallWhenMissing installs one: %v", err)
+		currentVersion, err = "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get installed version: %w", err)
 	}
 
-	currentParts := parseVersion(current)
-	latestParts := parseVersion(latest)
+	if version != "" {
+		if err := verifyVersionExists(version); err != nil {
+			return "", err
+		}
+		if sameRevision(currentVersion, version) {
+			LogInfo("Version %s is already installed", version)
+			return "", nil
+		}
 
-	for i := 0; i < 3; i++ {
-		if latestParts[i] > currentParts[i] {
-			return true
+		LogInfo("=== Forced update from %s to %s requested ===", currentVersion, version)
+		if isNewerVersion(version, currentVersion) {
+			LogWarning("Installing %s, older than the installed %s; the service may update it again at its next check", version, currentVersion)
 		}
-		if latestParts[i] < currentParts[i] {
-			return false
+		if err := performUpdate(version, noCache); err != nil {
+			return "", err
 		}
+		return version, nil
 	}
 
-	return false
-}
+	check, err := getLatestVersion(paths.GetDataDirectory(), true)
+	if err != nil {
+		return "", err
+	}
+	if !check.needsUpdate(currentVersion) {
+		LogInfo("No update needed, already running %s", currentVersion)
+		return "", nil
+	}
 
-func parseVersion(version string) [3]int {
-	var parts [3]int
-	segments := strings.Split(version, ".")
-	for i := 0; i < len(segments) && i < 3; i++ {
-		var num int
-		fmt.Sscanf(segments[i], "%d", &num)
-		parts[i] = num
+	LogInfo("=== Manual update from %s to %s requested ===", currentVersion, check.Selected)
+	if err := performUpdate(check.Selected, noCache); err != nil {
+		return "", err
 	}
-	return parts
+	return check.Selected, nil
 }
 
-func performUpdate(targetVersion string) error {
-	LogInfo("=== Starting update to %s ===", targetVersion)
+// verifyVersionExists checks that version is a semantic or pseudo-version and
+// that it is published for the agent module, before anything is stopped
+func verifyVersionExists(version string) error {
+	if _, ok := parseVersion(version); !ok {
+		return newUpdateError(ErrCodeVersionNotFound, "invalid version %q: want a version such as v1.2.3", version)
+	}
 
-	currentVersion, err := getInstalledVersion()
+	goBinary, err := findGoBinary()
 	if err != nil {
-		LogWarning("Could not get current version: %v", err)
-		LogWarning("This may indicate the binary is not properly installed")
-		currentVersion = "unknown"
-		if currentVersion == "unknown" {
-			LogError("Cannot proceed with update - current binary not detected")
-			LogError("Please ensure sentinel is properly installed before updating")
-			return fmt.Errorf("cannot update: current binary not detected: %w", err)
-		}
+		return fmt.Errorf("go command not found: %w", err)
 	}
 
-	LogInfo("Creating backup before update...")
-	backup, err := createBackup(currentVersion)
+	module := getConfig().AgentModule
+	resolved, err := queryModuleVersion(goBinary, fmt.Sprintf("%s@%s", module, version))
 	if err != nil {
-		return fmt.Errorf("failed to create backup: %w", err)
+		return fmt.Errorf("version %s of %s not found: %w", version, module, err)
+	}
+	if resolved != version {
+		return newUpdateError(ErrCodeVersionNotFound, "%s@%s resolves to %s; give the exact version", module, version, resolved)
 	}
+	return nil
+}
 
-	updateErr := func() error {
-		LogInfo("Step 1: Stopping main agent service...")
-		if err := serviceManager.Stop(MainAgentServiceName); err != nil {
-			return fmt.Errorf("failed to stop main agent: %w", err)
-		}
-		LogInfo("Main agent service stopped successfully")
+// performUpdate installs targetVersion through the update pipeline, rolling
+// back on failure. noCache is journaled so a resumed update honours it. A
+// version minVersion or skipVersions rejects is refused, even when forced.
+func performUpdate(targetVersion string, noCache bool) (err error) {
+	LogInfo("=== Starting update to %s ===", targetVersion)
 
-		LogInfo("Step 2: Uninstalling main agent service...")
-		if err := serviceManager.Uninstall(MainAgentServiceName); err != nil {
-			return fmt.Errorf("failed to uninstall main agent: %w", err)
-		}
-		LogInfo("Main agent service uninstalled successfully")
+	dataDir, release, err := beginUpdate(targetVersion)
+	if err != nil {
+		return err
+	}
+	defer release()
 
-		LogInfo("Step 3: Cleaning up old files...")
-		if err := cleanupOldFiles(); err != nil {
-			LogWarning("Cleanup failed: %v", err)
-		}
-		LogInfo("Cleanup completed")
+	started := now()
+	previousVersion := ""
+	defer func() {
+		reportUpdateTelemetry(dataDir, previousVersion, targetVersion, now().Sub(started), err)
+	}()
 
-		LogInfo("Step 4: Downloading and compiling version %s...", targetVersion)
-		newBinaryPath, err := downloadAndCompile(targetVersion)
-		if err != nil {
-			return fmt.Errorf("failed to compile: %w", err)
+	currentPath, binaryPath, err := resolveUpdateBinary()
+	var current agentVersion
+	if err == nil {
+		current, err = installedVersionDetailsAt(currentPath)
+	}
+	currentVersion := current.Version
+	if err != nil {
+		if !getConfig().AllowInstallWhenMissing {
+			LogError("Cannot proceed with update - current binary not detected")
+			LogError("Please ensure sentinel is properly installed before updating, or set allowInstallWhenMissing to install it")
+			return fmt.Errorf("cannot update: current binary not detected: %w", err)
 		}
-		LogInfo("Compilation successful, binary at: %s", newBinaryPath)
-
-		LogInfo("Step 5: Installing new binary...")
-		if err := installBinary(newBinaryPath); err != nil {
-			return fmt.Errorf("failed to install binary: %w", err)
+		LogWarning("No working agent binary detected: %v", err)
+		if binaryPath == "" {
+			binaryPath = freshInstallPath()
 		}
-		LogInfo("Binary installed successfully")
+		return performFreshInstall(dataDir, targetVersion, binaryPath, noCache)
+	}
+	previousVersion = currentVersion
+	LogInfo("Installed agent: %s", current)
 
-		LogInfo("Step 6: Reinstalling main agent service...")
-		installedBinaryPath, detectionMethod, detectErr := getMainAgentBinaryPathWithDetails()
-		if detectErr != nil {
-			LogError("Failed to detect newly installed binary: %v", detectErr)
-			installedBinaryPath = paths.GetMainAgentBinaryPath()
-			LogWarning("Using fallback path detection: %s", installedBinaryPath)
-		} else {
-			LogInfo("Newly installed binary detected using method: %s", detectionMethod)
-			LogInfo("Binary path: %s", installedBinaryPath)
-		}
+	if err := runPreflightChecks(); err != nil {
+		LogError("Pre-flight checks failed: %v", err)
+		return fmt.Errorf("update aborted before stopping the agent: %w", err)
+	}
 
-		if err := serviceManager.Install(MainAgentServiceName, installedBinaryPath); err != nil {
-			return fmt.Errorf("failed to install service: %w", err)
-		}
-		LogInfo("Service reinstalled successfully")
+	if err := drainAgent(getConfig()); err != nil {
+		return fmt.Errorf("update aborted before stopping the agent: %w", err)
+	}
 
-		LogInfo("Step 7: Starting main agent service...")
-		if err := serviceManager.Start(MainAgentServiceName); err != nil {
-			return fmt.Errorf("failed to start service: %w", err)
-		}
-		LogInfo("Service started successfully")
+	LogInfo("Creating backup before update...")
+	backup, err := createBackup(currentVersion, currentPath, binaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
 
-		LogInfo("Step 8: Verifying main agent is running...")
-		if err := verifyMainAgentRunning(); err != nil {
-			LogError("Service verification failed: %v", err)
-			return fmt.Errorf("service not running after update: %w", err)
-		}
-		LogInfo("Main agent verified running")
+	if err := saveBackupMetadata(dataDir, backup); err != nil {
+		LogWarning("Failed to persist backup metadata: %v", err)
+		LogWarning("Rollback will not be possible if the updater restarts mid-update")
+	}
+	marker := &UpdateMarker{
+		TargetVersion:          targetVersion,
+		PreviousVersion:        currentVersion,
+		PreviousVersionDetails: current.Raw,
+		NoCache:                noCache,
+		StartedAt:              time.Now(),
+	}
+	markUpdateStep(dataDir, marker, stepBackupCreated)
+	LogInfo("Step %d/%d: Backup created", stepIndex(stepBackupCreated)+1, len(updateSteps))
 
-		return nil
-	}()
+	run := &updateRun{dataDir: dataDir, marker: marker, backup: backup}
+	updateErr := runUpdateTransitions(dataDir, marker, run.transitions())
+
+	recordUpdateHistory(dataDir, marker, updateErr)
 
 	if updateErr != nil {
 		LogError("Update failed: %v", updateErr)
 		LogInfo("Triggering rollback to previous version...")
 
-		if rollbackErr := rollback(backup); rollbackErr != nil {
+		rollbackErr := rollback(backup)
+		recordHistory(dataDir, HistoryActionRollback, targetVersion, backup.Version, rollbackErr)
+		if rollbackErr != nil {
 			LogCritical("Rollback failed: %v", rollbackErr)
 			return fmt.Errorf("update failed and rollback failed: update error: %w, rollback error: %v", updateErr, rollbackErr)
 		}
 
 		LogInfo("Rollback successful, restored version %s", backup.Version)
+		if err := clearUpdateState(dataDir); err != nil {
+			LogWarning("%v", err)
+		}
 		return fmt.Errorf("update failed, rolled back to version %s: %w", backup.Version, updateErr)
 	}
 
-	LogInfo("Update completed successfully, cleaning up backup file...")
-	if err := cleanupBackupFile(backup.BackupPath); err != nil {
-		LogWarning("Failed to clean up backup file: %v", err)
-		LogWarning("Backup file may need to be manually deleted: %s", backup.BackupPath)
-	}
+	LogInfo("Update completed successfully, retaining backup for manual rollback...")
+	finishUpdate(dataDir, backup)
 
 	LogInfo("=== Update completed successfully ===")
 	return nil
 }
 
-func cleanupOldFiles() error {
+// beginUpdate refuses a rejected targetVersion and an unprivileged updater,
+// then takes the update lock for the data directory it returns. The caller
+// must call release when it no longer modifies the agent.
+func beginUpdate(targetVersion string) (dataDir string, release func(), err error) {
+	if reason := getConfig().versionRejection(targetVersion); reason != "" {
+		LogError("Refusing to install %s: %s", targetVersion, reason)
+		return "", nil, newUpdateError(ErrCodeVersionRejected, "refusing to install %s: %s", targetVersion, reason)
+	}
+
+	if err := checkPrivileges(); err != nil {
+		LogError("Cannot update: %v", err)
+		return "", nil, err
+	}
+
+	dataDir = paths.GetDataDirectory()
+	release, err = acquireUpdateLock(dataDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot start update: %w", err)
+	}
+	return dataDir, release, nil
+}
+
+// cleanupOldFiles deletes the agent binary at binaryPath and legacy backups
+// next to it, keeping the backup, database and logs
+func cleanupOldFiles(binaryPath string) error {
 	var errors []string
 
-	binaryPath := paths.GetMainAgentBinaryPath()
 	LogInfo("Deleting main agent binary: %s", binaryPath)
 	if err := os.Remove(binaryPath); err != nil && !os.IsNotExist(err) {
 		errors = append(errors, fmt.Sprintf("failed to delete binary %s: %v", binaryPath, err))
@@ -543,164 +974,403 @@ func cleanupOldFiles() error {
 	return nil
 }
 
-func downloadAndCompile(version string) (string, error) {
+// downloadAndCompile builds the requested agent version with go install and
+// returns the compiled binary path and the build mode that produced it. The
+// cgoEnabled setting selects a CGO build, a pure Go build, or (auto) a pure Go
+// build that falls back to CGO when the agent needs it. A build of the same
+// version cached in the data directory is reused unless useCache is false.
+func downloadAndCompile(dataDir, version string, useCache bool) (string, string, error) {
+	config := getConfig()
+	agentPackage := config.agentPackagePath()
+	if config.ArtifactCacheMaxMB == 0 {
+		return compileAgent(dataDir, version)
+	}
+
+	if !useCache {
+		LogInfo("Build cache bypassed, compiling %s@%s", agentPackage, version)
+	} else if artifact := lookupArtifact(dataDir, agentPackage, version, cacheableBuildModes(config.CGOEnabled)); artifact != nil {
+		LogInfo("Build cache hit: %s@%s (%s build, sha256 %s)", agentPackage, version, artifact.BuildMode, artifact.SHA256)
+		return restoreArtifact(dataDir, agentPackage, artifact)
+	} else {
+		LogInfo("Build cache miss: %s@%s, compiling", agentPackage, version)
+	}
+
+	compiledPath, buildMode, err := compileAgent(dataDir, version)
+	if err != nil {
+		return "", "", err
+	}
+	if err := storeArtifact(dataDir, agentPackage, version, buildMode, compiledPath,
+		int64(config.ArtifactCacheMaxMB)*1024*1024, config.ArtifactCacheMaxAge()); err != nil {
+		LogWarning("Failed to cache compiled binary: %v", err)
+	}
+	return compiledPath, buildMode, nil
+}
+
+// restoreArtifact copies a cached binary to the build output directory, where
+// go install would have written it
+func restoreArtifact(dataDir, agentPackage string, artifact *CachedArtifact) (string, string, error) {
+	binDir := paths.BuildBinDirectory(dataDir)
+	if err := os.RemoveAll(binDir); err != nil {
+		return "", "", fmt.Errorf("failed to remove build directory %s: %w", binDir, err)
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+
+	binaryPath := filepath.Join(binDir, goInstallBinaryName(agentPackage))
+	if err := copyFileStreaming(artifact.Path, binaryPath); err != nil {
+		return "", "", fmt.Errorf("failed to copy cached binary: %w", err)
+	}
+	return binaryPath, artifact.BuildMode, nil
+}
+
+// compileAgent builds the requested agent version with go install into the
+// build output directory under dataDir
+func compileAgent(dataDir, version string) (string, string, error) {
+	goBinary, dirs, env, err := buildEnvironment(dataDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Start from an empty GOBIN so only this build's output can be found
+	if err := removeBuildArtifacts(dirs); err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dirs.GOBIN, 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+
+	account, err := resolveBuildAccount(getConfig().BuildUser)
+	if err != nil {
+		return "", "", err
+	}
+	if account != nil {
+		if env, err = prepareBuildAccount(account, dataDir, dirs, env); err != nil {
+			return "", "", err
+		}
+	}
+
+	agentPackage := getConfig().agentPackagePath()
+	moduleWithVersion := fmt.Sprintf("%s@%s", agentPackage, version)
+	cgoMode := getConfig().CGOEnabled
+	LogInfo("CGO mode: %s (%s)", cgoMode, cgoMode.toolchainRequirement())
+
+	if cgoMode != CGOModeTrue {
+		output, err := runGoInstall(goBinary, moduleWithVersion, setEnvVar(env, "CGO_ENABLED", "0"), account)
+		if err == nil {
+			return compiledBinary(dirs, agentPackage, BuildModePureGo)
+		}
+		if isChecksumMismatch(output) {
+			return "", "", checksumMismatchError(moduleWithVersion, err, output)
+		}
+		if !shouldFallBackToCGO(cgoMode, output) {
+			return "", "", fmt.Errorf("compilation failed: %w\nOutput: %s", err, output)
+		}
+		LogWarning("Pure Go build failed with cgo-related errors, retrying with CGO_ENABLED=1")
+	}
+
+	env, err = cgoBuildEnvironment(env)
+	if err != nil {
+		return "", "", err
+	}
+
+	output, err := runGoInstall(goBinary, moduleWithVersion, env, account)
+	if isChecksumMismatch(output) {
+		return "", "", checksumMismatchError(moduleWithVersion, err, output)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("compilation failed: %w\nOutput: %s", err, output)
+	}
+	return compiledBinary(dirs, agentPackage, BuildModeCGO)
+}
+
+// isChecksumMismatch reports whether go install refused a module because its
+// content does not match go.sum or the checksum database
+func isChecksumMismatch(output string) bool {
+	return strings.Contains(output, "checksum mismatch") || strings.Contains(output, "SECURITY ERROR")
+}
+
+// checksumMismatchError classifies a go install of module that failed its
+// checksum verification; it is never retried with CGO
+func checksumMismatchError(module string, err error, output string) error {
+	LogCritical("The downloaded %s does not match its recorded checksum; it may have been tampered with", module)
+	return newUpdateError(ErrCodeChecksumMismatch, "go install %s failed checksum verification: %v\nOutput: %s", module, err, output)
+}
+
+// buildEnvironment returns the go binary, the Go directories and the
+// environment used to compile the agent, without CGO_ENABLED set
+func buildEnvironment(dataDir string) (string, *goDirs, []string, error) {
 	LogInfo("Setting up Go environment for compilation...")
 
 	goBinary, err := findGoBinary()
 	if err != nil {
-		return "", fmt.Errorf("go command not found: %w", err)
+		return "", nil, nil, fmt.Errorf("go command not found: %w", err)
 	}
 	LogInfo("Using go binary: %s", goBinary)
 
-	gopath := os.Getenv("GOPATH")
-	if gopath == "" {
-		homeDir, err := ensureHomeDirectory()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		gopath = filepath.Join(homeDir, "go")
-		LogInfo("GOPATH not set, using default: %s", gopath)
+	dirs, err := resolveGoDirs(dataDir)
+	if err != nil {
+		return "", nil, nil, err
 	}
+	gopath, gocache, gomodcache := dirs.GOPATH, dirs.GOCACHE, dirs.GOMODCACHE
 
 	goroot := os.Getenv("GOROOT")
 	if goroot == "" {
-		cmd := exec.Command(goBinary, "env", "GOROOT")
-		output, err := cmd.Output()
+		output, _, err := commandRunner.Run(context.Background(), goBinary, []string{"env", "GOROOT"}, nil, "")
 		if err == nil {
 			goroot = strings.TrimSpace(string(output))
 			LogInfo("Detected GOROOT: %s", goroot)
 		}
 	}
 
-	gocache := os.Getenv("GOCACHE")
-	if gocache == "" {
-		gocache = filepath.Join(gopath, "cache")
-		LogInfo("GOCACHE not set, using: %s", gocache)
-	}
-
-	gomodcache := os.Getenv("GOMODCACHE")
-	if gomodcache == "" {
-		gomodcache = filepath.Join(gopath, "pkg", "mod")
-		LogInfo("GOMODCACHE not set, using: %s", gomodcache)
-	}
-
-	env := os.Environ()
-	env = append(env, "CGO_ENABLED=1")
+	env := commandEnvironment()
 	env = append(env, fmt.Sprintf("GOPATH=%s", gopath))
 	if goroot != "" {
 		env = append(env, fmt.Sprintf("GOROOT=%s", goroot))
 	}
 	env = append(env, fmt.Sprintf("GOCACHE=%s", gocache))
 	env = append(env, fmt.Sprintf("GOMODCACHE=%s", gomodcache))
+	env = setEnvVar(env, "GOBIN", dirs.GOBIN)
 
 	LogInfo("Environment variables configured:")
-	LogInfo("  CGO_ENABLED=1")
 	LogInfo("  GOPATH=%s", gopath)
 	if goroot != "" {
 		LogInfo("  GOROOT=%s", goroot)
 	}
 	LogInfo("  GOCACHE=%s", gocache)
 	LogInfo("  GOMODCACHE=%s", gomodcache)
+	LogInfo("  GOBIN=%s", dirs.GOBIN)
 
-	// On Windows, ensure GCC is available
-	if runtime.GOOS == "windows" {
-		LogInfo("Windows platform detected, checking for GCC...")
-		if _, err := exec.LookPath("gcc"); err != nil {
-			LogWarning("GCC not found in PATH, attempting to locate...")
-
-			// Try to find GCC in common locations
-			gccPath := findGCCOnWindows()
-			if gccPath != "" {
-				LogInfo("Found GCC at: %s", gccPath)
-				// Add to PATH for this process
-				currentPath := os.Getenv("PATH")
-				newPath := gccPath + string(os.PathListSeparator) + currentPath
-				env = setEnvVar(env, "PATH", newPath)
-				LogInfo("Added GCC to PATH for compilation")
-			} else {
-				LogError("GCC not found in PATH or common locations")
-				LogError("CGO compilation requires GCC on Windows")
-				LogError("")
-				LogError("INSTALLATION REQUIRED:")
-				LogError("  Install GCC using: winget install BrechtSanders.WinLibs.POSIX.UCRT")
-				LogError("  Or download from: https://winlibs.com/")
-				LogError("")
-				LogError("After installing GCC, the updater will automatically detect it on the next update check")
-				return "", fmt.Errorf("GCC not found - please install GCC and retry")
+	config := getConfig()
+	env = pinHostTarget(applyGoEnv(env, config))
+	logGoEnv(config)
+	if config.BuildParallelism > 0 {
+		env = limitBuildParallelism(env, config.BuildParallelism)
+		LogInfo("  Build parallelism limited to %d (GOFLAGS=%s)", config.BuildParallelism, getEnvVar(env, "GOFLAGS"))
+	}
+
+	return goBinary, dirs, env, nil
+}
+
+// cgoBuildEnvironment enables CGO in env after making sure a C compiler is
+// available. On Windows GCC is added to PATH when it was found outside PATH.
+func cgoBuildEnvironment(env []string) ([]string, error) {
+	if runtime.GOOS != "windows" {
+		if err := ensureCCompiler(runtime.GOOS, env); err != nil {
+			return nil, err
+		}
+	} else {
+		gccDir, err := locateGCC(paths.GetDataDirectory(), getConfig().SearchToolchainOutsidePath, env)
+		if err != nil {
+			return nil, err
+		}
+		if gccDir != "" {
+			// Add to PATH for the build only
+			newPath := gccDir + string(os.PathListSeparator) + getEnvVar(env, "PATH")
+			env = setEnvVar(env, "PATH", newPath)
+			LogInfo("Added GCC to PATH for compilation")
+
+			if getConfig().PersistToolchainPath {
+				if err := persistMachinePath(paths.GetDataDirectory(), gccDir); err != nil {
+					LogWarning("Failed to add GCC to the machine PATH: %v", err)
+				}
 			}
-		} else {
-			LogInfo("GCC found in PATH")
 		}
 	}
 
-	moduleWithVersion := fmt.Sprintf("%s/cmd/sentinel@%s", MainAgentModule, version)
-	LogInfo("Executing: %s install %s", goBinary, moduleWithVersion)
-
-	cmd := exec.Command(goBinary, "install", moduleWithVersion)
-	cmd.Env = env
+	return setEnvVar(env, "CGO_ENABLED", "1"), nil
+}
 
-	output, err := cmd.CombinedOutput()
+// runGoInstall runs go install for module with env, streaming its output. It
+// runs as account when that is not nil.
+func runGoInstall(goBinary, module string, env []string, account *buildAccount) (string, error) {
+	priority := getConfig().BuildPriority
+	LogInfo("Executing: CGO_ENABLED=%s %s install %s (%s priority)", getEnvVar(env, "CGO_ENABLED"), goBinary, module, priority)
 
-	if len(output) > 0 {
-		LogInfo("Compilation output:\n%s", string(output))
+	if account != nil {
+		LogInfo("Building as user %s (uid %d, gid %d)", account.Name, account.UID, account.GID)
 	}
 
+	progress := &logLines{prefix: "[go install]"}
+	stdout, stderr, err := buildRunner(account, priority, progress).Run(context.Background(), goBinary, []string{"install", module}, env, "")
+	progress.Flush()
+	output := string(stdout) + string(stderr)
 	if err != nil {
 		LogError("Compilation failed: %v", err)
-		LogError("Output: %s", string(output))
-		return "", fmt.Errorf("compilation failed: %w\nOutput: %s", err, string(output))
+		LogError("Output: %s", output)
 	}
+	return output, err
+}
+
+// buildRunner returns the runner for go install, which runs the build as
+// account at priority and writes its output to progress
+func buildRunner(account *buildAccount, priority string, progress io.Writer) command.Runner {
+	return processRunner(func(process *command.Exec) {
+		var started func(*os.Process)
+		process.Prepare = func(cmd *exec.Cmd) {
+			if account != nil {
+				runAsBuildAccount(cmd, account)
+			}
+			started = prioritizeBuild(cmd, priority)
+		}
+		process.Started = func(p *os.Process) {
+			if started != nil {
+				started(p)
+			}
+		}
+		process.Output = progress
+	})
+}
 
-	binaryName := "sentinel"
-	if runtime.GOOS == "windows" {
-		binaryName = "sentinel.exe"
+// processRunner returns commandRunner with adjust applied to it when it
+// starts processes. Other runners, such as fakes, are returned as they are.
+func processRunner(adjust func(process *command.Exec)) command.Runner {
+	process, ok := commandRunner.(command.Exec)
+	if !ok {
+		return commandRunner
 	}
-	compiledBinaryPath := filepath.Join(gopath, "bin", binaryName)
+	adjust(&process)
+	return process
+}
+
+// compiledBinary returns the path go install wrote the agent to
+func compiledBinary(dirs *goDirs, agentPackage, buildMode string) (string, string, error) {
+	compiledBinaryPath := filepath.Join(dirs.GOBIN, goInstallBinaryName(agentPackage))
 
 	if _, err := os.Stat(compiledBinaryPath); os.IsNotExist(err) {
 		LogError("Compiled binary not found at expected location: %s", compiledBinaryPath)
-		return "", fmt.Errorf("compiled binary not found at expected location: %s", compiledBinaryPath)
+		return "", "", fmt.Errorf("compiled binary not found at expected location: %s", compiledBinaryPath)
+	}
+
+	// A build for another platform is never cached or installed
+	if err := verifyBinaryArchitecture(compiledBinaryPath); err != nil {
+		LogError("Compiled binary cannot run on this host: %v", err)
+		return "", "", err
 	}
 
-	LogInfo("Compilation successful, binary located at: %s", compiledBinaryPath)
-	return compiledBinaryPath, nil
+	LogInfo("Compilation successful (%s build), binary located at: %s", buildMode, compiledBinaryPath)
+	return compiledBinaryPath, buildMode, nil
 }
 
-func installBinary(sourcePath string) error {
-	targetPath := paths.GetMainAgentBinaryPath()
-	LogInfo("Installing binary from %s to %s", sourcePath, targetPath)
+// removeBuildArtifacts deletes the build output directory
+func removeBuildArtifacts(dirs *goDirs) error {
+	if err := os.RemoveAll(dirs.GOBIN); err != nil {
+		return fmt.Errorf("failed to remove build directory %s: %w", dirs.GOBIN, err)
+	}
+	return nil
+}
 
-	targetDir := filepath.Dir(targetPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
+// goDirs holds the directories go install reads from and writes to
+type goDirs struct {
+	GOPATH     string
+	GOBIN      string
+	GOCACHE    string
+	GOMODCACHE string
+}
+
+// resolveGoDirs returns the Go directories used for compilation, applying the
+// updater's defaults for any that are not set in the environment. GOBIN is
+// always the private build directory under dataDir, so go install never
+// replaces a binary in the user's GOPATH. With a build user, all of them are
+// under dataDir.
+func resolveGoDirs(dataDir string) (*goDirs, error) {
+	if getConfig().BuildUser != "" {
+		// The build user gets a GOPATH of its own, so none of root's
+		// directories are handed over to it
+		gopath := paths.BuildGoPathDirectory(dataDir)
+		return &goDirs{
+			GOPATH:     gopath,
+			GOBIN:      paths.BuildBinDirectory(dataDir),
+			GOCACHE:    filepath.Join(gopath, "cache"),
+			GOMODCACHE: filepath.Join(gopath, "pkg", "mod"),
+		}, nil
 	}
 
-	sourceData, err := os.ReadFile(sourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to read source binary: %w", err)
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		homeDir, err := ensureHomeDirectory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		gopath = filepath.Join(homeDir, "go")
+		LogInfo("GOPATH not set, using default: %s", gopath)
 	}
 
-	if err := os.WriteFile(targetPath, sourceData, 0755); err != nil {
-		return fmt.Errorf("failed to write target binary: %w", err)
+	dirs := &goDirs{
+		GOPATH:     gopath,
+		GOBIN:      paths.BuildBinDirectory(dataDir),
+		GOCACHE:    os.Getenv("GOCACHE"),
+		GOMODCACHE: os.Getenv("GOMODCACHE"),
+	}
+	if dirs.GOCACHE == "" {
+		dirs.GOCACHE = filepath.Join(gopath, "cache")
+	}
+	if dirs.GOMODCACHE == "" {
+		dirs.GOMODCACHE = filepath.Join(gopath, "pkg", "mod")
 	}
 
-	LogInfo("Binary written to: %s", targetPath)
+	return dirs, nil
+}
 
-	if runtime.GOOS != "windows" {
-		if err := os.Chmod(targetPath, 0755); err != nil {
-			return fmt.Errorf("failed to set executable permissions: %w", err)
-		}
-		LogInfo("Set executable permissions (0755) on: %s", targetPath)
+// logLines is the io.Writer go install's output is written to. It logs each
+// line with prefix as it arrives, so long-running builds show progress in
+// the log.
+type logLines struct {
+	mu      sync.Mutex
+	prefix  string
+	partial []byte
+}
 
-		if os.Geteuid() == 0 {
-			if err := os.Chown(targetPath, 0, 0); err != nil {
-				LogWarning("Failed to set ownership to root: %v", err)
-			} else {
-				LogInfo("Set ownership to root:root on: %s", targetPath)
-			}
+func (l *logLines) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partial = append(l.partial, p...)
+	for {
+		line, rest, found := bytes.Cut(l.partial, []byte("\n"))
+		if !found {
+			break
 		}
+		LogInfo("%s %s", l.prefix, strings.TrimSuffix(string(line), "\r"))
+		l.partial = rest
+	}
+	return len(p), nil
+}
+
+// Flush logs the output that followed the last newline
+func (l *logLines) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.partial) > 0 {
+		LogInfo("%s %s", l.prefix, l.partial)
+		l.partial = nil
+	}
+}
+
+// installBinary verifies the binary at sourcePath and installs it at
+// targetPath
+func installBinary(sourcePath, targetPath string) error {
+	LogInfo("Installing binary from %s to %s", sourcePath, targetPath)
+
+	if err := verifyBinaryArchitecture(sourcePath); err != nil {
+		LogError("Refusing to install binary: %v", err)
+		return err
+	}
+	config := getConfig()
+	if err := checkCodeSignature(runtime.GOOS, sourcePath, config.CodesignPolicy, config.TrustedSigners); err != nil {
+		return err
+	}
+
+	targetDir := filepath.Dir(targetPath)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	if err := replaceBinary(sourcePath, targetPath); err != nil {
+		return fmt.Errorf("failed to write target binary: %w", err)
 	}
 
+	LogInfo("Binary written to: %s", targetPath)
+
 	fileInfo, err := os.Stat(targetPath)
 	if err != nil {
 		return fmt.Errorf("failed to verify installed binary: %w", err)
@@ -716,16 +1386,20 @@ func installBinary(sourcePath string) error {
 	return nil
 }
 
-func verifyMainAgentRunning() error {
-	const maxRetries = 3
-	const retryDelay = 2 * time.Second
+// verifyMainAgentRunning waits for the agent service to run, checking up to
+// verifyRetries times, verifyDelaySeconds apart. binaryPath is the binary it
+// was registered with, named in the error when it never starts.
+func verifyMainAgentRunning(binaryPath string) error {
+	config := getConfig()
+	maxRetries := config.VerifyRetries
+	retryDelay := config.VerifyDelay()
 
 	LogInfo("Verifying service is running (max %d retries, %v delay)...", maxRetries, retryDelay)
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		LogInfo("Verification attempt %d/%d", attempt, maxRetries)
 
-		isRunning, err := serviceManager.IsRunning(MainAgentServiceName)
+		isRunning, err := serviceManager.IsRunning(agentServiceName())
 		if err != nil {
 			LogError("Error checking service status: %v", err)
 			if attempt < maxRetries {
@@ -748,51 +1422,56 @@ func verifyMainAgentRunning() error {
 		}
 	}
 
-	return fmt.Errorf("service not running after %d verification attempts", maxRetries)
+	err := fmt.Errorf("service not running after %d verification attempts", maxRetries)
+	return withAgentOutput(withGatekeeperHint(runtime.GOOS, binaryPath, err))
+}
+
+// resolveUpdateBinary detects the agent binary once for an update. It
+// returns the current binary, whose version is read and which is backed up,
+// and the path the update installs to. Every later step uses these paths,
+// since detection can answer differently once the old binary is removed.
+func resolveUpdateBinary() (currentPath, binaryPath string, err error) {
+	currentPath, detectionMethod, err := getMainAgentBinaryPathWithDetails()
+	if err != nil {
+		return "", "", err
+	}
+	binaryPath = updateTargetPath(currentPath)
+	if !sameFile(currentPath, binaryPath) {
+		LogInfo("Agent binary for this update: %s (current copy %s found via %s is backed up but left in place)",
+			binaryPath, currentPath, detectionMethod)
+	} else {
+		LogInfo("Agent binary for this update: %s (found via %s)", binaryPath, detectionMethod)
+	}
+	if target, linked, err := resolveBinaryLink(binaryPath); err == nil && linked {
+		LogInfo("%s is a symbolic link to %s, the update replaces %s and keeps the link", binaryPath, target, target)
+	}
+	return currentPath, binaryPath, nil
 }
 
 type BackupInfo struct {
-	Version    string
-	BackupPath string
-	BinaryPath string
-	Timestamp  time.Time
+	Version    string            `json:"version"`
+	BackupPath string            `json:"backupPath"`
+	BinaryPath string            `json:"binaryPath"`
+	Timestamp  time.Time         `json:"timestamp"`
+	SHA256     string            `json:"sha256,omitempty"`
+	Database   *DatabaseSnapshot `json:"database,omitempty"`
+
+	// LinkTarget is the file BinaryPath points to when it is a symbolic
+	// link; the update and a rollback write to it and keep the link
+	LinkTarget string `json:"linkTarget,omitempty"`
 }
 
-func createBackup(currentVersion string) (*BackupInfo, error) {
+// createBackup copies the current binary at currentPath next to binaryPath,
+// the path the update installs to and a rollback restores
+func createBackup(currentVersion, currentPath, binaryPath string) (*BackupInfo, error) {
 	LogInfo("Creating backup of current binary...")
 
-	binaryPath := paths.GetMainAgentBinaryPath()
-
-	// Check if binary exists at system location
-	if _, err := os.Stat(binaryPath); os.IsNotExist(err) {
-		// If not found at system location, try platform-specific paths
-		possiblePaths := getPossibleBinaryPaths()
-		LogInfo("Binary not found at system location, checking %d possible locations...", len(possiblePaths))
-		for _, path := range possiblePaths {
-			if _, err := os.Stat(path); err == nil {
-				LogInfo("Found binary for backup at: %s", path)
-				binaryPath = path
-				break
-			}
-		}
-
-		// If still not found, return error
-		if binaryPath == paths.GetMainAgentBinaryPath() {
-			return nil, fmt.Errorf("current binary not found at %s or any fallback location", binaryPath)
-		}
-	}
-
 	backupPath := binaryPath + ".backup"
 
-	LogInfo("Reading current binary from: %s", binaryPath)
-	binaryData, err := os.ReadFile(binaryPath)
+	LogInfo("Copying current binary from %s to %s", currentPath, backupPath)
+	checksum, err := writeVerifiedBackup(currentPath, backupPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read current binary: %w", err)
-	}
-
-	LogInfo("Writing backup to: %s", backupPath)
-	if err := os.WriteFile(backupPath, binaryData, 0755); err != nil {
-		return nil, fmt.Errorf("failed to write backup file: %w", err)
+		return nil, err
 	}
 
 	backupInfo, err := os.Stat(backupPath)
@@ -805,97 +1484,129 @@ func createBackup(currentVersion string) (*BackupInfo, error) {
 		BackupPath: backupPath,
 		BinaryPath: binaryPath,
 		Timestamp:  time.Now(),
+		SHA256:     checksum,
+	}
+	if target, linked, err := resolveBinaryLink(binaryPath); err == nil && linked {
+		backup.LinkTarget = target
 	}
 
 	LogInfo("Backup created successfully:")
 	LogInfo("  Version: %s", backup.Version)
 	LogInfo("  Path: %s", backup.BackupPath)
 	LogInfo("  Binary Path: %s", backup.BinaryPath)
+	if backup.LinkTarget != "" {
+		LogInfo("  Links to: %s", backup.LinkTarget)
+	}
 	LogInfo("  Size: %d bytes", backupInfo.Size())
+	LogInfo("  SHA256: %s", backup.SHA256)
 	LogInfo("  Timestamp: %s", backup.Timestamp.Format(time.RFC3339))
 
 	return backup, nil
 }
 
+// logManualRecoverySteps tells the operator how to restore the agent when the
+// backup cannot be used
+func logManualRecoverySteps(backup *BackupInfo) {
+	LogCritical("Manual recovery steps:")
+	LogCritical("  1. Restore a retained backup from %s with: sentinel-updater rollback [--to <version>]", paths.GetBackupDirectory())
+	if backup.Version != "" && backup.Version != "unknown" {
+		LogCritical("  2. Or rebuild version %s with: go install %s@%s", backup.Version, getConfig().agentPackagePath(), backup.Version)
+		LogCritical("     and copy the binary to %s", backup.BinaryPath)
+	}
+	LogCritical("  Then start the %s service with the system service manager", agentServiceName())
+}
+
 func rollback(backup *BackupInfo) error {
 	LogInfo("=== Starting rollback process ===")
 	LogInfo("Rolling back to version: %s", backup.Version)
 	LogInfo("Backup path: %s", backup.BackupPath)
 
-	LogInfo("Step 1: Verifying backup file exists...")
+	LogInfo("Step 1: Verifying backup file...")
 	if _, err := os.Stat(backup.BackupPath); os.IsNotExist(err) {
 		LogCritical("Backup file not found at %s", backup.BackupPath)
+		logManualRecoverySteps(backup)
 		return fmt.Errorf("backup file not found at %s - manual recovery required", backup.BackupPath)
 	}
+	// Backups recorded before checksums were stored are restored unverified
+	if backup.SHA256 == "" {
+		LogWarning("No checksum recorded for %s, restoring it unverified", backup.BackupPath)
+	} else if err := verifyChecksum(backup.BackupPath, backup.SHA256); err != nil {
+		LogCritical("Backup verification failed, refusing to restore a corrupt binary: %v", err)
+		logManualRecoverySteps(backup)
+		return fmt.Errorf("backup %s failed verification, refusing to restore: %w - manual recovery required", backup.BackupPath, err)
+	}
 	LogInfo("Backup file verified")
 
+	// The new binary may still be running (e.g. a failed health check), and a
+	// running executable cannot be overwritten on every platform
+	LogInfo("Stopping main agent service before restoring...")
+	if err := serviceManager.Stop(agentServiceName()); err != nil {
+		LogWarning("Failed to stop main agent service: %v", err)
+	}
+
 	LogInfo("Step 2: Restoring binary from backup...")
 	binaryPath := backup.BinaryPath
 	LogInfo("Restoring to original binary path: %s", binaryPath)
 
-	backupData, err := os.ReadFile(backup.BackupPath)
-	if err != nil {
-		LogCritical("Failed to read backup file: %v", err)
-		return fmt.Errorf("failed to read backup file: %w - manual recovery may be required", err)
-	}
-
 	targetDir := filepath.Dir(binaryPath)
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
 		LogCritical("Failed to create target directory: %v", err)
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	if err := os.WriteFile(binaryPath, backupData, 0755); err != nil {
+	if err := replaceBinary(backup.BackupPath, binaryPath); err != nil {
 		LogCritical("Failed to restore binary: %v", err)
 		return fmt.Errorf("failed to restore binary: %w - manual recovery required", err)
 	}
 	LogInfo("Binary restored to: %s", binaryPath)
 
-	if runtime.GOOS != "windows" {
-		if err := os.Chmod(binaryPath, 0755); err != nil {
-			LogWarning("Failed to set executable permissions: %v", err)
-		}
-		if os.Geteuid() == 0 {
-			if err := os.Chown(binaryPath, 0, 0); err != nil {
-				LogWarning("Failed to set ownership to root: %v", err)
+	if backup.Database != nil {
+		if getConfig().RestoreDatabaseOnRollback {
+			if err := restoreDatabaseSnapshot(backup.Database); err != nil {
+				LogCritical("Failed to restore database snapshot: %v", err)
+				return fmt.Errorf("failed to restore database: %w - manual recovery required from %s", err, backup.Database.Dir)
 			}
+			LogInfo("Database restored from snapshot")
+		} else {
+			LogInfo("Database snapshot kept at %s (restoreDatabaseOnRollback is disabled)", backup.Database.Dir)
 		}
 	}
 
 	LogInfo("Step 3: Reinstalling service...")
-	// For rollback, always use the system binary path, not the user GOPATH location
-	systemBinaryPath := paths.GetMainAgentBinaryPath()
-
-	// If we restored to a user location, copy it to the system location
-	if binaryPath != systemBinaryPath {
-		LogInfo("Copying binary from %s to system location %s", binaryPath, systemBinaryPath)
-		if err := os.MkdirAll(filepath.Dir(systemBinaryPath), 0755); err != nil {
-			LogError("Failed to create system binary directory: %v", err)
-			return fmt.Errorf("failed to create system binary directory: %w", err)
+	// Older backups may record a user GOPATH location; the service runs the
+	// binary where updates install it
+	installPath := updateTargetPath(binaryPath)
+
+	// If we restored to a user location, copy it to the install location
+	if binaryPath != installPath {
+		LogInfo("Copying binary from %s to install location %s", binaryPath, installPath)
+		if err := os.MkdirAll(filepath.Dir(installPath), 0755); err != nil {
+			LogError("Failed to create install directory: %v", err)
+			return fmt.Errorf("failed to create install directory: %w", err)
 		}
-		if err := os.WriteFile(systemBinaryPath, backupData, 0755); err != nil {
-			LogError("Failed to copy binary to system location: %v", err)
-			return fmt.Errorf("failed to copy binary to system location: %w", err)
+		if err := replaceBinary(backup.BackupPath, installPath); err != nil {
+			LogError("Failed to copy binary to install location: %v", err)
+			return fmt.Errorf("failed to copy binary to install location: %w", err)
 		}
-		LogInfo("Binary copied to system location: %s", systemBinaryPath)
-		binaryPath = systemBinaryPath
+		LogInfo("Binary copied to install location: %s", installPath)
+		binaryPath = installPath
 	}
 
-	if err := serviceManager.Install(MainAgentServiceName, binaryPath); err != nil {
+	if err := serviceManager.Install(agentServiceName(), binaryPath); err != nil {
 		LogError("Failed to reinstall service: %v", err)
 		return fmt.Errorf("failed to reinstall service: %w - manual service installation required", err)
 	}
 	LogInfo("Service reinstalled successfully")
 
 	LogInfo("Step 4: Starting service...")
-	if err := serviceManager.Start(MainAgentServiceName); err != nil {
+	if err := serviceManager.Start(agentServiceName()); err != nil {
 		LogError("Failed to start service: %v", err)
 		return fmt.Errorf("failed to start service: %w - manual service start required", err)
 	}
 	LogInfo("Service started successfully")
 
 	LogInfo("Step 5: Verifying service is running...")
-	if err := verifyMainAgentRunning(); err != nil {
+	if err := verifyMainAgentRunning(binaryPath); err != nil {
 		LogError("Service not running after rollback: %v", err)
 		return fmt.Errorf("service not running after rollback: %w - manual verification required", err)
 	}
@@ -926,7 +1637,7 @@ func cleanupBackupFile(backupPath string) error {
 
 // findGCCOnWindows searches for GCC in common Windows installation locations
 func findGCCOnWindows() string {
-	LogInfo("Searching for GCC in common Windows installation directories...")
+	LogDebug("Searching for GCC in common Windows installation directories...")
 
 	// Common GCC installation paths on Windows
 	commonPaths := []string{
@@ -965,23 +1676,11 @@ func findGCCOnWindows() string {
 	for _, path := range commonPaths {
 		gccExe := filepath.Join(path, "gcc.exe")
 		if _, err := os.Stat(gccExe); err == nil {
-			LogInfo("Found gcc.exe at: %s", path)
+			LogDebug("Found gcc.exe at: %s", path)
 			return path
 		}
 	}
 
-	LogInfo("GCC not found in any common installation directory")
+	LogDebug("GCC not found in any common installation directory")
 	return ""
 }
-
-// setEnvVar sets or updates an environment variable in the env slice
-func setEnvVar(env []string, key, value string) []string {
-	prefix := key + "="
-	for i, e := range env {
-		if strings.HasPrefix(e, prefix) {
-			env[i] = prefix + value
-			return env
-		}
-	}
-	return append(env, prefix+value)
-}
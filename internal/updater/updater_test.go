@@ -0,0 +1,486 @@
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/command/commandtest"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service"
+	"github.com/BrainStation-23/SentinelGo-Updater/internal/service/servicetest"
+)
+
+// withConfig makes config active for the duration of the test
+func withConfig(t *testing.T, config *UpdaterConfig) {
+	original := getConfig()
+	activeConfig.Store(config)
+	t.Cleanup(func() { activeConfig.Store(original) })
+}
+
+// useServiceManager makes manager the service manager for the duration of
+// the test
+func useServiceManager(t *testing.T, manager service.Manager) {
+	original := serviceManager
+	serviceManager = manager
+	t.Cleanup(func() { serviceManager = original })
+}
+
+// useRunner makes runner run the commands of the package for the duration
+// of the test
+func useRunner(t *testing.T, runner command.Runner) {
+	original := commandRunner
+	commandRunner = runner
+	t.Cleanup(func() { commandRunner = original })
+}
+
+// stubAutoDetection replaces auto-detection and reports whether it was called
+func stubAutoDetection(t *testing.T) *bool {
+	called := false
+	original := autoDetectBinary
+	autoDetectBinary = func() (string, string, error) {
+		called = true
+		return "/auto/sentinel", "auto_detection", nil
+	}
+	t.Cleanup(func() { autoDetectBinary = original })
+	return &called
+}
+
+// TestBinaryPathAutoDetectionDisabled verifies that an invalid configured
+// binaryPath is an error when auto-detection is disabled
+func TestBinaryPathAutoDetectionDisabled(t *testing.T) {
+	config := defaultConfig()
+	config.BinaryPath = filepath.Join(t.TempDir(), "missing", "sentinel")
+	config.EnableAutoDetection = false
+	withConfig(t, config)
+	autoDetected := stubAutoDetection(t)
+
+	if _, _, err := getMainAgentBinaryPathWithDetails(); err == nil {
+		t.Error("getMainAgentBinaryPathWithDetails() should fail for an invalid binaryPath")
+	}
+	if *autoDetected {
+		t.Error("auto-detection ran although enableAutoDetection is false")
+	}
+}
+
+// TestBinaryPathAutoDetectionFallback verifies that an invalid configured
+// binaryPath falls back to auto-detection when it is enabled
+func TestBinaryPathAutoDetectionFallback(t *testing.T) {
+	config := defaultConfig()
+	config.BinaryPath = filepath.Join(t.TempDir(), "missing", "sentinel")
+	withConfig(t, config)
+	autoDetected := stubAutoDetection(t)
+
+	path, method, err := getMainAgentBinaryPathWithDetails()
+	if err != nil {
+		t.Fatalf("getMainAgentBinaryPathWithDetails() failed: %v", err)
+	}
+	if !*autoDetected || path != "/auto/sentinel" || method != "auto_detection" {
+		t.Errorf("getMainAgentBinaryPathWithDetails() = %s, %s; want auto-detected path", path, method)
+	}
+}
+
+// TestBinaryPathConfigured verifies that a valid configured binaryPath is used
+// without auto-detection
+func TestBinaryPathConfigured(t *testing.T) {
+	binaryPath := filepath.Join(t.TempDir(), "sentinel")
+	if err := os.WriteFile(binaryPath, []byte("binary"), 0755); err != nil {
+		t.Fatalf("failed to write binary: %v", err)
+	}
+
+	config := defaultConfig()
+	config.BinaryPath = binaryPath
+	config.EnableAutoDetection = false
+	withConfig(t, config)
+	autoDetected := stubAutoDetection(t)
+
+	path, method, err := getMainAgentBinaryPathWithDetails()
+	if err != nil {
+		t.Fatalf("getMainAgentBinaryPathWithDetails() failed: %v", err)
+	}
+	if path != binaryPath || method != "manual_configuration" {
+		t.Errorf("getMainAgentBinaryPathWithDetails() = %s, %s; want %s, manual_configuration", path, method, binaryPath)
+	}
+	if *autoDetected {
+		t.Error("auto-detection ran although binaryPath is valid")
+	}
+}
+
+// TestBinaryPathsFirstValidWins verifies that binaryPath is tried first and
+// the first valid entry of binaryPaths is used when it is missing
+func TestBinaryPathsFirstValidWins(t *testing.T) {
+	dir := t.TempDir()
+	second := filepath.Join(dir, "second", "sentinel")
+	third := filepath.Join(dir, "third", "sentinel")
+	for _, path := range []string{second, third} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("binary"), 0755); err != nil {
+			t.Fatalf("failed to write binary: %v", err)
+		}
+	}
+
+	config := defaultConfig()
+	config.BinaryPath = filepath.Join(dir, "first", "sentinel")
+	config.BinaryPaths = []string{config.BinaryPath, second, third}
+	withConfig(t, config)
+	autoDetected := stubAutoDetection(t)
+
+	path, _, err := getMainAgentBinaryPathWithDetails()
+	if err != nil {
+		t.Fatalf("getMainAgentBinaryPathWithDetails() failed: %v", err)
+	}
+	if path != second {
+		t.Errorf("getMainAgentBinaryPathWithDetails() = %s; want %s", path, second)
+	}
+	if *autoDetected {
+		t.Error("auto-detection ran although a configured path is valid")
+	}
+}
+
+// TestConfiguredBinaryPaths verifies that binaryPath comes first and empty or
+// duplicate entries are dropped
+func TestConfiguredBinaryPaths(t *testing.T) {
+	config := &UpdaterConfig{
+		BinaryPath:  "/opt/sentinel/sentinel",
+		BinaryPaths: []string{"", "/usr/local/bin/sentinel", "/opt/sentinel/sentinel"},
+	}
+
+	got := config.configuredBinaryPaths()
+	want := []string{"/opt/sentinel/sentinel", "/usr/local/bin/sentinel"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("configuredBinaryPaths() = %v; want %v", got, want)
+	}
+}
+
+// TestResolveUpdateBinaryOnce verifies that an update detects the binary once
+// and reads the installed version from that binary, even when a second
+// detection would find a different copy
+func TestResolveUpdateBinaryOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake agent script requires a Unix shell")
+	}
+	dir := t.TempDir()
+	var detected []string
+	for i, version := range []string{"v1.0.0", "v2.0.0"} {
+		path := filepath.Join(dir, fmt.Sprintf("sentinel-%d", i+1))
+		writeLog(t, path, "#!/bin/sh\necho sentinel "+version+"\n")
+		if err := os.Chmod(path, 0755); err != nil {
+			t.Fatalf("failed to make %s executable: %v", path, err)
+		}
+		detected = append(detected, path)
+	}
+
+	config := defaultConfig()
+	config.BinaryPath = filepath.Join(dir, "missing", "sentinel")
+	withConfig(t, config)
+	calls := 0
+	original := autoDetectBinary
+	autoDetectBinary = func() (string, string, error) {
+		path := detected[calls%len(detected)]
+		calls++
+		return path, "auto_detection", nil
+	}
+	t.Cleanup(func() { autoDetectBinary = original })
+
+	currentPath, binaryPath, err := resolveUpdateBinary()
+	if err != nil {
+		t.Fatalf("resolveUpdateBinary() failed: %v", err)
+	}
+	version, err := installedVersionAt(currentPath)
+	if err != nil {
+		t.Fatalf("installedVersionAt(%s) failed: %v", currentPath, err)
+	}
+
+	if calls != 1 {
+		t.Errorf("binary detected %d times; want once", calls)
+	}
+	if currentPath != detected[0] || version != "v1.0.0" {
+		t.Errorf("current binary = %s at %s; want v1.0.0 at %s", version, currentPath, detected[0])
+	}
+	if want := agentBinaryPath(); binaryPath != want {
+		t.Errorf("update target = %s; want %s", binaryPath, want)
+	}
+}
+
+// TestParseReportedVersion verifies that the version is found in --version
+// output, falling back to the commit hash of a development build
+func TestParseReportedVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"sentinel version v1.2.0", "v1.2.0"},
+		{"sentinel v0.0.0-20260101120000-a1b2c3d4e5f6 (linux/amd64)", "v0.0.0-20260101120000-a1b2c3d4e5f6"},
+		{"sentinel dev build a1b2c3d", "a1b2c3d"},
+		{"sentinel dev build", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseReportedVersion(tt.output); got != tt.want {
+			t.Errorf("parseReportedVersion(%q) = %q; want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+// TestInstalledVersionDetails verifies that the full --version output is kept
+// next to the normalized version and published in the status
+func TestInstalledVersionDetails(t *testing.T) {
+	saveLogger(t)
+	t.Cleanup(func() { lastAgentVersion.Store(nil); startStatus("") })
+	dataDir := t.TempDir()
+	startStatus(dataDir)
+	binary := filepath.Join(t.TempDir(), "sentinel")
+	writeLog(t, binary, "binary")
+	raw := "SentinelGo v1.6.116 (abcdef, 2024-01-01)"
+	useRunner(t, &commandtest.FakeRunner{Results: map[string]commandtest.Result{
+		binary + " --version": {Stdout: raw + "\n"},
+	}})
+
+	details, err := installedVersionDetailsAt(binary)
+	if err != nil || details.Version != "v1.6.116" || details.Raw != raw {
+		t.Fatalf("installedVersionDetailsAt() = %+v, %v; want v1.6.116 with %q", details, err, raw)
+	}
+	if want := "v1.6.116 (" + raw + ")"; details.String() != want {
+		t.Errorf("String() = %q; want %q", details.String(), want)
+	}
+	if got := (agentVersion{Version: "v1.6.116", Raw: "v1.6.116"}).String(); got != "v1.6.116" {
+		t.Errorf("String() without details = %q; want v1.6.116", got)
+	}
+
+	recordCheckResult("v1.6.116", nil, false, "up to date")
+	if status, err := readStatus(dataDir); err != nil || status.InstalledVersionDetails != raw {
+		t.Errorf("status = %+v, %v; want details %q", status, err, raw)
+	}
+	recordCheckResult("v1.6.117", nil, false, "updated to v1.6.117")
+	if status, err := readStatus(dataDir); err != nil || status.InstalledVersionDetails != "" {
+		t.Errorf("status after an update = %+v, %v; want no stale details", status, err)
+	}
+}
+
+// TestInstalledVersionFallbacks verifies that an agent without --version has
+// its version read with versionArgs or the common alternatives, and that
+// output without a version is not taken for one
+func TestInstalledVersionFallbacks(t *testing.T) {
+	saveLogger(t)
+	t.Cleanup(func() { lastAgentVersion.Store(nil) })
+	var output bytes.Buffer
+	useLogOutput(&output)
+	binary := filepath.Join(t.TempDir(), "sentinel")
+	writeLog(t, binary, "binary")
+	unknownFlag := commandtest.Failure("flag provided but not defined")
+
+	tests := []struct {
+		name        string
+		versionArgs []string
+		results     map[string]commandtest.Result
+		want        string
+		wantCalls   []string
+	}{
+		{"version subcommand", nil, map[string]commandtest.Result{
+			" --version": unknownFlag,
+			" version":   {Stdout: "SentinelGo v1.6.116 (abcdef)\n"},
+		}, "v1.6.116", []string{"--version", "version"}},
+		{"verbose -v", nil, map[string]commandtest.Result{
+			" --version": unknownFlag,
+			" version":   unknownFlag,
+			" -v":        {Stdout: "verbose logging enabled\n"},
+			" -V":        {Stdout: "v2.0.0\n"},
+		}, "v2.0.0", []string{"--version", "version", "-v", "-V"}},
+		{"configured", []string{"info", "--short"}, map[string]commandtest.Result{
+			" info --short": {Stdout: "v3.0.0\n"},
+		}, "v3.0.0", []string{"info --short"}},
+		{"broken", nil, map[string]commandtest.Result{
+			" --version": unknownFlag,
+			" version":   unknownFlag,
+			" -v":        unknownFlag,
+			" -V":        unknownFlag,
+		}, "", []string{"--version", "version", "-v", "-V"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			if tt.versionArgs != nil {
+				config.VersionArgs = tt.versionArgs
+			}
+			withConfig(t, config)
+			results := make(map[string]commandtest.Result)
+			for args, result := range tt.results {
+				results[binary+args] = result
+			}
+			runner := &commandtest.FakeRunner{Results: results}
+			useRunner(t, runner)
+			output.Reset()
+
+			version, err := installedVersionAt(binary)
+			if version != tt.want || (err != nil) != (tt.want == "") {
+				t.Errorf("installedVersionAt() = %q, %v; want %q", version, err, tt.want)
+			}
+			var want []string
+			for _, args := range tt.wantCalls {
+				want = append(want, binary+" "+args)
+			}
+			if calls := runner.CallLog(); !slices.Equal(calls, want) {
+				t.Errorf("commands = %q; want %q", calls, want)
+			}
+			if len(tt.wantCalls) > 1 && tt.want != "" {
+				if last := tt.wantCalls[len(tt.wantCalls)-1]; !strings.Contains(output.String(), fmt.Sprintf("printed its version with %q", last)) {
+					t.Errorf("log does not name %q:\n%s", last, output.String())
+				}
+			}
+		})
+	}
+
+	config := &UpdaterConfig{VersionArgs: []string{"-V"}}
+	want := [][]string{{"-V"}, {"--version"}, {"version"}, {"-v"}}
+	if got := config.versionInvocations(); !slices.EqualFunc(got, want, slices.Equal[[]string]) {
+		t.Errorf("versionInvocations() = %q; want %q", got, want)
+	}
+}
+
+// useFakeGo puts a go script on PATH whose install writes an executable
+// header for the host followed by "compiled" to sentinel in GOBIN, or
+// GOPATH/bin when GOBIN is unset, like go install. It returns the GOPATH and
+// a count of the installs run.
+func useFakeGo(t *testing.T) (string, func() int) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go script requires a Unix shell")
+	}
+
+	header := hostBinaryHeader(t)
+	if header == nil {
+		t.Skipf("no executable fixture for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	// Only the shell's builtins are available with PATH set to the fake go
+	var escaped strings.Builder
+	for _, b := range header {
+		fmt.Fprintf(&escaped, "\\%03o", b)
+	}
+
+	gopath := t.TempDir()
+	goDir := t.TempDir()
+	script := "#!/bin/sh\necho install >> \"$GOPATH/installs\"\nbin=\"${GOBIN:-$GOPATH/bin}\"\n" +
+		"printf '" + escaped.String() + "compiled' > \"$bin/sentinel\"\n"
+	if err := os.WriteFile(filepath.Join(goDir, "go"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake go: %v", err)
+	}
+	t.Setenv("PATH", goDir)
+	t.Setenv("GOROOT", goDir)
+	t.Setenv("GOBIN", "")
+	t.Setenv("GOPATH", gopath)
+
+	return gopath, func() int {
+		data, _ := os.ReadFile(filepath.Join(gopath, "installs"))
+		return strings.Count(string(data), "install")
+	}
+}
+
+// TestDownloadAndCompileUsesPrivateGOBIN verifies that go install writes the
+// agent to the build directory under the data dir and leaves a binary of the
+// same name in the user's GOPATH alone
+func TestDownloadAndCompileUsesPrivateGOBIN(t *testing.T) {
+	gopath, _ := useFakeGo(t)
+	userBinary := filepath.Join(gopath, "bin", "sentinel")
+	if err := os.MkdirAll(filepath.Dir(userBinary), 0755); err != nil {
+		t.Fatalf("failed to create GOPATH bin: %v", err)
+	}
+	writeLog(t, userBinary, "user build")
+
+	config := defaultConfig()
+	config.CGOEnabled = CGOModeFalse
+	withConfig(t, config)
+
+	dataDir := t.TempDir()
+	compiled, buildMode, err := downloadAndCompile(dataDir, "v1.2.0", true)
+	if err != nil {
+		t.Fatalf("downloadAndCompile() failed: %v", err)
+	}
+	if want := filepath.Join(dataDir, "build", "bin", "sentinel"); compiled != want || buildMode != BuildModePureGo {
+		t.Errorf("downloadAndCompile() = %s, %s; want %s, %s", compiled, buildMode, want, BuildModePureGo)
+	}
+	if data, err := os.ReadFile(userBinary); err != nil || string(data) != "user build" {
+		t.Errorf("user binary = %q, %v; want \"user build\"", data, err)
+	}
+}
+
+// TestVerifyVersionExists verifies that a forced version must be a valid
+// version that go list resolves to itself
+func TestVerifyVersionExists(t *testing.T) {
+	withConfig(t, defaultConfig())
+
+	tests := []struct {
+		version string
+		calls   int
+		wantErr bool
+	}{
+		{"v1.0.0", 1, false},
+		{"v0.9.0", 1, true},
+		{"latest", 0, true},
+		{"v1.0", 1, true},
+	}
+
+	for _, tt := range tests {
+		calls := scriptGoList(t, nil)
+		err := verifyVersionExists(tt.version)
+		if (err != nil) != tt.wantErr || *calls != tt.calls {
+			t.Errorf("verifyVersionExists(%s) = %v after %d go list calls; want error %v after %d", tt.version, err, *calls, tt.wantErr, tt.calls)
+		}
+	}
+}
+
+// TestUpdaterCheckOnce verifies that an embedded Updater uses the config,
+// service manager, version checker and log output it was given, and reports
+// the outcome of a check
+func TestUpdaterCheckOnce(t *testing.T) {
+	saveLogger(t)
+	withConfig(t, getConfig())
+	useServiceManager(t, serviceManager)
+
+	config := DefaultConfig()
+	config.AgentServiceName = "guard-agent"
+	manager := &servicetest.FakeManager{}
+	var output bytes.Buffer
+	latest := &VersionCheck{Channel: ChannelStable, Selected: "v1.7.0"}
+	var latestErr error
+	u := New(Options{
+		Config:         config,
+		ServiceManager: manager,
+		Versions: &VersionChecker{
+			InstalledVersion: func() (string, error) { return "v1.7.0", nil },
+			LatestVersion:    func(string, bool) (*VersionCheck, error) { return latest, latestErr },
+		},
+		LogOutput: &output,
+	})
+
+	result, err := u.CheckOnce()
+	if err != nil {
+		t.Fatalf("CheckOnce() failed: %v", err)
+	}
+	if want := (Result{Installed: "v1.7.0", Latest: "v1.7.0", Summary: "up to date"}); result != want {
+		t.Errorf("CheckOnce() = %+v; want %+v", result, want)
+	}
+	if serviceManager != manager || getConfig().AgentServiceName != "guard-agent" {
+		t.Error("CheckOnce() did not use the given service manager and config")
+	}
+	if !strings.Contains(output.String(), "No update needed") {
+		t.Errorf("CheckOnce() did not log to the given output:\n%s", output.String())
+	}
+
+	latestErr = errNoTaggedVersions
+	if result, err := u.CheckOnce(); err != nil || result.Summary != "no tagged versions published" {
+		t.Errorf("CheckOnce() without tagged versions = %+v, %v", result, err)
+	}
+	latestErr = errors.New("proxy unavailable")
+	if result, err := u.CheckOnce(); err == nil || result.Installed != "v1.7.0" || result.Latest != "" {
+		t.Errorf("CheckOnce() with a failed query = %+v, %v; want installed version and error", result, err)
+	}
+}
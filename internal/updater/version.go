@@ -0,0 +1,175 @@
+package updater
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semVersion is a parsed semantic version such as v1.4.0-rc.1
+type semVersion struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// parseVersion parses a version with or without the leading "v". Build
+// metadata is ignored. Missing minor or patch numbers are treated as zero.
+func parseVersion(version string) (semVersion, bool) {
+	var v semVersion
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		if i == len(version)-1 {
+			return v, false
+		}
+		v.prerelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
+
+	segments := strings.Split(version, ".")
+	if len(segments) > 3 {
+		return v, false
+	}
+	numbers := [3]int{}
+	for i, segment := range segments {
+		n, err := strconv.Atoi(segment)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		numbers[i] = n
+	}
+	v.major, v.minor, v.patch = numbers[0], numbers[1], numbers[2]
+
+	return v, true
+}
+
+// isPrerelease reports whether v carries a prerelease suffix
+func (v semVersion) isPrerelease() bool {
+	return len(v.prerelease) > 0
+}
+
+// compareVersions returns -1, 0 or 1 as a is lower than, equal to or higher
+// than b, following semver precedence: a prerelease sorts before its release.
+// A version that does not parse sorts below every valid one.
+func compareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	for _, pair := range [][2]int{{va.major, vb.major}, {va.minor, vb.minor}, {va.patch, vb.patch}} {
+		if pair[0] != pair[1] {
+			return compareInts(pair[0], pair[1])
+		}
+	}
+
+	switch {
+	case !va.isPrerelease() && !vb.isPrerelease():
+		return 0
+	case !va.isPrerelease():
+		return 1
+	case !vb.isPrerelease():
+		return -1
+	}
+
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(va.prerelease), len(vb.prerelease))
+}
+
+// comparePrereleaseIdentifiers orders numeric identifiers numerically and
+// below alphanumeric ones, which are ordered lexically
+func comparePrereleaseIdentifiers(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// pseudoVersionRevision returns the commit hash at the end of a
+// pseudo-version such as v0.0.0-20260101120000-abcdef123456, or "" for any
+// other version
+func pseudoVersionRevision(version string) string {
+	v, ok := parseVersion(version)
+	if !ok || !v.isPrerelease() {
+		return ""
+	}
+
+	// The last identifier of every pseudo-version form is timestamp-revision
+	parts := strings.SplitN(v.prerelease[len(v.prerelease)-1], "-", 2)
+	if len(parts) != 2 || len(parts[0]) != 14 || !isDigits(parts[0]) || !isCommitHash(parts[1]) {
+		return ""
+	}
+	return parts[1]
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isCommitHash reports whether s looks like a full or abbreviated git commit
+// hash
+func isCommitHash(s string) bool {
+	if len(s) < 7 || len(s) > 40 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRevision reports whether installed, as reported by the agent, is the
+// build of version. An agent that reports only a commit hash matches the
+// pseudo-version of that commit.
+func sameRevision(installed, version string) bool {
+	if installed == version {
+		return true
+	}
+	revision := pseudoVersionRevision(version)
+	if revision == "" || !isCommitHash(installed) {
+		return false
+	}
+	return strings.HasPrefix(revision, installed) || strings.HasPrefix(installed, revision)
+}
+
+// isNewerVersion reports whether latest has a higher precedence than current
+func isNewerVersion(current, latest string) bool {
+	return compareVersions(latest, current) > 0
+}
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultVersionCacheTTLMinutes is how long a version check is reused
+const DefaultVersionCacheTTLMinutes = 15
+
+// now returns the current time; it is a variable so tests can move the clock
+var now = time.Now
+
+// versionCache holds the last successful version check between cycles
+var versionCache struct {
+	sync.Mutex
+	check *VersionCheck
+}
+
+// versionCheckFresh reports whether check answers the configured module query
+// and is younger than the cache TTL
+func versionCheckFresh(check *VersionCheck, config *UpdaterConfig) bool {
+	if check == nil || check.Selected == "" {
+		return false
+	}
+	if check.Module != config.AgentModule || check.Channel != config.Channel {
+		return false
+	}
+	if check.Branch != config.trackedRef() {
+		return false
+	}
+	age := now().Sub(check.CheckedAt)
+	return age >= 0 && age < config.VersionCacheTTL()
+}
+
+// cachedVersionCheck returns a fresh version check from memory, or from
+// version-check.json after a restart, or nil when a query is needed
+func cachedVersionCheck(config *UpdaterConfig, dataDir string) *VersionCheck {
+	if config.VersionCacheTTL() <= 0 {
+		return nil
+	}
+
+	versionCache.Lock()
+	defer versionCache.Unlock()
+
+	if versionCheckFresh(versionCache.check, config) {
+		return versionCache.check
+	}
+
+	var recorded VersionCheck
+	if found, err := readJSONFile(filepath.Join(dataDir, versionCheckFileName), &recorded); !found || err != nil {
+		return nil
+	}
+	if !versionCheckFresh(&recorded, config) {
+		return nil
+	}
+	versionCache.check = &recorded
+	return versionCache.check
+}
+
+// storeVersionCheck caches a successful version check
+func storeVersionCheck(check *VersionCheck) {
+	versionCache.Lock()
+	defer versionCache.Unlock()
+	versionCache.check = check
+}
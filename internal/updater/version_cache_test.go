@@ -0,0 +1,105 @@
+package updater
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeClock pins now to the returned time, which tests advance
+func fakeClock(t *testing.T) *time.Time {
+	current := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	originalNow := now
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = originalNow })
+	return &current
+}
+
+// resetVersionCache empties the in-memory version cache for a test
+func resetVersionCache(t *testing.T) {
+	storeVersionCheck(nil)
+	t.Cleanup(func() { storeVersionCheck(nil) })
+}
+
+// TestCachedVersionCheckExpires verifies that a cached check is reused until
+// the TTL passes
+func TestCachedVersionCheckExpires(t *testing.T) {
+	clock := fakeClock(t)
+	resetVersionCache(t)
+	config := &UpdaterConfig{AgentModule: MainAgentModule, Channel: ChannelStable, VersionCacheTTLMinutes: 15}
+
+	storeVersionCheck(&VersionCheck{Module: MainAgentModule, Channel: ChannelStable, Selected: "v1.2.0", CheckedAt: *clock})
+
+	*clock = clock.Add(14 * time.Minute)
+	if check := cachedVersionCheck(config, t.TempDir()); check == nil || check.Selected != "v1.2.0" {
+		t.Errorf("cachedVersionCheck() after 14m = %v; want v1.2.0", check)
+	}
+
+	*clock = clock.Add(2 * time.Minute)
+	if check := cachedVersionCheck(config, t.TempDir()); check != nil {
+		t.Errorf("cachedVersionCheck() after 16m = %v; want nil", check)
+	}
+}
+
+// TestCachedVersionCheckMismatch verifies that a check made for another
+// channel or canary branch, or with the cache disabled, is not reused
+func TestCachedVersionCheckMismatch(t *testing.T) {
+	clock := fakeClock(t)
+	resetVersionCache(t)
+	storeVersionCheck(&VersionCheck{Module: MainAgentModule, Channel: ChannelCanary, Branch: "main", Selected: "v0.0.0-20260101-abc", CheckedAt: *clock})
+
+	for _, config := range []*UpdaterConfig{
+		{AgentModule: MainAgentModule, Channel: ChannelStable, VersionCacheTTLMinutes: 15},
+		{AgentModule: MainAgentModule, Channel: ChannelCanary, CanaryBranch: "develop", VersionCacheTTLMinutes: 15},
+		{AgentModule: MainAgentModule, Channel: ChannelCanary, CanaryBranch: "main", VersionCacheTTLMinutes: 0},
+	} {
+		if check := cachedVersionCheck(config, t.TempDir()); check != nil {
+			t.Errorf("cachedVersionCheck(%s %s, ttl %d) = %v; want nil", config.Channel, config.CanaryBranch, config.VersionCacheTTLMinutes, check)
+		}
+	}
+}
+
+// TestCachedVersionCheckFromStateFile verifies that a fresh version-check.json
+// is reused after a restart
+func TestCachedVersionCheckFromStateFile(t *testing.T) {
+	clock := fakeClock(t)
+	resetVersionCache(t)
+	dataDir := t.TempDir()
+	recorded := &VersionCheck{Module: MainAgentModule, Channel: ChannelStable, Selected: "v1.2.0", CheckedAt: clock.Add(-time.Minute)}
+	if err := writeJSONFile(filepath.Join(dataDir, versionCheckFileName), recorded); err != nil {
+		t.Fatal(err)
+	}
+
+	check := cachedVersionCheck(&UpdaterConfig{AgentModule: MainAgentModule, Channel: ChannelStable, VersionCacheTTLMinutes: 15}, dataDir)
+	if check == nil || check.Selected != "v1.2.0" {
+		t.Errorf("cachedVersionCheck() = %v; want v1.2.0 from the state file", check)
+	}
+}
+
+// TestGetLatestVersionRefreshBypassesCache verifies that a fresh cache skips
+// the module query unless refresh is set
+func TestGetLatestVersionRefreshBypassesCache(t *testing.T) {
+	clock := fakeClock(t)
+	resetVersionCache(t)
+	calls := scriptGoList(t, nil, nil)
+	withConfig(t, &UpdaterConfig{AgentModule: MainAgentModule, Channel: ChannelStable, VersionCacheTTLMinutes: 15, VersionResolvers: []string{ResolverGoProxy}})
+	storeVersionCheck(&VersionCheck{Module: MainAgentModule, Channel: ChannelStable, Selected: "v1.2.0", CheckedAt: *clock})
+	dataDir := t.TempDir()
+
+	check, err := getLatestVersion(dataDir, false)
+	if err != nil || check.Selected != "v1.2.0" {
+		t.Errorf("getLatestVersion(false) = %v, %v; want cached v1.2.0", check, err)
+	}
+	if *calls != 0 {
+		t.Errorf("go list calls = %d; want 0 on a cache hit", *calls)
+	}
+
+	// The scripted proxy has no tagged versions
+	if _, err := getLatestVersion(dataDir, true); !errors.Is(err, errNoTaggedVersions) {
+		t.Errorf("getLatestVersion(true) error = %v; want %v", err, errNoTaggedVersions)
+	}
+	if *calls != 2 {
+		t.Errorf("go list calls = %d; want 2 with refresh", *calls)
+	}
+}
@@ -0,0 +1,67 @@
+package updater
+
+import "testing"
+
+// TestCompareVersions verifies semver precedence including prereleases
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"1.2.3", "v1.2.3", 0},
+		{"v1.2.4", "v1.2.3", 1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.2.3-rc.1", "v1.2.3", -1},
+		{"v1.2.3-beta.2", "v1.2.3-beta.11", -1},
+		{"v1.2.3-rc.1", "v1.2.3-beta.5", 1},
+		{"v1.2.3-beta", "v1.2.3-beta.1", -1},
+		{"v1.2.3-1", "v1.2.3-alpha", -1},
+		{"v1.2.3+build.5", "v1.2.3", 0},
+		{"v1.2.4-0.20240101000000-abcdef123456", "v1.2.3", 1},
+		{"unknown", "v0.0.1", -1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestIsNewerVersion verifies that a release is newer than its prerelease but
+// not the other way round
+func TestIsNewerVersion(t *testing.T) {
+	if !isNewerVersion("v1.2.3-rc.1", "v1.2.3") {
+		t.Errorf("isNewerVersion(v1.2.3-rc.1, v1.2.3) = false; want true")
+	}
+	if isNewerVersion("v1.2.3", "v1.2.3-rc.1") {
+		t.Errorf("isNewerVersion(v1.2.3, v1.2.3-rc.1) = true; want false")
+	}
+	if isNewerVersion("v1.2.3", "v1.2.3") {
+		t.Errorf("isNewerVersion(v1.2.3, v1.2.3) = true; want false")
+	}
+}
+
+// TestPseudoVersionRevision verifies that the commit hash is taken from every
+// pseudo-version form and nothing else
+func TestPseudoVersionRevision(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v0.0.0-20260101120000-a1b2c3d4e5f6", "a1b2c3d4e5f6"},
+		{"v1.2.4-0.20260101120000-a1b2c3d4e5f6", "a1b2c3d4e5f6"},
+		{"v1.3.0-rc.1.0.20260101120000-a1b2c3d4e5f6", "a1b2c3d4e5f6"},
+		{"v1.2.3", ""},
+		{"v1.2.3-rc.1", ""},
+		{"v1.2.3-build-a1b2c3d4e5f6", ""},
+	}
+
+	for _, tt := range tests {
+		if got := pseudoVersionRevision(tt.version); got != tt.want {
+			t.Errorf("pseudoVersionRevision(%s) = %q; want %q", tt.version, got, tt.want)
+		}
+	}
+}